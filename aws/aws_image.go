@@ -3,6 +3,7 @@ package aws
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ebs"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/nanovms/ops/lepton"
 	"github.com/nanovms/ops/types"
@@ -49,7 +51,12 @@ func (p *AWS) CreateImage(ctx *lepton.Context, imagePath string) error {
 	// 2) create a snapshot
 	// 3) create an image
 
-	err := p.Storage.CopyToBucket(ctx.Config(), imagePath)
+	hash, err := lepton.ImageHash(ctx.Config())
+	if err != nil {
+		return err
+	}
+
+	err = p.Storage.CopyToBucket(ctx.Config(), imagePath)
 	if err != nil {
 		return err
 	}
@@ -91,6 +98,7 @@ func (p *AWS) CreateImage(ctx *lepton.Context, imagePath string) error {
 
 	// tag the volume
 	tags, _ := buildAwsTags(c.CloudConfig.Tags, key)
+	tags = append(tags, &ec2.Tag{Key: aws.String(lepton.ImageHashTag), Value: aws.String(hash)})
 
 	ctx.Logger().Log("Tagging snapshot")
 	_, err = p.ec2.CreateTags(&ec2.CreateTagsInput{
@@ -263,6 +271,12 @@ func (p *AWS) GetImages(ctx *lepton.Context) ([]lepton.CloudImage, error) {
 			Created: imageCreatedAt,
 		}
 
+		for _, tag := range image.Tags {
+			if aws.StringValue(tag.Key) == lepton.ImageHashTag {
+				cimage.Hash = aws.StringValue(tag.Value)
+			}
+		}
+
 		cimages = append(cimages, cimage)
 	}
 
@@ -367,8 +381,96 @@ func (p *AWS) DeleteImage(ctx *lepton.Context, imagename string) error {
 
 // SyncImage syncs image from provider to another provider
 func (p *AWS) SyncImage(config *types.Config, target lepton.Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	ctx := lepton.NewContext(config)
+	return lepton.SyncImage(p, ctx, target, ctx, image)
+}
+
+// ExportImage downloads the snapshot of the ami with the EBS direct APIs to a raw
+// image, the blocks never written are left sparse
+func (p *AWS) ExportImage(ctx *lepton.Context, image, imagePath string) error {
+	ami, err := p.findImage(image)
+	if err != nil {
+		return err
+	}
+
+	if len(ami.BlockDeviceMappings) == 0 || ami.BlockDeviceMappings[0].Ebs == nil {
+		return fmt.Errorf("image %s has no snapshot", image)
+	}
+	snapshotID := ami.BlockDeviceMappings[0].Ebs.SnapshotId
+
+	f, err := os.Create(imagePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fmt.Printf("Downloading snapshot %s\n", aws.StringValue(snapshotID))
+
+	input := &ebs.ListSnapshotBlocksInput{SnapshotId: snapshotID}
+	for {
+		output, err := p.volumeService.ListSnapshotBlocks(input)
+		if err != nil {
+			return err
+		}
+
+		if input.NextToken == nil {
+			err = f.Truncate(aws.Int64Value(output.VolumeSize) * int64(lepton.GiB))
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, block := range output.Blocks {
+			err = p.downloadSnapshotBlock(f, snapshotID, block, aws.Int64Value(output.BlockSize))
+			if err != nil {
+				return err
+			}
+		}
+
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	return f.Close()
+}
+
+func (p *AWS) downloadSnapshotBlock(f *os.File, snapshotID *string, block *ebs.Block, blockSize int64) error {
+	output, err := p.volumeService.GetSnapshotBlock(&ebs.GetSnapshotBlockInput{
+		SnapshotId: snapshotID,
+		BlockIndex: block.BlockIndex,
+		BlockToken: block.BlockToken,
+	})
+	if err != nil {
+		return err
+	}
+	defer output.BlockData.Close()
+
+	data, err := ioutil.ReadAll(output.BlockData)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteAt(data, aws.Int64Value(block.BlockIndex)*blockSize)
+	return err
+}
+
+// findImage returns the ami created by ops with the image name
+func (p *AWS) findImage(name string) (*ec2.Image, error) {
+	result, err := getAWSImages(p.ec2)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, image := range result.Images {
+		tag := p.getNameTag(image.Tags)
+		if tag != nil && aws.StringValue(tag.Value) == name {
+			return image, nil
+		}
+	}
+
+	return nil, fmt.Errorf("image %s not found", name)
 }
 
 // CustomizeImage returns image path with adaptations needed by cloud provider
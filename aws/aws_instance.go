@@ -274,6 +274,18 @@ func (p *AWS) CreateInstance(ctx *lepton.Context) error {
 		},
 	}
 
+	// the boot disk is encrypted when the instance is launched, the ami snapshot
+	// is left unencrypted
+	if lepton.EncryptionRequired(ctx.Config()) {
+		ebs := &ec2.EbsBlockDevice{Encrypted: aws.Bool(true)}
+		if ctx.Config().CloudConfig.EncryptionKey != "" {
+			ebs.KmsKeyId = aws.String(ctx.Config().CloudConfig.EncryptionKey)
+		}
+		instanceInput.BlockDeviceMappings = []*ec2.BlockDeviceMapping{
+			{DeviceName: image.RootDeviceName, Ebs: ebs},
+		}
+	}
+
 	// Specify the details of the instance that you want to create.
 	runResult, err := svc.RunInstances(instanceInput)
 
@@ -392,13 +404,10 @@ func (p *AWS) DeleteInstance(ctx *lepton.Context, instancename string) error {
 }
 
 // PrintInstanceLogs writes instance logs to console
-func (p *AWS) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := p.GetInstanceLogs(ctx, instancename)
-	if err != nil {
-		return err
-	}
-	fmt.Printf(l)
-	return nil
+func (p *AWS) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	return lepton.PrintLogs(opts.Writer(), opts, func() (string, error) {
+		return p.GetInstanceLogs(ctx, instancename)
+	})
 }
 
 // GetInstanceLogs gets instance related logs
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -122,30 +121,13 @@ func (p *AWS) GetVPC(ctx *lepton.Context, svc *ec2.EC2) (*ec2.Vpc, error) {
 	return vpc, nil
 }
 
-func (p AWS) buildFirewallRule(protocol string, port string) *ec2.IpPermission {
-	fromPort := port
-	toPort := port
-
-	if strings.Contains(port, "-") {
-		rangeParts := strings.Split(port, "-")
-		fromPort = rangeParts[0]
-		toPort = rangeParts[1]
-	}
-
-	fromPortInt, err := strconv.Atoi(fromPort)
-	if err != nil {
-		panic(err)
-	}
-
-	toPortInt, err := strconv.Atoi(toPort)
-	if err != nil {
-		panic(err)
-	}
-
+// buildFirewallRule opens the guest ports of the port mapping, since cloud
+// instances are reached directly without host port forwarding
+func (p AWS) buildFirewallRule(pm network.PortMapping) *ec2.IpPermission {
 	var ec2Permission = new(ec2.IpPermission)
-	ec2Permission.SetIpProtocol(protocol)
-	ec2Permission.SetFromPort(int64(fromPortInt))
-	ec2Permission.SetToPort(int64(toPortInt))
+	ec2Permission.SetIpProtocol(pm.Protocol)
+	ec2Permission.SetFromPort(int64(pm.GuestFrom))
+	ec2Permission.SetToPort(int64(pm.GuestTo))
 	ec2Permission.SetIpRanges([]*ec2.IpRange{
 		{CidrIp: aws.String("0.0.0.0/0")},
 	})
@@ -160,6 +142,16 @@ func (p *AWS) CreateSG(ctx *lepton.Context, svc *ec2.EC2, imgName string, vpcID
 
 	sgName := imgName + s
 
+	tcpMappings, err := network.ParsePortMappings(ctx.Config().RunConfig.Ports, network.ProtocolTCP)
+	if err != nil {
+		return "", err
+	}
+
+	udpMappings, err := network.ParsePortMappings(ctx.Config().RunConfig.UDPPorts, network.ProtocolUDP)
+	if err != nil {
+		return "", err
+	}
+
 	createRes, err := svc.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
 		GroupName:   aws.String(sgName),
 		Description: aws.String("security group for " + imgName),
@@ -185,13 +177,8 @@ func (p *AWS) CreateSG(ctx *lepton.Context, svc *ec2.EC2, imgName string, vpcID
 
 	var ec2Permissions []*ec2.IpPermission
 
-	for _, port := range ctx.Config().RunConfig.Ports {
-		rule := p.buildFirewallRule("tcp", port)
-		ec2Permissions = append(ec2Permissions, rule)
-	}
-
-	for _, port := range ctx.Config().RunConfig.UDPPorts {
-		rule := p.buildFirewallRule("udp", port)
+	for _, pm := range append(tcpMappings, udpMappings...) {
+		rule := p.buildFirewallRule(pm)
 		ec2Permissions = append(ec2Permissions, rule)
 	}
 
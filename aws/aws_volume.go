@@ -1,13 +1,15 @@
 package aws
 
 import (
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
 )
 
 var (
@@ -78,14 +80,34 @@ func (a *AWS) CreateVolume(ctx *lepton.Context, name, data, size, provider strin
 			},
 		},
 	}
-	_, err = a.ec2.CreateVolume(createVolumeInput)
+	setVolumeEncryption(config, createVolumeInput)
+
+	created, err := a.ec2.CreateVolume(createVolumeInput)
 	if err != nil {
 		return vol, fmt.Errorf("create aws volume: %v", err)
 	}
 
+	vol = localVolume
+	vol.ID = aws.StringValue(created.VolumeId)
+	vol.Encrypted = aws.BoolValue(created.Encrypted)
+	vol.EncryptionKey = config.CloudConfig.EncryptionKey
+
 	return vol, nil
 }
 
+// setVolumeEncryption encrypts the volume if the configuration requires it, with
+// the customer KMS key if there is one
+func setVolumeEncryption(config *types.Config, input *ec2.CreateVolumeInput) {
+	if !lepton.EncryptionRequired(config) {
+		return
+	}
+
+	input.Encrypted = aws.Bool(true)
+	if config.CloudConfig.EncryptionKey != "" {
+		input.KmsKeyId = aws.String(config.CloudConfig.EncryptionKey)
+	}
+}
+
 // GetAllVolumes finds and returns all volumes
 func (a *AWS) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error) {
 	vols := &[]lepton.NanosVolume{}
@@ -114,10 +136,14 @@ func (a *AWS) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error)
 			ID:         *volume.VolumeId,
 			Name:       name,
 			Status:     *volume.State,
-			Size:       strconv.Itoa(int(*volume.Size)),
+			Size:       lepton.VolumeSize(*volume.Size) * lepton.GiB,
 			Path:       "",
 			CreatedAt:  volume.CreateTime.String(),
 			AttachedTo: strings.Join(attachments, ";"),
+			Encrypted:  aws.BoolValue(volume.Encrypted),
+		}
+		if vol.Encrypted {
+			vol.EncryptionKey = aws.StringValue(volume.KmsKeyId)
 		}
 
 		*vols = append(*vols, vol)
@@ -139,14 +165,41 @@ func (a *AWS) DeleteVolume(ctx *lepton.Context, name string) error {
 	return nil
 }
 
-// AttachVolume attaches a volume to an instance
+// AttachVolume attaches the volume with the name or id to the instance with the
+// name or id, on the first device name the instance does not use
 func (a *AWS) AttachVolume(ctx *lepton.Context, image, name string) error {
+	instance, err := a.findInstance(image)
+	if err != nil {
+		return err
+	}
+
+	volume, err := a.findVolume(name)
+	if err != nil {
+		return err
+	}
+
+	if aws.StringValue(volume.AvailabilityZone) != aws.StringValue(instance.Placement.AvailabilityZone) {
+		return fmt.Errorf("volume %s is in %s, instance %s is in %s", name, aws.StringValue(volume.AvailabilityZone),
+			image, aws.StringValue(instance.Placement.AvailabilityZone))
+	}
+
+	device, err := FreeDeviceName(instance.BlockDeviceMappings)
+	if err != nil {
+		return fmt.Errorf("instance %s: %v", image, err)
+	}
+
+	// volumes can not be attached to instances still pending
+	err = a.ec2.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{InstanceIds: []*string{instance.InstanceId}})
+	if err != nil {
+		return err
+	}
+
 	input := &ec2.AttachVolumeInput{
-		Device:     aws.String("/dev/sdf"),
-		InstanceId: aws.String(image),
-		VolumeId:   aws.String(name),
+		Device:     aws.String(device),
+		InstanceId: instance.InstanceId,
+		VolumeId:   volume.VolumeId,
 	}
-	_, err := a.ec2.AttachVolume(input)
+	_, err = a.ec2.AttachVolume(input)
 	if err != nil {
 		return err
 	}
@@ -154,17 +207,261 @@ func (a *AWS) AttachVolume(ctx *lepton.Context, image, name string) error {
 	return nil
 }
 
-// DetachVolume detachs a volume from an instance
+// DetachVolume detachs the volume with the name or id from the instance with the
+// name or id
 func (a *AWS) DetachVolume(ctx *lepton.Context, image, name string) error {
-	input := &ec2.DetachVolumeInput{
-		Device:     aws.String("/dev/sdf"),
-		InstanceId: aws.String(image),
-		VolumeId:   aws.String(name),
+	instance, err := a.findInstance(image)
+	if err != nil {
+		return err
 	}
-	_, err := a.ec2.DetachVolume(input)
+
+	volume, err := a.findVolume(name)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	for _, att := range volume.Attachments {
+		if aws.StringValue(att.InstanceId) != aws.StringValue(instance.InstanceId) {
+			continue
+		}
+
+		input := &ec2.DetachVolumeInput{
+			Device:     att.Device,
+			InstanceId: instance.InstanceId,
+			VolumeId:   volume.VolumeId,
+		}
+		_, err = a.ec2.DetachVolume(input)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("volume %s is not attached to instance %s", name, image)
+}
+
+// awsDeviceNames are the device names recommended for EBS volumes
+var awsDeviceNames = []string{"f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p"}
+
+// FreeDeviceName returns the first device name recommended for EBS volumes not
+// used by the block devices of an instance
+func FreeDeviceName(mappings []*ec2.InstanceBlockDeviceMapping) (string, error) {
+	used := make(map[string]bool)
+	for _, m := range mappings {
+		device := strings.TrimPrefix(aws.StringValue(m.DeviceName), "/dev/")
+		used[strings.TrimPrefix(strings.TrimPrefix(device, "sd"), "xvd")] = true
+	}
+
+	for _, name := range awsDeviceNames {
+		if !used[name] {
+			return "/dev/sd" + name, nil
+		}
+	}
+
+	return "", errors.New("no device name left to attach the volume")
+}
+
+// findInstance returns the instance with the id or the name tag
+func (a *AWS) findInstance(name string) (*ec2.Instance, error) {
+	input := &ec2.DescribeInstancesInput{}
+	if strings.HasPrefix(name, "i-") {
+		input.InstanceIds = []*string{aws.String(name)}
+	} else {
+		input.Filters = []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: []*string{aws.String(name)}},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		}
+	}
+
+	output, err := a.ec2.DescribeInstances(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*ec2.Instance
+	for _, reservation := range output.Reservations {
+		instances = append(instances, reservation.Instances...)
+	}
+
+	if len(instances) == 0 {
+		return nil, lepton.ErrInstanceNotFound(name)
+	} else if len(instances) > 1 {
+		return nil, fmt.Errorf("ambiguous instance name %s: multiple instances found", name)
+	}
+
+	return instances[0], nil
+}
+
+// findVolume returns the volume with the id or the name tag
+func (a *AWS) findVolume(name string) (*ec2.Volume, error) {
+	input := &ec2.DescribeVolumesInput{}
+	if strings.HasPrefix(name, "vol-") {
+		input.VolumeIds = []*string{aws.String(name)}
+	} else {
+		input.Filters = []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: []*string{aws.String(name)}},
+		}
+	}
+
+	output, err := a.ec2.DescribeVolumes(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output.Volumes) == 0 {
+		return nil, fmt.Errorf("volume %s not found", name)
+	} else if len(output.Volumes) > 1 {
+		return nil, fmt.Errorf("ambiguous volume name %s: multiple volumes found", name)
+	}
+
+	return output.Volumes[0], nil
+}
+
+// ResizeVolume grows the volume, the instance sees the new size while the
+// modification is optimizing
+func (a *AWS) ResizeVolume(ctx *lepton.Context, name string, size lepton.VolumeSize) (lepton.NanosVolume, error) {
+	var vol lepton.NanosVolume
+
+	volume, err := a.findVolume(name)
+	if err != nil {
+		return vol, err
+	}
+
+	sizeGB := size.GB()
+	err = lepton.CheckVolumeGrow(name, lepton.VolumeSize(*volume.Size)*lepton.GiB, lepton.VolumeSize(sizeGB)*lepton.GiB)
+	if err != nil {
+		return vol, err
+	}
+
+	output, err := a.ec2.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: volume.VolumeId,
+		Size:     aws.Int64(sizeGB),
+	})
+	if err != nil {
+		return vol, fmt.Errorf("modify aws volume: %v", err)
+	}
+
+	vol = lepton.NanosVolume{
+		ID:            *volume.VolumeId,
+		Name:          name,
+		Status:        aws.StringValue(output.VolumeModification.ModificationState),
+		Size:          lepton.VolumeSize(aws.Int64Value(output.VolumeModification.TargetSize)) * lepton.GiB,
+		Encrypted:     aws.BoolValue(volume.Encrypted),
+		EncryptionKey: aws.StringValue(volume.KmsKeyId),
+	}
+	return vol, nil
+}
+
+// SnapshotVolume creates a snapshot of the volume
+func (a *AWS) SnapshotVolume(ctx *lepton.Context, name string) (lepton.NanosVolume, error) {
+	var vol lepton.NanosVolume
+
+	volume, err := a.findVolume(name)
+	if err != nil {
+		return vol, err
+	}
+
+	snapshotName := name + "-" + time.Now().Format("20060102150405")
+	snapshot, err := a.createVolumeSnapshot(ctx, volume, snapshotName)
+	if err != nil {
+		return vol, err
+	}
+
+	vol = lepton.NanosVolume{
+		ID:     *snapshot.SnapshotId,
+		Name:   snapshotName,
+		Status: *snapshot.State,
+	}
+	if snapshot.VolumeSize != nil {
+		vol.Size = lepton.VolumeSize(*snapshot.VolumeSize) * lepton.GiB
+	}
+
+	return vol, nil
+}
+
+func (a *AWS) createVolumeSnapshot(ctx *lepton.Context, volume *ec2.Volume, snapshotName string) (*ec2.Snapshot, error) {
+	tags, _ := buildAwsTags(ctx.Config().CloudConfig.Tags, snapshotName)
+
+	snapshot, err := a.ec2.CreateSnapshot(&ec2.CreateSnapshotInput{
+		Description: aws.String("snapshot of volume " + *volume.VolumeId),
+		VolumeId:    volume.VolumeId,
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String("snapshot"),
+				Tags:         tags,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create snapshot of volume %s: %v", *volume.VolumeId, err)
+	}
+
+	return snapshot, nil
+}
+
+// CloneVolume creates a volume from a snapshot of the volume, in the same zone
+func (a *AWS) CloneVolume(ctx *lepton.Context, name, newName string) (lepton.NanosVolume, error) {
+	var vol lepton.NanosVolume
+
+	source, err := a.findVolume(name)
+	if err != nil {
+		return vol, err
+	}
+
+	snapshot, err := a.createVolumeSnapshot(ctx, source, newName)
+	if err != nil {
+		return vol, err
+	}
+
+	err = a.ec2.WaitUntilSnapshotCompleted(&ec2.DescribeSnapshotsInput{SnapshotIds: []*string{snapshot.SnapshotId}})
+	if err != nil {
+		return vol, fmt.Errorf("wait snapshot %s: %v", *snapshot.SnapshotId, err)
+	}
+
+	tags, _ := buildAwsTags(ctx.Config().CloudConfig.Tags, newName)
+
+	input := &ec2.CreateVolumeInput{
+		AvailabilityZone: source.AvailabilityZone,
+		SnapshotId:       snapshot.SnapshotId,
+		VolumeType:       source.VolumeType,
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String("volume"),
+				Tags:         tags,
+			},
+		},
+	}
+	setVolumeEncryption(ctx.Config(), input)
+
+	created, err := a.ec2.CreateVolume(input)
+	if err != nil {
+		return vol, fmt.Errorf("create aws volume: %v", err)
+	}
+
+	err = a.ec2.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{VolumeIds: []*string{created.VolumeId}})
+	if err != nil {
+		return vol, fmt.Errorf("wait volume %s: %v", *created.VolumeId, err)
+	}
+
+	// the snapshot was only needed to create the volume
+	_, err = a.ec2.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: snapshot.SnapshotId})
+	if err != nil {
+		fmt.Printf("warning: failed deleting snapshot %s: %v\n", *snapshot.SnapshotId, err)
+	}
+
+	vol = lepton.NanosVolume{
+		ID:        *created.VolumeId,
+		Name:      newName,
+		Status:    "available",
+		Encrypted: aws.BoolValue(created.Encrypted),
+	}
+	if vol.Encrypted {
+		vol.EncryptionKey = aws.StringValue(created.KmsKeyId)
+	}
+	if created.Size != nil {
+		vol.Size = lepton.VolumeSize(*created.Size) * lepton.GiB
+	}
+
+	return vol, nil
 }
@@ -0,0 +1,41 @@
+package aws_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nanovms/ops/aws"
+)
+
+func TestFreeDeviceName(t *testing.T) {
+	mappings := func(devices ...string) (m []*ec2.InstanceBlockDeviceMapping) {
+		for n := range devices {
+			m = append(m, &ec2.InstanceBlockDeviceMapping{DeviceName: &devices[n]})
+		}
+		return
+	}
+
+	t.Run("should return the first recommended device name", func(t *testing.T) {
+		got, err := aws.FreeDeviceName(mappings("/dev/xvda"))
+		if err != nil || got != "/dev/sdf" {
+			t.Errorf("got %s %v, want /dev/sdf", got, err)
+		}
+	})
+
+	t.Run("should skip device names used with either prefix", func(t *testing.T) {
+		got, err := aws.FreeDeviceName(mappings("/dev/xvda", "/dev/sdf", "/dev/xvdg"))
+		if err != nil || got != "/dev/sdh" {
+			t.Errorf("got %s %v, want /dev/sdh", got, err)
+		}
+	})
+
+	t.Run("should return an error when all device names are used", func(t *testing.T) {
+		var devices []string
+		for c := 'f'; c <= 'p'; c++ {
+			devices = append(devices, "/dev/sd"+string(c))
+		}
+		if _, err := aws.FreeDeviceName(mappings(devices...)); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
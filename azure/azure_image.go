@@ -3,8 +3,13 @@ package azure
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
@@ -67,7 +72,12 @@ func (a *Azure) BuildImageWithPackage(ctx *lepton.Context, pkgpath string) (stri
 
 // CreateImage - Creates image on Azure using nanos images
 func (a *Azure) CreateImage(ctx *lepton.Context, imagePath string) error {
-	err := a.Storage.CopyToBucket(ctx.Config(), imagePath)
+	hash, err := lepton.ImageHash(ctx.Config())
+	if err != nil {
+		return err
+	}
+
+	err = a.Storage.CopyToBucket(ctx.Config(), imagePath)
 	if err != nil {
 		return err
 	}
@@ -88,9 +98,12 @@ func (a *Azure) CreateImage(ctx *lepton.Context, imagePath string) error {
 
 	uri := "https://" + bucket + ".blob.core.windows.net/" + container + "/" + disk
 
+	tags := getAzureDefaultTags()
+	tags[lepton.ImageHashTag] = to.StringPtr(hash)
+
 	imageParams := compute.Image{
 		Location: to.StringPtr(region),
-		Tags:     getAzureDefaultTags(),
+		Tags:     tags,
 		ImageProperties: &compute.ImageProperties{
 			StorageProfile: &compute.ImageStorageProfile{
 				OsDisk: &compute.ImageOSDisk{
@@ -132,6 +145,9 @@ func (a *Azure) GetImages(ctx *lepton.Context) ([]lepton.CloudImage, error) {
 				Name:   *image.Name,
 				Status: *(*image.ImageProperties).ProvisioningState,
 			}
+			if hash, ok := image.Tags[lepton.ImageHashTag]; ok && hash != nil {
+				cImage.Hash = *hash
+			}
 
 			cimages = append(cimages, cImage)
 		}
@@ -188,10 +204,131 @@ func (a *Azure) DeleteImage(ctx *lepton.Context, imagename string) error {
 
 // SyncImage syncs image from provider to another provider
 func (a *Azure) SyncImage(config *types.Config, target lepton.Provider, image string) error {
-	fmt.Println("not yet implemented")
+	ctx := lepton.NewContext(config)
+	return lepton.SyncImage(a, ctx, target, ctx, image)
+}
+
+// ExportImage downloads the VHD of the image with a shared access signature and
+// converts it to a raw image. Images uploaded by ops keep the VHD blob they were
+// created from, images of managed disks are read with a disk access grant.
+func (a *Azure) ExportImage(ctx *lepton.Context, image, imagePath string) error {
+	img, err := a.getImagesClient().Get(context.TODO(), a.groupName, image, "")
+	if err != nil {
+		return err
+	}
+
+	if img.ImageProperties == nil || img.StorageProfile == nil || img.StorageProfile.OsDisk == nil {
+		return fmt.Errorf("image %s has no os disk", image)
+	}
+	osDisk := img.StorageProfile.OsDisk
+
+	var sasURL string
+	if osDisk.BlobURI != nil {
+		sasURL, err = blobSASURL(*osDisk.BlobURI)
+		if err != nil {
+			return err
+		}
+	} else if osDisk.ManagedDisk != nil && osDisk.ManagedDisk.ID != nil {
+		parts := strings.Split(*osDisk.ManagedDisk.ID, "/")
+		diskName := parts[len(parts)-1]
+
+		sasURL, err = a.grantDiskAccess(diskName)
+		if err != nil {
+			return err
+		}
+		defer a.revokeDiskAccess(diskName)
+	} else {
+		return fmt.Errorf("image %s can not be exported, it has no vhd or managed disk", image)
+	}
+
+	vhdPath := imagePath + ".vhd"
+	defer os.Remove(vhdPath)
+
+	fmt.Printf("Downloading vhd of image %s\n", image)
+	err = downloadVHD(sasURL, vhdPath)
+	if err != nil {
+		return err
+	}
+
+	out, err := exec.Command("qemu-img", "convert", "-f", "vpc", "-O", "raw", vhdPath, imagePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("convert vhd to raw: %v: %s", err, out)
+	}
+
 	return nil
 }
 
+// grantDiskAccess returns a read only shared access signature uri of the disk
+func (a *Azure) grantDiskAccess(diskName string) (string, error) {
+	disksClient, err := a.getDisksClient()
+	if err != nil {
+		return "", err
+	}
+
+	future, err := disksClient.GrantAccess(context.TODO(), a.groupName, diskName, compute.GrantAccessData{
+		Access:            compute.Read,
+		DurationInSeconds: to.Int32Ptr(3600),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = future.WaitForCompletionRef(context.TODO(), disksClient.Client)
+	if err != nil {
+		return "", fmt.Errorf("cannot get the disk grant access future response: %v", err)
+	}
+
+	access, err := future.Result(*disksClient)
+	if err != nil {
+		return "", err
+	}
+	if access.AccessSAS == nil {
+		return "", fmt.Errorf("no access granted to disk %s", diskName)
+	}
+
+	return *access.AccessSAS, nil
+}
+
+func (a *Azure) revokeDiskAccess(diskName string) {
+	disksClient, err := a.getDisksClient()
+	if err != nil {
+		return
+	}
+
+	_, err = disksClient.RevokeAccess(context.TODO(), a.groupName, diskName)
+	if err != nil {
+		fmt.Printf("warning: cannot revoke access to disk %s: %v\n", diskName, err)
+	}
+}
+
+// downloadVHD downloads the vhd without printing the uri, the signature is a secret
+func downloadVHD(sasURL, dst string) error {
+	resp, err := http.Get(sasURL)
+	if uerr, ok := err.(*url.Error); ok {
+		return fmt.Errorf("download vhd: %v", uerr.Err)
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download vhd: %s", resp.Status)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
 // ResizeImage is not supported on azure.
 func (a *Azure) ResizeImage(ctx *lepton.Context, imagename string, hbytes string) error {
 	return fmt.Errorf("Operation not supported")
@@ -163,6 +163,7 @@ func (a *Azure) CreateInstance(ctx *lepton.Context) error {
 					ImageReference: &compute.ImageReference{
 						ID: to.StringPtr("/subscriptions/" + a.subID + "/resourceGroups/" + a.groupName + "/providers/Microsoft.Compute/images/" + ctx.Config().CloudConfig.ImageName),
 					},
+					OsDisk: osDisk(ctx.Config()),
 				},
 				DiagnosticsProfile: &compute.DiagnosticsProfile{
 					BootDiagnostics: &compute.BootDiagnostics{
@@ -441,13 +442,10 @@ func (a *Azure) StopInstance(ctx *lepton.Context, instancename string) error {
 }
 
 // PrintInstanceLogs writes instance logs to console
-func (a *Azure) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := a.GetInstanceLogs(ctx, instancename)
-	if err != nil {
-		return err
-	}
-	fmt.Printf(l)
-	return nil
+func (a *Azure) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	return lepton.PrintLogs(opts.Writer(), opts, func() (string, error) {
+		return a.GetInstanceLogs(ctx, instancename)
+	})
 }
 
 // GetInstanceLogs gets instance related logs
@@ -12,6 +12,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/nanovms/ops/lepton"
+	opsnetwork "github.com/nanovms/ops/network"
 	"github.com/nanovms/ops/types"
 )
 
@@ -504,15 +505,22 @@ func (a *Azure) getNsgClient() (*network.SecurityGroupsClient, error) {
 	return &nsgClient, nil
 }
 
-func (a Azure) buildFirewallRule(protocol network.SecurityRuleProtocol, port string) network.SecurityRule {
+// buildFirewallRule opens the guest ports of the port mapping, since cloud
+// instances are reached directly without host port forwarding
+func (a Azure) buildFirewallRule(pm opsnetwork.PortMapping) network.SecurityRule {
+	protocol := network.SecurityRuleProtocolTCP
+	if pm.Protocol == opsnetwork.ProtocolUDP {
+		protocol = network.SecurityRuleProtocolUDP
+	}
+
 	return network.SecurityRule{
-		Name: to.StringPtr("allow_" + strings.ReplaceAll(port, ",", ".")),
+		Name: to.StringPtr("allow_" + pm.Protocol + "_" + pm.GuestPorts()),
 		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
 			Protocol:                 protocol,
 			SourceAddressPrefix:      to.StringPtr("0.0.0.0/0"),
 			SourcePortRange:          to.StringPtr("1-65535"),
 			DestinationAddressPrefix: to.StringPtr("0.0.0.0/0"),
-			DestinationPortRange:     to.StringPtr(port),
+			DestinationPortRange:     to.StringPtr(pm.GuestPorts()),
 			Access:                   network.SecurityRuleAccessAllow,
 			Direction:                network.SecurityRuleDirectionInbound,
 			Priority:                 to.Int32Ptr(rand.Int31n(200-100) + 100), //Generating number between 100 - 200
@@ -528,15 +536,20 @@ func (a *Azure) CreateNetworkSecurityGroup(ctx context.Context, location string,
 		return
 	}
 
-	var securityRules []network.SecurityRule
+	tcpMappings, err := opsnetwork.ParsePortMappings(c.RunConfig.Ports, opsnetwork.ProtocolTCP)
+	if err != nil {
+		return
+	}
 
-	for _, ports := range c.RunConfig.Ports {
-		var rule = a.buildFirewallRule(network.SecurityRuleProtocolTCP, ports)
-		securityRules = append(securityRules, rule)
+	udpMappings, err := opsnetwork.ParsePortMappings(c.RunConfig.UDPPorts, opsnetwork.ProtocolUDP)
+	if err != nil {
+		return
 	}
 
-	for _, ports := range c.RunConfig.UDPPorts {
-		var rule = a.buildFirewallRule(network.SecurityRuleProtocolUDP, ports)
+	var securityRules []network.SecurityRule
+
+	for _, pm := range append(tcpMappings, udpMappings...) {
+		var rule = a.buildFirewallRule(pm)
 		securityRules = append(securityRules, rule)
 	}
 
@@ -12,6 +12,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/nanovms/ops/types"
@@ -248,3 +249,32 @@ func getBlobURL(container string, blobname string) azblob.BlobURL {
 	return containerURL.NewBlobURL(blobname)
 
 }
+
+// blobSASURL returns the uri of a blob of the storage account with a read only
+// shared access signature valid for an hour
+func blobSASURL(blobURI string) (string, error) {
+	u, err := url.Parse(blobURI)
+	if err != nil {
+		return "", err
+	}
+
+	credential, err := azblob.NewSharedKeyCredential(os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_ACCESS_KEY"))
+	if err != nil {
+		return "", fmt.Errorf("invalid storage credentials: %v", err)
+	}
+
+	parts := azblob.NewBlobURLParts(*u)
+	parts.SAS, err = azblob.BlobSASSignatureValues{
+		Protocol:      azblob.SASProtocolHTTPS,
+		ExpiryTime:    time.Now().UTC().Add(time.Hour),
+		ContainerName: parts.ContainerName,
+		BlobName:      parts.BlobName,
+		Permissions:   azblob.BlobSASPermissions{Read: true}.String(),
+	}.NewSASQueryParameters(credential)
+	if err != nil {
+		return "", err
+	}
+
+	sasURL := parts.URL()
+	return sasURL.String(), nil
+}
@@ -2,13 +2,14 @@ package azure
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
 )
 
 // CreateVolume uploads the volume raw file and creates a disk from it
@@ -24,7 +25,7 @@ func (a *Azure) CreateVolume(ctx *lepton.Context, name, data, size, provider str
 
 	location := a.getLocation(config)
 
-	sizeInt, err := strconv.Atoi(size)
+	diskSize, err := lepton.ParseVolumeSize(size)
 	if err != nil {
 		return vol, err
 	}
@@ -56,12 +57,13 @@ func (a *Azure) CreateVolume(ctx *lepton.Context, name, data, size, provider str
 		Name:     to.StringPtr(name),
 		DiskProperties: &compute.DiskProperties{
 			HyperVGeneration: compute.V1,
-			DiskSizeGB:       to.Int32Ptr(int32(sizeInt / 1000 / 1000)),
+			DiskSizeGB:       to.Int32Ptr(int32(diskSize.GB())),
 			CreationData: &compute.CreationData{
 				CreateOption:     "Import",
 				SourceURI:        to.StringPtr(sourceURI),
 				StorageAccountID: to.StringPtr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s", a.subID, a.groupName, bucket)),
 			},
+			Encryption: diskEncryption(config),
 		},
 	}
 
@@ -70,9 +72,25 @@ func (a *Azure) CreateVolume(ctx *lepton.Context, name, data, size, provider str
 		return vol, err
 	}
 
+	vol.Encrypted = true
+	vol.EncryptionKey = config.CloudConfig.EncryptionKey
+
 	return vol, nil
 }
 
+// diskEncryption returns the encryption of disks with the disk encryption set of
+// the configuration, disks are encrypted at rest with a platform key otherwise
+func diskEncryption(config *types.Config) *compute.Encryption {
+	if config.CloudConfig.EncryptionKey == "" {
+		return nil
+	}
+
+	return &compute.Encryption{
+		DiskEncryptionSetID: to.StringPtr(config.CloudConfig.EncryptionKey),
+		Type:                compute.EncryptionAtRestWithCustomerKey,
+	}
+}
+
 // GetAllVolumes returns all volumes in NanosVolume format
 func (a *Azure) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error) {
 	vols := &[]lepton.NanosVolume{}
@@ -105,10 +123,14 @@ func (a *Azure) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error
 			vol := lepton.NanosVolume{
 				Name:       *disk.Name,
 				Status:     string(disk.DiskProperties.DiskState),
-				Size:       strconv.Itoa(int(*disk.DiskSizeGB)),
+				Size:       lepton.VolumeSize(*disk.DiskSizeGB) * lepton.GiB,
 				Path:       "",
 				CreatedAt:  disk.TimeCreated.String(),
 				AttachedTo: attachedTo,
+				Encrypted:  true,
+			}
+			if disk.Encryption != nil && disk.Encryption.DiskEncryptionSetID != nil {
+				vol.EncryptionKey = *disk.Encryption.DiskEncryptionSetID
 			}
 
 			*vols = append(*vols, vol)
@@ -135,6 +157,57 @@ func (a *Azure) DeleteVolume(ctx *lepton.Context, name string) error {
 	return nil
 }
 
+// ResizeVolume grows the disk, disks attached to a running vm can not be resized
+func (a *Azure) ResizeVolume(ctx *lepton.Context, name string, size lepton.VolumeSize) (lepton.NanosVolume, error) {
+	var vol lepton.NanosVolume
+
+	disksClient, err := a.getDisksClient()
+	if err != nil {
+		return vol, err
+	}
+
+	disk, err := disksClient.Get(context.TODO(), a.groupName, name)
+	if err != nil {
+		return vol, err
+	}
+
+	sizeGB := int32(size.GB())
+	err = lepton.CheckVolumeGrow(name, lepton.VolumeSize(*disk.DiskSizeGB)*lepton.GiB, lepton.VolumeSize(sizeGB)*lepton.GiB)
+	if err != nil {
+		return vol, err
+	}
+
+	future, err := disksClient.Update(context.TODO(), a.groupName, name, compute.DiskUpdate{
+		DiskUpdateProperties: &compute.DiskUpdateProperties{
+			DiskSizeGB: to.Int32Ptr(sizeGB),
+		},
+	})
+	if err != nil {
+		return vol, err
+	}
+
+	err = future.WaitForCompletionRef(context.TODO(), disksClient.Client)
+	if err != nil {
+		return vol, fmt.Errorf("cannot get the disk update future response: %v", err)
+	}
+
+	updated, err := future.Result(*disksClient)
+	if err != nil {
+		return vol, err
+	}
+
+	vol = lepton.NanosVolume{
+		Name:      name,
+		Status:    string(updated.DiskProperties.DiskState),
+		Size:      lepton.VolumeSize(*updated.DiskSizeGB) * lepton.GiB,
+		Encrypted: true,
+	}
+	if updated.Encryption != nil && updated.Encryption.DiskEncryptionSetID != nil {
+		vol.EncryptionKey = *updated.Encryption.DiskEncryptionSetID
+	}
+	return vol, nil
+}
+
 // AttachVolume attaches a volume to an instance
 func (a *Azure) AttachVolume(ctx *lepton.Context, image, name string) error {
 	vmClient := a.getVMClient()
@@ -154,17 +227,26 @@ func (a *Azure) AttachVolume(ctx *lepton.Context, image, name string) error {
 		return err
 	}
 
-	vm.StorageProfile.DataDisks = &[]compute.DataDisk{
-		{
-			Lun:          to.Int32Ptr(0),
-			Name:         &name,
-			CreateOption: compute.DiskCreateOptionTypesAttach,
-			ManagedDisk: &compute.ManagedDiskParameters{
-				ID: to.StringPtr(*disk.ID),
-			},
-		},
+	var dataDisks []compute.DataDisk
+	if vm.StorageProfile.DataDisks != nil {
+		dataDisks = *vm.StorageProfile.DataDisks
+	}
+
+	lun, err := freeLun(dataDisks)
+	if err != nil {
+		return fmt.Errorf("vm %s: %v", image, err)
 	}
 
+	dataDisks = append(dataDisks, compute.DataDisk{
+		Lun:          to.Int32Ptr(lun),
+		Name:         &name,
+		CreateOption: compute.DiskCreateOptionTypesAttach,
+		ManagedDisk: &compute.ManagedDiskParameters{
+			ID: to.StringPtr(*disk.ID),
+		},
+	})
+	vm.StorageProfile.DataDisks = &dataDisks
+
 	future, err := vmClient.CreateOrUpdate(context.TODO(), a.groupName, image, vm)
 	if err != nil {
 		return fmt.Errorf("cannot update vm: %v", err)
@@ -180,6 +262,27 @@ func (a *Azure) AttachVolume(ctx *lepton.Context, image, name string) error {
 	return nil
 }
 
+// maxDataDiskLuns is the number of logical units of the largest vm sizes
+const maxDataDiskLuns = 64
+
+// freeLun returns the first logical unit not used by the data disks of a vm
+func freeLun(dataDisks []compute.DataDisk) (int32, error) {
+	used := make(map[int32]bool)
+	for _, d := range dataDisks {
+		if d.Lun != nil {
+			used[*d.Lun] = true
+		}
+	}
+
+	for lun := int32(0); lun < maxDataDiskLuns; lun++ {
+		if !used[lun] {
+			return lun, nil
+		}
+	}
+
+	return 0, errors.New("no logical unit left to attach the volume")
+}
+
 // DetachVolume detachs a volume from an instance
 func (a *Azure) DetachVolume(ctx *lepton.Context, image, name string) error {
 	vmClient := a.getVMClient()
@@ -224,3 +327,20 @@ func (a *Azure) getDisksClient() (*compute.DisksClient, error) {
 	vmClient.AddToUserAgent(userAgent)
 	return &vmClient, nil
 }
+
+// osDisk returns the os disk of vms encrypted with the disk encryption set of the
+// configuration, the default os disk is used otherwise
+func osDisk(config *types.Config) *compute.OSDisk {
+	if config.CloudConfig.EncryptionKey == "" {
+		return nil
+	}
+
+	return &compute.OSDisk{
+		CreateOption: compute.DiskCreateOptionTypesFromImage,
+		ManagedDisk: &compute.ManagedDiskParameters{
+			DiskEncryptionSet: &compute.DiskEncryptionSetParameters{
+				ID: to.StringPtr(config.CloudConfig.EncryptionKey),
+			},
+		},
+	}
+}
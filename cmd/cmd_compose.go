@@ -0,0 +1,406 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nanovms/ops/compose"
+	"github.com/nanovms/ops/constants"
+	api "github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/network"
+	"github.com/nanovms/ops/types"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ComposeCommands provides commands to run several services on a local bridge network
+func ComposeCommands() *cobra.Command {
+	var cmdCompose = &cobra.Command{
+		Use:       "compose",
+		Short:     "run multiple services described in a compose file",
+		ValidArgs: []string{"up", "down", "ps", "logs"},
+		Args:      cobra.OnlyValidArgs,
+	}
+
+	cmdCompose.PersistentFlags().StringP("file", "f", compose.DefaultFile, "compose file")
+	cmdCompose.PersistentFlags().String("project", "", "project name, it defaults to the project of the compose file")
+
+	cmdCompose.AddCommand(composeUpCommand())
+	cmdCompose.AddCommand(composeDownCommand())
+	cmdCompose.AddCommand(composePsCommand())
+	cmdCompose.AddCommand(composeLogsCommand())
+
+	return cmdCompose
+}
+
+func composeUpCommand() *cobra.Command {
+	var cmdComposeUp = &cobra.Command{
+		Use:   "up",
+		Short: "build and boot the services in dependency order",
+		Run:   composeUpCommandHandler,
+	}
+
+	persistentFlags := cmdComposeUp.PersistentFlags()
+
+	PersistNightlyCommandFlags(persistentFlags)
+	PersistNanosVersionCommandFlags(persistentFlags)
+	persistentFlags.Duration("wait-timeout", api.DefaultReadyTimeout, "maximum time waited for a dependency to be ready")
+
+	return cmdComposeUp
+}
+
+func composeUpCommandHandler(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+
+	composePath, _ := flags.GetString("file")
+	waitTimeout, _ := flags.GetDuration("wait-timeout")
+
+	f, err := compose.Load(composePath)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = compose.CheckConflicts(f)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	replicas, err := f.Replicas()
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	composePath, _ = filepath.Abs(composePath)
+
+	// relative paths of the services are resolved from the compose file directory
+	err = os.Chdir(f.Dir)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	state := &compose.State{
+		Project: f.Project,
+		File:    composePath,
+		Bridge:  f.Bridge,
+		Subnet:  f.Subnet,
+	}
+
+	hosts := compose.Hosts(replicas)
+	started := map[string]bool{}
+
+	for _, r := range replicas {
+		service := f.Services[r.Service]
+
+		if !started[r.Service] {
+			err = waitForComposeDependencies(f, replicas, service, waitTimeout)
+			if err != nil {
+				exitWithComposeError(err)
+			}
+			started[r.Service] = true
+		}
+
+		fmt.Printf("creating %s ...\n", r.Name)
+
+		c, err := buildComposeReplica(flags, f.Bridge, service, r, hosts)
+		if err != nil {
+			exitWithComposeError(fmt.Errorf("failed building %s: %v", r.Name, err))
+		}
+
+		_, err = setupNetworkInterfaces(c)
+		if err != nil {
+			exitWithComposeError(err)
+		}
+
+		p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
+		if err != nil {
+			exitWithComposeError(err)
+		}
+
+		err = p.CreateInstance(ctx)
+		if err != nil {
+			exitWithComposeError(err)
+		}
+
+		state.Replicas = append(state.Replicas, r)
+		err = state.Save()
+		if err != nil {
+			exitWithComposeError(err)
+		}
+	}
+
+	fmt.Printf("project %s is up\n", f.Project)
+}
+
+// exitWithComposeError exits reminding that the services started are still running
+func exitWithComposeError(err error) {
+	exitWithError(fmt.Sprintf("%v\nrun \"ops compose down\" to stop the services started", err))
+}
+
+// buildComposeReplica builds the image of the service replica and returns the
+// configuration to boot it connected to the project bridge
+func buildComposeReplica(flags *pflag.FlagSet, bridge string, service *compose.Service, r compose.Replica, hosts []string) (*types.Config, error) {
+	c := types.NewConfig()
+
+	if service.Program != "" {
+		checkProgramExists(service.Program)
+		curdir, _ := os.Getwd()
+		c.Program = service.Program
+		c.ProgramPath = filepath.Join(curdir, service.Program)
+		c.Args = append([]string{service.Program}, service.Args...)
+	} else {
+		c.Args = service.Args
+	}
+
+	pkgFlags := &PkgCommandFlags{Package: service.Package, LocalPackage: service.LocalPackage}
+
+	mergeContainer := NewMergeConfigContainer(
+		&ConfigCommandFlags{Config: service.Config},
+		NewGlobalCommandFlags(flags),
+		NewNightlyCommandFlags(flags),
+		NewNanosVersionCommandFlags(flags),
+		&BuildImageCommandFlags{ImageName: r.Name, Mounts: service.Volumes},
+		pkgFlags,
+	)
+	err := mergeContainer.Merge(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Env == nil {
+		c.Env = make(map[string]string)
+	}
+	for k, v := range service.Env {
+		c.Env[k] = v
+	}
+
+	c.Hosts = hosts
+
+	c.CloudConfig.Platform = "onprem"
+	c.CloudConfig.ImageName = filepath.Base(c.RunConfig.Imagename)
+
+	c.RunConfig.InstanceName = r.Name
+	c.RunConfig.Bridged = true
+	c.RunConfig.BridgeName = bridge
+	c.RunConfig.TapName = r.Tap
+	c.RunConfig.IPAddr = r.IP
+	c.RunConfig.Gateway = r.Gateway
+	c.RunConfig.NetMask = r.NetMask
+	c.RunConfig.Ports = service.Ports
+
+	if service.Package != "" {
+		err = api.BuildImageFromPackage(pkgFlags.PackagePath(), *c)
+	} else {
+		err = api.BuildImage(*c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// waitForComposeDependencies waits until every replica of the services the service
+// depends on passes the readiness probe of its service
+func waitForComposeDependencies(f *compose.File, replicas []compose.Replica, service *compose.Service, timeout time.Duration) error {
+	for _, dep := range service.DependsOn {
+		depService := f.Services[dep]
+		if depService.WaitFor == "" {
+			continue
+		}
+
+		for _, r := range compose.ServiceReplicas(replicas, dep) {
+			probe, err := api.ParseReadinessProbe(depService.WaitFor)
+			if err != nil {
+				return err
+			}
+			if probe.Host == "" {
+				probe.Host = r.IP
+			}
+
+			c := types.NewConfig()
+			p, ctx, err := getProviderAndContext(c, "onprem")
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("waiting for %s ...\n", r.Name)
+			_, err = api.WaitForReady(ctx, p, r.Name, api.WaitForReadyOptions{Probe: probe, Timeout: timeout})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func composeDownCommand() *cobra.Command {
+	var cmdComposeDown = &cobra.Command{
+		Use:   "down",
+		Short: "stop the services and remove their network devices",
+		Run:   composeDownCommandHandler,
+	}
+	return cmdComposeDown
+}
+
+func composeDownCommandHandler(cmd *cobra.Command, args []string) {
+	state := loadComposeState(cmd)
+
+	c := types.NewConfig()
+	p, ctx, err := getProviderAndContext(c, "onprem")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	networkService := network.NewIprouteNetworkService()
+
+	// dependent services are stopped first
+	for i := len(state.Replicas) - 1; i >= 0; i-- {
+		r := state.Replicas[i]
+
+		fmt.Printf("stopping %s ...\n", r.Name)
+		err = p.DeleteInstance(ctx, r.Name)
+		if err != nil {
+			fmt.Printf(constants.WarningColor, err.Error()+"\n")
+		}
+
+		err = network.TurnOffNetworkInterfaces(networkService, r.Tap, state.Bridge)
+		if err != nil {
+			fmt.Printf(constants.WarningColor, err.Error()+"\n")
+		}
+
+		networkService.DeleteNIC(r.Tap)
+	}
+
+	err = state.Remove()
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	fmt.Printf("project %s is down\n", state.Project)
+}
+
+func composePsCommand() *cobra.Command {
+	var cmdComposePs = &cobra.Command{
+		Use:   "ps",
+		Short: "list the instances of the services",
+		Run:   composePsCommandHandler,
+	}
+	return cmdComposePs
+}
+
+func composePsCommandHandler(cmd *cobra.Command, args []string) {
+	state := loadComposeState(cmd)
+
+	c := types.NewConfig()
+	p, ctx, err := getProviderAndContext(c, "onprem")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Service", "Instance", "Address", "Ports", "Status"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, r := range state.Replicas {
+		status := "Exited"
+		if instance, err := p.GetInstanceByID(ctx, r.Name); err == nil {
+			status = instance.Status
+		}
+
+		var row []string
+		row = append(row, r.Service)
+		row = append(row, r.Name)
+		row = append(row, r.IP)
+		row = append(row, strings.Join(r.Ports, ","))
+		row = append(row, status)
+		table.Append(row)
+	}
+
+	table.Render()
+}
+
+func composeLogsCommand() *cobra.Command {
+	var cmdComposeLogs = &cobra.Command{
+		Use:   "logs [service...]",
+		Short: "print the logs of the services",
+		Run:   composeLogsCommandHandler,
+	}
+	return cmdComposeLogs
+}
+
+func composeLogsCommandHandler(cmd *cobra.Command, args []string) {
+	state := loadComposeState(cmd)
+
+	for _, service := range args {
+		if len(compose.ServiceReplicas(state.Replicas, service)) == 0 {
+			exitWithError(fmt.Sprintf("service \"%s\" not found in project \"%s\"", service, state.Project))
+		}
+	}
+
+	c := types.NewConfig()
+	p, ctx, err := getProviderAndContext(c, "onprem")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	for _, r := range state.Replicas {
+		if len(args) > 0 && !containsString(args, r.Service) {
+			continue
+		}
+
+		logs, err := p.GetInstanceLogs(ctx, r.Name)
+		if err != nil {
+			fmt.Printf(constants.WarningColor, fmt.Sprintf("%s: %v\n", r.Name, err))
+			continue
+		}
+
+		fmt.Print(prefixLines(r.Name+" | ", logs))
+	}
+}
+
+// loadComposeState returns the state of the project of the --project flag or of the compose file
+func loadComposeState(cmd *cobra.Command) *compose.State {
+	project, _ := cmd.Flags().GetString("project")
+
+	if project == "" {
+		composePath, _ := cmd.Flags().GetString("file")
+
+		f, err := compose.Load(composePath)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		project = f.Project
+	}
+
+	state, err := compose.LoadState(project)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	return state
+}
+
+// prefixLines adds the prefix to every line of the text
+func prefixLines(prefix, text string) string {
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i := range lines {
+		lines[i] = prefix + lines[i]
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
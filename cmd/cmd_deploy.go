@@ -30,6 +30,7 @@ func DeployCommand() *cobra.Command {
 	PersistCreateInstanceFlags(persistentFlags)
 	PersistNightlyCommandFlags(persistentFlags)
 	PersistNanosVersionCommandFlags(persistentFlags)
+	PersistReadyCommandFlags(persistentFlags)
 
 	return cmdDeploy
 }
@@ -45,6 +46,7 @@ func deployCommandHandler(cmd *cobra.Command, args []string) {
 	pkgFlags := NewPkgCommandFlags(flags)
 	buildImageFlags := NewBuildImageCommandFlags(flags)
 	createInstanceFlags := NewCreateInstanceCommandFlags(flags)
+	readyFlags := NewReadyCommandFlags(flags)
 
 	c := types.NewConfig()
 
@@ -66,26 +68,16 @@ func deployCommandHandler(cmd *cobra.Command, args []string) {
 		exitWithError(err.Error())
 	}
 
-	p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
+	err = createInstanceFlags.MergeVolumeMounts(c)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
-	// Delete image with the same name
-	images, err := p.GetImages(ctx)
+	p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
-	for _, i := range images {
-		if i.Name == ctx.Config().CloudConfig.ImageName {
-			err = p.DeleteImage(ctx, ctx.Config().CloudConfig.ImageName)
-			if err != nil {
-				exitWithError(err.Error())
-			}
-		}
-	}
-
 	// Build image
 	var keypath string
 	if pkgFlags.Package != "" {
@@ -100,11 +92,35 @@ func deployCommandHandler(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	err = p.CreateImage(ctx, keypath)
+	images, err := p.GetImages(ctx)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
+	unchanged, err := unchangedImage(ctx, images)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if unchanged != nil {
+		fmt.Printf("image '%s' is unchanged, reusing it...\n", c.CloudConfig.ImageName)
+	} else {
+		// Delete image with the same name
+		for _, i := range images {
+			if i.Name == ctx.Config().CloudConfig.ImageName {
+				err = p.DeleteImage(ctx, ctx.Config().CloudConfig.ImageName)
+				if err != nil {
+					exitWithError(err.Error())
+				}
+			}
+		}
+
+		err = p.CreateImage(ctx, keypath)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+	}
+
 	// Create instance and stop instances created with the same image
 	ctx.Config().RunConfig.InstanceName = fmt.Sprintf("%v-%v",
 		filepath.Base(c.CloudConfig.ImageName),
@@ -123,6 +139,10 @@ func deployCommandHandler(cmd *cobra.Command, args []string) {
 		exitWithError("failed creating instance: " + err.Error())
 	}
 
+	attachInstanceVolumes(p, ctx, createInstanceFlags.Volumes)
+
+	waitForInstanceReady(p, ctx, readyFlags)
+
 	for _, i := range instances {
 		if i.Image == c.CloudConfig.ImageName {
 			ctx.Logger().Debug("deleting instance %s", i.Name)
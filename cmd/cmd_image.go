@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/nanovms/ops/fs"
 	api "github.com/nanovms/ops/lepton"
 	"github.com/nanovms/ops/types"
 	"github.com/spf13/cobra"
@@ -15,7 +19,7 @@ func ImageCommands() *cobra.Command {
 	var cmdImage = &cobra.Command{
 		Use:       "image",
 		Short:     "manage nanos images",
-		ValidArgs: []string{"create", "list", "delete", "resize", "sync"},
+		ValidArgs: []string{"create", "list", "delete", "resize", "sync", "klog"},
 		Args:      cobra.OnlyValidArgs,
 	}
 
@@ -27,6 +31,7 @@ func ImageCommands() *cobra.Command {
 	cmdImage.AddCommand(imageDeleteCommand())
 	cmdImage.AddCommand(imageResizeCommand())
 	cmdImage.AddCommand(imageSyncCommand())
+	cmdImage.AddCommand(imageKlogCommand())
 
 	return cmdImage
 }
@@ -46,9 +51,55 @@ func imageCreateCommand() *cobra.Command {
 	PersistNanosVersionCommandFlags(persistentFlags)
 	PersistPkgCommandFlags(persistentFlags)
 
+	persistentFlags.StringSlice("targets", nil, "build the image once and publish it to the providers, a provider zone and bucket can be set as <provider>:<zone>:<bucket> [aws, gcp, azure, onprem, ...]")
+
 	return cmdImageCreate
 }
 
+// ImageTarget is a provider image create --targets publishes the image to
+type ImageTarget struct {
+	Platform string
+	Zone     string
+	Bucket   string
+}
+
+// ParseImageTargets parses the targets of image create, a target is a provider with
+// an optional zone and bucket written as <provider>:<zone>:<bucket>. The zone can be
+// left empty to set only the bucket, as in <provider>::<bucket>.
+func ParseImageTargets(targets []string) ([]ImageTarget, error) {
+	var parsed []ImageTarget
+	for _, target := range targets {
+		parts := strings.SplitN(strings.TrimSpace(target), ":", 3)
+		t := ImageTarget{Platform: parts[0]}
+		if len(parts) > 1 {
+			t.Zone = parts[1]
+		}
+		if len(parts) > 2 {
+			t.Bucket = parts[2]
+		}
+		if t.Platform == "" || (len(parts) == 2 && t.Zone == "") || (len(parts) == 3 && t.Bucket == "") {
+			return nil, fmt.Errorf("invalid target \"%s\"", target)
+		}
+
+		for _, other := range parsed {
+			if other.Platform == t.Platform {
+				return nil, fmt.Errorf("target %s is repeated", t.Platform)
+			}
+		}
+		parsed = append(parsed, t)
+	}
+
+	return parsed, nil
+}
+
+// requiresBucket returns true if images of the platform are uploaded to a bucket
+func requiresBucket(platform string) bool {
+	return platform != "onprem" &&
+		platform != "hyper-v" &&
+		platform != "upcloud" &&
+		platform != "openstack"
+}
+
 func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 	flags := cmd.Flags()
 	c := types.NewConfig()
@@ -75,11 +126,13 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 		exitForCmd(cmd, "no program specified")
 	}
 
-	if len(c.CloudConfig.BucketName) == 0 &&
-		c.CloudConfig.Platform != "onprem" &&
-		c.CloudConfig.Platform != "hyper-v" &&
-		c.CloudConfig.Platform != "upcloud" &&
-		c.CloudConfig.Platform != "openstack" {
+	targets, _ := flags.GetStringSlice("targets")
+	if len(targets) != 0 {
+		imageCreateTargets(c, pkgFlags, targets)
+		return
+	}
+
+	if len(c.CloudConfig.BucketName) == 0 && requiresBucket(c.CloudConfig.Platform) {
 		exitWithError("Please specify a cloud bucket in config")
 	}
 
@@ -101,6 +154,20 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	images, err := p.GetImages(ctx)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	unchanged, err := unchangedImage(ctx, images)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	if unchanged != nil {
+		fmt.Printf("%s image '%s' is unchanged, reusing it...\n", c.CloudConfig.Platform, c.CloudConfig.ImageName)
+		return
+	}
+
 	err = p.CreateImage(ctx, keypath)
 	if err != nil {
 		exitWithError(err.Error())
@@ -114,6 +181,149 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 	fmt.Printf("%s image '%s' created...\n", c.CloudConfig.Platform, imageName)
 }
 
+// unchangedImage returns the image of the context created from the same image file
+// as the image built, nil if the image has to be created. The image file is hashed
+// only when the provider has an image with the name and a hash.
+func unchangedImage(ctx *api.Context, images []api.CloudImage) (*api.CloudImage, error) {
+	name := ctx.Config().CloudConfig.ImageName
+
+	hashed := false
+	for _, image := range images {
+		if image.Name == name && image.Hash != "" {
+			hashed = true
+		}
+	}
+	if !hashed {
+		return nil, nil
+	}
+
+	hash, err := api.ImageHash(ctx.Config())
+	if err != nil {
+		return nil, err
+	}
+
+	return api.FindImageByHash(images, name, hash), nil
+}
+
+// imageCreateTargets builds the image once, customizes it for each target and
+// creates the images of the targets in parallel
+func imageCreateTargets(c *types.Config, pkgFlags *PkgCommandFlags, args []string) {
+	targets, err := ParseImageTargets(args)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	providers := make([]api.Provider, len(targets))
+	contexts := make([]*api.Context, len(targets))
+	for i, target := range targets {
+		tc := *c
+		tc.CloudConfig.Platform = target.Platform
+		if target.Zone != "" {
+			tc.CloudConfig.Zone = target.Zone
+		}
+		if target.Bucket != "" {
+			tc.CloudConfig.BucketName = target.Bucket
+		}
+
+		if len(tc.CloudConfig.BucketName) == 0 && requiresBucket(target.Platform) {
+			exitWithError(fmt.Sprintf("Please specify a cloud bucket in config or in the target as %s:<zone>:<bucket>", target.Platform))
+		}
+
+		providers[i], contexts[i], err = getProviderAndContext(&tc, target.Platform)
+		if err != nil {
+			exitWithError(fmt.Sprintf("%s: %v", target.Platform, err))
+		}
+	}
+
+	if pkgFlags.Package != "" {
+		err = api.BuildImageFromPackage(pkgFlags.PackagePath(), *c)
+	} else {
+		err = api.BuildImage(*c)
+	}
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	// targets with an image created from the same image file are not uploaded again
+	unchanged := make([]bool, len(targets))
+	for i, target := range targets {
+		images, err := providers[i].GetImages(contexts[i])
+		if err != nil {
+			exitWithError(fmt.Sprintf("%s: %v", target.Platform, err))
+		}
+
+		image, err := unchangedImage(contexts[i], images)
+		if err != nil {
+			exitWithError(fmt.Sprintf("%s: %v", target.Platform, err))
+		}
+		unchanged[i] = image != nil
+	}
+
+	// the conversions write next to the image, they run one at a time
+	archives := make([]string, len(targets))
+	for i, target := range targets {
+		if unchanged[i] {
+			continue
+		}
+		archives[i], err = providers[i].CustomizeImage(contexts[i])
+		if err != nil {
+			exitWithError(fmt.Sprintf("%s: %v", target.Platform, err))
+		}
+	}
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for i := range targets {
+		if unchanged[i] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = providers[i].CreateImage(contexts[i], archives[i])
+		}(i)
+	}
+	wg.Wait()
+
+	failed := false
+	for i, target := range targets {
+		if errs[i] != nil {
+			failed = true
+			fmt.Printf("%s image '%s' failed: %v\n", target.Platform, c.CloudConfig.ImageName, errs[i])
+			continue
+		}
+		if unchanged[i] {
+			fmt.Printf("%s image '%s' unchanged: %s\n", target.Platform, c.CloudConfig.ImageName, createdImageID(providers[i], contexts[i]))
+			continue
+		}
+		fmt.Printf("%s image '%s' created: %s\n", target.Platform, c.CloudConfig.ImageName, createdImageID(providers[i], contexts[i]))
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// createdImageID returns the id of the image of the context reported by the
+// provider, or its name when the provider has no image ids
+func createdImageID(p api.Provider, ctx *api.Context) string {
+	c := ctx.Config()
+	if c.CloudConfig.Platform == "onprem" {
+		return c.RunConfig.Imagename
+	}
+
+	images, err := p.GetImages(ctx)
+	if err == nil {
+		for _, image := range images {
+			if image.Name == c.CloudConfig.ImageName && image.ID != "" {
+				return image.ID
+			}
+		}
+	}
+
+	return c.CloudConfig.ImageName
+}
+
 func imageListCommand() *cobra.Command {
 	var cmdImageList = &cobra.Command{
 		Use:   "list",
@@ -301,24 +511,24 @@ func imageResizeCommandHandler(cmd *cobra.Command, args []string) {
 }
 
 func imageSyncCommand() *cobra.Command {
-	var sourceCloud string
+	var sourceCloud, sourceZone, sourceBucket string
 	var cmdImageSync = &cobra.Command{
 		Use:   "sync <image_name>",
 		Short: "sync image with from one provider to another",
+		Long:  "sync image with from one provider to another\n\nimages of aws, gcp and azure are exported to a local raw image, then created on the target provider,\nthe zone and bucket of the source can be set when they differ from the target",
 		Run:   imageSyncCommandHandler,
 		Args:  cobra.MinimumNArgs(1),
 	}
-	cmdImageSync.PersistentFlags().StringVarP(&sourceCloud, "source-cloud", "s", "onprem", "cloud platform [gcp, aws, do, vultr, onprem, hyper-v, upcloud]")
+	cmdImageSync.PersistentFlags().StringVarP(&sourceCloud, "source-cloud", "s", "onprem", "cloud platform [onprem, aws, gcp, azure]")
+	cmdImageSync.PersistentFlags().StringVar(&sourceZone, "source-zone", "", "zone of the source cloud, defaults to the zone")
+	cmdImageSync.PersistentFlags().StringVar(&sourceBucket, "source-bucket", "", "bucket of the source cloud, defaults to the bucket")
 	return cmdImageSync
 }
 
 func imageSyncCommandHandler(cmd *cobra.Command, args []string) {
 	image := args[0]
-	// TODO only accepts onprem for now, implement for other source providers later
 	source, _ := cmd.Flags().GetString("source-cloud")
-	if source != "onprem" {
-		exitWithError(source + " sync not yet implemented")
-	}
+	target, _ := cmd.Flags().GetString("target-cloud")
 
 	config, _ := cmd.Flags().GetString("config")
 	conf := unWarpConfig(config)
@@ -333,19 +543,112 @@ func imageSyncCommandHandler(cmd *cobra.Command, args []string) {
 		conf.CloudConfig.Zone = zone
 	}
 
-	src, err := getCloudProvider(source, &conf.CloudConfig)
+	// the source keeps its own zone and bucket, they differ between clouds
+	srcConf := *conf
+	sourceZone, _ := cmd.Flags().GetString("source-zone")
+	if sourceZone != "" {
+		srcConf.CloudConfig.Zone = sourceZone
+	}
+	sourceBucket, _ := cmd.Flags().GetString("source-bucket")
+	if sourceBucket != "" {
+		srcConf.CloudConfig.BucketName = sourceBucket
+	}
+
+	src, err := getCloudProvider(source, &srcConf.CloudConfig)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
-	target, _ := cmd.Flags().GetString("target-cloud")
+	exporter, ok := src.(api.ImageExporter)
+	if !ok {
+		exitWithError("image sync from " + source + " is not supported")
+	}
+
+	if target == "onprem" {
+		if source == "onprem" {
+			exitWithError("image " + image + " is already an onprem image")
+		}
+		err = exporter.ExportImage(api.NewContext(&srcConf), image, path.Join(api.LocalImageDir, image+".img"))
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		return
+	}
+
 	tar, err := getCloudProvider(target, &conf.CloudConfig)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
-	err = src.SyncImage(conf, tar, image)
+	if source == "onprem" {
+		err = src.SyncImage(conf, tar, image)
+	} else {
+		err = api.SyncImage(exporter, api.NewContext(&srcConf), tar, api.NewContext(conf), image)
+	}
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func imageKlogCommand() *cobra.Command {
+	var cmdImageKlog = &cobra.Command{
+		Use:   "klog <image|instance>",
+		Short: "print the kernel log dump written in a local image after a crash",
+		Run:   imageKlogCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+	return cmdImageKlog
+}
+
+func imageKlogCommandHandler(cmd *cobra.Command, args []string) {
+	c := types.NewConfig()
+
+	err := NewMergeConfigContainer(NewConfigCommandFlags(cmd.Flags()), NewGlobalCommandFlags(cmd.Flags())).Merge(c)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	imagePath, err := klogImagePath(c, args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	dump, err := fs.ReadKlogDump(imagePath)
 	if err != nil {
 		exitWithError(err.Error())
 	}
+
+	if dump == nil {
+		fmt.Printf("no kernel log dump found in %s\n", imagePath)
+		return
+	}
+
+	fmt.Print(dump.String())
+}
+
+// klogImagePath returns the path of the image file, name is a path, a local image
+// or an onprem instance
+func klogImagePath(c *types.Config, name string) (string, error) {
+	candidates := []string{
+		name,
+		path.Join(api.LocalImageDir, name),
+		path.Join(api.LocalImageDir, name+".img"),
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+
+	p, ctx, err := getProviderAndContext(c, "onprem")
+	if err != nil {
+		return "", err
+	}
+
+	instance, err := p.GetInstanceByID(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("image or instance \"%s\" not found", name)
+	}
+
+	return instance.Image, nil
 }
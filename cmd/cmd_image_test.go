@@ -47,3 +47,26 @@ func TestDeleteImage(t *testing.T) {
 	assert.Nil(t, err)
 	assertImageDoesNotExist(t, imagePath)
 }
+
+func TestParseImageTargets(t *testing.T) {
+	t.Run("targets", func(t *testing.T) {
+		targets, err := cmd.ParseImageTargets([]string{"aws:us-west-2", "gcp", "onprem", "azure:westus:images", "do::spaces-bucket"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []cmd.ImageTarget{
+			{Platform: "aws", Zone: "us-west-2"},
+			{Platform: "gcp"},
+			{Platform: "onprem"},
+			{Platform: "azure", Zone: "westus", Bucket: "images"},
+			{Platform: "do", Bucket: "spaces-bucket"},
+		}, targets)
+	})
+
+	t.Run("invalid targets", func(t *testing.T) {
+		for _, targets := range [][]string{{""}, {"aws:"}, {":us-west-2"}, {"aws:us-west-2:"}, {"aws::"}, {"aws", "aws:us-east-1"}} {
+			_, err := cmd.ParseImageTargets(targets)
+
+			assert.NotNil(t, err, targets)
+		}
+	})
+}
@@ -2,12 +2,19 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/nanovms/ops/fs"
+	api "github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/onprem"
 	"github.com/nanovms/ops/types"
+	"github.com/olekukonko/tablewriter"
 
 	"github.com/spf13/cobra"
 )
@@ -18,7 +25,7 @@ func InstanceCommands() *cobra.Command {
 	var cmdInstance = &cobra.Command{
 		Use:       "instance",
 		Short:     "manage nanos instances",
-		ValidArgs: []string{"create", "list", "delete", "stop", "start", "logs"},
+		ValidArgs: []string{"create", "list", "delete", "stop", "start", "logs", "console", "snapshot", "stats"},
 		Args:      cobra.OnlyValidArgs,
 	}
 
@@ -31,6 +38,11 @@ func InstanceCommands() *cobra.Command {
 	cmdInstance.AddCommand(instanceStopCommand())
 	cmdInstance.AddCommand(instanceStartCommand())
 	cmdInstance.AddCommand(instanceLogsCommand())
+	cmdInstance.AddCommand(instanceConsoleCommand())
+	cmdInstance.AddCommand(instanceSnapshotCommand())
+	cmdInstance.AddCommand(instanceStatsCommand())
+	cmdInstance.AddCommand(instanceSerialLoggerCommand())
+	cmdInstance.AddCommand(instanceSuperviseCommand())
 
 	return cmdInstance
 }
@@ -44,6 +56,7 @@ func instanceCreateCommand() *cobra.Command {
 	}
 
 	PersistCreateInstanceFlags(cmdInstanceCreate.PersistentFlags())
+	PersistReadyCommandFlags(cmdInstanceCreate.PersistentFlags())
 	cmdInstanceCreate.PersistentFlags().StringP("imagename", "i", "", "image name [required]")
 	cmdInstanceCreate.MarkPersistentFlagRequired("imagename")
 
@@ -57,6 +70,7 @@ func instanceCreateCommandHandler(cmd *cobra.Command, args []string) {
 	globalFlags := NewGlobalCommandFlags(flags)
 	providerFlags := NewProviderCommandFlags(flags)
 	createInstanceFlags := NewCreateInstanceCommandFlags(flags)
+	readyFlags := NewReadyCommandFlags(flags)
 
 	c := types.NewConfig()
 
@@ -82,10 +96,74 @@ func instanceCreateCommandHandler(cmd *cobra.Command, args []string) {
 		exitForCmd(cmd, err.Error())
 	}
 
+	err = checkImageVolumeMounts(c.CloudConfig.ImageName, createInstanceFlags.Volumes)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	err = p.CreateInstance(ctx)
 	if err != nil {
 		exitWithError(err.Error())
 	}
+
+	attachInstanceVolumes(p, ctx, createInstanceFlags.Volumes)
+
+	waitForInstanceReady(p, ctx, readyFlags)
+}
+
+// checkImageVolumeMounts makes sure the image mounts the volumes at their mount
+// paths, the volumes are mounted by label. Cloud images can not be changed once
+// created, so the local copy of the image is checked.
+func checkImageVolumeMounts(imageName string, volumes []string) error {
+	if len(volumes) == 0 {
+		return nil
+	}
+
+	var imagePath string
+	for _, name := range []string{imageName, imageName + ".img"} {
+		p := path.Join(api.GetOpsHome(), "images", name)
+		if _, err := os.Stat(p); err == nil {
+			imagePath = p
+			break
+		}
+	}
+	if imagePath == "" {
+		fmt.Printf("warning: image %s not found locally, the volume mount paths are not checked\n", imageName)
+		return nil
+	}
+
+	mounts, err := fs.ReadImageMounts(imagePath)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range volumes {
+		name, mountPath, err := api.ParseVolumeAttachment(v)
+		if err != nil {
+			return err
+		}
+		if mounts[name] != mountPath {
+			return fmt.Errorf("image %s does not mount volume %s at %s, build it with --mounts %s:%s", imageName, name, mountPath, name, mountPath)
+		}
+	}
+
+	return nil
+}
+
+// attachInstanceVolumes attaches the volumes to the instance by name, the images of
+// the instance were checked to mount them at their paths
+func attachInstanceVolumes(p api.Provider, ctx *api.Context, volumes []string) {
+	for _, v := range volumes {
+		name, _, err := api.ParseVolumeAttachment(v)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		err = p.AttachVolume(ctx, ctx.Config().RunConfig.InstanceName, name)
+		if err != nil {
+			exitWithError(fmt.Sprintf("failed attaching volume %s: %v", name, err))
+		}
+	}
 }
 
 func instanceListCommand() *cobra.Command {
@@ -237,6 +315,10 @@ func instanceLogsCommand() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 	}
 	cmdLogsCommand.PersistentFlags().BoolVarP(&watch, "watch", "w", false, "watch logs")
+	cmdLogsCommand.PersistentFlags().String("since", "", "show logs written since a duration (e.g. 10m) or a RFC3339 timestamp")
+	cmdLogsCommand.PersistentFlags().Int("tail", 0, "number of lines to show from the end of the logs")
+	cmdLogsCommand.PersistentFlags().String("symbolize", "", "resolve the addresses of crash dumps with the symbols of the program `elf`")
+	persistSymbolizeFlags(cmdLogsCommand)
 	return cmdLogsCommand
 }
 
@@ -254,6 +336,14 @@ func instanceLogsCommandHandler(cmd *cobra.Command, args []string) {
 		panic(err)
 	}
 
+	tail, _ := cmd.Flags().GetInt("tail")
+
+	since, _ := cmd.Flags().GetString("since")
+	sinceTime, err := parseLogsSince(time.Now(), since)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	c.CloudConfig.ProjectID = projectID
 	c.CloudConfig.Zone = zone
 
@@ -262,7 +352,252 @@ func instanceLogsCommandHandler(cmd *cobra.Command, args []string) {
 		exitForCmd(cmd, err.Error())
 	}
 
-	err = p.PrintInstanceLogs(ctx, args[0], watch)
+	opts := api.LogOptions{Watch: watch, Since: sinceTime, Tail: tail}
+
+	program, _ := cmd.Flags().GetString("symbolize")
+	if program == "" {
+		err = p.PrintInstanceLogs(ctx, args[0], opts)
+	} else {
+		var symbolizer *api.Symbolizer
+		symbolizer, err = newSymbolizer(cmd, program)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		err = symbolizeLogs(symbolizer, os.Stdout, func(w io.Writer) error {
+			opts.Output = w
+			return p.PrintInstanceLogs(ctx, args[0], opts)
+		})
+	}
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+// parseLogsSince returns the time a duration before now or the time of a RFC3339 timestamp
+func parseLogsSince(now time.Time, since string) (time.Time, error) {
+	if since == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return t, fmt.Errorf("invalid since value \"%s\", use a duration (e.g. 10m) or a RFC3339 timestamp", since)
+	}
+
+	return t, nil
+}
+
+func instanceConsoleCommand() *cobra.Command {
+	var cmdConsoleCommand = &cobra.Command{
+		Use:   "console <instance_name>",
+		Short: "Attach to the serial console of an onprem instance",
+		Run:   instanceConsoleCommandHandler,
+		Args:  cobra.MinimumNArgs(1),
+	}
+	return cmdConsoleCommand
+}
+
+func instanceConsoleCommandHandler(cmd *cobra.Command, args []string) {
+	c, err := getInstanceCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if c.CloudConfig.Platform != "onprem" {
+		exitWithError("console is only supported for onprem instances")
+	}
+
+	p := &onprem.OnPrem{}
+	ctx := api.NewContext(c)
+
+	_, err = p.GetInstanceByID(ctx, args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = onprem.AttachConsole(args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceSnapshotCommand() *cobra.Command {
+	var cmdSnapshotCommand = &cobra.Command{
+		Use:   "snapshot <instance_name> [snapshot_name]",
+		Short: "Save the memory and devices state of an onprem instance",
+		Run:   instanceSnapshotCommandHandler,
+		Args:  cobra.RangeArgs(1, 2),
+	}
+
+	cmdSnapshotCommand.PersistentFlags().Bool("stop", false, "delete the instance after saving the snapshot")
+
+	return cmdSnapshotCommand
+}
+
+func instanceSnapshotCommandHandler(cmd *cobra.Command, args []string) {
+	c, err := getInstanceCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if c.CloudConfig.Platform != "onprem" {
+		exitWithError("snapshot is only supported for onprem instances")
+	}
+
+	stop, _ := cmd.Flags().GetBool("stop")
+
+	snapshotName := ""
+	if len(args) > 1 {
+		snapshotName = args[1]
+	}
+
+	p := &onprem.OnPrem{}
+	ctx := api.NewContext(c)
+
+	snapshot, err := p.CreateSnapshot(ctx, args[0], snapshotName, stop)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	fmt.Printf("snapshot %s saved, restore it with \"ops run --from-snapshot %s\"\n", snapshot.Name, snapshot.Name)
+}
+
+func instanceStatsCommand() *cobra.Command {
+	var cmdStatsCommand = &cobra.Command{
+		Use:   "stats [instance_name]",
+		Short: "display the resource usage of onprem instances",
+		Run:   instanceStatsCommandHandler,
+		Args:  cobra.MaximumNArgs(1),
+	}
+
+	cmdStatsCommand.PersistentFlags().Bool("watch", false, "refresh the stats until interrupted")
+	cmdStatsCommand.PersistentFlags().Bool("json", false, "print the stats in json")
+
+	return cmdStatsCommand
+}
+
+func instanceStatsCommandHandler(cmd *cobra.Command, args []string) {
+	c, err := getInstanceCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if c.CloudConfig.Platform != "onprem" {
+		exitWithError("stats is only supported for onprem instances")
+	}
+
+	watch, _ := cmd.Flags().GetBool("watch")
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+
+	instanceName := ""
+	if len(args) > 0 {
+		instanceName = args[0]
+	}
+
+	p := &onprem.OnPrem{}
+
+	for {
+		stats, err := p.GetInstanceStats(instanceName)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		if jsonOutput {
+			printJSON(stats)
+		} else {
+			if watch {
+				// clear the terminal to redraw the table
+				fmt.Print("\033[H\033[2J")
+			}
+			printInstanceStats(stats)
+		}
+
+		if !watch {
+			return
+		}
+	}
+}
+
+func printInstanceStats(stats []onprem.InstanceStats) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "PID", "CPU %", "CPUs", "Mem Usage / Limit", "Mem %", "Block I/O", "Net I/O"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, s := range stats {
+		memory := api.Bytes2Human(int64(s.MemoryUsage)) + " / -"
+		memoryPercent := "-"
+		if s.MemoryLimit > 0 {
+			memory = api.Bytes2Human(int64(s.MemoryUsage)) + " / " + api.Bytes2Human(int64(s.MemoryLimit))
+			memoryPercent = fmt.Sprintf("%.2f%%", float64(s.MemoryUsage)/float64(s.MemoryLimit)*100)
+		}
+
+		netIO := "-"
+		if s.NetworkReceived != nil && s.NetworkSent != nil {
+			netIO = api.Bytes2Human(int64(*s.NetworkReceived)) + " / " + api.Bytes2Human(int64(*s.NetworkSent))
+		}
+
+		var row []string
+		row = append(row, s.Name)
+		row = append(row, strconv.Itoa(s.PID))
+		row = append(row, fmt.Sprintf("%.2f%%", s.CPUPercent))
+		row = append(row, strconv.Itoa(s.CPUs))
+		row = append(row, memory)
+		row = append(row, memoryPercent)
+		row = append(row, api.Bytes2Human(int64(s.BlockRead))+" / "+api.Bytes2Human(int64(s.BlockWritten)))
+		row = append(row, netIO)
+		table.Append(row)
+	}
+
+	table.Render()
+}
+
+// instanceSerialLoggerCommand is launched by onprem instances running in background to capture the serial output
+func instanceSerialLoggerCommand() *cobra.Command {
+	var cmdSerialLoggerCommand = &cobra.Command{
+		Use:    "serial-logger <instance_name>",
+		Short:  "Capture the serial output of an onprem instance",
+		Hidden: true,
+		Run:    instanceSerialLoggerCommandHandler,
+		Args:   cobra.MinimumNArgs(1),
+	}
+	return cmdSerialLoggerCommand
+}
+
+func instanceSerialLoggerCommandHandler(cmd *cobra.Command, args []string) {
+	err := onprem.RunSerialLogger(args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+// instanceSuperviseCommand is launched by onprem instances with a restart policy to run and relaunch the hypervisor
+func instanceSuperviseCommand() *cobra.Command {
+	var cmdSuperviseCommand = &cobra.Command{
+		Use:    "supervise <instance_name>",
+		Short:  "Run an onprem instance applying its restart policy",
+		Hidden: true,
+		Run:    instanceSuperviseCommandHandler,
+		Args:   cobra.MinimumNArgs(1),
+	}
+	return cmdSuperviseCommand
+}
+
+func instanceSuperviseCommandHandler(cmd *cobra.Command, args []string) {
+	err := onprem.RunSupervisor(os.Stdin)
 	if err != nil {
 		exitWithError(err.Error())
 	}
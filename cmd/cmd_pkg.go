@@ -236,6 +236,6 @@ func loadCommandHandler(cmd *cobra.Command, args []string) {
 
 	err = RunLocalInstance(c)
 	if err != nil {
-		exitWithError(err.Error())
+		exitWithGuestError(err)
 	}
 }
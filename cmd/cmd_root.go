@@ -12,11 +12,14 @@ func GetRootCommand() *cobra.Command {
 	PersistGlobalCommandFlags(rootCmd.PersistentFlags())
 
 	rootCmd.AddCommand(BuildCommand())
+	rootCmd.AddCommand(ComposeCommands())
 	rootCmd.AddCommand(ImageCommands())
 	rootCmd.AddCommand(InstanceCommands())
 	rootCmd.AddCommand(ProfileCommand())
 	rootCmd.AddCommand(PackageCommands())
 	rootCmd.AddCommand(RunCommand())
+	rootCmd.AddCommand(SnapshotCommands())
+	rootCmd.AddCommand(SymbolizeCommand())
 	rootCmd.AddCommand(UpdateCommand())
 	rootCmd.AddCommand(VersionCommand())
 	rootCmd.AddCommand(VolumeCommands())
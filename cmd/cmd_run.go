@@ -1,10 +1,15 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"time"
 
 	api "github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/onprem"
 	"github.com/nanovms/ops/types"
 	"github.com/spf13/cobra"
 )
@@ -14,7 +19,7 @@ func RunCommand() *cobra.Command {
 	var cmdRun = &cobra.Command{
 		Use:   "run [elf]",
 		Short: "Run ELF binary as unikernel",
-		Args:  cobra.MinimumNArgs(1),
+		Args:  runCommandArgs,
 		Run:   runCommandHandler,
 	}
 
@@ -25,15 +30,89 @@ func RunCommand() *cobra.Command {
 	PersistRunLocalInstanceCommandFlags(persistentFlags)
 	PersistNightlyCommandFlags(persistentFlags)
 	PersistNanosVersionCommandFlags(persistentFlags)
+	PersistReadyCommandFlags(persistentFlags)
+
+	persistentFlags.Bool("watch", false, "rebuild the image and restart the instance when the program, files or config change")
+	persistentFlags.String("from-snapshot", "", "restore an onprem instance snapshot instead of running an ELF")
 
 	return cmdRun
 }
 
+// runCommandArgs requires the ELF to run unless a snapshot is restored
+func runCommandArgs(cmd *cobra.Command, args []string) error {
+	if fromSnapshot, _ := cmd.Flags().GetString("from-snapshot"); fromSnapshot != "" {
+		return nil
+	}
+	return cobra.MinimumNArgs(1)(cmd, args)
+}
+
 func runCommandHandler(cmd *cobra.Command, args []string) {
+	if fromSnapshot, _ := cmd.Flags().GetString("from-snapshot"); fromSnapshot != "" {
+		runFromSnapshotHandler(cmd, fromSnapshot)
+		return
+	}
+
+	c := newProgramConfig(args[0])
+
+	flags := cmd.Flags()
+
+	configFlags := NewConfigCommandFlags(flags)
+	globalFlags := NewGlobalCommandFlags(flags)
+	nightlyFlags := NewNightlyCommandFlags(flags)
+	nanosVersionFlags := NewNanosVersionCommandFlags(flags)
+	buildImageFlags := NewBuildImageCommandFlags(flags)
+	runLocalInstanceFlags := NewRunLocalInstanceCommandFlags(flags)
+	readyFlags := NewReadyCommandFlags(flags)
+
+	mergeContainer := NewMergeConfigContainer(configFlags, globalFlags, nightlyFlags, nanosVersionFlags, buildImageFlags, runLocalInstanceFlags)
+	err := mergeContainer.Merge(c)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if readyFlags.Probe != nil && !c.RunConfig.Background {
+		exitWithError("--wait-for requires --background")
+	}
+
+	if watch, _ := flags.GetBool("watch"); watch {
+		if c.RunConfig.Background {
+			exitWithError("--watch can not be used with --background")
+		}
+
+		reloadConfig := func() (*types.Config, error) {
+			c := newProgramConfig(args[0])
+			return c, mergeContainer.Merge(c)
+		}
+
+		err = RunLocalInstanceWatch(c, configFlags.Config, reloadConfig)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		return
+	}
+
+	if !runLocalInstanceFlags.SkipBuild {
+		err = api.BuildImage(*c)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if c.RunConfig.Background {
+		runBackgroundInstance(c, readyFlags)
+		return
+	}
+
+	err = RunLocalInstance(c)
+	if err != nil {
+		exitWithGuestError(err)
+	}
+}
 
+// newProgramConfig returns a configuration to run the program
+func newProgramConfig(program string) *types.Config {
 	c := types.NewConfig()
 
-	program := args[0]
 	c.Program = program
 	curdir, _ := os.Getwd()
 	c.ProgramPath = path.Join(curdir, c.Program)
@@ -45,30 +124,88 @@ func runCommandHandler(cmd *cobra.Command, args []string) {
 		c.Args = append([]string{c.Program}, c.Args...)
 	}
 
+	return c
+}
+
+// runBackgroundInstance starts the image as an onprem instance, so it can be managed
+// with the instance commands, and waits for it to be ready
+func runBackgroundInstance(c *types.Config, readyFlags *ReadyCommandFlags) {
+	c.CloudConfig.Platform = "onprem"
+	c.CloudConfig.ImageName = filepath.Base(c.RunConfig.Imagename)
+
+	p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = p.CreateInstance(ctx)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	waitForInstanceReady(p, ctx, readyFlags)
+}
+
+// runFromSnapshotHandler restores the machine state saved by "ops instance snapshot" in
+// a copy of the snapshot disk
+func runFromSnapshotHandler(cmd *cobra.Command, snapshotName string) {
 	flags := cmd.Flags()
 
 	configFlags := NewConfigCommandFlags(flags)
 	globalFlags := NewGlobalCommandFlags(flags)
-	nightlyFlags := NewNightlyCommandFlags(flags)
-	nanosVersionFlags := NewNanosVersionCommandFlags(flags)
-	buildImageFlags := NewBuildImageCommandFlags(flags)
 	runLocalInstanceFlags := NewRunLocalInstanceCommandFlags(flags)
+	readyFlags := NewReadyCommandFlags(flags)
 
-	mergeContainer := NewMergeConfigContainer(configFlags, globalFlags, nightlyFlags, nanosVersionFlags, buildImageFlags, runLocalInstanceFlags)
+	c := types.NewConfig()
+
+	mergeContainer := NewMergeConfigContainer(configFlags, globalFlags, runLocalInstanceFlags)
 	err := mergeContainer.Merge(c)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
-	if !runLocalInstanceFlags.SkipBuild {
-		err = api.BuildImage(*c)
+	if readyFlags.Probe != nil && !c.RunConfig.Background {
+		exitWithError("--wait-for requires --background")
+	}
+
+	snapshot, err := onprem.GetSnapshot(snapshotName)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if c.RunConfig.InstanceName == "" {
+		c.RunConfig.InstanceName = fmt.Sprintf("%s-%d", snapshot.Name, time.Now().Unix())
+	}
+
+	if c.RunConfig.Background {
+		diskPath, err := snapshot.RestoreDiskPath(c.RunConfig.InstanceName)
 		if err != nil {
-			panic(err)
+			exitWithError(err.Error())
+		}
+
+		err = onprem.RestoreSnapshotConfig(snapshot, &c.RunConfig, diskPath)
+		if err != nil {
+			exitWithError(err.Error())
 		}
+
+		runBackgroundInstance(c, readyFlags)
+		return
 	}
 
-	err = RunLocalInstance(c)
+	restoreDir, err := ioutil.TempDir("", "ops-restore")
 	if err != nil {
 		exitWithError(err.Error())
 	}
+
+	err = onprem.RestoreSnapshotConfig(snapshot, &c.RunConfig, path.Join(restoreDir, snapshot.Name+".img"))
+	if err != nil {
+		os.RemoveAll(restoreDir)
+		exitWithError(err.Error())
+	}
+
+	err = RunLocalInstance(c)
+	os.RemoveAll(restoreDir)
+	if err != nil {
+		exitWithGuestError(err)
+	}
 }
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/onprem"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// SnapshotCommands provides onprem instance snapshots related commands
+func SnapshotCommands() *cobra.Command {
+	var cmdSnapshot = &cobra.Command{
+		Use:       "snapshot",
+		Short:     "manage onprem instance snapshots",
+		ValidArgs: []string{"list", "delete"},
+		Args:      cobra.OnlyValidArgs,
+	}
+
+	cmdSnapshot.AddCommand(snapshotListCommand())
+	cmdSnapshot.AddCommand(snapshotDeleteCommand())
+
+	return cmdSnapshot
+}
+
+func snapshotListCommand() *cobra.Command {
+	var cmdSnapshotList = &cobra.Command{
+		Use:   "list",
+		Short: "list instance snapshots",
+		Run:   snapshotListCommandHandler,
+	}
+	return cmdSnapshotList
+}
+
+func snapshotListCommandHandler(cmd *cobra.Command, args []string) {
+	snapshots, err := onprem.GetSnapshots()
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Instance", "Image", "Size", "CreatedAt"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, s := range snapshots {
+		var row []string
+		row = append(row, s.Name)
+		row = append(row, s.Instance)
+		row = append(row, s.Image)
+		row = append(row, api.Bytes2Human(s.Size))
+		row = append(row, api.Time2Human(s.Created))
+		table.Append(row)
+	}
+
+	table.Render()
+}
+
+func snapshotDeleteCommand() *cobra.Command {
+	var cmdSnapshotDelete = &cobra.Command{
+		Use:   "delete <snapshot_name>",
+		Short: "delete instance snapshots",
+		Run:   snapshotDeleteCommandHandler,
+		Args:  cobra.MinimumNArgs(0),
+	}
+
+	cmdSnapshotDelete.PersistentFlags().StringP("lru", "", "", "clean least recently used snapshots with a time notation. Use \"1w\" notation to delete snapshots older than one week. Other notation examples are 300d, 3w, 1m and 2y.")
+	cmdSnapshotDelete.PersistentFlags().BoolP("assume-yes", "", false, "clean snapshots without waiting for confirmation")
+
+	return cmdSnapshotDelete
+}
+
+func snapshotDeleteCommandHandler(cmd *cobra.Command, args []string) {
+	lru, _ := cmd.Flags().GetString("lru")
+	assumeYes, _ := cmd.Flags().GetBool("assume-yes")
+
+	snapshotsToDelete := []string{}
+
+	if lru != "" {
+		olderThanDate, err := SubtractTimeNotation(time.Now(), lru)
+		if err != nil {
+			exitWithError(fmt.Errorf("failed getting date from lru flag: %s", err).Error())
+		}
+
+		snapshots, err := onprem.GetSnapshots()
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		for _, s := range snapshots {
+			if s.Created.Before(olderThanDate) {
+				snapshotsToDelete = append(snapshotsToDelete, s.Name)
+			}
+		}
+	}
+
+	snapshotsToDelete = append(snapshotsToDelete, args...)
+
+	if len(snapshotsToDelete) == 0 {
+		fmt.Println("There are no snapshots to delete")
+		return
+	}
+
+	if !assumeYes {
+		fmt.Printf("You are about to delete the next snapshots:\n")
+		for _, s := range snapshotsToDelete {
+			fmt.Println(s)
+		}
+		fmt.Println("Are you sure? (yes/no)")
+		if !askForConfirmation() {
+			return
+		}
+	}
+
+	for _, s := range snapshotsToDelete {
+		err := onprem.DeleteSnapshot(s)
+		if err != nil {
+			fmt.Printf("failed deleting %s: %v\n", s, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// SymbolizeCommand provides the command resolving the program addresses of crash dumps
+func SymbolizeCommand() *cobra.Command {
+	var cmdSymbolize = &cobra.Command{
+		Use:     "symbolize <elf>",
+		Short:   "resolve program addresses of a console log read from stdin to functions and source lines",
+		Example: "  ops instance logs my-instance | ops symbolize ./myprogram",
+		Run:     symbolizeCommandHandler,
+		Args:    cobra.ExactArgs(1),
+	}
+
+	persistSymbolizeFlags(cmdSymbolize)
+
+	return cmdSymbolize
+}
+
+func symbolizeCommandHandler(cmd *cobra.Command, args []string) {
+	symbolizer, err := newSymbolizer(cmd, args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = symbolizer.Symbolize(os.Stdin, os.Stdout)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func persistSymbolizeFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("load-base", "", "address a position independent program is loaded at, required for position independent programs")
+}
+
+// newSymbolizer reads the symbols of the program using the load base of the command flags
+func newSymbolizer(cmd *cobra.Command, program string) (*api.Symbolizer, error) {
+	loadBase, _ := cmd.Flags().GetString("load-base")
+
+	var base uint64
+	if loadBase != "" {
+		var err error
+		base, err = strconv.ParseUint(loadBase, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid load base \"%s\"", loadBase)
+		}
+	}
+
+	return api.NewSymbolizer(program, base)
+}
+
+// symbolizeLogs resolves the program addresses of the logs printed by print to the
+// writer it is passed
+func symbolizeLogs(symbolizer *api.Symbolizer, w io.Writer, print func(w io.Writer) error) error {
+	r, pw := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := symbolizer.Symbolize(r, w)
+		// keep draining so print does not block when w fails
+		io.Copy(ioutil.Discard, r)
+		done <- err
+	}()
+
+	err := print(pw)
+	pw.Close()
+
+	if symbolizeErr := <-done; err == nil {
+		err = symbolizeErr
+	}
+
+	return err
+}
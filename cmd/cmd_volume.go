@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"strconv"
 
 	"github.com/nanovms/ops/types"
@@ -16,7 +18,7 @@ func VolumeCommands() *cobra.Command {
 	cmdVolume := &cobra.Command{
 		Use:       "volume",
 		Short:     "manage nanos volumes",
-		ValidArgs: []string{"create, list, delete, attach"},
+		ValidArgs: []string{"create, list, delete, attach, detach, resize, snapshot, clone, export, import"},
 		Args:      cobra.OnlyValidArgs,
 	}
 
@@ -32,6 +34,11 @@ func VolumeCommands() *cobra.Command {
 	cmdVolume.AddCommand(volumeDeleteCommand())
 	cmdVolume.AddCommand(volumeAttachCommand())
 	cmdVolume.AddCommand(volumeDetachCommand())
+	cmdVolume.AddCommand(volumeResizeCommand())
+	cmdVolume.AddCommand(volumeSnapshotCommand())
+	cmdVolume.AddCommand(volumeCloneCommand())
+	cmdVolume.AddCommand(volumeExportCommand())
+	cmdVolume.AddCommand(volumeImportCommand())
 	return cmdVolume
 }
 
@@ -45,6 +52,8 @@ func volumeCreateCommand() *cobra.Command {
 	}
 	cmdVolumeCreate.PersistentFlags().StringVarP(&data, "data", "d", "", "volume data source")
 	cmdVolumeCreate.PersistentFlags().StringVarP(&size, "size", "s", strconv.Itoa(onprem.MinimumVolumeSize), "volume initial size")
+	cmdVolumeCreate.PersistentFlags().Bool("encrypt", false, "encrypt the volume at rest with the provider-managed key")
+	cmdVolumeCreate.PersistentFlags().String("encryption-key", "", "encrypt the volume at rest with a customer key (aws kms key id, gcp kms key name, azure disk encryption set id)")
 	return cmdVolumeCreate
 }
 
@@ -53,11 +62,26 @@ func volumeCreateCommandHandler(cmd *cobra.Command, args []string) {
 	data, _ := cmd.Flags().GetString("data")
 	size, _ := cmd.Flags().GetString("size")
 
+	encrypt, _ := cmd.Flags().GetBool("encrypt")
+	encryptionKey, _ := cmd.Flags().GetString("encryption-key")
+
 	c, err := getVolumeCommandDefaultConfig(cmd)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
+	if encrypt {
+		c.CloudConfig.Encrypt = true
+	}
+	if encryptionKey != "" {
+		c.CloudConfig.EncryptionKey = encryptionKey
+	}
+
+	err = api.CheckEncryption(c)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
 	if err != nil {
 		log.Fatal(err)
@@ -68,6 +92,9 @@ func volumeCreateCommandHandler(cmd *cobra.Command, args []string) {
 		exitWithError(err.Error())
 	}
 	log.Printf("volume: %s created with UUID %s and label %s\n", res.Name, res.ID, res.Label)
+	if res.Encrypted {
+		log.Printf("volume: %s is encrypted at rest\n", res.Name)
+	}
 }
 
 // TODO might be nice to be able to filter by name/label
@@ -133,8 +160,9 @@ func volumeAttachCommand() *cobra.Command {
 	cmdVolumeAttach := &cobra.Command{
 		Use:   "attach <image_name> <volume_name>",
 		Short: "attach volume",
+		Long:  "attach volume\n\nonprem volumes are attached to an image or to a running instance, use <volume_name>:<mount_path> to set\nthe mount path, /<volume_name> by default",
 		Run:   volumeAttachCommandHandler,
-		Args:  cobra.MinimumNArgs(3),
+		Args:  cobra.MinimumNArgs(2),
 	}
 	return cmdVolumeAttach
 }
@@ -189,6 +217,212 @@ func volumeDetachCommandHandler(cmd *cobra.Command, args []string) {
 	}
 }
 
+func volumeResizeCommand() *cobra.Command {
+	cmdVolumeResize := &cobra.Command{
+		Use:   "resize <volume_name> <size>",
+		Short: "grow volume",
+		Long:  "grow volume to size, in bytes or with a k, m, g or t unit\n\ncloud providers size disks in whole GiB, volumes can not shrink",
+		Run:   volumeResizeCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	return cmdVolumeResize
+}
+
+func volumeResizeCommandHandler(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	size, err := api.ParseVolumeSize(args[1])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c, err := getVolumeCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, ok := p.(api.VolumeResizeService)
+	if !ok {
+		exitWithError(fmt.Sprintf("volume resize is not supported on %s", c.CloudConfig.Platform))
+	}
+
+	res, err := s.ResizeVolume(ctx, name, size)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("volume: %s resized to %s\n", name, res.Size)
+}
+
+func volumeSnapshotCommand() *cobra.Command {
+	cmdVolumeSnapshot := &cobra.Command{
+		Use:   "snapshot <volume_name>",
+		Short: "snapshot volume",
+		Long:  "snapshot volume\n\nonprem snapshots are copies of the volume named <volume_name>-<timestamp>, cloud providers\ncreate a disk snapshot",
+		Run:   volumeSnapshotCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+	return cmdVolumeSnapshot
+}
+
+func volumeSnapshotCommandHandler(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	c, err := getVolumeCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	s, ctx := getVolumeSnapshotService(c)
+
+	res, err := s.SnapshotVolume(ctx, name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("volume: snapshot %s of volume %s created\n", res.Name, name)
+}
+
+func volumeCloneCommand() *cobra.Command {
+	cmdVolumeClone := &cobra.Command{
+		Use:   "clone <volume_name> <new_volume_name>",
+		Short: "clone volume",
+		Run:   volumeCloneCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	return cmdVolumeClone
+}
+
+func volumeCloneCommandHandler(cmd *cobra.Command, args []string) {
+	name := args[0]
+	newName := args[1]
+
+	c, err := getVolumeCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	s, ctx := getVolumeSnapshotService(c)
+
+	res, err := s.CloneVolume(ctx, name, newName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if res.ID != "" {
+		log.Printf("volume: %s created with UUID %s from volume %s\n", res.Name, res.ID, name)
+	} else {
+		log.Printf("volume: %s created from volume %s\n", res.Name, name)
+	}
+}
+
+// getVolumeSnapshotService returns the provider of the platform if it can snapshot volumes
+func getVolumeSnapshotService(c *types.Config) (api.VolumeSnapshotService, *api.Context) {
+	p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s, ok := p.(api.VolumeSnapshotService)
+	if !ok {
+		exitWithError(fmt.Sprintf("volume snapshots are not supported on %s", c.CloudConfig.Platform))
+	}
+
+	return s, ctx
+}
+
+func volumeExportCommand() *cobra.Command {
+	cmdVolumeExport := &cobra.Command{
+		Use:   "export <volume_name> <tar_file>",
+		Short: "export the files of an onprem volume to a tar archive",
+		Run:   volumeExportCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	return cmdVolumeExport
+}
+
+func volumeExportCommandHandler(cmd *cobra.Command, args []string) {
+	name := args[0]
+	tarPath := args[1]
+
+	c, err := getVolumeCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	p, ctx := getOnPremVolumeProvider(c)
+
+	f, err := os.Create(tarPath)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = p.ExportVolume(ctx, name, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tarPath)
+		log.Fatal(err)
+	}
+	log.Printf("volume: %s exported to %s\n", name, tarPath)
+}
+
+func volumeImportCommand() *cobra.Command {
+	var size string
+	cmdVolumeImport := &cobra.Command{
+		Use:   "import <volume_name> <tar_file>",
+		Short: "create an onprem volume with the files of a tar archive",
+		Run:   volumeImportCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	cmdVolumeImport.PersistentFlags().StringVarP(&size, "size", "s", "", "volume size, large enough for the files by default")
+	return cmdVolumeImport
+}
+
+func volumeImportCommandHandler(cmd *cobra.Command, args []string) {
+	name := args[0]
+	tarPath := args[1]
+	size, _ := cmd.Flags().GetString("size")
+
+	c, err := getVolumeCommandDefaultConfig(cmd)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	p, ctx := getOnPremVolumeProvider(c)
+
+	f, err := os.Open(tarPath)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	defer f.Close()
+
+	res, err := p.ImportVolume(ctx, name, size, f)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	log.Printf("volume: %s created with UUID %s and label %s\n", res.Name, res.ID, res.Label)
+}
+
+// getOnPremVolumeProvider returns the onprem provider, volumes can only be exported
+// and imported locally
+func getOnPremVolumeProvider(c *types.Config) (*onprem.OnPrem, *api.Context) {
+	p, ctx, err := getProviderAndContext(c, c.CloudConfig.Platform)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	op, ok := p.(*onprem.OnPrem)
+	if !ok {
+		exitWithError(fmt.Sprintf("volume export and import are only supported on onprem, not on %s", c.CloudConfig.Platform))
+	}
+
+	return op, ctx
+}
+
 func getVolumeCommandDefaultConfig(cmd *cobra.Command) (c *types.Config, err error) {
 	flags := cmd.Flags()
 
@@ -28,5 +28,8 @@ func (m *MergeConfigContainer) Merge(config *types.Config) error {
 		}
 	}
 
+	// shares and volumes are mounted from any of the flags
+	UniqueShareTags(config)
+
 	return nil
 }
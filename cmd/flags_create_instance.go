@@ -1,6 +1,12 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/onprem"
 	"github.com/nanovms/ops/types"
 
 	"github.com/spf13/pflag"
@@ -12,8 +18,13 @@ type CreateInstanceFlags struct {
 	Flavor     string
 	Ports      []string
 	UDPPorts   []string
+	Restart    string
+	Volumes    []string
 }
 
+// instanceVolumePlatforms are the providers which attach volumes by name to new instances
+var instanceVolumePlatforms = []string{"aws", "gcp", "azure", "openstack"}
+
 // MergeToConfig append command flags that are used to create an instance
 func (f *CreateInstanceFlags) MergeToConfig(config *types.Config) (err error) {
 	if f.DomainName != "" {
@@ -32,6 +43,61 @@ func (f *CreateInstanceFlags) MergeToConfig(config *types.Config) (err error) {
 		config.RunConfig.UDPPorts = append(config.RunConfig.UDPPorts, f.UDPPorts...)
 	}
 
+	if f.Restart != "" {
+		if config.CloudConfig.Platform != "onprem" {
+			return errors.New("--restart is only supported for onprem instances")
+		}
+
+		_, err = onprem.ParseRestartPolicy(f.Restart)
+		if err != nil {
+			return
+		}
+		config.RunConfig.Restart = f.Restart
+	}
+
+	// the boot disks of the instances are encrypted when the configuration requires it
+	err = lepton.CheckEncryption(config)
+	if err != nil {
+		return
+	}
+
+	if len(f.Volumes) != 0 {
+		if !containsString(instanceVolumePlatforms, config.CloudConfig.Platform) {
+			return fmt.Errorf("--volume is only supported for %s instances", strings.Join(instanceVolumePlatforms, ", "))
+		}
+
+		for _, v := range f.Volumes {
+			_, _, err = lepton.ParseVolumeAttachment(v)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return nil
+}
+
+// MergeVolumeMounts adds the volumes to the mounts of the image built with the
+// instance, the image mounts the volumes by label
+func (f *CreateInstanceFlags) MergeVolumeMounts(config *types.Config) error {
+	if len(f.Volumes) == 0 {
+		return nil
+	}
+
+	if config.Mounts == nil {
+		config.Mounts = make(map[string]string)
+	}
+	for _, v := range f.Volumes {
+		name, mountPath, err := lepton.ParseVolumeAttachment(v)
+		if err != nil {
+			return err
+		}
+		if mounted, ok := config.Mounts[name]; ok && mounted != mountPath {
+			return fmt.Errorf("volume %s is already mounted at %s", name, mounted)
+		}
+		config.Mounts[name] = mountPath
+	}
+
 	return nil
 }
 
@@ -68,6 +134,16 @@ func NewCreateInstanceCommandFlags(cmdFlags *pflag.FlagSet) (flags *CreateInstan
 		exitWithError(err.Error())
 	}
 
+	flags.Restart, err = cmdFlags.GetString("restart")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	flags.Volumes, err = cmdFlags.GetStringArray("volume")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	return flags
 }
 
@@ -75,6 +151,8 @@ func NewCreateInstanceCommandFlags(cmdFlags *pflag.FlagSet) (flags *CreateInstan
 func PersistCreateInstanceFlags(cmdFlags *pflag.FlagSet) {
 	cmdFlags.StringP("domainname", "d", "", "domain name for instance")
 	cmdFlags.StringP("flavor", "f", "", "flavor name for cloud provider")
-	cmdFlags.StringArrayP("port", "p", nil, "port to open")
+	cmdFlags.StringArrayP("port", "p", nil, "port to open ([hostaddress:]hostport[:guestport][/tcp|udp])")
 	cmdFlags.StringArrayP("udp", "", nil, "udp ports to forward")
+	cmdFlags.String("restart", "", "restart policy of onprem instances (no, on-failure[:max-retries], always)")
+	cmdFlags.StringArray("volume", nil, "volume attached to the instance by name (<volume>[:<mount path>])")
 }
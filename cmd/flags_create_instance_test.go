@@ -66,3 +66,119 @@ func TestCreateInstanceFlagsMergeToConfig(t *testing.T) {
 
 	assert.Equal(t, expected, actual)
 }
+
+func TestCreateInstanceFlagsRestart(t *testing.T) {
+	flagSet := pflag.NewFlagSet("test", 0)
+
+	cmd.PersistCreateInstanceFlags(flagSet)
+
+	flagSet.Set("restart", "on-failure:3")
+
+	createInstanceFlags := cmd.NewCreateInstanceCommandFlags(flagSet)
+
+	t.Run("onprem", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "onprem"}}
+
+		err := createInstanceFlags.MergeToConfig(c)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "on-failure:3", c.RunConfig.Restart)
+	})
+
+	t.Run("cloud provider", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "gcp"}}
+
+		err := createInstanceFlags.MergeToConfig(c)
+
+		assert.EqualError(t, err, "--restart is only supported for onprem instances")
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		flagSet.Set("restart", "sometimes")
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "onprem"}}
+
+		err := cmd.NewCreateInstanceCommandFlags(flagSet).MergeToConfig(c)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCreateInstanceFlagsVolumes(t *testing.T) {
+	flagSet := pflag.NewFlagSet("test", 0)
+
+	cmd.PersistCreateInstanceFlags(flagSet)
+
+	flagSet.Set("volume", "data")
+	flagSet.Set("volume", "logs:/var/log/app")
+
+	createInstanceFlags := cmd.NewCreateInstanceCommandFlags(flagSet)
+
+	assert.Equal(t, []string{"data", "logs:/var/log/app"}, createInstanceFlags.Volumes)
+
+	t.Run("cloud provider", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "aws"}}
+
+		err := createInstanceFlags.MergeToConfig(c)
+
+		assert.Nil(t, err)
+		assert.Nil(t, c.Mounts)
+	})
+
+	t.Run("image mounts", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "aws"}}
+
+		err := createInstanceFlags.MergeVolumeMounts(c)
+
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"data": "/data", "logs": "/var/log/app"}, c.Mounts)
+	})
+
+	t.Run("mounted elsewhere", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "gcp"}, Mounts: map[string]string{"data": "/mnt"}}
+
+		err := createInstanceFlags.MergeVolumeMounts(c)
+
+		assert.EqualError(t, err, "volume data is already mounted at /mnt")
+	})
+
+	t.Run("unsupported provider", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "onprem"}}
+
+		err := createInstanceFlags.MergeToConfig(c)
+
+		assert.EqualError(t, err, "--volume is only supported for aws, gcp, azure, openstack instances")
+	})
+
+	t.Run("invalid volume", func(t *testing.T) {
+		flagSet.Set("volume", "data:mnt")
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "aws"}}
+
+		err := cmd.NewCreateInstanceCommandFlags(flagSet).MergeToConfig(c)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestCreateInstanceFlagsEncryption(t *testing.T) {
+	flagSet := pflag.NewFlagSet("test", 0)
+
+	cmd.PersistCreateInstanceFlags(flagSet)
+
+	createInstanceFlags := cmd.NewCreateInstanceCommandFlags(flagSet)
+
+	t.Run("supported provider", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "azure", Encrypt: true}}
+
+		err := createInstanceFlags.MergeToConfig(c)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("unsupported provider", func(t *testing.T) {
+		c := &types.Config{CloudConfig: types.ProviderConfig{Platform: "onprem", Encrypt: true}}
+
+		err := createInstanceFlags.MergeToConfig(c)
+
+		assert.EqualError(t, err, "encryption at rest is not supported on onprem, it is supported on aws, gcp, azure")
+	})
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/network"
+	"github.com/nanovms/ops/types"
+
+	"github.com/spf13/pflag"
+)
+
+// ReadyCommandFlags consolidates flags used to wait for an instance to be ready
+type ReadyCommandFlags struct {
+	Probe   *api.ReadinessProbe
+	Timeout time.Duration
+}
+
+// NewReadyCommandFlags returns an instance of ReadyCommandFlags initialized with command flags values
+func NewReadyCommandFlags(cmdFlags *pflag.FlagSet) (flags *ReadyCommandFlags) {
+	var err error
+	flags = &ReadyCommandFlags{}
+
+	waitFor, err := cmdFlags.GetString("wait-for")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if waitFor != "" {
+		flags.Probe, err = api.ParseReadinessProbe(waitFor)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+	}
+
+	flags.Timeout, err = cmdFlags.GetDuration("wait-timeout")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	return
+}
+
+// PersistReadyCommandFlags append a command the flags required to wait for an instance to be ready
+func PersistReadyCommandFlags(cmdFlags *pflag.FlagSet) {
+	cmdFlags.String("wait-for", "", "wait until the instance is ready (tcp:port, http://:port/path or log:pattern)")
+	cmdFlags.Duration("wait-timeout", api.DefaultReadyTimeout, "time to wait for the instance to be ready")
+}
+
+// waitForInstanceReady blocks until the instance is ready and prints the address it is
+// reachable at. It does nothing if no readiness probe was specified.
+func waitForInstanceReady(p api.Provider, ctx *api.Context, flags *ReadyCommandFlags) {
+	if flags.Probe == nil {
+		return
+	}
+
+	c := ctx.Config()
+	probe := *flags.Probe
+
+	opts := api.WaitForReadyOptions{
+		Probe:   &probe,
+		Timeout: flags.Timeout,
+	}
+
+	if c.CloudConfig.Platform == "onprem" {
+		if probe.NeedsAddress() && probe.Host == "" {
+			probe.Host = "127.0.0.1"
+			probe.Port = localHostPort(c.RunConfig, probe.Port)
+		}
+	} else {
+		opts.PublicIP = true
+	}
+
+	instanceName := c.RunConfig.InstanceName
+	address, err := api.WaitForReady(ctx, p, instanceName, opts)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if address != "" {
+		fmt.Printf("%s ready at %s\n", instanceName, address)
+	} else {
+		fmt.Printf("%s ready\n", instanceName)
+	}
+}
+
+// localHostPort returns the host port forwarded to the guest port of a local instance
+func localHostPort(rconfig types.RunConfig, guestPort int) int {
+	mappings, err := network.ParsePortMappings(rconfig.Ports, network.ProtocolTCP)
+	if err != nil {
+		return guestPort
+	}
+
+	for _, pm := range mappings {
+		if pm.Protocol == network.ProtocolTCP && guestPort >= pm.GuestFrom && guestPort <= pm.GuestTo {
+			return pm.HostFrom + guestPort - pm.GuestFrom
+		}
+	}
+
+	return guestPort
+}
@@ -0,0 +1,37 @@
+package cmd_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/cmd"
+	"github.com/nanovms/ops/lepton"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateReadyFlags(t *testing.T) {
+	t.Run("without probe", func(t *testing.T) {
+		flagSet := pflag.NewFlagSet("test", 0)
+		cmd.PersistReadyCommandFlags(flagSet)
+
+		readyFlags := cmd.NewReadyCommandFlags(flagSet)
+
+		assert.Nil(t, readyFlags.Probe)
+		assert.Equal(t, lepton.DefaultReadyTimeout, readyFlags.Timeout)
+	})
+
+	t.Run("with probe", func(t *testing.T) {
+		flagSet := pflag.NewFlagSet("test", 0)
+		cmd.PersistReadyCommandFlags(flagSet)
+
+		flagSet.Set("wait-for", "http://:8080/health")
+		flagSet.Set("wait-timeout", "30s")
+
+		readyFlags := cmd.NewReadyCommandFlags(flagSet)
+
+		assert.Equal(t, lepton.ProbeHTTP, readyFlags.Probe.Type)
+		assert.Equal(t, 8080, readyFlags.Probe.Port)
+		assert.Equal(t, 30*time.Second, readyFlags.Timeout)
+	})
+}
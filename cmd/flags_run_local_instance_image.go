@@ -4,8 +4,9 @@ import (
 	"debug/elf"
 	"fmt"
 	"net"
-	"strconv"
 
+	"github.com/nanovms/ops/network"
+	"github.com/nanovms/ops/qemu"
 	"github.com/nanovms/ops/types"
 
 	"github.com/go-errors/errors"
@@ -16,22 +17,30 @@ import (
 // RunLocalInstanceCommandFlags consolidates all command flags required to run a local instance in one struct
 type RunLocalInstanceCommandFlags struct {
 	Accel          bool
+	Background     bool
 	Bridged        bool
 	BridgeName     string
+	CPUQuota       float64
+	CPUSet         string
 	Debug          bool
 	Force          bool
 	Gateway        string
 	GDBPort        int
+	IOThreads      bool
+	IOWeight       int
 	IPAddress      string
+	MemoryLimit    string
 	Netmask        string
 	NoTrace        []string
 	Ports          []string
+	Shares         []string
 	SkipBuild      bool
 	Smp            int
 	SyscallSummary bool
 	TapName        string
 	Trace          bool
 	Verbose        bool
+	VhostNet       bool
 }
 
 // MergeToConfig overrides configuration passed by argument with command flags values
@@ -84,10 +93,27 @@ func (flags *RunLocalInstanceCommandFlags) MergeToConfig(c *types.Config) (err e
 	}
 
 	c.RunConfig.Verbose = flags.Verbose
+	c.RunConfig.Background = flags.Background
 	c.RunConfig.Bridged = flags.Bridged
 	c.RunConfig.Accel = flags.Accel
 	c.Force = flags.Force
 
+	if flags.VhostNet && !flags.Bridged {
+		return errors.New("--vhost-net requires bridge networking")
+	}
+	c.RunConfig.VhostNet = flags.VhostNet
+	c.RunConfig.IOThreads = flags.IOThreads
+
+	c.RunConfig.CPUQuota = flags.CPUQuota
+	c.RunConfig.CPUSet = flags.CPUSet
+	c.RunConfig.MemoryLimit = flags.MemoryLimit
+	c.RunConfig.IOWeight = flags.IOWeight
+
+	err = qemu.ValidateResourceLimits(&c.RunConfig)
+	if err != nil {
+		return
+	}
+
 	ipaddr := flags.IPAddress
 	gateway := flags.Gateway
 	netmask := flags.Netmask
@@ -120,9 +146,13 @@ func (flags *RunLocalInstanceCommandFlags) MergeToConfig(c *types.Config) (err e
 		return
 	}
 
-	for _, p := range ports {
-		i, err := strconv.Atoi(p)
-		if err == nil && i == flags.GDBPort {
+	mappings, err := network.ParsePortMappings(ports, network.ProtocolTCP)
+	if err != nil {
+		return
+	}
+
+	for _, pm := range mappings {
+		if flags.GDBPort != 0 && pm.Protocol == network.ProtocolTCP && pm.Contains(flags.GDBPort) {
 			errstr := fmt.Sprintf("Port %d is forwarded and cannot be used as gdb port", flags.GDBPort)
 			return errors.New(errstr)
 		}
@@ -130,6 +160,12 @@ func (flags *RunLocalInstanceCommandFlags) MergeToConfig(c *types.Config) (err e
 
 	c.RunConfig.Ports = append(c.RunConfig.Ports, ports...)
 
+	shares, err := ParseSharedDirs(flags.Shares)
+	if err != nil {
+		return
+	}
+	c.RunConfig.Shares = append(c.RunConfig.Shares, shares...)
+
 	return
 }
 
@@ -138,11 +174,26 @@ func NewRunLocalInstanceCommandFlags(cmdFlags *pflag.FlagSet) (flags *RunLocalIn
 	var err error
 	flags = &RunLocalInstanceCommandFlags{}
 
+	flags.Background, err = cmdFlags.GetBool("background")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	flags.Bridged, err = cmdFlags.GetBool("bridged")
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
+	flags.CPUQuota, err = cmdFlags.GetFloat64("cpu-quota")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	flags.CPUSet, err = cmdFlags.GetString("cpuset")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	flags.Debug, err = cmdFlags.GetBool("debug")
 	if err != nil {
 		exitWithError(err.Error())
@@ -172,11 +223,26 @@ func NewRunLocalInstanceCommandFlags(cmdFlags *pflag.FlagSet) (flags *RunLocalIn
 		exitWithError(err.Error())
 	}
 
+	flags.IOThreads, err = cmdFlags.GetBool("iothreads")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	flags.IOWeight, err = cmdFlags.GetInt("io-weight")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	flags.IPAddress, err = cmdFlags.GetString("ip-address")
 	if err != nil {
 		exitWithError(err.Error())
 	}
 
+	flags.MemoryLimit, err = cmdFlags.GetString("memory-limit")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	flags.Netmask, err = cmdFlags.GetString("netmask")
 	if err != nil {
 		exitWithError(err.Error())
@@ -192,6 +258,11 @@ func NewRunLocalInstanceCommandFlags(cmdFlags *pflag.FlagSet) (flags *RunLocalIn
 		exitWithError(err.Error())
 	}
 
+	flags.Shares, err = cmdFlags.GetStringArray("share")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	flags.SkipBuild, err = cmdFlags.GetBool("skipbuild")
 	if err != nil {
 		exitWithError(err.Error())
@@ -227,12 +298,17 @@ func NewRunLocalInstanceCommandFlags(cmdFlags *pflag.FlagSet) (flags *RunLocalIn
 		exitWithError(err.Error())
 	}
 
+	flags.VhostNet, err = cmdFlags.GetBool("vhost-net")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
 	return
 }
 
 // PersistRunLocalInstanceCommandFlags append a command the required flags to run an image
 func PersistRunLocalInstanceCommandFlags(cmdFlags *pflag.FlagSet) {
-	cmdFlags.StringArrayP("port", "p", nil, "port to forward")
+	cmdFlags.StringArrayP("port", "p", nil, "port to forward ([hostaddress:]hostport[:guestport][/tcp|udp])")
 	cmdFlags.BoolP("force", "f", false, "update images")
 	cmdFlags.BoolP("debug", "d", false, "enable interactive debugger")
 	cmdFlags.BoolP("trace", "", false, "enable required flags to trace")
@@ -240,15 +316,23 @@ func PersistRunLocalInstanceCommandFlags(cmdFlags *pflag.FlagSet) {
 	cmdFlags.StringArrayP("no-trace", "", nil, "do not trace syscall")
 	cmdFlags.BoolP("verbose", "v", false, "verbose")
 	cmdFlags.BoolP("bridged", "b", false, "bridge networking")
+	cmdFlags.Bool("background", false, "run the instance in background, manage it with the instance commands")
 	cmdFlags.StringP("bridgename", "", "", "bridge name")
 	cmdFlags.StringP("tapname", "t", "", "tap device name")
 	cmdFlags.String("ip-address", "", "static ip address")
 	cmdFlags.String("gateway", "", "network gateway")
 	cmdFlags.String("netmask", "255.255.255.0", "network mask")
 	cmdFlags.BoolP("skipbuild", "s", false, "skip building image")
+	cmdFlags.StringArray("share", nil, "share a host directory with the guest (hostdir:/guestpath)")
 	cmdFlags.Bool("accel", true, "use cpu virtualization extension")
 	cmdFlags.IntP("smp", "", 1, "number of threads to use")
 	cmdFlags.Bool("syscall-summary", false, "print syscall summary on exit")
+	cmdFlags.Float64("cpu-quota", 0, "limit the hypervisor cpu time to a number of host cpus, e.g. 1.5")
+	cmdFlags.String("cpuset", "", "host cpus the hypervisor runs on, e.g. 2-3")
+	cmdFlags.String("memory-limit", "", "maximum memory of the hypervisor process, e.g. 1G")
+	cmdFlags.Int("io-weight", 0, "relative block I/O weight of the hypervisor, from 1 to 10000")
+	cmdFlags.Bool("iothreads", false, "run the disk emulation in a dedicated thread")
+	cmdFlags.Bool("vhost-net", false, "use the vhost-net kernel driver for bridge networking")
 }
 
 // isIPAddressValid checks whether IP address is valid
@@ -97,3 +97,44 @@ func newRunLocalInstanceFlagSet(debug string) *cmd.RunLocalInstanceCommandFlags
 
 	return cmd.NewRunLocalInstanceCommandFlags(flagSet)
 }
+
+func TestRunLocalInstanceFlagsResourceLimits(t *testing.T) {
+	t.Run("should set the resource limits", func(t *testing.T) {
+		flags := &cmd.RunLocalInstanceCommandFlags{
+			Bridged:     true,
+			CPUQuota:    1.5,
+			CPUSet:      "0",
+			MemoryLimit: "1G",
+			IOWeight:    500,
+			IOThreads:   true,
+			VhostNet:    true,
+		}
+
+		c := &types.Config{}
+		err := flags.MergeToConfig(c)
+
+		assert.Nil(t, err)
+		assert.Equal(t, 1.5, c.RunConfig.CPUQuota)
+		assert.Equal(t, "0", c.RunConfig.CPUSet)
+		assert.Equal(t, "1G", c.RunConfig.MemoryLimit)
+		assert.Equal(t, 500, c.RunConfig.IOWeight)
+		assert.True(t, c.RunConfig.IOThreads)
+		assert.True(t, c.RunConfig.VhostNet)
+	})
+
+	t.Run("should fail if vhost-net is used without bridge networking", func(t *testing.T) {
+		flags := &cmd.RunLocalInstanceCommandFlags{VhostNet: true}
+
+		err := flags.MergeToConfig(&types.Config{})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should fail if a limit is invalid", func(t *testing.T) {
+		flags := &cmd.RunLocalInstanceCommandFlags{CPUSet: "3-1"}
+
+		err := flags.MergeToConfig(&types.Config{})
+
+		assert.NotNil(t, err)
+	})
+}
@@ -1,41 +1,79 @@
 package cmd
 
 import (
+	"net"
 	"strings"
 	"unicode"
 
 	"github.com/go-errors/errors"
+	"github.com/nanovms/ops/network"
 )
 
 // ValidateNetworkPorts verifies ports strings have right format
-// Strings must have only numbers, commas or hyphens. Commas and hypens must separate 2 numbers
+// Strings are lists of port mappings separated by commas. Each mapping has the format
+// [hostaddress:]hostport[:guestport][/protocol] where ports have only numbers or one hyphen separating 2 numbers
 func ValidateNetworkPorts(ports []string) error {
 	for _, str := range ports {
-		var hyphenUsed bool
-
-		if str[0] == ',' || str[len(str)-1] == ',' {
+		if str == "" || str[0] == ',' || str[len(str)-1] == ',' || strings.Contains(str, ",,") {
 			return errors.Errorf("\"%s\" commas must separate numbers", str)
-		} else if str[0] == '-' || str[len(str)-1] == '-' {
-			return errors.Errorf("\"%s\" hyphen must separate two numbers", str)
 		}
 
-		for i, ch := range str {
-			if ch == ',' {
-				if !unicode.IsDigit(rune(str[i-1])) || !unicode.IsDigit(rune(str[i+1])) {
-					return errors.Errorf("\"%s\" commas must separate numbers", str)
-				}
-			} else if ch == '-' {
-				if hyphenUsed {
-					return errors.Errorf("\"%s\" may have only one hyphen", str)
-				} else if !unicode.IsDigit(rune(str[i-1])) || !unicode.IsDigit(rune(str[i+1])) {
-					return errors.Errorf("\"%s\" hyphen must separate two numbers", str)
+		for _, mapping := range strings.Split(str, ",") {
+			for _, portRange := range portRanges(mapping) {
+				err := validatePortRange(str, portRange)
+				if err != nil {
+					return err
 				}
-				hyphenUsed = true
-			} else if !unicode.IsDigit(ch) {
-				return errors.Errorf("\"%s\" must have only numbers, commas or one hyphen", str)
 			}
+
+			_, err := network.ParsePortMapping(mapping, network.ProtocolTCP)
+			if err != nil {
+				return errors.New(err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// portRanges returns the host and guest port ranges of a port mapping without host address and protocol
+func portRanges(mapping string) []string {
+	if i := strings.LastIndex(mapping, "/"); i != -1 {
+		mapping = mapping[:i]
+	}
+
+	if strings.HasPrefix(mapping, "[") {
+		if i := strings.Index(mapping, "]:"); i != -1 {
+			mapping = mapping[i+2:]
 		}
+	}
+
+	parts := strings.Split(mapping, ":")
+	if len(parts) == 3 || (len(parts) == 2 && net.ParseIP(parts[0]) != nil) {
+		parts = parts[1:]
+	}
+
+	return parts
+}
 
+func validatePortRange(str, portRange string) error {
+	var hyphenUsed bool
+
+	if portRange == "" || portRange[0] == '-' || portRange[len(portRange)-1] == '-' {
+		return errors.Errorf("\"%s\" hyphen must separate two numbers", str)
+	}
+
+	for i, ch := range portRange {
+		if ch == '-' {
+			if hyphenUsed {
+				return errors.Errorf("\"%s\" may have only one hyphen", str)
+			} else if !unicode.IsDigit(rune(portRange[i-1])) || !unicode.IsDigit(rune(portRange[i+1])) {
+				return errors.Errorf("\"%s\" hyphen must separate two numbers", str)
+			}
+			hyphenUsed = true
+		} else if !unicode.IsDigit(ch) {
+			return errors.Errorf("\"%s\" must have only numbers, commas or one hyphen", str)
+		}
 	}
 
 	return nil
@@ -20,10 +20,16 @@ func TestValidateNetworkPorts(t *testing.T) {
 			{[]string{"80,90,100"}, true, ""},
 			{[]string{"80-8080,9000"}, true, ""},
 			{[]string{"9000,80-8080"}, true, ""},
+			{[]string{"8080:80"}, true, ""},
+			{[]string{"127.0.0.1:8080:80/udp,9000-9010:7000-7010"}, true, ""},
+			{[]string{"53/udp"}, true, ""},
 			{[]string{"hello"}, false, "\"hello\" must have only numbers, commas or one hyphen"},
 			{[]string{"-80"}, false, "\"-80\" hyphen must separate two numbers"},
 			{[]string{"80-8080-9000"}, false, "\"80-8080-9000\" may have only one hyphen"},
 			{[]string{"80,"}, false, "\"80,\" commas must separate numbers"},
+			{[]string{"8080:hello"}, false, "\"8080:hello\" must have only numbers, commas or one hyphen"},
+			{[]string{"80-90:80"}, false, "\"80-90:80\" host and guest port ranges must have the same size"},
+			{[]string{"80/icmp"}, false, "\"80/icmp\" protocol must be tcp or udp"},
 		}
 
 		for _, tt := range tests {
@@ -1,13 +1,54 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
 
+	"github.com/nanovms/ops/fs"
+	api "github.com/nanovms/ops/lepton"
 	"github.com/nanovms/ops/network"
 	"github.com/nanovms/ops/qemu"
 	"github.com/nanovms/ops/types"
 )
 
+// Exit codes used when the guest program does not report its own exit status
+const (
+	// ExitCodeBootFailure is used when the hypervisor fails or the guest stops without exit status
+	ExitCodeBootFailure = 125
+	// ExitCodeInterrupted is used when the hypervisor is stopped by a signal
+	ExitCodeInterrupted = 130
+	// ExitCodeProgramCrash is used when the guest program faults or the kernel panics
+	ExitCodeProgramCrash = 134
+)
+
+// GuestExitError is returned when the guest program does not exit successfully
+type GuestExitError struct {
+	Code  int
+	Crash *api.CrashReport
+	Cause error
+
+	// Klog is the kernel log dump the kernel wrote in the image, if any
+	Klog *fs.KlogDump
+}
+
+func (e *GuestExitError) Error() string {
+	switch {
+	case e.Crash != nil:
+		return e.Crash.String()
+	case e.Code == ExitCodeBootFailure && e.Cause != nil:
+		return fmt.Sprintf("guest failed to boot: %v", e.Cause)
+	case e.Code == ExitCodeBootFailure:
+		return "guest stopped without exit status"
+	case e.Code == ExitCodeInterrupted:
+		return "guest interrupted"
+	default:
+		return fmt.Sprintf("guest program exited with status %d", e.Code)
+	}
+}
+
 // RunLocalInstance runs a virtual machine in a hypervisor
 func RunLocalInstance(c *types.Config) (err error) {
 	hypervisor := qemu.HypervisorInstance()
@@ -17,6 +58,44 @@ func RunLocalInstance(c *types.Config) (err error) {
 		return fmt.Errorf("%s\n%s", ErrNoHypervisor, InfoInstallOps)
 	}
 
+	turnOffNetwork, err := setupNetworkInterfaces(c)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		turnOffErr := turnOffNetwork()
+		if err == nil {
+			err = turnOffErr
+		}
+	}()
+
+	crashDetector := &api.CrashDetector{Trace: containsString(c.Debugflags, "trace")}
+	bootDetector := &qemu.BootDetector{}
+
+	cmd, err := hypervisor.Command(&c.RunConfig)
+	if err != nil {
+		return
+	}
+	cmd.Stdout = io.MultiWriter(os.Stdout, crashDetector, bootDetector.Guest())
+	cmd.Stderr = io.MultiWriter(os.Stderr, bootDetector)
+
+	// a dump read once the guest stopped was written by this boot
+	err = fs.ClearKlogDump(c.RunConfig.Imagename)
+	if err != nil {
+		fmt.Printf("warning: %v\n", err)
+	}
+
+	fmt.Printf("booting %s ...\n", c.RunConfig.Imagename)
+	err = guestExitError(bootDetector.Check(hypervisor.Start(&c.RunConfig)), crashDetector.Report())
+	addKlogDump(err, c.RunConfig.Imagename)
+
+	return
+}
+
+// setupNetworkInterfaces sets up the tap device of the instance if there is one and
+// returns the function that turns it off
+func setupNetworkInterfaces(c *types.Config) (turnOff func() error, err error) {
 	tapDeviceName := c.RunConfig.TapName
 	bridged := c.RunConfig.Bridged
 	ipaddr := c.RunConfig.IPAddr
@@ -27,24 +106,91 @@ func RunLocalInstance(c *types.Config) (err error) {
 		bridgeName = "br0"
 	}
 
+	if tapDeviceName == "" {
+		return func() error { return nil }, nil
+	}
+
 	networkService := network.NewIprouteNetworkService()
 
-	if tapDeviceName != "" {
-		err = network.SetupNetworkInterfaces(networkService, tapDeviceName, bridgeName, ipaddr, netmask)
-		if err != nil {
-			return
-		}
+	err = network.SetupNetworkInterfaces(networkService, tapDeviceName, bridgeName, ipaddr, netmask)
+	if err != nil {
+		return
 	}
 
-	fmt.Printf("booting %s ...\n", c.RunConfig.Imagename)
-	hypervisor.Start(&c.RunConfig)
+	turnOff = func() error {
+		return network.TurnOffNetworkInterfaces(networkService, tapDeviceName, bridgeName)
+	}
 
-	if tapDeviceName != "" {
-		err = network.TurnOffNetworkInterfaces(networkService, tapDeviceName, bridgeName)
-		if err != nil {
-			return
+	return
+}
+
+// guestExitError interprets the error returned by the hypervisor and the crash found in
+// the guest output, it returns nil if the guest program exited successfully
+func guestExitError(err error, crash *api.CrashReport) error {
+	status, reported := qemu.GuestExitStatus(err)
+
+	if reported && (status == qemu.GuestExitFault || status == qemu.GuestExitHalt) {
+		if crash == nil {
+			crash = &api.CrashReport{Reason: "kernel halted"}
+			if status == qemu.GuestExitFault {
+				crash.Reason = "unhandled fault"
+			}
 		}
+		return &GuestExitError{Code: ExitCodeProgramCrash, Crash: crash}
 	}
 
-	return
+	if reported {
+		if status == 0 {
+			return nil
+		}
+		return &GuestExitError{Code: status}
+	}
+
+	if crash != nil {
+		return &GuestExitError{Code: ExitCodeProgramCrash, Crash: crash}
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == -1 {
+		return &GuestExitError{Code: ExitCodeInterrupted, Cause: err}
+	}
+
+	return &GuestExitError{Code: ExitCodeBootFailure, Cause: err}
+}
+
+// addKlogDump reads the kernel log dump of the image when the guest crashed or stopped
+// without exit status
+func addKlogDump(err error, imagePath string) {
+	var guestErr *GuestExitError
+	if !errors.As(err, &guestErr) {
+		return
+	}
+
+	if guestErr.Code != ExitCodeProgramCrash && guestErr.Code != ExitCodeBootFailure {
+		return
+	}
+
+	// the image may have no boot filesystem or may be gone, the dump is best effort
+	guestErr.Klog, _ = fs.ReadKlogDump(imagePath)
+}
+
+// exitWithGuestError exits with the guest exit status if the error is a GuestExitError
+// and with the default error handling otherwise
+func exitWithGuestError(err error) {
+	var guestErr *GuestExitError
+	if !errors.As(err, &guestErr) {
+		exitWithError(err.Error())
+	}
+
+	if guestErr.Crash != nil {
+		fmt.Print(guestErr.Crash.String())
+	} else if guestErr.Code == ExitCodeBootFailure || guestErr.Code == ExitCodeInterrupted {
+		fmt.Println(guestErr.Error())
+	}
+
+	if guestErr.Klog != nil {
+		fmt.Print(guestErr.Klog.String())
+	}
+
+	os.Exit(guestErr.Code)
 }
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nanovms/ops/constants"
+	"github.com/nanovms/ops/fs"
+	api "github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/qemu"
+	"github.com/nanovms/ops/types"
+)
+
+// watchInterval is the interval between checks for changes in the watched files
+var watchInterval = 500 * time.Millisecond
+
+// RunLocalInstanceWatch runs the program in a hypervisor, rebuilding the image and
+// restarting the hypervisor every time the program, its files or the config file
+// change. The manifest is built again only when the program or the config change or
+// when files are created or removed, the image of files whose content changed is
+// rebuilt with the same manifest. The tap device is kept up between restarts. It
+// returns when interrupted.
+func RunLocalInstanceWatch(c *types.Config, configPath string, reloadConfig func() (*types.Config, error)) (err error) {
+	hypervisor := qemu.HypervisorInstance()
+	if hypervisor == nil {
+		return fmt.Errorf("No hypervisor found on $PATH")
+	}
+
+	turnOffNetwork, err := setupNetworkInterfaces(c)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		turnOffErr := turnOffNetwork()
+		if err == nil {
+			err = turnOffErr
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	// the build directory holds the files generated for the manifest while it is reused
+	defer func() {
+		os.RemoveAll(c.BuildDir)
+	}()
+
+	var m *fs.Manifest
+
+	for {
+		watcher := api.NewFileWatcher(watchedPaths(c, configPath)...)
+
+		var instance *watchedInstance
+
+		m, err = buildWatchedImage(c, m)
+		if err != nil {
+			fmt.Printf(constants.ErrorColor, fmt.Sprintf("failed building image: %v\n", err))
+		} else {
+			instance, err = startWatchedInstance(hypervisor, c)
+			if err != nil {
+				fmt.Printf(constants.ErrorColor, fmt.Sprintf("failed booting instance: %v\n", err))
+			}
+		}
+
+		fmt.Println("watching for changes, press Ctrl-C to stop")
+
+	waitForChanges:
+		for {
+			select {
+			case <-signals:
+				instance.stop()
+				return nil
+			case exitErr := <-instance.exitedChan():
+				if guestErr := guestExitError(exitErr, instance.crashDetector.Report()); guestErr != nil {
+					fmt.Printf(constants.WarningColor, guestErr.Error()+"\n")
+
+					addKlogDump(guestErr, c.RunConfig.Imagename)
+					if klog := guestErr.(*GuestExitError).Klog; klog != nil {
+						fmt.Print(klog.String())
+					}
+				}
+				instance = nil
+				fmt.Println("instance stopped, waiting for changes")
+			case <-ticker.C:
+				created, modified, removed := watcher.Changes()
+				changed := append(append(append([]string{}, created...), modified...), removed...)
+				if len(changed) == 0 {
+					continue
+				}
+
+				sort.Strings(changed)
+				fmt.Printf("changed %s, restarting\n", strings.Join(changed, ", "))
+				instance.stop()
+				instance = nil
+
+				// the libraries of the program and the entries of the manifest may change
+				if len(created) > 0 || len(removed) > 0 || containsString(modified, c.ProgramPath) {
+					m = nil
+				}
+
+				if configPath != "" && containsString(changed, configPath) {
+					reloaded, reloadErr := reloadConfig()
+					if reloadErr != nil {
+						fmt.Printf(constants.ErrorColor, fmt.Sprintf("failed reloading config: %v\n", reloadErr))
+						continue
+					}
+					os.RemoveAll(c.BuildDir)
+					c = reloaded
+					m = nil
+				}
+
+				break waitForChanges
+			}
+		}
+	}
+}
+
+// buildWatchedImage builds the image of the config with the manifest, the manifest
+// is built first if it is nil. It returns the manifest to rebuild the image with.
+func buildWatchedImage(c *types.Config, m *fs.Manifest) (*fs.Manifest, error) {
+	if m == nil {
+		var err error
+		m, err = api.BuildManifest(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed building manifest: %v", err)
+		}
+	}
+
+	return m, api.BuildImageFromManifest(c, m)
+}
+
+// watchedInstance is a hypervisor started by the watch loop
+type watchedInstance struct {
+	cmd           *exec.Cmd
+	crashDetector *api.CrashDetector
+	exited        chan error
+}
+
+// startWatchedInstance starts the hypervisor without waiting for it to exit
+func startWatchedInstance(hypervisor qemu.Hypervisor, c *types.Config) (*watchedInstance, error) {
+	cmd, err := hypervisor.Command(&c.RunConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := &watchedInstance{
+		cmd:           cmd,
+		crashDetector: &api.CrashDetector{Trace: containsString(c.Debugflags, "trace")},
+		exited:        make(chan error, 1),
+	}
+
+	instance.cmd.Stdout = io.MultiWriter(os.Stdout, instance.crashDetector)
+	instance.cmd.Stderr = os.Stderr
+
+	// a dump read once the guest stopped was written by this boot
+	if err := fs.ClearKlogDump(c.RunConfig.Imagename); err != nil {
+		fmt.Printf("warning: %v\n", err)
+	}
+
+	fmt.Printf("booting %s ...\n", c.RunConfig.Imagename)
+	err = qemu.StartCommand(instance.cmd, &c.RunConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		err := instance.cmd.Wait()
+		if qemu.HasResourceLimits(&c.RunConfig) {
+			qemu.RemoveCgroup(instance.cmd.Process.Pid)
+		}
+		instance.exited <- err
+	}()
+
+	return instance, nil
+}
+
+// exitedChan returns the channel the hypervisor exit error is sent to, it is nil if
+// there is no hypervisor running so it blocks forever in a select
+func (i *watchedInstance) exitedChan() chan error {
+	if i == nil {
+		return nil
+	}
+	return i.exited
+}
+
+// stop kills the hypervisor if it is running and waits until it exits
+func (i *watchedInstance) stop() {
+	if i == nil {
+		return
+	}
+
+	i.cmd.Process.Kill()
+	<-i.exited
+}
+
+// watchedPaths returns the files that require rebuilding the image when they change
+func watchedPaths(c *types.Config, configPath string) []string {
+	paths := []string{c.ProgramPath}
+	paths = append(paths, c.Files...)
+	paths = append(paths, c.Dirs...)
+
+	for hostDir := range c.MapDirs {
+		paths = append(paths, hostDir)
+	}
+
+	if configPath != "" {
+		paths = append(paths, configPath)
+	}
+
+	return paths
+}
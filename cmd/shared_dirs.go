@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nanovms/ops/types"
+)
+
+// ParseSharedDirs parses host directories shared with the guest with the format
+// "hostdir:/guestpath". Each directory gets a unique tag the kernel mounts it with.
+func ParseSharedDirs(specs []string) ([]types.SharedDir, error) {
+	shares := []types.SharedDir{}
+	guestPaths := map[string]bool{}
+
+	for i, spec := range specs {
+		sep := strings.LastIndex(spec, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("share \"%s\" must have the format hostdir:/guestpath", spec)
+		}
+
+		hostDir, guestPath := spec[:sep], spec[sep+1:]
+		if !strings.HasPrefix(guestPath, "/") || guestPath == "/" {
+			return nil, fmt.Errorf("share \"%s\" guest path must be an absolute path other than /", spec)
+		}
+
+		if guestPaths[guestPath] {
+			return nil, fmt.Errorf("share \"%s\" guest path is already shared", spec)
+		}
+		guestPaths[guestPath] = true
+
+		hostDir, err := filepath.Abs(hostDir)
+		if err != nil {
+			return nil, err
+		}
+
+		// qemu options are separated by commas and arguments by whitespace
+		if strings.ContainsAny(hostDir, ", \t") {
+			return nil, fmt.Errorf("share \"%s\" host directory can not have commas or whitespace", spec)
+		}
+
+		info, err := os.Stat(hostDir)
+		if err != nil {
+			return nil, fmt.Errorf("share \"%s\": %v", spec, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("share \"%s\": %s is not a directory", spec, hostDir)
+		}
+
+		shares = append(shares, types.SharedDir{
+			HostDir:   hostDir,
+			GuestPath: guestPath,
+			Tag:       fmt.Sprintf("share%d", i),
+		})
+	}
+
+	return shares, nil
+}
+
+// UniqueShareTags renames the tags of the shared directories that are used by a
+// volume mount or by a previous share, the kernel mounts volumes and shares by their
+// labels in the manifest mounts. Shares are renamed with the first free share<n> tag.
+func UniqueShareTags(c *types.Config) {
+	used := map[string]bool{}
+	for label := range c.Mounts {
+		used[label] = true
+	}
+
+	var renamed []int
+	for i, share := range c.RunConfig.Shares {
+		if share.Tag == "" || used[share.Tag] {
+			renamed = append(renamed, i)
+			continue
+		}
+		used[share.Tag] = true
+	}
+
+	n := 0
+	for _, i := range renamed {
+		for used[fmt.Sprintf("share%d", n)] {
+			n++
+		}
+		c.RunConfig.Shares[i].Tag = fmt.Sprintf("share%d", n)
+		used[c.RunConfig.Shares[i].Tag] = true
+	}
+}
@@ -0,0 +1,78 @@
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/nanovms/ops/cmd"
+	"github.com/nanovms/ops/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSharedDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	assets := path.Join(dir, "assets")
+	templates := path.Join(dir, "templates")
+	os.Mkdir(assets, 0755)
+	os.Mkdir(templates, 0755)
+	ioutil.WriteFile(path.Join(dir, "file"), []byte{}, 0644)
+
+	t.Run("valid", func(t *testing.T) {
+		shares, err := cmd.ParseSharedDirs([]string{assets + ":/assets", templates + ":/app/templates"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []types.SharedDir{
+			{HostDir: assets, GuestPath: "/assets", Tag: "share0"},
+			{HostDir: templates, GuestPath: "/app/templates", Tag: "share1"},
+		}, shares)
+	})
+
+	invalid := []struct {
+		name  string
+		specs []string
+	}{
+		{"missing guest path", []string{assets}},
+		{"relative guest path", []string{assets + ":assets"}},
+		{"root guest path", []string{assets + ":/"}},
+		{"guest path shared twice", []string{assets + ":/assets", templates + ":/assets"}},
+		{"host directory missing", []string{path.Join(dir, "missing") + ":/assets"}},
+		{"host path is a file", []string{path.Join(dir, "file") + ":/assets"}},
+		{"host directory with comma", []string{path.Join(dir, "a,b") + ":/assets"}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cmd.ParseSharedDirs(tt.specs)
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestUniqueShareTags(t *testing.T) {
+	c := &types.Config{
+		Mounts: map[string]string{"share0": "/data"},
+		RunConfig: types.RunConfig{
+			Shares: []types.SharedDir{
+				{HostDir: "/a", GuestPath: "/a", Tag: "share0"},
+				{HostDir: "/b", GuestPath: "/b", Tag: "share1"},
+				{HostDir: "/c", GuestPath: "/c", Tag: "share1"},
+				{HostDir: "/d", GuestPath: "/d", Tag: "assets"},
+			},
+		},
+	}
+
+	cmd.UniqueShareTags(c)
+
+	var tags []string
+	for _, share := range c.RunConfig.Shares {
+		tags = append(tags, share.Tag)
+	}
+	assert.Equal(t, []string{"share2", "share1", "share3", "assets"}, tags)
+}
@@ -0,0 +1,369 @@
+// Package compose runs several unikernel services on a shared local bridge network.
+//
+// Services are described in a JSON compose file:
+//
+//	{
+//	  "Services": {
+//	    "db": {
+//	      "Package": "redis_5.0.5",
+//	      "Ports": ["6379"],
+//	      "WaitFor": "tcp:6379"
+//	    },
+//	    "web": {
+//	      "Program": "./web",
+//	      "Config": "web.json",
+//	      "Ports": ["8080"],
+//	      "Env": {"REDIS_ADDR": "db:6379"},
+//	      "DependsOn": ["db"],
+//	      "Replicas": 2
+//	    }
+//	  }
+//	}
+//
+// Paths in the compose file and in the configuration files of the services are
+// relative to the compose file directory, where the images are built.
+//
+// Every replica gets a static address in the project subnet and an /etc/hosts file
+// resolving the names of every service, so services find each other by name.
+package compose
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+// DefaultFile is the compose file used when none is specified
+const DefaultFile = "ops-compose.json"
+
+// DefaultSubnet is the network of the services when the compose file does not specify one
+const DefaultSubnet = "10.10.10.0/24"
+
+// bridgeHost is the last byte of the bridge address, see network.SetupNetworkInterfaces
+const bridgeHost = 66
+
+// maxInterfaceName is the maximum length of a network interface name
+const maxInterfaceName = 15
+
+var serviceNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Service is a unikernel built from a program or a package and run in one or more replicas
+type Service struct {
+	// Program is the path of the ELF binary
+	Program string
+
+	// Package is the name of the package run instead of a program
+	Package string
+
+	// LocalPackage loads the package from the local packages directory
+	LocalPackage bool
+
+	// Config is the path of the ops configuration file of the image
+	Config string
+
+	// Args are passed to the program
+	Args []string
+
+	// Ports are the ports the service listens on, reachable from the host at the
+	// address of every replica
+	Ports []string
+
+	// Volumes are mounted with the format <volume_id:mount_path>
+	Volumes []string
+
+	// Env is the environment of the program
+	Env map[string]string
+
+	// DependsOn are the services that must be ready before the service is booted
+	DependsOn []string
+
+	// WaitFor is the readiness probe dependent services wait for, see lepton.ParseReadinessProbe
+	WaitFor string
+
+	// Replicas is the number of instances of the service, one by default
+	Replicas int
+}
+
+// File describes the services of a compose project
+type File struct {
+	// Project names the instances and images of the services, it defaults to the
+	// name of the compose file directory
+	Project string
+
+	// Bridge is the name of the bridge the services are connected to
+	Bridge string
+
+	// Subnet is the network of the services in CIDR notation
+	Subnet string
+
+	Services map[string]*Service
+
+	// Dir is the directory of the compose file
+	Dir string `json:"-"`
+}
+
+// Load reads the compose file, applies the defaults and validates it
+func Load(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compose file: %v", err)
+	}
+
+	var f File
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("error compose file: %v", err)
+	}
+
+	f.Dir, err = filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	f.setDefaults()
+
+	err = f.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &f, nil
+}
+
+func (f *File) setDefaults() {
+	if f.Project == "" {
+		f.Project = filepath.Base(f.Dir)
+	}
+	f.Project = projectName(f.Project)
+
+	if f.Bridge == "" {
+		f.Bridge = defaultBridgeName(f.Project)
+	}
+
+	if f.Subnet == "" {
+		f.Subnet = DefaultSubnet
+	}
+
+	for _, s := range f.Services {
+		if s == nil {
+			continue
+		}
+
+		if s.Replicas == 0 {
+			s.Replicas = 1
+		}
+	}
+}
+
+// projectName converts the name to a valid host name prefix
+func projectName(name string) string {
+	name = strings.ToLower(name)
+	name = regexp.MustCompile(`[^a-z0-9-]+`).ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-")
+	if name == "" {
+		name = "compose"
+	}
+	return name
+}
+
+// defaultBridgeName returns a bridge name that leaves room for the tap suffixes
+func defaultBridgeName(project string) string {
+	name := "ops-" + project
+	if len(name) > maxInterfaceName-4 {
+		name = strings.TrimRight(name[:maxInterfaceName-4], "-")
+	}
+	return name
+}
+
+// Validate returns an error if the services can not be run
+func (f *File) Validate() error {
+	if len(f.Services) == 0 {
+		return errors.New("compose file has no services")
+	}
+
+	if len(f.Bridge) > maxInterfaceName-4 {
+		return fmt.Errorf("bridge name \"%s\" is too long, use %d characters at most", f.Bridge, maxInterfaceName-4)
+	}
+
+	for name, s := range f.Services {
+		if !serviceNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid service name \"%s\", use lowercase letters, digits and dashes", name)
+		}
+
+		if s == nil {
+			return fmt.Errorf("service \"%s\" is empty", name)
+		}
+
+		if (s.Program == "") == (s.Package == "") {
+			return fmt.Errorf("service \"%s\" requires either a program or a package", name)
+		}
+
+		if s.Replicas < 0 {
+			return fmt.Errorf("service \"%s\" has a negative number of replicas", name)
+		}
+
+		if s.WaitFor != "" {
+			if _, err := lepton.ParseReadinessProbe(s.WaitFor); err != nil {
+				return fmt.Errorf("service \"%s\": %v", name, err)
+			}
+		}
+
+		for _, dep := range s.DependsOn {
+			if _, ok := f.Services[dep]; !ok {
+				return fmt.Errorf("service \"%s\" depends on unknown service \"%s\"", name, dep)
+			}
+		}
+	}
+
+	_, err := f.Order()
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Replicas()
+	return err
+}
+
+// Order returns the service names sorted so that every service comes after its
+// dependencies, services without a dependency between them are sorted by name
+func (f *File) Order() ([]string, error) {
+	remaining := map[string]bool{}
+	for name := range f.Services {
+		remaining[name] = true
+	}
+
+	var order []string
+	for len(remaining) > 0 {
+		var ready []string
+		for name := range remaining {
+			blocked := false
+			for _, dep := range f.Services[name].DependsOn {
+				if remaining[dep] {
+					blocked = true
+					break
+				}
+			}
+			if !blocked {
+				ready = append(ready, name)
+			}
+		}
+
+		if len(ready) == 0 {
+			var cycle []string
+			for name := range remaining {
+				cycle = append(cycle, name)
+			}
+			sort.Strings(cycle)
+			return nil, fmt.Errorf("dependency cycle between services %s", strings.Join(cycle, ", "))
+		}
+
+		sort.Strings(ready)
+		for _, name := range ready {
+			delete(remaining, name)
+		}
+		order = append(order, ready...)
+	}
+
+	return order, nil
+}
+
+// Replica is an instance of a service
+type Replica struct {
+	Service string
+	Index   int
+
+	// Name is the name of the instance
+	Name string
+
+	IP      string
+	Gateway string
+	NetMask string
+
+	// Tap is the name of the tap device connecting the instance to the bridge
+	Tap string
+
+	Ports []string
+}
+
+// Replicas returns the instances of every service in dependency order with their
+// addresses assigned from the subnet
+func (f *File) Replicas() ([]Replica, error) {
+	_, subnet, err := net.ParseCIDR(f.Subnet)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet \"%s\": %v", f.Subnet, err)
+	}
+
+	base := subnet.IP.To4()
+	ones, bits := subnet.Mask.Size()
+	if base == nil || bits != 32 || ones > 24 || ones < 8 {
+		return nil, fmt.Errorf("invalid subnet \"%s\": an IPv4 network from /8 to /24 is required", f.Subnet)
+	}
+
+	gateway := make(net.IP, 4)
+	copy(gateway, base)
+	gateway[3] = bridgeHost
+
+	order, err := f.Order()
+	if err != nil {
+		return nil, err
+	}
+
+	var replicas []Replica
+	host := 2
+	for _, name := range order {
+		for i := 1; i <= f.Services[name].Replicas; i++ {
+			if host == bridgeHost {
+				host++
+			}
+			if host > 254 {
+				return nil, fmt.Errorf("subnet \"%s\" has not enough addresses for the services", f.Subnet)
+			}
+
+			ip := make(net.IP, 4)
+			copy(ip, base)
+			ip[3] = byte(host)
+			host++
+
+			replicas = append(replicas, Replica{
+				Service: name,
+				Index:   i,
+				Name:    fmt.Sprintf("%s-%s-%d", f.Project, name, i),
+				IP:      ip.String(),
+				Gateway: gateway.String(),
+				NetMask: net.IP(subnet.Mask).String(),
+				Tap:     fmt.Sprintf("%st%d", f.Bridge, len(replicas)),
+				Ports:   f.Services[name].Ports,
+			})
+		}
+	}
+
+	return replicas, nil
+}
+
+// Hosts returns the /etc/hosts entries resolving the service names, the replica
+// names (service-index) and the instance names to the replica addresses
+func Hosts(replicas []Replica) []string {
+	hosts := []string{"127.0.0.1 localhost"}
+	for _, r := range replicas {
+		hosts = append(hosts, fmt.Sprintf("%s %s %s-%d %s", r.IP, r.Service, r.Service, r.Index, r.Name))
+	}
+	return hosts
+}
+
+// ServiceReplicas returns the replicas of the service
+func ServiceReplicas(replicas []Replica, service string) (result []Replica) {
+	for _, r := range replicas {
+		if r.Service == service {
+			result = append(result, r)
+		}
+	}
+	return
+}
@@ -0,0 +1,176 @@
+package compose_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nanovms/ops/compose"
+)
+
+func writeComposeFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "My Project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, compose.DefaultFile)
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeComposeFile(t, `{
+		"Services": {
+			"web": {"Program": "./web", "DependsOn": ["db"], "Replicas": 2},
+			"db": {"Package": "redis_5.0.5", "WaitFor": "tcp:6379"}
+		}
+	}`)
+
+	f, err := compose.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(f.Project, "my-project") {
+		t.Errorf("project: got %q", f.Project)
+	}
+
+	if len(f.Bridge) > 11 || !strings.HasPrefix(f.Bridge, "ops-my") {
+		t.Errorf("bridge: got %q", f.Bridge)
+	}
+
+	if f.Subnet != compose.DefaultSubnet {
+		t.Errorf("subnet: got %q", f.Subnet)
+	}
+
+	if f.Services["db"].Replicas != 1 {
+		t.Errorf("db replicas: got %d", f.Services["db"].Replicas)
+	}
+
+	if f.Dir != filepath.Dir(path) {
+		t.Errorf("dir: got %q", f.Dir)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no services":         `{}`,
+		"invalid name":        `{"Services": {"Web_1": {"Program": "web"}}}`,
+		"program or package":  `{"Services": {"web": {}}}`,
+		"program and package": `{"Services": {"web": {"Program": "web", "Package": "node_v14.2.0"}}}`,
+		"unknown dependency":  `{"Services": {"web": {"Program": "web", "DependsOn": ["db"]}}}`,
+		"dependency cycle":    `{"Services": {"a": {"Program": "a", "DependsOn": ["b"]}, "b": {"Program": "b", "DependsOn": ["a"]}}}`,
+		"invalid probe":       `{"Services": {"web": {"Program": "web", "WaitFor": "port 80"}}}`,
+		"invalid subnet":      `{"Subnet": "10.0.0.0/30", "Services": {"web": {"Program": "web"}}}`,
+		"long bridge name":    `{"Bridge": "very-long-bridge", "Services": {"web": {"Program": "web"}}}`,
+		"too many replicas":   `{"Services": {"web": {"Program": "web", "Replicas": 300}}}`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := compose.Load(writeComposeFile(t, content)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	f := &compose.File{
+		Services: map[string]*compose.Service{
+			"web":    {Program: "web", DependsOn: []string{"api"}},
+			"api":    {Program: "api", DependsOn: []string{"db", "cache"}},
+			"db":     {Program: "db"},
+			"cache":  {Program: "cache"},
+			"worker": {Program: "worker", DependsOn: []string{"db"}},
+		},
+	}
+
+	order, err := f.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"cache", "db", "api", "worker", "web"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("got %v, want %v", order, expected)
+	}
+}
+
+func TestReplicas(t *testing.T) {
+	f := &compose.File{
+		Project: "shop",
+		Bridge:  "ops-shop",
+		Subnet:  "10.10.10.0/24",
+		Services: map[string]*compose.Service{
+			"web": {Program: "web", DependsOn: []string{"db"}, Replicas: 65, Ports: []string{"8080"}},
+			"db":  {Program: "db", Replicas: 1},
+		},
+	}
+
+	replicas, err := f.Replicas()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(replicas) != 66 {
+		t.Fatalf("got %d replicas", len(replicas))
+	}
+
+	db := replicas[0]
+	expected := compose.Replica{
+		Service: "db",
+		Index:   1,
+		Name:    "shop-db-1",
+		IP:      "10.10.10.2",
+		Gateway: "10.10.10.66",
+		NetMask: "255.255.255.0",
+		Tap:     "ops-shopt0",
+	}
+	if !reflect.DeepEqual(db, expected) {
+		t.Errorf("got %+v, want %+v", db, expected)
+	}
+
+	for _, r := range replicas {
+		if r.IP == r.Gateway {
+			t.Errorf("replica %s has the bridge address", r.Name)
+		}
+	}
+
+	last := replicas[len(replicas)-1]
+	if last.Name != "shop-web-65" || last.IP != "10.10.10.68" || last.Tap != "ops-shopt65" {
+		t.Errorf("got %+v", last)
+	}
+
+	if len(compose.ServiceReplicas(replicas, "web")) != 65 {
+		t.Error("expected 65 web replicas")
+	}
+}
+
+func TestHosts(t *testing.T) {
+	replicas := []compose.Replica{
+		{Service: "db", Index: 1, Name: "shop-db-1", IP: "10.10.10.2"},
+		{Service: "web", Index: 1, Name: "shop-web-1", IP: "10.10.10.3"},
+		{Service: "web", Index: 2, Name: "shop-web-2", IP: "10.10.10.4"},
+	}
+
+	expected := []string{
+		"127.0.0.1 localhost",
+		"10.10.10.2 db db-1 shop-db-1",
+		"10.10.10.3 web web-1 shop-web-1",
+		"10.10.10.4 web web-2 shop-web-2",
+	}
+
+	if hosts := compose.Hosts(replicas); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("got %v, want %v", hosts, expected)
+	}
+}
@@ -0,0 +1,107 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+// State records the instances of a project that is up, so they can be listed and stopped
+type State struct {
+	Project string
+
+	// File is the path of the compose file the project was started from
+	File string
+
+	Bridge   string
+	Subnet   string
+	Replicas []Replica
+}
+
+// LoadState returns the state of the project, it fails if the project is not up
+func LoadState(project string) (*State, error) {
+	var s State
+	err := lepton.ViewState(func(tx *lepton.StateTx) error {
+		found, err := tx.Get(lepton.StateNetworks, project, &s)
+		if err == nil && !found {
+			err = fmt.Errorf("project \"%s\" is not up", project)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// LoadStates returns the state of every project that is up
+func LoadStates() (states []State, err error) {
+	err = lepton.ViewState(func(tx *lepton.StateTx) (err error) {
+		states, err = loadStates(tx)
+		return
+	})
+
+	return
+}
+
+func loadStates(tx *lepton.StateTx) (states []State, err error) {
+	err = tx.ForEach(lepton.StateNetworks, func(key string, value []byte) error {
+		var s State
+		if err := json.Unmarshal(value, &s); err != nil {
+			return err
+		}
+		states = append(states, s)
+		return nil
+	})
+
+	return
+}
+
+// Save saves the state of the project, it fails if another project that is up took
+// its bridge or its subnet in the meantime
+func (s *State) Save() error {
+	return lepton.UpdateState(func(tx *lepton.StateTx) error {
+		states, err := loadStates(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, other := range states {
+			if other.Project != s.Project && (other.Bridge == s.Bridge || other.Subnet == s.Subnet) {
+				return fmt.Errorf("project \"%s\" uses the same bridge or subnet", other.Project)
+			}
+		}
+
+		return tx.Put(lepton.StateNetworks, s.Project, s)
+	})
+}
+
+// Remove removes the state of the project once it is down
+func (s *State) Remove() error {
+	return lepton.UpdateState(func(tx *lepton.StateTx) error {
+		return tx.Delete(lepton.StateNetworks, s.Project)
+	})
+}
+
+// CheckConflicts returns an error if another project that is up uses the bridge or
+// the subnet of the compose file
+func CheckConflicts(f *File) error {
+	states, err := LoadStates()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range states {
+		if s.Project == f.Project {
+			return fmt.Errorf("project \"%s\" is already up, run \"ops compose down\" first", f.Project)
+		}
+
+		if s.Bridge == f.Bridge || s.Subnet == f.Subnet {
+			return fmt.Errorf("project \"%s\" uses the same bridge or subnet, set another Bridge and Subnet in the compose file", s.Project)
+		}
+	}
+
+	return nil
+}
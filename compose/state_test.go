@@ -0,0 +1,75 @@
+package compose_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nanovms/ops/compose"
+)
+
+func TestState(t *testing.T) {
+	home, err := ioutil.TempDir("", "ops-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", oldHome)
+
+	f := &compose.File{Project: "shop", Bridge: "ops-shop", Subnet: "10.10.10.0/24"}
+
+	if _, err := compose.LoadState("shop"); err == nil {
+		t.Fatal("expected project not up error")
+	}
+
+	if err := compose.CheckConflicts(f); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &compose.State{
+		Project:  f.Project,
+		Bridge:   f.Bridge,
+		Subnet:   f.Subnet,
+		Replicas: []compose.Replica{{Service: "web", Index: 1, Name: "shop-web-1", IP: "10.10.10.2"}},
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := compose.LoadState("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Replicas) != 1 || loaded.Replicas[0].Name != "shop-web-1" {
+		t.Errorf("got %+v", loaded)
+	}
+
+	if err := compose.CheckConflicts(f); err == nil {
+		t.Error("expected project already up error")
+	}
+
+	other := &compose.File{Project: "blog", Bridge: "ops-blog", Subnet: "10.10.10.0/24"}
+	if err := compose.CheckConflicts(other); err == nil {
+		t.Error("expected subnet conflict error")
+	}
+
+	other.Subnet = "10.10.11.0/24"
+	if err := compose.CheckConflicts(other); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if err := loaded.Remove(); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := compose.LoadStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Errorf("expected no projects up, got %d", len(states))
+	}
+}
@@ -2,6 +2,7 @@ package digitalocean
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -208,15 +209,10 @@ func (do *DigitalOcean) StopInstance(ctx *lepton.Context, instancename string) e
 
 // GetInstanceLogs gets instance related logs
 func (do *DigitalOcean) GetInstanceLogs(ctx *lepton.Context, instancename string) (string, error) {
-	return "", nil
+	return "", errors.New("Unsupported")
 }
 
 // PrintInstanceLogs writes instance logs to console
-func (do *DigitalOcean) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := do.GetInstanceLogs(ctx, instancename)
-	if err != nil {
-		return err
-	}
-	fmt.Printf(l)
-	return nil
+func (do *DigitalOcean) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	return errors.New("Unsupported")
 }
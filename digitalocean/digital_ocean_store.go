@@ -2,6 +2,7 @@ package digitalocean
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -40,6 +41,38 @@ func (s *Spaces) getSignedURL(key string, bucket string, region string) string {
 	return presignedURL.String()
 }
 
+// getSignedPutURL returns a url the key of config's bucket can be uploaded to
+// until it expires
+func (s *Spaces) getSignedPutURL(config *types.Config, key string, expires time.Duration) (string, error) {
+	client, err := s.getMinioClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	presignedURL, err := client.PresignedPutObject(config.CloudConfig.BucketName, key, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return presignedURL.String(), nil
+}
+
+// readFromBucket returns the content of the key of config's bucket
+func (s *Spaces) readFromBucket(config *types.Config, key string) ([]byte, error) {
+	client, err := s.getMinioClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObject(config.CloudConfig.BucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return ioutil.ReadAll(object)
+}
+
 func (s *Spaces) getImageSpacesURL(config *types.Config, imageName string) string {
 	return fmt.Sprintf("https://%s.%s.digitaloceanspaces.com/%s", config.CloudConfig.BucketName, config.CloudConfig.Zone, imageName)
 }
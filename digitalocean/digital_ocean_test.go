@@ -12,6 +12,7 @@ import (
 
 	"github.com/digitalocean/godo"
 	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
 )
 
 var (
@@ -68,6 +69,53 @@ func TestDoGetImages(t *testing.T) {
 	}
 }
 
+func TestDoGetAllVolumes(t *testing.T) {
+	setup()
+	defer teardown()
+	mux.HandleFunc("/v2/volumes", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("region") != "nyc1" {
+			t.Errorf("got region %q", r.URL.Query().Get("region"))
+		}
+		fmt.Fprint(w, `{
+			"volumes": [
+				{
+					"id": "506f78a4-e098-11e5-ad9f-000f53306ae1",
+					"name": "data",
+					"size_gigabytes": 10,
+					"droplet_ids": [42, 43],
+					"created_at": "2020-09-04T06:50:46Z"
+				}
+			],
+			"meta": {
+				"total": 1
+			}
+		}`)
+	})
+	do := &DigitalOcean{
+		Client: client,
+	}
+	config := types.NewConfig()
+	config.CloudConfig.Zone = "nyc1"
+	volumes, err := do.GetAllVolumes(lepton.NewContext(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedResult := []lepton.NanosVolume{
+		{
+			ID:         "506f78a4-e098-11e5-ad9f-000f53306ae1",
+			Name:       "data",
+			Status:     "available",
+			Size:       10 * lepton.GiB,
+			CreatedAt:  "2020-09-04 06:50:46 +0000 UTC",
+			AttachedTo: "42;43",
+		},
+	}
+	if !reflect.DeepEqual(*volumes, expectedResult) {
+		t.Errorf("got %+v", *volumes)
+	}
+}
+
 func setup() {
 	mux = http.NewServeMux()
 	server = httptest.NewServer(mux)
@@ -1,29 +1,279 @@
 package digitalocean
 
-import "github.com/nanovms/ops/lepton"
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
-// CreateVolume is a stub to satisfy VolumeService interface
-func (do *DigitalOcean) CreateVolume(ctx *lepton.Context, name, data, size, provider string) (lepton.NanosVolume, error) {
-	var vol lepton.NanosVolume
-	return vol, nil
+	"github.com/digitalocean/godo"
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
+)
+
+// volumeWriterImage and volumeWriterSize are the distribution image and size of the
+// droplet that writes the volume built by ops to the block storage volume, volumes
+// can not be uploaded and are created empty
+const (
+	volumeWriterImage = "ubuntu-22-04-x64"
+	volumeWriterSize  = "s-1vcpu-1gb"
+)
+
+// volumeWriterTimeout limits the time the writer droplet takes to boot, write the
+// volume and power off
+const volumeWriterTimeout = 15 * time.Minute
+
+// volumeWriterScript is the user data of the writer droplet, it downloads the
+// volume from Spaces and writes it to the attached block storage volume. The droplet
+// uploads the status of the write and powers off when the script exits, on errors too.
+const volumeWriterScript = `#!/bin/sh
+status=failed
+trap "curl -sSf -X PUT --data \$status '%[3]s' || true; poweroff" EXIT
+set -e
+dev=/dev/disk/by-id/scsi-0DO_Volume_%[1]s
+while [ ! -e $dev ]; do sleep 1; done
+curl -sSfL -o /tmp/volume.raw '%[2]s'
+dd if=/tmp/volume.raw of=$dev bs=1M conv=fsync
+status=written
+`
+
+// volumeWrittenStatus is the status the writer droplet uploads once the volume is written
+const volumeWrittenStatus = "written"
+
+// CreateVolume builds the volume locally, uploads it to Spaces and writes it to a
+// new block storage volume from a temporary droplet the volume is attached to. The
+// local and the block storage volume are deleted if the volume is not written.
+func (do *DigitalOcean) CreateVolume(ctx *lepton.Context, name, data, size, provider string) (lv lepton.NanosVolume, err error) {
+	config := ctx.Config()
+
+	lv, err = lepton.CreateLocalVolume(config, name, data, size, provider)
+	if err != nil {
+		return lv, err
+	}
+	defer func() {
+		if err != nil {
+			lepton.DeleteLocalVolume(lv)
+		}
+	}()
+
+	// the volume is uploaded with the name of the volume as key
+	dir, err := ioutil.TempDir("", "ops-volume")
+	if err != nil {
+		return lv, err
+	}
+	defer os.RemoveAll(dir)
+
+	key := name + ".raw"
+	link := filepath.Join(dir, key)
+	err = os.Symlink(lv.Path, link)
+	if err != nil {
+		return lv, err
+	}
+
+	err = do.Storage.CopyToBucket(config, link)
+	if err != nil {
+		return lv, err
+	}
+	defer do.Storage.DeleteFromBucket(config, key)
+
+	volume, _, err := do.Client.Storage.CreateVolume(context.TODO(), &godo.VolumeCreateRequest{
+		Region:        config.CloudConfig.Zone,
+		Name:          name,
+		SizeGigaBytes: lv.Size.GB(),
+		Tags:          []string{opsTag},
+	})
+	if err != nil {
+		return lv, err
+	}
+	defer func() {
+		if err != nil {
+			do.deleteUnwrittenVolume(volume)
+		}
+	}()
+
+	signedURL := do.Storage.getSignedURL(key, config.CloudConfig.BucketName, config.CloudConfig.Zone)
+	if signedURL == "" {
+		return lv, fmt.Errorf("cannot sign url of volume %s", key)
+	}
+
+	err = do.writeVolume(config, volume, signedURL)
+	if err != nil {
+		return lv, err
+	}
+
+	lv.ID = volume.ID
+	lv.Status = "available"
+	return lv, nil
+}
+
+// writeVolume writes the volume at the url to the block storage volume from a
+// droplet created for it, the droplet is deleted once it powered off and the volume
+// is written if the droplet uploaded the written status
+func (do *DigitalOcean) writeVolume(config *types.Config, volume *godo.Volume, url string) error {
+	statusKey := volume.Name + ".status"
+	statusURL, err := do.Storage.getSignedPutURL(config, statusKey, volumeWriterTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot sign status url of volume %s: %v", volume.Name, err)
+	}
+	defer do.Storage.DeleteFromBucket(config, statusKey)
+
+	droplet, _, err := do.Client.Droplets.Create(context.TODO(), &godo.DropletCreateRequest{
+		Name:     volume.Name + "-writer",
+		Region:   config.CloudConfig.Zone,
+		Size:     volumeWriterSize,
+		Image:    godo.DropletCreateImage{Slug: volumeWriterImage},
+		UserData: fmt.Sprintf(volumeWriterScript, volume.Name, url, statusURL),
+		Volumes:  []godo.DropletCreateVolume{{ID: volume.ID}},
+		Tags:     []string{opsTag},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create droplet writing volume %s: %v", volume.Name, err)
+	}
+	defer do.Client.Droplets.Delete(context.TODO(), droplet.ID)
+
+	deadline := time.Now().Add(volumeWriterTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(10 * time.Second)
+
+		droplet, _, err = do.Client.Droplets.Get(context.TODO(), droplet.ID)
+		if err != nil {
+			return err
+		}
+		if droplet.Status != "off" {
+			continue
+		}
+
+		status, err := do.Storage.readFromBucket(config, statusKey)
+		if err != nil {
+			return fmt.Errorf("cannot read status of droplet %s writing volume %s: %v", droplet.Name, volume.Name, err)
+		}
+		if strings.TrimSpace(string(status)) != volumeWrittenStatus {
+			return fmt.Errorf("droplet %s failed writing volume %s", droplet.Name, volume.Name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("droplet %s did not write volume %s after %v", droplet.Name, volume.Name, volumeWriterTimeout)
 }
 
-// GetAllVolumes is a stub to satisfy VolumeService interface
+// deleteUnwrittenVolume deletes the block storage volume that was not written, the
+// volume is detached from the deleted writer droplet in the background so the
+// deletion is retried until the volume writer timeout
+func (do *DigitalOcean) deleteUnwrittenVolume(volume *godo.Volume) {
+	var err error
+	deadline := time.Now().Add(volumeWriterTimeout)
+	for time.Now().Before(deadline) {
+		_, err = do.Client.Storage.DeleteVolume(context.TODO(), volume.ID)
+		if err == nil {
+			return
+		}
+		time.Sleep(10 * time.Second)
+	}
+
+	fmt.Printf("cannot delete volume %s: %v\n", volume.Name, err)
+}
+
+// GetAllVolumes returns the block storage volumes of the region
 func (do *DigitalOcean) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error) {
-	return nil, nil
+	vols := &[]lepton.NanosVolume{}
+
+	list, _, err := do.Client.Storage.ListVolumes(context.TODO(), &godo.ListVolumeParams{
+		Region:      ctx.Config().CloudConfig.Zone,
+		ListOptions: &godo.ListOptions{PerPage: 200},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, volume := range list {
+		var droplets []string
+		for _, id := range volume.DropletIDs {
+			droplets = append(droplets, strconv.Itoa(id))
+		}
+
+		*vols = append(*vols, lepton.NanosVolume{
+			ID:         volume.ID,
+			Name:       volume.Name,
+			Status:     "available",
+			Size:       lepton.VolumeSize(volume.SizeGigaBytes) * lepton.GiB,
+			CreatedAt:  volume.CreatedAt.String(),
+			AttachedTo: strings.Join(droplets, ";"),
+		})
+	}
+
+	return vols, nil
 }
 
-// DeleteVolume is a stub to satisfy VolumeService interface
+// DeleteVolume deletes the block storage volume with the name or id
 func (do *DigitalOcean) DeleteVolume(ctx *lepton.Context, name string) error {
-	return nil
+	volume, err := do.getVolume(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = do.Client.Storage.DeleteVolume(context.TODO(), volume.ID)
+	return err
 }
 
-// AttachVolume is a stub to satisfy VolumeService interface
+// AttachVolume attaches the block storage volume to the droplet
 func (do *DigitalOcean) AttachVolume(ctx *lepton.Context, image, name string) error {
-	return nil
+	volume, dropletID, err := do.getVolumeAndDroplet(ctx, image, name)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = do.Client.StorageActions.Attach(context.TODO(), volume.ID, dropletID)
+	return err
 }
 
-// DetachVolume is a stub to satisfy VolumeService interface
+// DetachVolume detaches the block storage volume from the droplet
 func (do *DigitalOcean) DetachVolume(ctx *lepton.Context, image, name string) error {
-	return nil
+	volume, dropletID, err := do.getVolumeAndDroplet(ctx, image, name)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = do.Client.StorageActions.DetachByDropletID(context.TODO(), volume.ID, dropletID)
+	return err
+}
+
+func (do *DigitalOcean) getVolume(ctx *lepton.Context, name string) (*godo.Volume, error) {
+	list, _, err := do.Client.Storage.ListVolumes(context.TODO(), &godo.ListVolumeParams{
+		Region:      ctx.Config().CloudConfig.Zone,
+		ListOptions: &godo.ListOptions{PerPage: 200},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, volume := range list {
+		if volume.Name == name || volume.ID == name {
+			return &volume, nil
+		}
+	}
+
+	return nil, fmt.Errorf(`volume "%s" not found`, name)
+}
+
+func (do *DigitalOcean) getVolumeAndDroplet(ctx *lepton.Context, instanceName, name string) (*godo.Volume, int, error) {
+	volume, err := do.getVolume(ctx, name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	droplet, err := do.GetInstanceByID(ctx, instanceName)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dropletID, err := strconv.Atoi(droplet.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return volume, dropletID, nil
 }
@@ -0,0 +1,77 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// imageHashSize is the number of bytes of the hash kept, its hex string fits in
+// the 63 characters of a GCP label value
+const imageHashSize = 16
+
+// ImageHash returns the content hash of an image or volume. Filesystems get a
+// random uuid each time they are written, the uuids are hashed as zeros so that
+// building the same files twice gives the same hash.
+func ImageHash(imagePath string) (string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	offsets := []uint64{0}
+	if bootFSOffset, err := partitionOffset(f, partitionBootFS); err == nil {
+		rootFSOffset, _ := partitionOffset(f, partitionRootFS)
+		offsets = []uint64{bootFSOffset, rootFSOffset}
+	}
+
+	var uuids []int64
+	for _, offset := range offsets {
+		if uuid, ok := uuidOffset(f, offset); ok {
+			uuids = append(uuids, uuid)
+		}
+	}
+
+	h := sha256.New()
+	buf := make([]byte, 1024*sectorSize)
+	var pos int64
+	for {
+		n, err := f.Read(buf)
+		chunk := buf[:n]
+		for _, uuid := range uuids {
+			for i := uuid; i < uuid+tfsUUIDSize; i++ {
+				if i >= pos && i < pos+int64(n) {
+					chunk[i-pos] = 0
+				}
+			}
+		}
+		h.Write(chunk)
+		pos += int64(n)
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)[:imageHashSize]), nil
+}
+
+// uuidOffset returns the offset in the image of the uuid of the filesystem at
+// imgOffset, if there is a filesystem
+func uuidOffset(r io.ReaderAt, imgOffset uint64) (int64, bool) {
+	sector := make([]byte, sectorSize)
+	if _, err := r.ReadAt(sector, int64(imgOffset)); err != nil {
+		return 0, false
+	}
+
+	b := &logBuffer{data: sector}
+	if err := b.readLogHeader(); err != nil {
+		return 0, false
+	}
+
+	return int64(imgOffset) + int64(b.pos), true
+}
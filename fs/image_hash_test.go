@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// testBootSector returns a boot sector mkfs writes images with, with an empty
+// filesystem region
+func testBootSector() []byte {
+	boot := testMBR(nil)
+	parts := sectorSize - 2 - 4*partitionEntrySize
+	binary.LittleEndian.PutUint32(boot[parts-4:], regionFilesystem)
+	return boot
+}
+
+func writeHashTestImage(t *testing.T, dir, name, content string) string {
+	bootPath := path.Join(dir, "boot.img")
+	if err := ioutil.WriteFile(bootPath, testBootSector(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	kernel := path.Join(dir, "kernel.img")
+	if err := ioutil.WriteFile(kernel, []byte("kernel"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	program := path.Join(dir, "program")
+	if err := ioutil.WriteFile(program, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManifest("")
+	m.AddKernel(kernel)
+	m.AddUserProgram(program)
+	m.AddEnvironmentVariable("USER", "nanovms")
+	m.AddEnvironmentVariable("PWD", "/")
+	m.AddArgument("program")
+	m.AddArgument("-v")
+
+	image := path.Join(dir, name)
+	mkfs := NewMkfsCommand(m)
+	mkfs.SetBoot(bootPath)
+	mkfs.SetFileSystemPath(image)
+	if err := mkfs.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	return image
+}
+
+func TestImageHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hash := func(imagePath string) string {
+		h, err := ImageHash(imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	t.Run("image", func(t *testing.T) {
+		first := hash(writeHashTestImage(t, dir, "first.img", "program"))
+		if len(first) != 2*imageHashSize {
+			t.Errorf("invalid hash %s", first)
+		}
+
+		if second := hash(writeHashTestImage(t, dir, "second.img", "program")); second != first {
+			t.Errorf("same image: got %s want %s", second, first)
+		}
+
+		if changed := hash(writeHashTestImage(t, dir, "changed.img", "changed")); changed == first {
+			t.Error("changed image: got the same hash")
+		}
+	})
+
+	t.Run("volume", func(t *testing.T) {
+		files := map[string]string{"a.txt": "hello", "sub/b.txt": "world"}
+		first := hash(writeTestVolume(t, path.Join(dir, "first"), files))
+		if second := hash(writeTestVolume(t, path.Join(dir, "second"), files)); second != first {
+			t.Errorf("same volume: got %s want %s", second, first)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := ImageHash(path.Join(dir, "missing.img")); err == nil {
+			t.Error("expected error for a missing image")
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// klogDumpMagic starts the kernel log dump written by the kernel when it crashes
+const klogDumpMagic = "KLOG"
+
+// klogDumpHeaderSize is the size of the header of the dump, struct klog_dump of the
+// kernel (src/kernel/klog.h) starts with the magic and header fields that are not
+// decoded, the messages follow the header
+const klogDumpHeaderSize = 16
+
+// KlogDump is the kernel log saved in the image after a crash
+type KlogDump struct {
+	// Messages is the end of the kernel log, the oldest messages are dropped
+	Messages string
+}
+
+// String returns the dump in the format printed on the console
+func (d *KlogDump) String() string {
+	var sb strings.Builder
+	sb.WriteString("kernel log dump:\n")
+	sb.WriteString(d.Messages)
+	if !strings.HasSuffix(d.Messages, "\n") {
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ReadKlogDump reads the kernel log dump of the image, it returns nil if the kernel
+// did not write a dump
+func ReadKlogDump(imagePath string) (*KlogDump, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	offset, err := klogDumpOffset(f)
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate kernel log dump of %s: %v", imagePath, err)
+	}
+
+	dump := make([]byte, klogDumpSize)
+	_, err = f.ReadAt(dump, offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read kernel log dump of %s: %v", imagePath, err)
+	}
+
+	return decodeKlogDump(dump), nil
+}
+
+// ClearKlogDump zeroes the kernel log dump of the image so a dump read after the
+// image was booted was written by that boot, images without dump region are left as is
+func ClearKlogDump(imagePath string) error {
+	f, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := klogDumpOffset(f)
+	if err != nil {
+		return nil
+	}
+
+	magic := make([]byte, len(klogDumpMagic))
+	_, err = f.ReadAt(magic, offset)
+	if err != nil || string(magic) != klogDumpMagic {
+		return err
+	}
+
+	_, err = f.WriteAt(make([]byte, klogDumpSize), offset)
+	if err != nil {
+		return fmt.Errorf("cannot clear kernel log dump of %s: %v", imagePath, err)
+	}
+
+	return nil
+}
+
+// klogDumpOffset returns the offset of the kernel log dump, which is written
+// right before the boot filesystem
+func klogDumpOffset(r io.ReaderAt) (int64, error) {
+	bootFSOffset, err := partitionOffset(r, partitionBootFS)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := int64(bootFSOffset) - klogDumpSize
+	if offset < sectorSize {
+		return 0, fmt.Errorf("image has no boot filesystem")
+	}
+
+	return offset, nil
+}
+
+// decodeKlogDump decodes the dump region, it returns nil if the region has no dump
+func decodeKlogDump(dump []byte) *KlogDump {
+	if len(dump) < klogDumpHeaderSize || string(dump[:4]) != klogDumpMagic {
+		return nil
+	}
+
+	d := &KlogDump{}
+
+	msgs := dump[klogDumpHeaderSize:]
+	if end := bytes.IndexByte(msgs, 0); end != -1 {
+		msgs = msgs[:end]
+	}
+	d.Messages = string(msgs)
+
+	return d
+}
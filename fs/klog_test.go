@@ -0,0 +1,121 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// testMBR returns a master boot record with the partition at the offset with the
+// length, in bytes, for each partition index in partitions
+func testMBR(partitions map[int][2]uint64) []byte {
+	mbr := make([]byte, sectorSize)
+	mbr[sectorSize-2], mbr[sectorSize-1] = 0x55, 0xAA
+	parts := sectorSize - 2 - 4*partitionEntrySize
+	for index, partition := range partitions {
+		entry := mbr[parts+index*partitionEntrySize : parts+(index+1)*partitionEntrySize]
+		writePartition(entry, true, 0x83, partition[0], partition[1])
+	}
+	return mbr
+}
+
+func writeKlogTestImage(t *testing.T, dump []byte) string {
+	f, err := ioutil.TempFile("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	bootFSOffset := uint64(64 * sectorSize)
+	mbr := testMBR(map[int][2]uint64{partitionBootFS: {bootFSOffset, bootFSSize}})
+
+	if _, err := f.WriteAt(mbr, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(dump, int64(bootFSOffset)-klogDumpSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(int64(bootFSOffset)); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func TestReadKlogDump(t *testing.T) {
+	t.Run("dump", func(t *testing.T) {
+		dump := make([]byte, klogDumpSize)
+		copy(dump, klogDumpMagic)
+		copy(dump[klogDumpHeaderSize:], "en1: assigned 10.0.2.15\npage fault\x00stale")
+
+		d, err := ReadKlogDump(writeKlogTestImage(t, dump))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d == nil {
+			t.Fatal("dump not found")
+		}
+
+		if d.Messages != "en1: assigned 10.0.2.15\npage fault" {
+			t.Errorf("messages: got %q", d.Messages)
+		}
+	})
+
+	t.Run("no dump", func(t *testing.T) {
+		d, err := ReadKlogDump(writeKlogTestImage(t, make([]byte, klogDumpSize)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != nil {
+			t.Errorf("got %+v", d)
+		}
+	})
+
+	t.Run("no partition table", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "klog")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Truncate(sectorSize)
+		f.Close()
+
+		if _, err := ReadKlogDump(f.Name()); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestClearKlogDump(t *testing.T) {
+	dump := make([]byte, klogDumpSize)
+	copy(dump, klogDumpMagic)
+	copy(dump[klogDumpHeaderSize:], "page fault")
+	imagePath := writeKlogTestImage(t, dump)
+
+	if err := ClearKlogDump(imagePath); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := ReadKlogDump(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != nil {
+		t.Errorf("dump not cleared: %+v", d)
+	}
+
+	t.Run("no partition table", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "klog")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Truncate(sectorSize)
+		f.Close()
+
+		if err := ClearKlogDump(f.Name()); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -180,8 +180,11 @@ func (m *MkfsCommand) Execute() error {
 
 // GetUUID returns the uuid of file system built
 func (m *MkfsCommand) GetUUID() string {
-	uuid := m.rootTfs.uuid
+	return uuidString(m.rootTfs.uuid)
+}
 
+// uuidString formats the uuid of a filesystem
+func uuidString(uuid [16]byte) string {
 	/* UUID format: 00112233-4455-6677-8899-aabbccddeeff */
 	var uuidStr string
 	for i := 0; i < 4; i++ {
@@ -247,6 +250,24 @@ func writeMBR(imgFile *os.File) error {
 	return nil
 }
 
+// partitionOffset returns the offset of the partition of the image from its MBR
+func partitionOffset(r io.ReaderAt, partition int) (uint64, error) {
+	mbr := make([]byte, sectorSize)
+	_, err := r.ReadAt(mbr, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if (mbr[sectorSize-2] != 0x55) || (mbr[sectorSize-1] != 0xAA) {
+		return 0, fmt.Errorf("invalid MBR signature")
+	}
+
+	parts := sectorSize - 2 - 4*partitionEntrySize
+	part := mbr[parts+partition*partitionEntrySize : parts+(partition+1)*partitionEntrySize]
+
+	return uint64(binary.LittleEndian.Uint32(part[8:12])) * sectorSize, nil
+}
+
 func writePartition(part []byte, active bool, pType uint8, offset uint64, size uint64) {
 	if active {
 		part[0] = 0x80
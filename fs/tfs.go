@@ -6,6 +6,7 @@ import (
 	"math/bits"
 	"math/rand"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -101,7 +102,8 @@ func (t *tfs) writeDirEntries(dir map[string]interface{}) error {
 	var err error
 	t.encodeSymbol("children")
 	t.encodeTupleHeader(len(dir))
-	for k, v := range dir {
+	for _, k := range sortedKeys(dir) {
+		v := dir[k]
 		nvalue, nok := v.(link)
 		if nok {
 			err = t.writeLink(k, nvalue.path)
@@ -161,11 +163,22 @@ func (t *tfs) encodeTupleHeader(tupleEntries int) {
 
 func (t *tfs) encodeTuple(tuple map[string]interface{}) {
 	t.encodeTupleHeader(len(tuple))
-	for k, v := range tuple {
-		t.encodeMetadata(k, v)
+	for _, k := range sortedKeys(tuple) {
+		t.encodeMetadata(k, tuple[k])
 	}
 }
 
+// sortedKeys returns the keys of the tuple in order, so the same manifest always
+// writes the same log
+func sortedKeys(tuple map[string]interface{}) []string {
+	keys := make([]string, 0, len(tuple))
+	for k := range tuple {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func (t *tfs) encodeString(s string) {
 	t.pushHeader(entryImmediate, typeBuffer, len(s))
 	t.staging = append(t.staging, s...)
@@ -363,7 +376,8 @@ func tfsWrite(imgFile *os.File, imgOffset uint64, fsSize uint64, label string, r
 		return nil, fmt.Errorf("cannot create filesystem log: %v", err)
 	}
 	tfs.encodeTupleHeader(len(root))
-	for k, v := range root {
+	for _, k := range sortedKeys(root) {
+		v := root[k]
 		if k == "children" {
 			err = tfs.writeDirEntries(v.(map[string]interface{}))
 			if err != nil {
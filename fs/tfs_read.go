@@ -0,0 +1,646 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxLogExtensions limits the log extensions read, a loop of links is a corrupted log
+const maxLogExtensions = 1 << 16
+
+// tfsReader decodes the log of a filesystem written by tfsWrite or by the kernel
+type tfsReader struct {
+	imgFile    io.ReaderAt
+	imgOffset  uint64
+	dictionary map[int]interface{}
+	root       map[string]interface{}
+
+	// logEnd is the image offset of the end of the log and logLimit the end of its
+	// last extension, records are appended between them
+	logEnd   int64
+	logLimit int64
+}
+
+// logBuffer is the content of a log extension being decoded
+type logBuffer struct {
+	data []byte
+	pos  int
+}
+
+func (b *logBuffer) readByte() (byte, error) {
+	if b.pos >= len(b.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	c := b.data[b.pos]
+	b.pos++
+	return c, nil
+}
+
+// readVarint decodes values written by appendVarint, most significant bits first
+func (b *logBuffer) readVarint() (uint, error) {
+	var x uint
+	for i := 0; i < maxVarintSize; i++ {
+		c, err := b.readByte()
+		if err != nil {
+			return 0, err
+		}
+		x = (x << 7) | uint(c&0x7f)
+		if c&0x80 == 0 {
+			return x, nil
+		}
+	}
+	return 0, errors.New("invalid varint")
+}
+
+func (b *logBuffer) readBytes(n int) ([]byte, error) {
+	if n < 0 || b.pos+n > len(b.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return data, nil
+}
+
+var errNoFilesystem = errors.New("no filesystem")
+
+// readLogHeader decodes the magic, version and extension size at the start of the
+// log, the uuid follows
+func (b *logBuffer) readLogHeader() error {
+	magic, _ := b.readBytes(len(tfsMagic))
+	if string(magic) != tfsMagic {
+		return errNoFilesystem
+	}
+	if _, err := b.readVarint(); err != nil {
+		return err
+	}
+	_, err := b.readVarint()
+	return err
+}
+
+// readHeader decodes the headers written by pushHeader
+func (b *logBuffer) readHeader() (entry byte, dataType byte, length int, err error) {
+	first, err := b.readByte()
+	if err != nil {
+		return
+	}
+
+	entry = first >> 7
+	dataType = (first >> 6) & 1
+	length = int(first & 0x1f)
+
+	if first&(1<<5) != 0 {
+		for {
+			var c byte
+			c, err = b.readByte()
+			if err != nil {
+				return
+			}
+			length = (length << 7) | int(c&0x7f)
+			if c&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// readLogExtension reads the extension at the sector offset and skips its header
+func (t *tfsReader) readLogExtension(sector uint64, initial bool) (*logBuffer, error) {
+	header := make([]byte, sectorSize)
+	_, err := t.imgFile.ReadAt(header, int64(t.imgOffset+sector*sectorSize))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read log extension: %v", err)
+	}
+
+	b := &logBuffer{data: header}
+	magic, _ := b.readBytes(len(tfsMagic))
+	if string(magic) != tfsMagic {
+		return nil, errors.New("invalid filesystem magic")
+	}
+
+	version, err := b.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if version != tfsVersion {
+		return nil, fmt.Errorf("unsupported filesystem version %d", version)
+	}
+
+	sectors, err := b.readVarint()
+	if err != nil {
+		return nil, err
+	}
+
+	if sectors > 1 {
+		b.data = make([]byte, sectors*sectorSize)
+		_, err = t.imgFile.ReadAt(b.data, int64(t.imgOffset+sector*sectorSize))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read log extension: %v", err)
+		}
+	}
+
+	if initial {
+		// uuid and label
+		if _, err := b.readBytes(tfsUUIDSize); err != nil {
+			return nil, err
+		}
+		end := bytes.IndexByte(b.data[b.pos:], 0)
+		if end == -1 {
+			return nil, errors.New("invalid filesystem label")
+		}
+		b.pos += end + 1
+	}
+
+	return b, nil
+}
+
+// tfsUUIDSize is the size of the uuid in the initial log extension
+const tfsUUIDSize = 16
+
+// readLog decodes the records of the log following the extension links
+func (t *tfsReader) readLog() error {
+	var sector uint64
+	b, err := t.readLogExtension(sector, true)
+	if err != nil {
+		return err
+	}
+
+	var record []byte
+	var recordLength uint
+
+	for extensions := 0; extensions < maxLogExtensions; {
+		recordType, err := b.readByte()
+		if err != nil {
+			return err
+		}
+
+		switch recordType {
+		case endOfLog, 0:
+			extOffset := int64(t.imgOffset + sector*sectorSize)
+			t.logEnd = extOffset + int64(b.pos-1)
+			t.logLimit = extOffset + int64(len(b.data))
+			return nil
+		case endOfSegment:
+			continue
+		case logExtensionLink:
+			linkSector, err := b.readVarint()
+			if err != nil {
+				return err
+			}
+			if _, err := b.readVarint(); err != nil {
+				return err
+			}
+			sector = uint64(linkSector)
+			b, err = t.readLogExtension(sector, false)
+			if err != nil {
+				return err
+			}
+			extensions++
+		case tupleAvailable, tupleExtended:
+			if recordType == tupleAvailable {
+				recordLength, err = b.readVarint()
+				if err != nil {
+					return err
+				}
+				record = make([]byte, 0, recordLength)
+			}
+
+			length, err := b.readVarint()
+			if err != nil {
+				return err
+			}
+			data, err := b.readBytes(int(length))
+			if err != nil {
+				return err
+			}
+			record = append(record, data...)
+
+			if uint(len(record)) >= recordLength {
+				err = t.decodeRecord(record)
+				if err != nil {
+					return err
+				}
+				record = nil
+			}
+		default:
+			return fmt.Errorf("unsupported log record type %d", recordType)
+		}
+	}
+
+	return errors.New("too many log extensions")
+}
+
+// decodeRecord decodes the tuples of a record, the first tuple of the log is the
+// root and later records update the tuples they reference
+func (t *tfsReader) decodeRecord(record []byte) error {
+	b := &logBuffer{data: record}
+	for b.pos < len(b.data) {
+		value, err := t.decodeValue(b)
+		if err != nil {
+			return fmt.Errorf("cannot decode filesystem log: %v", err)
+		}
+
+		if tuple, ok := value.(map[string]interface{}); ok && t.root == nil {
+			t.root = tuple
+		}
+	}
+	return nil
+}
+
+func (t *tfsReader) addToDictionary(value interface{}) {
+	t.dictionary[len(t.dictionary)+1] = value
+}
+
+func (t *tfsReader) decodeValue(b *logBuffer) (interface{}, error) {
+	entry, dataType, length, err := b.readHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if dataType == typeBuffer {
+		if entry == entryReference {
+			value, ok := t.dictionary[length]
+			if !ok {
+				return nil, fmt.Errorf("reference %d not found", length)
+			}
+			return value, nil
+		}
+
+		data, err := b.readBytes(length)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+
+	var tuple map[string]interface{}
+	if entry == entryImmediate {
+		tuple = make(map[string]interface{})
+		t.addToDictionary(tuple)
+	} else {
+		index, err := b.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		tuple, ok = t.dictionary[int(index)].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tuple %d not found", index)
+		}
+	}
+
+	for i := 0; i < length; i++ {
+		entry, _, symLength, err := b.readHeader()
+		if err != nil {
+			return nil, err
+		}
+
+		var name string
+		if entry == entryImmediate {
+			data, err := b.readBytes(symLength)
+			if err != nil {
+				return nil, err
+			}
+			name = string(data)
+			t.addToDictionary(name)
+		} else {
+			symbol, ok := t.dictionary[symLength].(string)
+			if !ok {
+				return nil, fmt.Errorf("symbol %d not found", symLength)
+			}
+			name = symbol
+		}
+
+		value, err := t.decodeValue(b)
+		if err != nil {
+			return nil, err
+		}
+		tuple[name] = value
+	}
+
+	return tuple, nil
+}
+
+// readTFS decodes the root tuple of the filesystem at the offset of the image
+func readTFS(imgFile io.ReaderAt, imgOffset uint64) (*tfsReader, error) {
+	t := &tfsReader{
+		imgFile:    imgFile,
+		imgOffset:  imgOffset,
+		dictionary: make(map[int]interface{}),
+	}
+
+	err := t.readLog()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.root == nil {
+		return nil, errors.New("filesystem has no root")
+	}
+
+	return t, nil
+}
+
+// ReadImageMounts returns the mount paths of the volumes mounted by the image, by
+// volume label, from the manifest saved in its root filesystem
+func ReadImageMounts(imagePath string) (map[string]string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	offset, err := partitionOffset(f, partitionRootFS)
+	if err != nil {
+		return nil, fmt.Errorf("cannot locate root filesystem of %s: %v", imagePath, err)
+	}
+
+	t, err := readTFS(f, offset)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read root filesystem of %s: %v", imagePath, err)
+	}
+
+	mounts := make(map[string]string)
+	tuple, _ := t.root["mounts"].(map[string]interface{})
+	for label, mountPath := range tuple {
+		if s, ok := mountPath.(string); ok {
+			mounts[label] = s
+		}
+	}
+
+	return mounts, nil
+}
+
+// ExportTar writes the files of the filesystem of the volume to w as a tar archive
+func ExportTar(volumePath string, w io.Writer) error {
+	f, err := os.Open(volumePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	t, err := readTFS(f, 0)
+	if err != nil {
+		return fmt.Errorf("cannot read filesystem of %s: %v", volumePath, err)
+	}
+
+	tw := tar.NewWriter(w)
+
+	children, _ := t.root["children"].(map[string]interface{})
+	err = t.exportDir(tw, "", children, info.ModTime())
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+func (t *tfsReader) exportDir(tw *tar.Writer, dir string, children map[string]interface{}, modTime time.Time) error {
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// the kernel links the directories to themselves and their parent
+		if name == "." || name == ".." {
+			continue
+		}
+
+		// removed entries are not tuples
+		entry, ok := children[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		filePath := path.Join(dir, name)
+
+		if target, ok := entry["linktarget"].(string); ok {
+			err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: filePath, Linkname: target, Mode: 0777, ModTime: modTime})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if subdir, ok := entry["children"].(map[string]interface{}); ok {
+			err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: filePath + "/", Mode: 0755, ModTime: modTime})
+			if err != nil {
+				return err
+			}
+			err = t.exportDir(tw, filePath, subdir, modTime)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := t.exportFile(tw, filePath, entry, modTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileExtent is a region of a file stored at a sector of the filesystem
+type fileExtent struct {
+	fileOffset uint64
+	sector     uint64
+	length     uint64
+	uninited   bool
+}
+
+func (t *tfsReader) exportFile(tw *tar.Writer, filePath string, entry map[string]interface{}, modTime time.Time) error {
+	length, _ := entry["filelength"].(string)
+	size, err := strconv.ParseUint(length, 10, 64)
+	if length != "" && err != nil {
+		return fmt.Errorf("invalid length of file %s", filePath)
+	}
+
+	var extents []fileExtent
+	tuples, _ := entry["extents"].(map[string]interface{})
+	for key, value := range tuples {
+		tuple, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var e fileExtent
+		e.fileOffset, err = strconv.ParseUint(key, 10, 64)
+		if err == nil {
+			e.sector, err = strconv.ParseUint(fmt.Sprint(tuple["offset"]), 10, 64)
+		}
+		if err == nil {
+			e.length, err = strconv.ParseUint(fmt.Sprint(tuple["length"]), 10, 64)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid extent of file %s", filePath)
+		}
+		_, e.uninited = tuple["uninited"]
+
+		extents = append(extents, e)
+	}
+	sort.Slice(extents, func(i, j int) bool { return extents[i].fileOffset < extents[j].fileOffset })
+
+	err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: filePath, Size: int64(size), Mode: 0644, ModTime: modTime})
+	if err != nil {
+		return err
+	}
+
+	var written uint64
+	for _, e := range extents {
+		start := e.fileOffset * sectorSize
+		end := start + e.length*sectorSize
+		if end > size {
+			end = size
+		}
+		if start >= end || start < written {
+			continue
+		}
+
+		err = writeZeros(tw, start-written)
+		if err != nil {
+			return err
+		}
+
+		if e.uninited {
+			err = writeZeros(tw, end-start)
+		} else {
+			src := io.NewSectionReader(t.imgFile, int64(t.imgOffset+e.sector*sectorSize), int64(end-start))
+			_, err = io.Copy(tw, src)
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read file %s: %v", filePath, err)
+		}
+		written = end
+	}
+
+	return writeZeros(tw, size-written)
+}
+
+func writeZeros(w io.Writer, n uint64) error {
+	zeros := make([]byte, sectorSize)
+	for n > 0 {
+		chunk := uint64(len(zeros))
+		if n < chunk {
+			chunk = n
+		}
+		if _, err := w.Write(zeros[:chunk]); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// Relabel sets a new label and a new random uuid to the filesystem of a volume, so a
+// copy of the volume can be mounted with the original. It returns the new uuid.
+func Relabel(volumePath string, label string) (string, error) {
+	f, err := os.OpenFile(volumePath, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sector := make([]byte, sectorSize)
+	_, err = f.ReadAt(sector, 0)
+	if err != nil {
+		return "", fmt.Errorf("cannot read filesystem of %s: %v", volumePath, err)
+	}
+
+	b := &logBuffer{data: sector}
+	if err := b.readLogHeader(); err == errNoFilesystem {
+		return "", fmt.Errorf("%s has no filesystem", volumePath)
+	} else if err != nil {
+		return "", err
+	}
+	headerEnd := b.pos
+
+	if _, err := b.readBytes(tfsUUIDSize); err != nil {
+		return "", err
+	}
+	end := bytes.IndexByte(b.data[b.pos:], 0)
+	if end == -1 {
+		return "", errors.New("invalid filesystem label")
+	}
+	rest := b.data[b.pos+end+1:]
+
+	var uuid [tfsUUIDSize]byte
+	rand.Seed(time.Now().UnixNano())
+	rand.Read(uuid[:])
+
+	relabeled := make([]byte, 0, sectorSize)
+	relabeled = append(relabeled, sector[:headerEnd]...)
+	relabeled = append(relabeled, uuid[:]...)
+	relabeled = append(relabeled, label...)
+	relabeled = append(relabeled, 0)
+
+	// the records after the label are kept, the end of the sector is unused
+	keep := sectorSize - len(relabeled)
+	if keep < 0 || bytes.IndexFunc(rest[min(keep, len(rest)):], func(r rune) bool { return r != 0 }) != -1 {
+		return "", fmt.Errorf("label %s is too long", label)
+	}
+	relabeled = append(relabeled, rest[:min(keep, len(rest))]...)
+	relabeled = append(relabeled, make([]byte, sectorSize-len(relabeled))...)
+
+	_, err = f.WriteAt(relabeled, 0)
+	if err != nil {
+		return "", err
+	}
+
+	return uuidString(uuid), nil
+}
+
+// GrowFilesystem extends the volume file to size bytes, rounded up to whole sectors.
+// The filesystem has no size in its log, the kernel uses the size of the disk, so
+// growing the file grows the filesystem. The log is read first so that only valid
+// filesystems are grown.
+func GrowFilesystem(volumePath string, size int64) error {
+	f, err := os.OpenFile(volumePath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = readTFS(f, 0)
+	if err != nil {
+		return fmt.Errorf("cannot read filesystem of %s: %v", volumePath, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size = (size + sectorSize - 1) / sectorSize * sectorSize
+	if size <= info.Size() {
+		return fmt.Errorf("filesystem of %s is %d bytes, it can not shrink to %d bytes", volumePath, info.Size(), size)
+	}
+
+	return f.Truncate(size)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,201 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func writeTestVolume(t *testing.T, dir string, files map[string]string) string {
+	data := path.Join(dir, "data")
+	for name, content := range files {
+		file := path.Join(data, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("a.txt", path.Join(data, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManifest("")
+	if err := m.AddRelativeDirectory(data); err != nil {
+		t.Fatal(err)
+	}
+
+	volume := path.Join(dir, "vol.raw")
+	mkfs := NewMkfsCommand(m)
+	mkfs.SetLabel("vol")
+	mkfs.SetFileSystemPath(volume)
+	if err := mkfs.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	return volume
+}
+
+func TestExportTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.txt":       "hello",
+		"sub/b.txt":   strings.Repeat("0123456789", 1000),
+		"sub/c/empty": "",
+	}
+	volume := writeTestVolume(t, dir, files)
+
+	var buf bytes.Buffer
+	if err := ExportTar(volume, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found[hdr.Name] = string(content)
+		case tar.TypeSymlink:
+			found[hdr.Name] = "-> " + hdr.Linkname
+		}
+	}
+
+	for name, content := range files {
+		if found[name] != content {
+			t.Errorf("file %s: got %d bytes, want %d", name, len(found[name]), len(content))
+		}
+	}
+	if found["link"] != "-> a.txt" {
+		t.Errorf("link: got %q", found["link"])
+	}
+}
+
+func TestRelabel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	volume := writeTestVolume(t, dir, map[string]string{"a.txt": "hello"})
+
+	uuid, err := Relabel(volume, "clone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uuid) != 36 {
+		t.Errorf("invalid uuid %s", uuid)
+	}
+
+	f, err := os.Open(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sector := make([]byte, sectorSize)
+	if _, err := f.ReadAt(sector, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(sector, []byte("clone\x00")) {
+		t.Error("label not written")
+	}
+
+	if _, err := readTFS(f, 0); err != nil {
+		t.Errorf("relabeled filesystem: %v", err)
+	}
+
+	if _, err := Relabel(volume, strings.Repeat("x", sectorSize)); err == nil {
+		t.Error("expected error for a label too long")
+	}
+}
+
+func TestReadImageMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewManifest("")
+	m.AddMount("data", "/var/data")
+	imagePath := writeTestImage(t, dir, m)
+
+	mounts, err := ReadImageMounts(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 1 || mounts["data"] != "/var/data" {
+		t.Errorf("got %v", mounts)
+	}
+
+	if _, err := ReadImageMounts(path.Join(dir, "root.raw")); err == nil {
+		t.Error("expected error for an image without partition table")
+	}
+}
+
+func TestGrowFilesystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	volume := writeTestVolume(t, dir, map[string]string{"a.txt": "hello"})
+
+	info, err := os.Stat(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GrowFilesystem(volume, info.Size()+1000); err != nil {
+		t.Fatal(err)
+	}
+	grown, err := os.Stat(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grown.Size() != info.Size()+1024 {
+		t.Errorf("got size %d, want %d", grown.Size(), info.Size()+1024)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportTar(volume, &buf); err != nil {
+		t.Errorf("grown filesystem: %v", err)
+	}
+
+	if err := GrowFilesystem(volume, info.Size()); err == nil {
+		t.Error("expected error for a smaller size")
+	}
+
+	empty := path.Join(dir, "empty.raw")
+	if err := ioutil.WriteFile(empty, make([]byte, sectorSize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := GrowFilesystem(empty, 4*sectorSize); err == nil {
+		t.Error("expected error for a file without filesystem")
+	}
+}
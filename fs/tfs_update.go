@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// tupleIndex returns the dictionary index of a tuple decoded from the log, records
+// appended to the log reference tuples by index to update them
+func (t *tfsReader) tupleIndex(tuple map[string]interface{}) (int, bool) {
+	ptr := reflect.ValueOf(tuple).Pointer()
+	for index, value := range t.dictionary {
+		if v, ok := value.(map[string]interface{}); ok && reflect.ValueOf(v).Pointer() == ptr {
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+// encodeImmediate encodes a tuple with all its symbols and tuples immediate, so the
+// record does not depend on the dictionary of the log it is appended to
+func (t *tfs) encodeImmediate(tuple map[string]interface{}) {
+	t.pushHeader(entryImmediate, typeTuple, len(tuple))
+	for _, k := range sortedKeys(tuple) {
+		t.encodeString(k)
+		if s, ok := tuple[k].(string); ok {
+			t.encodeString(s)
+		} else {
+			t.encodeImmediate(tuple[k].(map[string]interface{}))
+		}
+	}
+}
+
+// encodeUpdate encodes a reference to a tuple of the log followed by the entries it
+// is updated with
+func (t *tfs) encodeUpdate(index int, entries map[string]interface{}) {
+	t.pushHeader(entryReference, typeTuple, len(entries))
+	t.staging = appendVarint(t.staging, uint(index))
+	for _, k := range sortedKeys(entries) {
+		t.encodeString(k)
+		if s, ok := entries[k].(string); ok {
+			t.encodeString(s)
+		} else {
+			t.encodeImmediate(entries[k].(map[string]interface{}))
+		}
+	}
+}
+
+// appendRecord writes the staged record at the end of the log, the record must fit
+// in the last log extension
+func (t *tfsReader) appendRecord(f *os.File, record []byte) error {
+	buf := []byte{tupleAvailable}
+	buf = appendVarint(buf, uint(len(record)))
+	buf = appendVarint(buf, uint(len(record)))
+	buf = append(buf, record...)
+	buf = append(buf, endOfLog)
+
+	if t.logEnd+int64(len(buf))+tfsExtLinkBytes > t.logLimit {
+		return errors.New("no space left in filesystem log")
+	}
+
+	_, err := f.WriteAt(buf, t.logEnd)
+	return err
+}
+
+// missingDirs adds the directories of the path missing from the filesystem to the
+// updates of the tuple of the deepest directory found
+func (t *tfsReader) missingDirs(updates map[int]map[string]interface{}, dirPath string) error {
+	children, _ := t.root["children"].(map[string]interface{})
+	parts := strings.Split(strings.Trim(dirPath, "/"), "/")
+	for i, part := range parts {
+		entry, found := children[part]
+		if !found {
+			index, ok := t.tupleIndex(children)
+			if !ok {
+				return fmt.Errorf("cannot update directory of %s", dirPath)
+			}
+			if updates[index] == nil {
+				updates[index] = make(map[string]interface{})
+			}
+			dir := updates[index]
+			for _, missing := range parts[i:] {
+				subDir, ok := dir[missing].(map[string]interface{})
+				if !ok {
+					subDir = map[string]interface{}{"children": make(map[string]interface{})}
+					dir[missing] = subDir
+				}
+				dir = subDir["children"].(map[string]interface{})
+			}
+			return nil
+		}
+
+		tuple, _ := entry.(map[string]interface{})
+		children, _ = tuple["children"].(map[string]interface{})
+		if children == nil {
+			return fmt.Errorf("%s is not a directory", path.Join(append([]string{"/"}, parts[:i+1]...)...))
+		}
+	}
+	return nil
+}
+
+// SetImageMounts replaces the mount paths of the volumes mounted by the image, by
+// volume label, in the manifest saved in its root filesystem. The mount directories
+// missing from the filesystem are created, the kernel mounts a volume on an existing
+// directory only.
+func SetImageMounts(imagePath string, mounts map[string]string) error {
+	f, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := partitionOffset(f, partitionRootFS)
+	if err != nil {
+		return fmt.Errorf("cannot locate root filesystem of %s: %v", imagePath, err)
+	}
+
+	t, err := readTFS(f, offset)
+	if err != nil {
+		return fmt.Errorf("cannot read root filesystem of %s: %v", imagePath, err)
+	}
+
+	rootIndex, ok := t.tupleIndex(t.root)
+	if !ok {
+		return fmt.Errorf("cannot update root filesystem of %s: root not found", imagePath)
+	}
+
+	updates := make(map[int]map[string]interface{})
+	tuple := make(map[string]interface{})
+	for label, mountPath := range mounts {
+		if mountPath == "" || mountPath[0] != '/' {
+			return fmt.Errorf("invalid mount path %s of volume %s", mountPath, label)
+		}
+		if err := t.missingDirs(updates, mountPath); err != nil {
+			return fmt.Errorf("cannot mount volume %s: %v", label, err)
+		}
+		tuple[label] = mountPath
+	}
+	updates[rootIndex] = map[string]interface{}{"mounts": tuple}
+
+	indexes := make([]int, 0, len(updates))
+	for index := range updates {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	w := &tfs{}
+	for _, index := range indexes {
+		w.encodeUpdate(index, updates[index])
+	}
+
+	if err := t.appendRecord(f, w.staging); err != nil {
+		return fmt.Errorf("cannot update root filesystem of %s: %v", imagePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTestImage writes an image with a partition table and the root filesystem of
+// the manifest, the root filesystem alone is left in root.raw
+func writeTestImage(t *testing.T, dir string, m *Manifest) string {
+	rootFS := path.Join(dir, "root.raw")
+	mkfs := NewMkfsCommand(m)
+	mkfs.SetFileSystemPath(rootFS)
+	if err := mkfs.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	fsData, err := ioutil.ReadFile(rootFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootFSOffset := uint64(64 * sectorSize)
+	mbr := testMBR(map[int][2]uint64{partitionRootFS: {rootFSOffset, uint64(len(fsData))}})
+
+	image := append(mbr, make([]byte, rootFSOffset-sectorSize)...)
+	image = append(image, fsData...)
+	imagePath := path.Join(dir, "image.img")
+	if err := ioutil.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return imagePath
+}
+
+func TestSetImageMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := NewManifest("")
+	m.AddMount("data", "/var/data")
+	imagePath := writeTestImage(t, dir, m)
+
+	readMounts := func() map[string]string {
+		mounts, err := ReadImageMounts(imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mounts
+	}
+
+	t.Run("attach", func(t *testing.T) {
+		mounts := map[string]string{"data": "/var/data", "logs": "/var/log/app", "cache": "/cache"}
+		if err := SetImageMounts(imagePath, mounts); err != nil {
+			t.Fatal(err)
+		}
+		if got := readMounts(); !reflect.DeepEqual(got, mounts) {
+			t.Errorf("got %v, want %v", got, mounts)
+		}
+
+		f, err := os.Open(imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		tfs, err := readTFS(f, 64*sectorSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dirPath := range []string{"var/data", "var/log/app", "cache"} {
+			children, _ := tfs.root["children"].(map[string]interface{})
+			for _, part := range strings.Split(dirPath, "/") {
+				entry, _ := children[part].(map[string]interface{})
+				children, _ = entry["children"].(map[string]interface{})
+			}
+			if children == nil {
+				t.Errorf("directory %s not created", dirPath)
+			}
+		}
+	})
+
+	t.Run("detach", func(t *testing.T) {
+		mounts := map[string]string{"data": "/var/data"}
+		if err := SetImageMounts(imagePath, mounts); err != nil {
+			t.Fatal(err)
+		}
+		if got := readMounts(); !reflect.DeepEqual(got, mounts) {
+			t.Errorf("got %v, want %v", got, mounts)
+		}
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		if err := SetImageMounts(imagePath, map[string]string{"data": "var/data"}); err == nil {
+			t.Error("expected error for a relative mount path")
+		}
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/nanovms/ops/types"
 	"github.com/olekukonko/tablewriter"
 	"golang.org/x/oauth2/google"
+	cloudbuild "google.golang.org/api/cloudbuild/v1"
 	compute "google.golang.org/api/compute/v1"
 )
 
@@ -71,7 +72,12 @@ func (p *GCloud) BuildImageWithPackage(ctx *lepton.Context, pkgpath string) (str
 // CreateImage - Creates image on GCP using nanos images
 // TODO : re-use and cache DefaultClient and instances.
 func (p *GCloud) CreateImage(ctx *lepton.Context, imagePath string) error {
-	err := p.Storage.CopyToBucket(ctx.Config(), imagePath)
+	hash, err := lepton.ImageHash(ctx.Config())
+	if err != nil {
+		return err
+	}
+
+	err = p.Storage.CopyToBucket(ctx.Config(), imagePath)
 	if err != nil {
 		return err
 	}
@@ -82,9 +88,12 @@ func (p *GCloud) CreateImage(ctx *lepton.Context, imagePath string) error {
 	sourceURL := fmt.Sprintf(GCPStorageURL,
 		c.CloudConfig.BucketName, p.getArchiveName(ctx))
 
+	labels := buildGcpTags(ctx.Config().CloudConfig.Tags)
+	labels[lepton.ImageHashTag] = hash
+
 	rb := &compute.Image{
 		Name:   c.CloudConfig.ImageName,
-		Labels: buildGcpTags(ctx.Config().CloudConfig.Tags),
+		Labels: labels,
 		RawDisk: &compute.ImageRawDisk{
 			Source: sourceURL,
 		},
@@ -131,6 +140,7 @@ func (p *GCloud) GetImages(ctx *lepton.Context) ([]lepton.CloudImage, error) {
 					Name:    image.Name,
 					Status:  fmt.Sprintf("%v", image.Status),
 					Created: imageCreatedAt,
+					Hash:    image.Labels[lepton.ImageHashTag],
 				}
 
 				images = append(images, ci)
@@ -199,8 +209,74 @@ func (p *GCloud) DeleteImage(ctx *lepton.Context, imagename string) error {
 
 // SyncImage syncs image from provider to another provider
 func (p *GCloud) SyncImage(config *types.Config, target lepton.Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	ctx := lepton.NewContext(config)
+	return lepton.SyncImage(p, ctx, target, ctx, image)
+}
+
+// imageExportBuilder is the Cloud Build step used by gcloud compute images export
+const imageExportBuilder = "gcr.io/compute-image-tools/gce_vm_image_export:release"
+
+// ExportImage exports the image to an archive of the bucket with Cloud Build and
+// extracts the raw disk of the downloaded archive. The Cloud Build service account
+// needs the compute admin and service account user roles.
+func (p *GCloud) ExportImage(ctx *lepton.Context, image, imagePath string) error {
+	c := ctx.Config()
+
+	archive := image + "-export.tar.gz"
+
+	build := &cloudbuild.Build{
+		Steps: []*cloudbuild.BuildStep{
+			{
+				Name: imageExportBuilder,
+				Args: []string{
+					"-timeout=3600s",
+					"-client_id=api",
+					"-source_image=projects/" + c.CloudConfig.ProjectID + "/global/images/" + image,
+					"-destination_uri=gs://" + c.CloudConfig.BucketName + "/" + archive,
+					"-zone=" + c.CloudConfig.Zone,
+				},
+			},
+		},
+		Timeout: "3700s",
+		Tags:    []string{"gce-daisy", "gce-daisy-image-export"},
+	}
+
+	service, err := cloudbuild.NewService(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	op, err := service.Projects.Builds.Create(c.CloudConfig.ProjectID, build).Context(context.TODO()).Do()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Image export started. Monitoring build operation %s.\n", op.Name)
+	for !op.Done {
+		time.Sleep(10 * time.Second)
+		op, err = service.Operations.Get(op.Name).Context(context.TODO()).Do()
+		if err != nil {
+			return err
+		}
+	}
+	if op.Error != nil {
+		return fmt.Errorf("image export failed: %s", op.Error.Message)
+	}
+
+	archPath := filepath.Join(filepath.Dir(imagePath), archive)
+	defer os.Remove(archPath)
+
+	err = p.Storage.CopyFromBucket(c, archive, archPath)
+	if err != nil {
+		return err
+	}
+
+	err = p.Storage.DeleteFromBucket(c, archive)
+	if err != nil {
+		return err
+	}
+
+	return lepton.ExtractArchiveFile(archPath, "disk.raw", imagePath)
 }
 
 // ResizeImage is not supported on google cloud.
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/network"
 	"github.com/olekukonko/tablewriter"
 	compute "google.golang.org/api/compute/v1"
 )
@@ -20,6 +21,11 @@ func (p *GCloud) CreateInstance(ctx *lepton.Context) error {
 		c.CloudConfig.Flavor = "g1-small"
 	}
 
+	portMappings, err := getPortMappings(c)
+	if err != nil {
+		return err
+	}
+
 	nic, err := p.getNIC(ctx, p.Service)
 	if err != nil {
 		return err
@@ -51,6 +57,7 @@ func (p *GCloud) CreateInstance(ctx *lepton.Context) error {
 				InitializeParams: &compute.AttachedDiskInitializeParams{
 					SourceImage: imageName,
 				},
+				DiskEncryptionKey: diskEncryptionKey(c),
 			},
 		},
 		NetworkInterfaces: nic,
@@ -98,19 +105,13 @@ func (p *GCloud) CreateInstance(ctx *lepton.Context) error {
 	}
 
 	// create firewall rules to expose instance ports
-	if len(ctx.Config().RunConfig.Ports) != 0 {
-		rule := p.buildFirewallRule("tcp", ctx.Config().RunConfig.Ports, instanceName)
-
-		_, err = p.Service.Firewalls.Insert(c.CloudConfig.ProjectID, rule).Context(context.TODO()).Do()
-
-		if err != nil {
-			ctx.Logger().Error("%v", err)
-			return errors.New("Failed to add Firewall rule")
+	for _, protocol := range []string{network.ProtocolTCP, network.ProtocolUDP} {
+		ports := firewallPorts(portMappings, protocol)
+		if len(ports) == 0 {
+			continue
 		}
-	}
 
-	if len(ctx.Config().RunConfig.UDPPorts) != 0 {
-		rule := p.buildFirewallRule("udp", ctx.Config().RunConfig.UDPPorts, instanceName)
+		rule := p.buildFirewallRule(protocol, ports, instanceName)
 
 		_, err = p.Service.Firewalls.Insert(c.CloudConfig.ProjectID, rule).Context(context.TODO()).Do()
 
@@ -300,32 +301,45 @@ func (p *GCloud) ResetInstance(ctx *lepton.Context, instancename string) error {
 }
 
 // PrintInstanceLogs writes instance logs to console
-func (p *GCloud) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := p.GetInstanceLogs(ctx, instancename)
+func (p *GCloud) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	if !opts.Since.IsZero() {
+		return lepton.ErrLogsSinceNotSupported
+	}
+
+	resp, err := p.getSerialPortOutput(ctx, instancename, 0)
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
+	w := opts.Writer()
+	fmt.Fprint(w, lepton.TailLines(resp.Contents, opts.Tail))
+
+	for opts.Watch {
+		time.Sleep(lepton.WatchLogsInterval)
+
+		resp, err = p.getSerialPortOutput(ctx, instancename, resp.Next)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, resp.Contents)
+	}
+
 	return nil
 }
 
 // GetInstanceLogs gets instance related logs
 func (p *GCloud) GetInstanceLogs(ctx *lepton.Context, instancename string) (string, error) {
-	context := context.TODO()
-
-	cloudConfig := ctx.Config().CloudConfig
-	lastPos := int64(0)
-
-	resp, err := p.Service.Instances.GetSerialPortOutput(cloudConfig.ProjectID, cloudConfig.Zone, instancename).Start(lastPos).Context(context).Do()
+	resp, err := p.getSerialPortOutput(ctx, instancename, 0)
 	if err != nil {
 		return "", err
 	}
-	if resp.Contents != "" {
-		return resp.Contents, nil
-	}
 
-	lastPos = resp.Next
-	time.Sleep(time.Second)
+	return resp.Contents, nil
+}
+
+// getSerialPortOutput returns the instance serial output starting at the byte position specified,
+// the position of the next output is returned in the Next field
+func (p *GCloud) getSerialPortOutput(ctx *lepton.Context, instancename string, start int64) (*compute.SerialPortOutput, error) {
+	cloudConfig := ctx.Config().CloudConfig
 
-	return "", nil
+	return p.Service.Instances.GetSerialPortOutput(cloudConfig.ProjectID, cloudConfig.Zone, instancename).Start(start).Context(context.TODO()).Do()
 }
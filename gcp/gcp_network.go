@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/network"
+	"github.com/nanovms/ops/types"
 	compute "google.golang.org/api/compute/v1"
 )
 
@@ -174,6 +176,33 @@ func (p *GCloud) buildFirewallRule(protocol string, ports []string, tag string)
 	}
 }
 
+// getPortMappings returns the tcp and udp port mappings specified in configuration
+func getPortMappings(c *types.Config) (mappings []network.PortMapping, err error) {
+	mappings, err = network.ParsePortMappings(c.RunConfig.Ports, network.ProtocolTCP)
+	if err != nil {
+		return
+	}
+
+	udpMappings, err := network.ParsePortMappings(c.RunConfig.UDPPorts, network.ProtocolUDP)
+	if err != nil {
+		return
+	}
+
+	mappings = append(mappings, udpMappings...)
+	return
+}
+
+// firewallPorts returns the guest ports of the mappings with the protocol specified,
+// since cloud instances are reached directly without host port forwarding
+func firewallPorts(mappings []network.PortMapping, protocol string) (ports []string) {
+	for _, pm := range mappings {
+		if pm.Protocol == protocol {
+			ports = append(ports, pm.GuestPorts())
+		}
+	}
+	return
+}
+
 func arrayToString(a interface{}, delim string) string {
 	return strings.Trim(strings.Replace(fmt.Sprint(a), " ", delim, -1), "[]")
 }
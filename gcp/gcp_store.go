@@ -53,3 +53,41 @@ func (s *Storage) CopyToBucket(config *types.Config, archPath string) error {
 	}
 	return nil
 }
+
+// CopyFromBucket downloads the key of config's bucket to dst
+func (s *Storage) CopyFromBucket(config *types.Config, key, dst string) error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	r, err := client.Bucket(config.CloudConfig.BucketName).Object(key).NewReader(ctx)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// DeleteFromBucket deletes key from config's bucket
+func (s *Storage) DeleteFromBucket(config *types.Config, key string) error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Bucket(config.CloudConfig.BucketName).Object(key).Delete(ctx)
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
 	compute "google.golang.org/api/compute/v1"
 )
 
@@ -61,18 +64,33 @@ func (g *GCloud) CreateVolume(ctx *lepton.Context, name, data, size, provider st
 	}
 
 	disk := &compute.Disk{
-		Name:        name,
-		SourceImage: "global/images/" + name,
-		Type:        fmt.Sprintf("projects/%s/zones/%s/diskTypes/pd-standard", config.CloudConfig.ProjectID, config.CloudConfig.Zone),
+		Name:              name,
+		SourceImage:       "global/images/" + name,
+		Type:              fmt.Sprintf("projects/%s/zones/%s/diskTypes/pd-standard", config.CloudConfig.ProjectID, config.CloudConfig.Zone),
+		DiskEncryptionKey: diskEncryptionKey(config),
 	}
 
 	_, err = g.Service.Disks.Insert(config.CloudConfig.ProjectID, config.CloudConfig.Zone, disk).Context(context.TODO()).Do()
 	if err != nil {
 		return lv, err
 	}
+
+	lv.Encrypted = true
+	lv.EncryptionKey = config.CloudConfig.EncryptionKey
+
 	return lv, nil
 }
 
+// diskEncryptionKey returns the Cloud KMS key of the configuration, disks are
+// encrypted at rest with a key managed by Google otherwise
+func diskEncryptionKey(config *types.Config) *compute.CustomerEncryptionKey {
+	if config.CloudConfig.EncryptionKey == "" {
+		return nil
+	}
+
+	return &compute.CustomerEncryptionKey{KmsKeyName: config.CloudConfig.EncryptionKey}
+}
+
 // GetAllVolumes gets all volumes created in GCP as Compute Engine Disks
 func (g *GCloud) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error) {
 	config := ctx.Config()
@@ -105,10 +123,14 @@ func (g *GCloud) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, erro
 			ID:         strconv.Itoa(int(d.Id)),
 			Name:       d.Name,
 			Status:     d.Status,
-			Size:       strconv.Itoa(int(d.SizeGb)),
+			Size:       lepton.VolumeSize(d.SizeGb) * lepton.GiB,
 			Path:       d.SelfLink,
 			CreatedAt:  d.CreationTimestamp,
 			AttachedTo: strings.Join(users, ";"),
+			Encrypted:  true,
+		}
+		if d.DiskEncryptionKey != nil {
+			vol.EncryptionKey = d.DiskEncryptionKey.KmsKeyName
 		}
 
 		volumes = append(volumes, vol)
@@ -138,26 +160,54 @@ func (g *GCloud) DeleteVolume(ctx *lepton.Context, name string) error {
 func (g *GCloud) AttachVolume(ctx *lepton.Context, image, name string) error {
 	config := ctx.Config()
 
+	ins, err := g.Service.Instances.Get(config.CloudConfig.ProjectID, config.CloudConfig.Zone, image).Context(context.TODO()).Do()
+	if err != nil {
+		return err
+	}
+
+	deviceName, err := FreeDeviceName(ins.Disks, name)
+	if err != nil {
+		return err
+	}
+
+	// disks are hot-plugged, the kernel mounts the volume without a restart
 	disk := &compute.AttachedDisk{
 		AutoDelete: false,
-		DeviceName: name,
+		DeviceName: deviceName,
 		Source:     fmt.Sprintf("zones/%s/disks/%s", config.CloudConfig.Zone, name),
 	}
 	op, err := g.Service.Instances.AttachDisk(config.CloudConfig.ProjectID, config.CloudConfig.Zone, image, disk).Context(context.TODO()).Do()
 	if err != nil {
 		return err
 	}
-	err = g.pollOperation(context.TODO(), config.CloudConfig.ProjectID, g.Service, *op)
-	if err != nil {
-		return err
+
+	return g.pollOperation(context.TODO(), config.CloudConfig.ProjectID, g.Service, *op)
+}
+
+// gcpMaxDisks is the number of disks that can be attached to an instance
+const gcpMaxDisks = 128
+
+// FreeDeviceName returns a device name for the disk not used by the disks of an
+// instance, the disk name is used when it is free
+func FreeDeviceName(disks []*compute.AttachedDisk, diskName string) (string, error) {
+	if len(disks) >= gcpMaxDisks {
+		return "", fmt.Errorf("no disk slot left to attach volume %s", diskName)
 	}
 
-	err = g.ResetInstance(lepton.NewContext(config), image)
-	if err != nil {
-		return fmt.Errorf("error reseting instance %v", image)
+	used := make(map[string]bool)
+	for _, d := range disks {
+		if path.Base(d.Source) == diskName {
+			return "", fmt.Errorf("volume %s is already attached", diskName)
+		}
+		used[d.DeviceName] = true
 	}
 
-	return nil
+	deviceName := diskName
+	for n := 1; used[deviceName]; n++ {
+		deviceName = fmt.Sprintf("%s-%d", diskName, n)
+	}
+
+	return deviceName, nil
 }
 
 // DetachVolume detaches Compute Engine Disk volume from existing instance
@@ -196,3 +246,108 @@ func (g *GCloud) DetachVolume(ctx *lepton.Context, image, volumeName string) err
 
 	return nil
 }
+
+// ResizeVolume grows the Compute Engine Disk
+func (g *GCloud) ResizeVolume(ctx *lepton.Context, name string, size lepton.VolumeSize) (lepton.NanosVolume, error) {
+	config := ctx.Config()
+
+	var vol lepton.NanosVolume
+
+	disk, err := g.Service.Disks.Get(config.CloudConfig.ProjectID, config.CloudConfig.Zone, name).Context(context.TODO()).Do()
+	if err != nil {
+		return vol, err
+	}
+
+	sizeGB := size.GB()
+	err = lepton.CheckVolumeGrow(name, lepton.VolumeSize(disk.SizeGb)*lepton.GiB, lepton.VolumeSize(sizeGB)*lepton.GiB)
+	if err != nil {
+		return vol, err
+	}
+
+	req := &compute.DisksResizeRequest{SizeGb: sizeGB}
+	op, err := g.Service.Disks.Resize(config.CloudConfig.ProjectID, config.CloudConfig.Zone, name, req).Context(context.TODO()).Do()
+	if err != nil {
+		return vol, err
+	}
+	err = g.pollOperation(context.TODO(), config.CloudConfig.ProjectID, g.Service, *op)
+	if err != nil {
+		return vol, err
+	}
+
+	vol = lepton.NanosVolume{
+		ID:        strconv.Itoa(int(disk.Id)),
+		Name:      name,
+		Status:    "READY",
+		Size:      lepton.VolumeSize(sizeGB) * lepton.GiB,
+		Path:      disk.SelfLink,
+		Encrypted: true,
+	}
+	if disk.DiskEncryptionKey != nil {
+		vol.EncryptionKey = disk.DiskEncryptionKey.KmsKeyName
+	}
+	return vol, nil
+}
+
+// SnapshotVolume creates a snapshot of the Compute Engine Disk
+func (g *GCloud) SnapshotVolume(ctx *lepton.Context, name string) (lepton.NanosVolume, error) {
+	config := ctx.Config()
+
+	var vol lepton.NanosVolume
+
+	snapshot := &compute.Snapshot{
+		Name:                  name + "-" + time.Now().Format("20060102150405"),
+		Labels:                buildGcpTags(config.CloudConfig.Tags),
+		SnapshotEncryptionKey: diskEncryptionKey(config),
+	}
+	op, err := g.Service.Disks.CreateSnapshot(config.CloudConfig.ProjectID, config.CloudConfig.Zone, name, snapshot).Context(context.TODO()).Do()
+	if err != nil {
+		return vol, err
+	}
+	err = g.pollOperation(context.TODO(), config.CloudConfig.ProjectID, g.Service, *op)
+	if err != nil {
+		return vol, err
+	}
+
+	vol = lepton.NanosVolume{
+		Name:   snapshot.Name,
+		Status: "READY",
+	}
+	return vol, nil
+}
+
+// CloneVolume creates a Compute Engine Disk from the disk
+func (g *GCloud) CloneVolume(ctx *lepton.Context, name, newName string) (lepton.NanosVolume, error) {
+	config := ctx.Config()
+
+	var vol lepton.NanosVolume
+
+	source, err := g.Service.Disks.Get(config.CloudConfig.ProjectID, config.CloudConfig.Zone, name).Context(context.TODO()).Do()
+	if err != nil {
+		return vol, err
+	}
+
+	disk := &compute.Disk{
+		Name:              newName,
+		SourceDisk:        source.SelfLink,
+		Type:              source.Type,
+		SizeGb:            source.SizeGb,
+		DiskEncryptionKey: diskEncryptionKey(config),
+	}
+	op, err := g.Service.Disks.Insert(config.CloudConfig.ProjectID, config.CloudConfig.Zone, disk).Context(context.TODO()).Do()
+	if err != nil {
+		return vol, err
+	}
+	err = g.pollOperation(context.TODO(), config.CloudConfig.ProjectID, g.Service, *op)
+	if err != nil {
+		return vol, err
+	}
+
+	vol = lepton.NanosVolume{
+		Name:          newName,
+		Status:        "READY",
+		Size:          lepton.VolumeSize(source.SizeGb) * lepton.GiB,
+		Encrypted:     true,
+		EncryptionKey: config.CloudConfig.EncryptionKey,
+	}
+	return vol, nil
+}
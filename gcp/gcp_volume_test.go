@@ -0,0 +1,48 @@
+package gcp_test
+
+import (
+	"testing"
+
+	"github.com/nanovms/ops/gcp"
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestFreeDeviceName(t *testing.T) {
+	disk := func(name, deviceName string) *compute.AttachedDisk {
+		return &compute.AttachedDisk{
+			Source:     "https://www.googleapis.com/compute/v1/projects/p/zones/z/disks/" + name,
+			DeviceName: deviceName,
+		}
+	}
+
+	t.Run("should return the disk name when it is free", func(t *testing.T) {
+		got, err := gcp.FreeDeviceName([]*compute.AttachedDisk{disk("boot", "persistent-disk-0")}, "data")
+		if err != nil || got != "data" {
+			t.Errorf("got %s %v, want data", got, err)
+		}
+	})
+
+	t.Run("should skip device names used by other disks", func(t *testing.T) {
+		disks := []*compute.AttachedDisk{disk("old-data", "data"), disk("other", "data-1")}
+		got, err := gcp.FreeDeviceName(disks, "data")
+		if err != nil || got != "data-2" {
+			t.Errorf("got %s %v, want data-2", got, err)
+		}
+	})
+
+	t.Run("should return an error when the disk is attached", func(t *testing.T) {
+		if _, err := gcp.FreeDeviceName([]*compute.AttachedDisk{disk("data", "vol")}, "data"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("should return an error when all slots are used", func(t *testing.T) {
+		var disks []*compute.AttachedDisk
+		for n := 0; n < 128; n++ {
+			disks = append(disks, disk("", ""))
+		}
+		if _, err := gcp.FreeDeviceName(disks, "data"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
@@ -204,6 +204,6 @@ func (p *Provider) GetInstanceLogs(ctx *lepton.Context, instancename string) (st
 }
 
 // PrintInstanceLogs prints vm logs content on console
-func (p *Provider) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
+func (p *Provider) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
 	return errors.New("Unsupported")
 }
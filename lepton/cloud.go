@@ -10,6 +10,7 @@ type CloudImage struct {
 	Size    int64
 	Path    string
 	Created time.Time
+	Hash    string // content hash of the image file the image was created from
 }
 
 // CloudInstance represents the instance that widely use in different
@@ -58,7 +58,6 @@ func GetOpsHome() string {
 
 	opshome := path.Join(home, ".ops")
 	images := path.Join(opshome, "images")
-	instances := path.Join(opshome, "instances")
 	manifests := path.Join(opshome, "manifests")
 	volumes := path.Join(opshome, "volumes")
 
@@ -66,10 +65,6 @@ func GetOpsHome() string {
 		os.MkdirAll(images, 0755)
 	}
 
-	if _, err := os.Stat(instances); os.IsNotExist(err) {
-		os.MkdirAll(instances, 0755)
-	}
-
 	if _, err := os.Stat(manifests); os.IsNotExist(err) {
 		os.MkdirAll(manifests, 0755)
 	}
@@ -0,0 +1,186 @@
+package lepton
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxCrashFrameLines limits the lines of a fault dump kept in a crash report
+const maxCrashFrameLines = 200
+
+var (
+	crashStartRegexp   = regexp.MustCompile(`(?i)^\s*\*\*\*|\b(page fault|general protection|unhandled|kernel panic|panic:|assertion .* failed)\b|^\s*interrupt: \d+`)
+	crashFieldRegexp   = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z _]*?)\s*:\s+(\S.*)$`)
+	traceSyscallRegexp = regexp.MustCompile(`^( *)(\d+) ([a-z][a-z0-9_]*)(:.*)?$`)
+)
+
+// traceIndentPerThread and traceMaxIndentThread are the indentation of the syscall
+// trace lines, nanos indents the lines of each thread by its id up to a maximum
+const (
+	traceIndentPerThread = 4
+	traceMaxIndentThread = 20
+)
+
+// CrashReport summarizes a nanos fault or panic dump found in the serial output
+type CrashReport struct {
+	Reason             string
+	FaultAddress       string
+	InstructionPointer string
+	Thread             string
+	LastSyscall        string
+
+	// Frame has the lines of the fault dump
+	Frame []string
+}
+
+func (r *CrashReport) String() string {
+	var sb strings.Builder
+
+	reason := r.Reason
+	if reason == "" {
+		reason = "unknown fault"
+	}
+	sb.WriteString(fmt.Sprintf("guest crashed: %s\n", reason))
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"fault address", r.FaultAddress},
+		{"instruction", r.InstructionPointer},
+		{"thread", r.Thread},
+		{"last syscall", r.LastSyscall},
+	}
+
+	for _, f := range fields {
+		if f.value != "" {
+			sb.WriteString(fmt.Sprintf("  %-14s %s\n", f.name+":", f.value))
+		}
+	}
+
+	if r.LastSyscall == "" {
+		sb.WriteString("  run with --trace to record the last syscall\n")
+	}
+
+	return sb.String()
+}
+
+// CrashDetector scans serial output written to it for nanos fault and panic dumps
+type CrashDetector struct {
+	// Trace is set when the guest traces its syscalls, the last syscall is read
+	// from the trace only
+	Trace bool
+
+	line         []byte
+	lastSyscall  string
+	markerReason string
+	report       *CrashReport
+}
+
+// Write scans output lines, it never fails
+func (d *CrashDetector) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c == '\n' {
+			d.scanLine(strings.TrimRight(string(d.line), "\r"))
+			d.line = d.line[:0]
+			continue
+		}
+		d.line = append(d.line, c)
+	}
+	return len(p), nil
+}
+
+// Report returns the crash found in the output or nil
+func (d *CrashDetector) Report() *CrashReport {
+	if len(d.line) > 0 {
+		d.scanLine(string(d.line))
+		d.line = d.line[:0]
+	}
+
+	if d.report != nil && d.report.Reason == "" {
+		d.report.Reason = d.markerReason
+	}
+	return d.report
+}
+
+func (d *CrashDetector) scanLine(line string) {
+	if d.report == nil {
+		if syscall, thread, ok := d.traceSyscall(line); ok {
+			d.lastSyscall = fmt.Sprintf("%s (thread %s)", syscall, thread)
+			return
+		}
+
+		if !crashStartRegexp.MatchString(line) {
+			return
+		}
+
+		d.report = &CrashReport{LastSyscall: d.lastSyscall}
+		d.markerReason = strings.TrimSpace(strings.Trim(strings.TrimSpace(line), "*"))
+	}
+
+	if len(d.report.Frame) >= maxCrashFrameLines {
+		return
+	}
+	d.report.Frame = append(d.report.Frame, line)
+
+	groups := crashFieldRegexp.FindStringSubmatch(line)
+	if groups == nil {
+		return
+	}
+
+	key := strings.ToLower(strings.TrimSpace(groups[1]))
+	value := strings.TrimSpace(groups[2])
+	firstValue := strings.Fields(value)[0]
+
+	switch key {
+	case "address", "fault address", "addr":
+		setIfEmpty(&d.report.FaultAddress, firstValue)
+	case "rip", "pc", "elr":
+		setIfEmpty(&d.report.InstructionPointer, firstValue)
+	case "thread", "tid", "thread id":
+		setIfEmpty(&d.report.Thread, value)
+	case "interrupt", "desc", "reason":
+		setIfEmpty(&d.report.Reason, value)
+	}
+}
+
+// traceSyscall returns the syscall and the thread of a syscall trace line, the line
+// is indented by the thread id as nanos does
+func (d *CrashDetector) traceSyscall(line string) (syscall, thread string, ok bool) {
+	if !d.Trace {
+		return
+	}
+
+	groups := traceSyscallRegexp.FindStringSubmatch(line)
+	if groups == nil {
+		return
+	}
+
+	tid, err := strconv.Atoi(groups[2])
+	if err != nil || tid < 1 {
+		return
+	}
+	if tid > traceMaxIndentThread {
+		tid = traceMaxIndentThread
+	}
+	if len(groups[1]) != (tid-1)*traceIndentPerThread {
+		return
+	}
+
+	return groups[3], groups[2], true
+}
+
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// ParseCrashReport returns the crash found in serial output or nil
+func ParseCrashReport(output string) *CrashReport {
+	d := &CrashDetector{}
+	d.Write([]byte(output))
+	return d.Report()
+}
@@ -0,0 +1,98 @@
+package lepton_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+func TestCrashDetector(t *testing.T) {
+	t.Run("no crash", func(t *testing.T) {
+		report := lepton.ParseCrashReport("booting\nlistening on 8080\nexit status 0\n")
+		if report != nil {
+			t.Errorf("got %v, want no crash", report)
+		}
+	})
+
+	t.Run("page fault", func(t *testing.T) {
+		output := "booting\n" +
+			"1 read\n" +
+			"    2 write: fd 1\n" +
+			"*** Unhandled page fault ***\n" +
+			"interrupt: 14 (Page fault)\n" +
+			"address: 0x0000000000000000\n" +
+			"rip: 0x0000000000401234\n" +
+			"thread: 2\n"
+
+		d := &lepton.CrashDetector{Trace: true}
+		// write output split in the middle of lines
+		d.Write([]byte(output[:20]))
+		d.Write([]byte(output[20:]))
+
+		report := d.Report()
+		if report == nil {
+			t.Fatal("crash not detected")
+		}
+
+		if report.Reason != "14 (Page fault)" {
+			t.Errorf("got reason %q", report.Reason)
+		}
+		if report.FaultAddress != "0x0000000000000000" {
+			t.Errorf("got fault address %q", report.FaultAddress)
+		}
+		if report.InstructionPointer != "0x0000000000401234" {
+			t.Errorf("got instruction pointer %q", report.InstructionPointer)
+		}
+		if report.Thread != "2" {
+			t.Errorf("got thread %q", report.Thread)
+		}
+		if report.LastSyscall != "write (thread 2)" {
+			t.Errorf("got last syscall %q", report.LastSyscall)
+		}
+		if len(report.Frame) != 5 {
+			t.Errorf("got %d frame lines, want 5", len(report.Frame))
+		}
+	})
+
+	t.Run("program output", func(t *testing.T) {
+		output := "200 ok\n" +
+			"    1 read\n" +
+			"*** Unhandled page fault ***\n"
+
+		d := &lepton.CrashDetector{Trace: true}
+		d.Write([]byte(output))
+
+		report := d.Report()
+		if report == nil {
+			t.Fatal("crash not detected")
+		}
+		if report.LastSyscall != "" {
+			t.Errorf("got last syscall %q", report.LastSyscall)
+		}
+	})
+
+	t.Run("not traced", func(t *testing.T) {
+		report := lepton.ParseCrashReport("1 read\n*** Unhandled page fault ***\n")
+		if report == nil {
+			t.Fatal("crash not detected")
+		}
+		if report.LastSyscall != "" {
+			t.Errorf("got last syscall %q", report.LastSyscall)
+		}
+	})
+
+	t.Run("marker reason without fields", func(t *testing.T) {
+		report := lepton.ParseCrashReport("kernel panic: out of memory")
+		if report == nil {
+			t.Fatal("crash not detected")
+		}
+
+		if report.Reason != "kernel panic: out of memory" {
+			t.Errorf("got reason %q", report.Reason)
+		}
+		if !strings.Contains(report.String(), "--trace") {
+			t.Errorf("expected --trace hint in %q", report.String())
+		}
+	})
+}
@@ -25,6 +25,7 @@ var LocalImageDir = path.Join(GetOpsHome(), "images")
 // BuildImage builds a unikernel image for user
 // supplied ELF binary.
 func BuildImage(c types.Config) error {
+	defer cleanup(&c)
 
 	m, err := BuildManifest(&c)
 	if err != nil {
@@ -38,9 +39,23 @@ func BuildImage(c types.Config) error {
 	return nil
 }
 
+// BuildImageFromManifest builds the image with a manifest built by BuildManifest. The
+// files of the manifest are read again, so the image of a manifest can be rebuilt when
+// only the content of its files changed. The build directory of the config holding the
+// files generated for the manifest is kept, it is removed by the caller.
+func BuildImageFromManifest(c *types.Config, m *fs.Manifest) error {
+	if err := createImageFile(c, m); err != nil {
+		return fmt.Errorf("failed creating image file: %v", err)
+	}
+
+	return nil
+}
+
 // rebuildImage rebuilds a unikernel image for user
 // supplied ELF binary after volume attach/detach
 func rebuildImage(c types.Config) error {
+	defer cleanup(&c)
+
 	c.Program = c.ProgramPath
 	m, err := BuildManifest(&c)
 	if err != nil {
@@ -98,6 +113,24 @@ func addHostName(m *fs.Manifest, c *types.Config) {
 	}
 }
 
+// add /etc/hosts
+func addHosts(m *fs.Manifest, c *types.Config) {
+	if len(c.Hosts) == 0 {
+		return
+	}
+	temp := getImageTempDir(c)
+	hosts := path.Join(temp, "hosts")
+	data := []byte(strings.Join(c.Hosts, "\n") + "\n")
+	err := ioutil.WriteFile(hosts, data, 0644)
+	if err != nil {
+		panic(err)
+	}
+	err = m.AddFile("/etc/hosts", hosts)
+	if err != nil {
+		panic(err)
+	}
+}
+
 func addPasswd(m *fs.Manifest, c *types.Config) {
 	// Skip adding password file if present in package
 	if m.FileExists("/etc/passwd") {
@@ -228,6 +261,7 @@ func setManifestFromConfig(m *fs.Manifest, c *types.Config) error {
 	m.AddKernel(c.Kernel)
 	addDNSConfig(m, c)
 	addHostName(m, c)
+	addHosts(m, c)
 	addPasswd(m, c)
 	m.SetKlibDir(getKlibsDir(c.NightlyBuild))
 	m.AddKlibs(c.RunConfig.Klibs)
@@ -289,6 +323,10 @@ func setManifestFromConfig(m *fs.Manifest, c *types.Config) error {
 		m.AddMount(k, v)
 	}
 
+	for _, share := range c.RunConfig.Shares {
+		m.AddMount(share.Tag, share.GuestPath)
+	}
+
 	if c.RunConfig.IPAddr != "" {
 		m.AddNetworkConfig(&fs.ManifestNetworkConfig{
 			IP:      c.RunConfig.IPAddr,
@@ -368,8 +406,6 @@ func createImageFile(c *types.Config, m *fs.Manifest) error {
 		return errors.Wrap(err, 1)
 	}
 
-	defer cleanup(c)
-
 	mkfsCommand := fs.NewMkfsCommand(m)
 
 	if c.BaseVolumeSz != "" {
@@ -597,3 +633,42 @@ func CreateArchive(archive string, files []string) error {
 	}
 	return nil
 }
+
+// ExtractArchiveFile extracts the file with the name from the archive created by
+// CreateArchive to dst
+func ExtractArchiveFile(archive, name, dst string) error {
+	fd, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	gzr, err := gzip.NewReader(fd)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	tr := tar.NewReader(gzr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("%s not found in %s", name, archive)
+		} else if err != nil {
+			return err
+		}
+		if hdr.Name != name {
+			continue
+		}
+
+		out, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+}
@@ -0,0 +1,27 @@
+package lepton
+
+import (
+	"github.com/nanovms/ops/fs"
+	"github.com/nanovms/ops/types"
+)
+
+// ImageHashTag is the tag, or label on GCP, with the content hash of the image
+// file a cloud image was created from
+const ImageHashTag = "opshash"
+
+// ImageHash returns the content hash of the image built for the configuration,
+// building the same program and files again gives the same hash
+func ImageHash(config *types.Config) (string, error) {
+	return fs.ImageHash(config.RunConfig.Imagename)
+}
+
+// FindImageByHash returns the image with the name created from an image file with
+// the hash, nil if the image changed since it was created
+func FindImageByHash(images []CloudImage, name, hash string) *CloudImage {
+	for i := range images {
+		if images[i].Name == name && images[i].Hash != "" && images[i].Hash == hash {
+			return &images[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package lepton
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// ImageExporter is implemented by the providers which can download their images to
+// a local raw image, so that the images can be synced to other providers
+type ImageExporter interface {
+	ExportImage(ctx *Context, image, imagePath string) error
+}
+
+// SyncImage exports the image of the source provider to a temporary raw image and
+// creates the image on the target provider from it, ctx configures the source and
+// targetCtx the target
+func SyncImage(source ImageExporter, ctx *Context, target Provider, targetCtx *Context, image string) error {
+	dir, err := ioutil.TempDir("", "ops-image-sync")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	imagePath := path.Join(dir, image+".img")
+
+	fmt.Printf("Exporting image %s\n", image)
+	err = source.ExportImage(ctx, image, imagePath)
+	if err != nil {
+		return fmt.Errorf("export image %s: %v", image, err)
+	}
+
+	return ImportImage(targetCtx, target, image, imagePath)
+}
+
+// ImportImage creates the image on the provider from the local raw image
+func ImportImage(ctx *Context, p Provider, image, imagePath string) error {
+	c := ctx.Config()
+	c.RunConfig.Imagename = imagePath
+	c.CloudConfig.ImageName = image
+
+	archive, err := p.CustomizeImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	return p.CreateImage(ctx, archive)
+}
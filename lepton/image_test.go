@@ -0,0 +1,80 @@
+package lepton_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+func TestExtractArchiveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ops-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	disk := path.Join(dir, "disk.raw")
+	if err := ioutil.WriteFile(disk, []byte("nanos"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := path.Join(dir, "image.tar.gz")
+	if err := lepton.CreateArchive(archive, []string{disk}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("extract", func(t *testing.T) {
+		dst := path.Join(dir, "image.img")
+		if err := lepton.ExtractArchiveFile(archive, "disk.raw", dst); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "nanos" {
+			t.Errorf("got %q", data)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if err := lepton.ExtractArchiveFile(archive, "other.raw", path.Join(dir, "other.img")); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestFindImageByHash(t *testing.T) {
+	images := []lepton.CloudImage{
+		{ID: "ami-1", Name: "web", Hash: "1234"},
+		{ID: "ami-2", Name: "web", Hash: "abcd"},
+		{ID: "ami-3", Name: "api"},
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		image := lepton.FindImageByHash(images, "web", "abcd")
+		if image == nil || image.ID != "ami-2" {
+			t.Errorf("got %+v want ami-2", image)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		if image := lepton.FindImageByHash(images, "web", "ef01"); image != nil {
+			t.Errorf("got %+v want nil", image)
+		}
+	})
+
+	t.Run("other name", func(t *testing.T) {
+		if image := lepton.FindImageByHash(images, "api", "abcd"); image != nil {
+			t.Errorf("got %+v want nil", image)
+		}
+	})
+
+	t.Run("image without hash", func(t *testing.T) {
+		if image := lepton.FindImageByHash(images, "api", ""); image != nil {
+			t.Errorf("got %+v want nil", image)
+		}
+	})
+}
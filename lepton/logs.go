@@ -0,0 +1,116 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLogsSinceNotSupported is used when a provider console output has no timestamps to filter by
+	ErrLogsSinceNotSupported = errors.New("--since is not supported by this provider")
+)
+
+var (
+	// WatchLogsInterval is the interval between console output requests when watching logs
+	WatchLogsInterval = 5 * time.Second
+)
+
+// LogOptions specifies how instance logs are printed
+type LogOptions struct {
+	// Watch keeps printing new output until interrupted
+	Watch bool
+
+	// Since prints only output written after this time
+	Since time.Time
+
+	// Tail prints only the last Tail lines of the existing output, 0 prints everything
+	Tail int
+
+	// Output is where logs are printed, stdout if nil
+	Output io.Writer
+}
+
+// Writer returns the writer logs are printed to
+func (o LogOptions) Writer() io.Writer {
+	if o.Output == nil {
+		return os.Stdout
+	}
+	return o.Output
+}
+
+// TailLines returns the last n lines of logs, or every line if n is not positive
+func TailLines(logs string, n int) string {
+	if n <= 0 {
+		return logs
+	}
+
+	end := len(logs)
+	if strings.HasSuffix(logs, "\n") {
+		end--
+	}
+
+	for i := end - 1; i >= 0; i-- {
+		if logs[i] == '\n' {
+			n--
+			if n == 0 {
+				return logs[i+1:]
+			}
+		}
+	}
+
+	return logs
+}
+
+// NewLogOutput returns the output of current console snapshot that was not in the
+// previous snapshot. Providers return a window with the latest console output, so
+// the longest end of the previous snapshot that starts the current one is skipped.
+func NewLogOutput(previous, current string) string {
+	if strings.HasPrefix(current, previous) {
+		return current[len(previous):]
+	}
+
+	k := len(current)
+	if len(previous) < k {
+		k = len(previous)
+	}
+
+	for ; k > 0; k-- {
+		if current[k-1] == previous[len(previous)-1] && strings.HasSuffix(previous, current[:k]) {
+			return current[k:]
+		}
+	}
+
+	return current
+}
+
+// PrintLogs prints the console output returned by getLogs applying the options.
+// When watching, console output is polled and only new output is printed.
+func PrintLogs(w io.Writer, opts LogOptions, getLogs func() (string, error)) error {
+	if !opts.Since.IsZero() {
+		return ErrLogsSinceNotSupported
+	}
+
+	logs, err := getLogs()
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, TailLines(logs, opts.Tail))
+
+	for opts.Watch {
+		time.Sleep(WatchLogsInterval)
+
+		current, err := getLogs()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprint(w, NewLogOutput(logs, current))
+		logs = current
+	}
+
+	return nil
+}
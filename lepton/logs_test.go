@@ -0,0 +1,83 @@
+package lepton_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+func TestTailLines(t *testing.T) {
+	logs := "booting\nlistening\nrequest\n"
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, logs},
+		{1, "request\n"},
+		{2, "listening\nrequest\n"},
+		{5, logs},
+	}
+
+	for _, tt := range tests {
+		got := lepton.TailLines(logs, tt.n)
+		if got != tt.want {
+			t.Errorf("TailLines(%d) got %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestNewLogOutput(t *testing.T) {
+	t.Run("should return output appended to previous output", func(t *testing.T) {
+		got := lepton.NewLogOutput("booting\n", "booting\nlistening\n")
+		want := "listening\n"
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("should return output after previous output when the window moved", func(t *testing.T) {
+		got := lepton.NewLogOutput("booting\nlistening\n", "listening\nrequest\n")
+		want := "request\n"
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("should return every output if previous output is gone", func(t *testing.T) {
+		got := lepton.NewLogOutput("booting\n", "request\n")
+		want := "request\n"
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestPrintLogs(t *testing.T) {
+	t.Run("should print the last lines", func(t *testing.T) {
+		var b bytes.Buffer
+		err := lepton.PrintLogs(&b, lepton.LogOptions{Tail: 1}, func() (string, error) {
+			return "booting\nlistening\n", nil
+		})
+
+		if err != nil || b.String() != "listening\n" {
+			t.Errorf("got %q (%v), want %q", b.String(), err, "listening\n")
+		}
+	})
+
+	t.Run("should return error if since is specified", func(t *testing.T) {
+		var b bytes.Buffer
+		err := lepton.PrintLogs(&b, lepton.LogOptions{Since: time.Now()}, func() (string, error) {
+			return "", nil
+		})
+
+		if err != lepton.ErrLogsSinceNotSupported {
+			t.Errorf("got %v, want %v", err, lepton.ErrLogsSinceNotSupported)
+		}
+	})
+}
@@ -234,6 +234,8 @@ func ExtractPackage(archive string, dest string) {
 
 // BuildImageFromPackage builds nanos image using a package
 func BuildImageFromPackage(packagepath string, c types.Config) error {
+	defer cleanup(&c)
+
 	m, err := BuildPackageManifest(packagepath, &c)
 	if err != nil {
 		return errors.Wrap(err, 1)
@@ -40,7 +40,7 @@ type Provider interface {
 	StopInstance(ctx *Context, instancename string) error
 	StartInstance(ctx *Context, instancename string) error
 	GetInstanceLogs(ctx *Context, instancename string) (string, error)
-	PrintInstanceLogs(ctx *Context, instancename string, watch bool) error
+	PrintInstanceLogs(ctx *Context, instancename string, opts LogOptions) error
 
 	VolumeService
 }
@@ -59,6 +59,17 @@ type VolumeService interface {
 	DetachVolume(ctx *Context, image, name string) error
 }
 
+// VolumeSnapshotService is implemented by the providers which can snapshot and clone volumes
+type VolumeSnapshotService interface {
+	SnapshotVolume(ctx *Context, name string) (NanosVolume, error)
+	CloneVolume(ctx *Context, name, newName string) (NanosVolume, error)
+}
+
+// VolumeResizeService is implemented by the providers which can grow volumes
+type VolumeResizeService interface {
+	ResizeVolume(ctx *Context, name string, size VolumeSize) (NanosVolume, error)
+}
+
 // DNSRecord is ops representation of a dns record
 type DNSRecord struct {
 	Name string
@@ -0,0 +1,245 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Readiness probe types
+const (
+	ProbeTCP  = "tcp"
+	ProbeHTTP = "http"
+	ProbeLog  = "log"
+)
+
+var (
+	// DefaultReadyTimeout is the time waited for an instance to be ready when no timeout is specified
+	DefaultReadyTimeout = 5 * time.Minute
+
+	// ReadyCheckInterval is the interval between readiness checks
+	ReadyCheckInterval = 2 * time.Second
+)
+
+// ReadinessProbe specifies the condition an instance must satisfy to be ready
+type ReadinessProbe struct {
+	Type string
+
+	// Host is the address probed, when empty the instance address is used
+	Host string
+
+	// Port is the port probed by tcp and http probes
+	Port int
+
+	// URL is the address requested by http probes
+	URL *url.URL
+
+	// Pattern is the text searched in the instance logs by log probes
+	Pattern string
+}
+
+// ParseReadinessProbe parses probes with the format tcp:[host:]port, http[s]://[host]:port/path or log:pattern
+func ParseReadinessProbe(spec string) (*ReadinessProbe, error) {
+	switch {
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid readiness probe \"%s\": %v", spec, err)
+		}
+
+		probe := &ReadinessProbe{Type: ProbeHTTP, Host: u.Hostname(), URL: u}
+		if u.Port() == "" {
+			probe.Port = 80
+			if u.Scheme == "https" {
+				probe.Port = 443
+			}
+		} else if probe.Port, err = strconv.Atoi(u.Port()); err != nil {
+			return nil, fmt.Errorf("invalid readiness probe \"%s\": invalid port", spec)
+		}
+
+		return probe, nil
+	case strings.HasPrefix(spec, ProbeTCP+":"):
+		address := strings.TrimPrefix(spec, ProbeTCP+":")
+
+		host := ""
+		port := address
+		if strings.Contains(address, ":") {
+			var err error
+			host, port, err = net.SplitHostPort(address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid readiness probe \"%s\": %v", spec, err)
+			}
+		}
+
+		portNumber, err := strconv.Atoi(port)
+		if err != nil || portNumber <= 0 || portNumber > 65535 {
+			return nil, fmt.Errorf("invalid readiness probe \"%s\": invalid port", spec)
+		}
+
+		return &ReadinessProbe{Type: ProbeTCP, Host: host, Port: portNumber}, nil
+	case strings.HasPrefix(spec, ProbeLog+":"):
+		pattern := strings.Trim(strings.TrimPrefix(spec, ProbeLog+":"), "\"'")
+		if pattern == "" {
+			return nil, fmt.Errorf("invalid readiness probe \"%s\": empty pattern", spec)
+		}
+
+		return &ReadinessProbe{Type: ProbeLog, Pattern: pattern}, nil
+	}
+
+	return nil, fmt.Errorf("invalid readiness probe \"%s\": expected tcp:port, http://:port/path or log:pattern", spec)
+}
+
+// NeedsAddress returns true if the probe connects to the instance
+func (p *ReadinessProbe) NeedsAddress() bool {
+	return p.Type == ProbeTCP || p.Type == ProbeHTTP
+}
+
+// Address returns the address probed using host if the probe has no host
+func (p *ReadinessProbe) Address(host string) string {
+	if p.Host != "" {
+		host = p.Host
+	}
+
+	switch p.Type {
+	case ProbeHTTP:
+		u := *p.URL
+		u.Host = net.JoinHostPort(host, strconv.Itoa(p.Port))
+		return u.String()
+	case ProbeTCP:
+		return net.JoinHostPort(host, strconv.Itoa(p.Port))
+	}
+
+	return host
+}
+
+// Check returns nil if the probe succeeds against host, logs are only requested by log probes
+func (p *ReadinessProbe) Check(host string, logs func() (string, error)) error {
+	switch p.Type {
+	case ProbeTCP:
+		conn, err := net.DialTimeout("tcp", p.Address(host), ReadyCheckInterval)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case ProbeHTTP:
+		client := http.Client{Timeout: ReadyCheckInterval}
+		resp, err := client.Get(p.Address(host))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("%s returned %s", p.Address(host), resp.Status)
+		}
+		return nil
+	case ProbeLog:
+		output, err := logs()
+		if err != nil {
+			return err
+		}
+
+		if !strings.Contains(output, p.Pattern) {
+			return fmt.Errorf("\"%s\" not found in logs", p.Pattern)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown readiness probe type \"%s\"", p.Type)
+}
+
+// WaitForReadyOptions specifies what WaitForReady waits for
+type WaitForReadyOptions struct {
+	// Probe is checked once the instance is running, it may be nil
+	Probe *ReadinessProbe
+
+	// PublicIP waits until the instance has a public ip
+	PublicIP bool
+
+	Timeout time.Duration
+}
+
+// WaitForReady waits until the instance is running, has the addresses required and
+// the probe succeeds. It returns the address the instance is reachable at.
+func WaitForReady(ctx *Context, p Provider, instanceName string, opts WaitForReadyOptions) (string, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	lastErr := errors.New("instance not found")
+	for {
+		address, err := checkReady(ctx, p, instanceName, opts)
+		if err == nil {
+			return address, nil
+		}
+		lastErr = err
+
+		if time.Now().Add(ReadyCheckInterval).After(deadline) {
+			return "", fmt.Errorf("instance \"%s\" not ready after %v: %v", instanceName, timeout, lastErr)
+		}
+		time.Sleep(ReadyCheckInterval)
+	}
+}
+
+func checkReady(ctx *Context, p Provider, instanceName string, opts WaitForReadyOptions) (string, error) {
+	instance, err := p.GetInstanceByID(ctx, instanceName)
+	if err != nil {
+		return "", err
+	}
+
+	if !isRunningStatus(instance.Status) {
+		return "", fmt.Errorf("instance status is %s", instance.Status)
+	}
+
+	host := firstAddress(instance.PublicIps)
+	if host == "" && opts.PublicIP {
+		return "", errors.New("instance has no public ip")
+	}
+	if host == "" {
+		host = firstAddress(instance.PrivateIps)
+	}
+
+	probe := opts.Probe
+	if probe == nil {
+		return host, nil
+	}
+
+	if probe.NeedsAddress() && host == "" && probe.Host == "" {
+		return "", errors.New("instance has no ip address")
+	}
+
+	err = probe.Check(host, func() (string, error) {
+		return p.GetInstanceLogs(ctx, instanceName)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return probe.Address(host), nil
+}
+
+// isRunningStatus returns true for the running status of every provider, providers
+// that do not report a status are considered running
+func isRunningStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "", "running", "active", "poweredon", "started":
+		return true
+	}
+	return false
+}
+
+func firstAddress(addresses []string) string {
+	for _, a := range addresses {
+		if a = strings.TrimSpace(a); a != "" {
+			return a
+		}
+	}
+	return ""
+}
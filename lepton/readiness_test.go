@@ -0,0 +1,116 @@
+package lepton_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+func TestParseReadinessProbe(t *testing.T) {
+	tests := []struct {
+		spec    string
+		kind    string
+		host    string
+		port    int
+		pattern string
+	}{
+		{"tcp:8080", lepton.ProbeTCP, "", 8080, ""},
+		{"tcp:10.0.0.2:8080", lepton.ProbeTCP, "10.0.0.2", 8080, ""},
+		{"http://:8080/health", lepton.ProbeHTTP, "", 8080, ""},
+		{"http://example.com/health", lepton.ProbeHTTP, "example.com", 80, ""},
+		{"https://:8443/", lepton.ProbeHTTP, "", 8443, ""},
+		{"log:listening", lepton.ProbeLog, "", 0, "listening"},
+		{`log:"listening on"`, lepton.ProbeLog, "", 0, "listening on"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			probe, err := lepton.ParseReadinessProbe(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if probe.Type != tt.kind || probe.Host != tt.host || probe.Port != tt.port || probe.Pattern != tt.pattern {
+				t.Errorf("got %+v", probe)
+			}
+		})
+	}
+
+	for _, spec := range []string{"8080", "tcp:", "tcp:http", "tcp:70000", "log:", "udp:53"} {
+		t.Run("invalid "+spec, func(t *testing.T) {
+			if _, err := lepton.ParseReadinessProbe(spec); err == nil {
+				t.Errorf("expected error parsing \"%s\"", spec)
+			}
+		})
+	}
+}
+
+func TestReadinessProbeAddress(t *testing.T) {
+	probe, _ := lepton.ParseReadinessProbe("http://:8080/health")
+	if got := probe.Address("10.0.0.2"); got != "http://10.0.0.2:8080/health" {
+		t.Errorf("got %s", got)
+	}
+
+	probe, _ = lepton.ParseReadinessProbe("tcp:127.0.0.1:8080")
+	if got := probe.Address("10.0.0.2"); got != "127.0.0.1:8080" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestReadinessProbeCheck(t *testing.T) {
+	noLogs := func() (string, error) { return "", nil }
+
+	t.Run("tcp", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		probe, _ := lepton.ParseReadinessProbe("tcp:" + strconv.Itoa(port))
+		if err := probe.Check("127.0.0.1", noLogs); err != nil {
+			t.Errorf("expected probe to succeed: %v", err)
+		}
+
+		listener.Close()
+		if err := probe.Check("127.0.0.1", noLogs); err == nil {
+			t.Error("expected probe to fail with listener closed")
+		}
+	})
+
+	t.Run("http", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+		port := server.Listener.Addr().(*net.TCPAddr).Port
+
+		probe, _ := lepton.ParseReadinessProbe("http://:" + strconv.Itoa(port) + "/health")
+		if err := probe.Check("127.0.0.1", noLogs); err != nil {
+			t.Errorf("expected probe to succeed: %v", err)
+		}
+
+		probe, _ = lepton.ParseReadinessProbe("http://:" + strconv.Itoa(port) + "/starting")
+		if err := probe.Check("127.0.0.1", noLogs); err == nil {
+			t.Error("expected probe to fail with error status")
+		}
+	})
+
+	t.Run("log", func(t *testing.T) {
+		probe, _ := lepton.ParseReadinessProbe("log:listening")
+
+		if err := probe.Check("", func() (string, error) { return "booting\n", nil }); err == nil {
+			t.Error("expected probe to fail before pattern is logged")
+		}
+
+		if err := probe.Check("", func() (string, error) { return "booting\nlistening on 8080\n", nil }); err != nil {
+			t.Errorf("expected probe to succeed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package lepton
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the local state
+const (
+	StateImages    = "images"
+	StateInstances = "instances"
+	StateVolumes   = "volumes"
+	StateNetworks  = "networks"
+)
+
+const (
+	stateMeta       = "meta"
+	stateVersionKey = "version"
+
+	// stateVolumeDirPrefix marks the volume directories already imported
+	stateVolumeDirPrefix = "volumes-dir:"
+)
+
+// StateLockTimeout is how long ops waits for other ops processes to release the local state
+var StateLockTimeout = 30 * time.Second
+
+// stateMigrations upgrade the local state, the version of the state is the number
+// of migrations applied
+var stateMigrations = []func(tx *bolt.Tx) error{
+	migrateLegacyState,
+}
+
+// StatePath returns the path of the database with the local state
+func StatePath() string {
+	return path.Join(GetOpsHome(), "state.db")
+}
+
+// StateTx is a transaction on the local state, values are saved as JSON
+type StateTx struct {
+	tx *bolt.Tx
+}
+
+// Get decodes the value saved with the key in v, it returns false if there is no such value
+func (t *StateTx) Get(bucket, key string, v interface{}) (bool, error) {
+	data := t.tx.Bucket([]byte(bucket)).Get([]byte(key))
+	if data == nil {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(data, v)
+}
+
+// Put saves the value with the key
+func (t *StateTx) Put(bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return t.tx.Bucket([]byte(bucket)).Put([]byte(key), data)
+}
+
+// Delete removes the value saved with the key
+func (t *StateTx) Delete(bucket, key string) error {
+	return t.tx.Bucket([]byte(bucket)).Delete([]byte(key))
+}
+
+// ForEach calls fn with the values of the bucket in key order
+func (t *StateTx) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	return t.tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+		return fn(string(k), v)
+	})
+}
+
+// UpdateState runs fn in a read-write transaction on the local state, the changes
+// are discarded if fn returns an error. Other ops processes wait until it returns.
+func UpdateState(fn func(tx *StateTx) error) error {
+	db, err := openState(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		return fn(&StateTx{tx: tx})
+	})
+}
+
+// ViewState runs fn in a read-only transaction on the local state
+func ViewState(fn func(tx *StateTx) error) error {
+	db, err := openState(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		return fn(&StateTx{tx: tx})
+	})
+}
+
+// openState opens the local state database, locking it, and migrates it to the
+// current version. Read-only databases are shared with other readers.
+func openState(readOnly bool) (*bolt.DB, error) {
+	if _, err := os.Stat(StatePath()); err != nil {
+		readOnly = false
+	}
+
+	db, err := openStateDB(readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	var version int
+	err = db.View(func(tx *bolt.Tx) (err error) {
+		version, err = stateVersion(tx)
+		return
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if version > len(stateMigrations) {
+		db.Close()
+		return nil, fmt.Errorf("local state %s was written by a newer version of ops", StatePath())
+	}
+
+	if version == len(stateMigrations) {
+		return db, nil
+	}
+
+	if readOnly {
+		db.Close()
+		db, err = openStateDB(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.Update(migrateState)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot migrate local state: %v", err)
+	}
+
+	return db, nil
+}
+
+func openStateDB(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(StatePath(), 0644, &bolt.Options{Timeout: StateLockTimeout, ReadOnly: readOnly})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("local state %s is locked by another ops process", StatePath())
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot open local state: %v", err)
+	}
+
+	return db, nil
+}
+
+func stateVersion(tx *bolt.Tx) (int, error) {
+	meta := tx.Bucket([]byte(stateMeta))
+	if meta == nil {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(string(meta.Get([]byte(stateVersionKey))))
+	if err != nil {
+		return 0, errors.New("invalid local state version")
+	}
+
+	return version, nil
+}
+
+// migrateState applies the migrations the state is missing, another process may
+// have migrated it in the meantime
+func migrateState(tx *bolt.Tx) error {
+	version, err := stateVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	for ; version < len(stateMigrations); version++ {
+		err = stateMigrations[version](tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	meta, err := tx.CreateBucketIfNotExists([]byte(stateMeta))
+	if err != nil {
+		return err
+	}
+
+	return meta.Put([]byte(stateVersionKey), []byte(strconv.Itoa(version)))
+}
+
+// migrateLegacyState creates the buckets and imports the state ops saved in files:
+// the instance files named after their pid, the volumes attached to the images, the
+// compose projects with their network and the volumes of the ops home. The files
+// are removed once the state is saved.
+func migrateLegacyState(tx *bolt.Tx) error {
+	for _, name := range []string{StateImages, StateInstances, StateVolumes, StateNetworks} {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+
+	opshome := GetOpsHome()
+	var imported []string
+
+	files, _ := ioutil.ReadDir(path.Join(opshome, "instances"))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		file := path.Join(opshome, "instances", f.Name())
+		var i map[string]interface{}
+		if err := readLegacyState(file, &i); err != nil {
+			return err
+		}
+		i["created"] = f.ModTime()
+
+		if err := putState(tx, StateInstances, f.Name(), i); err != nil {
+			return err
+		}
+		imported = append(imported, file)
+	}
+
+	files, _ = ioutil.ReadDir(path.Join(opshome, "images"))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".volumes") {
+			continue
+		}
+
+		file := path.Join(opshome, "images", f.Name())
+		var vols json.RawMessage
+		if err := readLegacyState(file, &vols); err != nil {
+			return err
+		}
+
+		image := strings.TrimSuffix(file, ".volumes")
+		record := map[string]interface{}{"path": image, "volumes": vols}
+		if err := putState(tx, StateImages, image, record); err != nil {
+			return err
+		}
+		imported = append(imported, file)
+	}
+
+	files, _ = ioutil.ReadDir(path.Join(opshome, "compose"))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+
+		file := path.Join(opshome, "compose", f.Name())
+		var project json.RawMessage
+		if err := readLegacyState(file, &project); err != nil {
+			return err
+		}
+
+		if err := putState(tx, StateNetworks, strings.TrimSuffix(f.Name(), ".json"), project); err != nil {
+			return err
+		}
+		imported = append(imported, file)
+	}
+
+	err := importVolumes(&StateTx{tx: tx}, path.Join(opshome, "volumes"))
+	if err != nil {
+		return err
+	}
+
+	tx.OnCommit(func() {
+		for _, file := range imported {
+			os.Remove(file)
+		}
+	})
+
+	return nil
+}
+
+func readLegacyState(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("cannot import %s: %v", file, err)
+	}
+
+	return nil
+}
+
+func putState(tx *bolt.Tx, bucket, key string, v interface{}) error {
+	return (&StateTx{tx: tx}).Put(bucket, key, v)
+}
@@ -0,0 +1,177 @@
+package lepton_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+func setTestOpsHome(t *testing.T) string {
+	home, err := ioutil.TempDir("", "ops-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+	t.Setenv("HOME", home)
+
+	return lepton.GetOpsHome()
+}
+
+func writeLegacyState(t *testing.T, opshome string, files map[string]string) {
+	for name, content := range files {
+		file := path.Join(opshome, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStateMigration(t *testing.T) {
+	opshome := setTestOpsHome(t)
+
+	writeLegacyState(t, opshome, map[string]string{
+		"instances/4242":                "{\"instance\": \"web\", \"image\": \"web.img\"}",
+		"images/web.img.volumes":        "[{\"name\": \"data\", \"path\": \"/tmp/data.raw\", \"mount_path\": \"/data\"}]",
+		"compose/shop.json":             "{\"Project\": \"shop\", \"Bridge\": \"ops-shop\"}",
+		"volumes/data:1234-5678.raw":    "",
+		"volumes/scratch:abcd-efgh.raw": "",
+	})
+	err := os.Symlink(path.Join(opshome, "volumes", "data:1234-5678.raw"), path.Join(opshome, "volumes", "data.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make(map[string][]string)
+	var created map[string]interface{}
+	err = lepton.ViewState(func(tx *lepton.StateTx) error {
+		for _, bucket := range []string{lepton.StateImages, lepton.StateInstances, lepton.StateVolumes, lepton.StateNetworks} {
+			err := tx.ForEach(bucket, func(key string, value []byte) error {
+				keys[bucket] = append(keys[bucket], key)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Get(lepton.StateInstances, "4242", &created)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys[lepton.StateInstances]) != 1 || created["instance"] != "web" || created["created"] == nil {
+		t.Errorf("instances: got %v %v", keys[lepton.StateInstances], created)
+	}
+	if len(keys[lepton.StateImages]) != 1 || !strings.HasSuffix(keys[lepton.StateImages][0], "web.img") {
+		t.Errorf("images: got %v", keys[lepton.StateImages])
+	}
+	if len(keys[lepton.StateNetworks]) != 1 || keys[lepton.StateNetworks][0] != "shop" {
+		t.Errorf("networks: got %v", keys[lepton.StateNetworks])
+	}
+	if len(keys[lepton.StateVolumes]) != 2 {
+		t.Errorf("volumes: got %v", keys[lepton.StateVolumes])
+	}
+
+	for _, file := range []string{"instances/4242", "images/web.img.volumes", "compose/shop.json"} {
+		if _, err := os.Stat(path.Join(opshome, file)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", file)
+		}
+	}
+
+	vols, err := lepton.LocalVolumes(path.Join(opshome, "volumes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, vol := range vols {
+		if vol.ID == "1234-5678" && vol.Label != "data" {
+			t.Errorf("volume %s: got label %q", vol.ID, vol.Label)
+		}
+	}
+}
+
+func TestUpdateStateConcurrent(t *testing.T) {
+	setTestOpsHome(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for n := 0; n < 20; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- lepton.UpdateState(func(tx *lepton.StateTx) error {
+				var count int
+				if _, err := tx.Get(lepton.StateNetworks, "count", &count); err != nil {
+					return err
+				}
+				return tx.Put(lepton.StateNetworks, "count", count+1)
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var count int
+	err := lepton.ViewState(func(tx *lepton.StateTx) (err error) {
+		_, err = tx.Get(lepton.StateNetworks, "count", &count)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 20 {
+		t.Errorf("got %d updates, want 20", count)
+	}
+}
+
+func TestStateLocked(t *testing.T) {
+	setTestOpsHome(t)
+
+	oldTimeout := lepton.StateLockTimeout
+	lepton.StateLockTimeout = 100 * time.Millisecond
+	defer func() { lepton.StateLockTimeout = oldTimeout }()
+
+	err := lepton.UpdateState(func(tx *lepton.StateTx) error {
+		return lepton.ViewState(func(tx *lepton.StateTx) error { return nil })
+	})
+	if err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("expected locked error, got %v", err)
+	}
+}
+
+func TestLocalVolumesReadLocked(t *testing.T) {
+	opshome := setTestOpsHome(t)
+	dir := path.Join(opshome, "volumes")
+
+	if _, err := lepton.LocalVolumes(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	oldTimeout := lepton.StateLockTimeout
+	lepton.StateLockTimeout = 100 * time.Millisecond
+	defer func() { lepton.StateLockTimeout = oldTimeout }()
+
+	// the volumes of an imported directory are listed while other processes read the state
+	err := lepton.ViewState(func(tx *lepton.StateTx) error {
+		_, err := lepton.LocalVolumes(dir)
+		return err
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
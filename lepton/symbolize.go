@@ -0,0 +1,257 @@
+package lepton
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// symbolizeAddressRegexp matches the addresses printed in nanos fault dumps and
+// stack traces, with a 0x prefix or as 16 hexadecimal digits
+var symbolizeAddressRegexp = regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|[0-9a-fA-F]{16})\b`)
+
+// symbolizeFramesRegexp matches the header of the frame trace of nanos fault dumps,
+// the addresses of the frames that follow are return addresses
+var symbolizeFramesRegexp = regexp.MustCompile(`(?i)^\s*frame trace:?\s*$`)
+
+// SourceLocation is the function and source line an address of a program belongs to
+type SourceLocation struct {
+	Function string
+	Offset   uint64
+	File     string
+	Line     int
+}
+
+func (l SourceLocation) String() string {
+	var sb strings.Builder
+	sb.WriteString(l.Function)
+	if l.Offset != 0 {
+		sb.WriteString(fmt.Sprintf("+0x%x", l.Offset))
+	}
+	if l.File != "" {
+		sb.WriteString(fmt.Sprintf(" at %s:%d", l.File, l.Line))
+	}
+	return sb.String()
+}
+
+// Symbolizer resolves addresses of a program with its symbol table and its DWARF
+// line information
+type Symbolizer struct {
+	// base is the address the program is loaded at, it is only added to the
+	// addresses of position independent programs
+	base      uint64
+	symbols   []elf.Symbol
+	lines     *dwarf.Data
+	units     []symbolizeUnit
+	textStart uint64
+	textEnd   uint64
+}
+
+type symbolizeUnit struct {
+	entry  *dwarf.Entry
+	ranges [][2]uint64
+}
+
+// NewSymbolizer reads the symbols of the program. The load base is required for
+// position independent programs, which are loaded at a random address unless
+// the instance runs without address space layout randomization, and ignored for
+// other programs.
+func NewSymbolizer(programPath string, base uint64) (*Symbolizer, error) {
+	f, err := elf.Open(programPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &Symbolizer{}
+	if f.Type == elf.ET_DYN {
+		// position independent programs are never loaded at address 0
+		if base == 0 {
+			return nil, fmt.Errorf("%s is position independent, the address it is loaded at is required", programPath)
+		}
+		s.base = base
+	}
+
+	symbols, err := f.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	for _, sym := range symbols {
+		if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 {
+			s.symbols = append(s.symbols, sym)
+		}
+	}
+	sort.Slice(s.symbols, func(i, j int) bool { return s.symbols[i].Value < s.symbols[j].Value })
+
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || p.Flags&elf.PF_X == 0 {
+			continue
+		}
+		if s.textEnd == 0 || p.Vaddr < s.textStart {
+			s.textStart = p.Vaddr
+		}
+		if p.Vaddr+p.Memsz > s.textEnd {
+			s.textEnd = p.Vaddr + p.Memsz
+		}
+	}
+
+	// programs without debugging information are resolved to functions only
+	if s.lines, err = f.DWARF(); err == nil {
+		s.readUnits()
+	}
+
+	if len(s.symbols) == 0 && len(s.units) == 0 {
+		return nil, fmt.Errorf("%s has no symbols", programPath)
+	}
+
+	return s, nil
+}
+
+func (s *Symbolizer) readUnits() {
+	r := s.lines.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil || entry == nil {
+			return
+		}
+
+		if entry.Tag == dwarf.TagCompileUnit {
+			if ranges, err := s.lines.Ranges(entry); err == nil && len(ranges) > 0 {
+				s.units = append(s.units, symbolizeUnit{entry: entry, ranges: ranges})
+			}
+		}
+		r.SkipChildren()
+	}
+}
+
+// Lookup returns the source location of a runtime address of the program
+func (s *Symbolizer) Lookup(addr uint64) (SourceLocation, bool) {
+	if addr < s.base {
+		return SourceLocation{}, false
+	}
+	pc := addr - s.base
+
+	if pc < s.textStart || pc >= s.textEnd {
+		return SourceLocation{}, false
+	}
+
+	var location SourceLocation
+	found := false
+
+	i := sort.Search(len(s.symbols), func(i int) bool { return s.symbols[i].Value > pc }) - 1
+	if i >= 0 {
+		sym := s.symbols[i]
+		if sym.Size == 0 || pc < sym.Value+sym.Size {
+			location.Function = sym.Name
+			location.Offset = pc - sym.Value
+			found = true
+		}
+	}
+
+	if file, line, ok := s.lookupLine(pc); ok {
+		location.File, location.Line = file, line
+		if location.Function == "" {
+			location.Function = "??"
+		}
+		found = true
+	}
+
+	return location, found
+}
+
+func (s *Symbolizer) lookupLine(pc uint64) (string, int, bool) {
+	for _, unit := range s.units {
+		for _, r := range unit.ranges {
+			if pc < r[0] || pc >= r[1] {
+				continue
+			}
+
+			lr, err := s.lines.LineReader(unit.entry)
+			if err != nil || lr == nil {
+				return "", 0, false
+			}
+
+			var entry dwarf.LineEntry
+			if err := lr.SeekPC(pc, &entry); err != nil {
+				return "", 0, false
+			}
+			return entry.File.Name, entry.Line, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// SymbolizeLine appends the source locations of the program addresses found in
+// the line
+func (s *Symbolizer) SymbolizeLine(line string) string {
+	return s.symbolizeLine(line, false)
+}
+
+// symbolizeLine appends the source locations of the addresses of the line. The
+// return addresses of frames are looked up one byte before, as they are the address
+// of the instruction after the call.
+func (s *Symbolizer) symbolizeLine(line string, frame bool) string {
+	var locations []string
+	for _, match := range symbolizeAddressRegexp.FindAllString(line, -1) {
+		addr, err := strconv.ParseUint(strings.TrimPrefix(match, "0x"), 16, 64)
+		if err != nil {
+			continue
+		}
+
+		if frame && addr > 0 {
+			addr--
+		}
+
+		if location, ok := s.Lookup(addr); ok {
+			locations = append(locations, location.String())
+		}
+	}
+
+	if len(locations) == 0 {
+		return line
+	}
+
+	return line + "  <- " + strings.Join(locations, ", ")
+}
+
+// Symbolize copies the console output from r to w resolving the program addresses
+func (s *Symbolizer) Symbolize(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReader(r)
+	frames := false
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			newline := strings.HasSuffix(line, "\n")
+			line = strings.TrimRight(line, "\r\n")
+
+			// the frame trace ends with the first line without address
+			if symbolizeFramesRegexp.MatchString(line) {
+				frames = true
+			} else if !symbolizeAddressRegexp.MatchString(line) {
+				frames = false
+			}
+
+			line = s.symbolizeLine(line, frames)
+			if newline {
+				line += "\n"
+			}
+
+			if _, werr := io.WriteString(w, line); werr != nil {
+				return werr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package lepton_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+const symbolizeTestProgram = `package main
+
+func main() {
+	println("crash")
+}
+`
+
+// buildSymbolizeTestProgram builds a program with debugging information in the build
+// mode, the test binary is stripped
+func buildSymbolizeTestProgram(t *testing.T, buildMode string) (program string, mainAddr uint64) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+
+	dir, err := ioutil.TempDir("", "symbolize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	source := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(source, []byte(symbolizeTestProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	program = filepath.Join(dir, "program")
+	cmd := exec.Command("go", "build", "-buildmode="+buildMode, "-o", program, source)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=off", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("cannot build test program: %v\n%s", err, out)
+	}
+
+	f, err := elf.Open(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	symbols, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sym := range symbols {
+		if sym.Name == "main.main" {
+			return program, sym.Value
+		}
+	}
+
+	t.Fatal("main.main not found")
+	return
+}
+
+func TestSymbolizer(t *testing.T) {
+	program, mainAddr := buildSymbolizeTestProgram(t, "exe")
+
+	s, err := lepton.NewSymbolizer(program, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("lookup", func(t *testing.T) {
+		location, ok := s.Lookup(mainAddr)
+		if !ok {
+			t.Fatalf("address %x not found", mainAddr)
+		}
+
+		if location.Function != "main.main" || location.Offset != 0 {
+			t.Errorf("function: got %s+%x", location.Function, location.Offset)
+		}
+		if filepath.Base(location.File) != "main.go" || location.Line != 3 {
+			t.Errorf("line: got %s:%d", location.File, location.Line)
+		}
+	})
+
+	t.Run("unknown address", func(t *testing.T) {
+		if _, ok := s.Lookup(0x10); ok {
+			t.Error("expected no location")
+		}
+	})
+
+	t.Run("log", func(t *testing.T) {
+		log := fmt.Sprintf("en1: assigned 10.0.2.15\n rip: %016x\nframe trace:\n", mainAddr)
+
+		var out bytes.Buffer
+		err := s.Symbolize(strings.NewReader(log), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(out.String(), "\n")
+		if lines[0] != "en1: assigned 10.0.2.15" || lines[2] != "frame trace:" {
+			t.Errorf("unexpected lines %q", lines)
+		}
+
+		if !strings.HasPrefix(lines[1], fmt.Sprintf(" rip: %016x  <- main.main at ", mainAddr)) || !strings.HasSuffix(lines[1], "main.go:3") {
+			t.Errorf("got %q", lines[1])
+		}
+	})
+
+	t.Run("frame trace", func(t *testing.T) {
+		// the return address is the address after the call
+		log := fmt.Sprintf(" rip: %016x\nframe trace:\nffffc00000001000:   %016x\n", mainAddr+1, mainAddr+1)
+
+		var out bytes.Buffer
+		err := s.Symbolize(strings.NewReader(log), &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(out.String(), "\n")
+		if !strings.Contains(lines[0], "<- main.main+0x1 at ") {
+			t.Errorf("instruction pointer: got %q", lines[0])
+		}
+		if !strings.Contains(lines[2], "<- main.main at ") {
+			t.Errorf("frame: got %q", lines[2])
+		}
+	})
+}
+
+func TestSymbolizerPositionIndependent(t *testing.T) {
+	program, mainAddr := buildSymbolizeTestProgram(t, "pie")
+
+	t.Run("without load base", func(t *testing.T) {
+		if _, err := lepton.NewSymbolizer(program, 0); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("with load base", func(t *testing.T) {
+		base := uint64(0x555555554000)
+		s, err := lepton.NewSymbolizer(program, base)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		location, ok := s.Lookup(base + mainAddr)
+		if !ok {
+			t.Fatalf("address %x not found", base+mainAddr)
+		}
+		if location.Function != "main.main" || location.Offset != 0 {
+			t.Errorf("function: got %s+%x", location.Function, location.Offset)
+		}
+	})
+}
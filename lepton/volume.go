@@ -2,8 +2,11 @@ package lepton
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/go-errors/errors"
 	"github.com/nanovms/ops/fs"
@@ -13,15 +16,48 @@ import (
 
 // NanosVolume information for nanos-managed volume
 type NanosVolume struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Label      string `json:"label"`
-	Data       string `json:"data"`
-	Size       string `json:"size"`
-	Path       string `json:"path"`
-	AttachedTo string `json:"attached_to"`
-	CreatedAt  string `json:"created_at"`
-	Status     string `json:"status"`
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Label      string     `json:"label"`
+	Data       string     `json:"data"`
+	Size       VolumeSize `json:"size"`
+	Path       string     `json:"path"`
+	AttachedTo string     `json:"attached_to"`
+	CreatedAt  string     `json:"created_at"`
+	Status     string     `json:"status"`
+
+	// Encrypted is true for the volumes encrypted at rest by the cloud provider
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// EncryptionKey is the customer key the volume is encrypted with, it is
+	// empty for volumes encrypted with the provider-managed key
+	EncryptionKey string `json:"encryption_key,omitempty"`
+}
+
+// EncryptionPlatforms are the providers which encrypt volumes and boot disks at rest
+var EncryptionPlatforms = []string{"aws", "gcp", "azure"}
+
+// EncryptionRequired returns true if the configuration requires the volumes and
+// the boot disks to be encrypted at rest
+func EncryptionRequired(c *types.Config) bool {
+	return c.CloudConfig.Encrypt || c.CloudConfig.EncryptionKey != ""
+}
+
+// CheckEncryption returns an error if the configuration requires encryption at
+// rest and the provider of the configuration does not support it
+func CheckEncryption(c *types.Config) error {
+	if !EncryptionRequired(c) {
+		return nil
+	}
+
+	for _, platform := range EncryptionPlatforms {
+		if c.CloudConfig.Platform == platform {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("encryption at rest is not supported on %s, it is supported on %s",
+		c.CloudConfig.Platform, strings.Join(EncryptionPlatforms, ", "))
 }
 
 const (
@@ -33,9 +69,23 @@ const (
 	VolumeDelimiter = ":"
 )
 
-var (
-	errVolumeNotFound = func(id string) error { return errors.Errorf("volume with UUID %s not found", id) }
-)
+// ParseVolumeAttachment splits a <volume>[:<mount path>] argument, the volume is
+// mounted at /<volume> by default
+func ParseVolumeAttachment(arg string) (name, mountPath string, err error) {
+	parts := strings.SplitN(arg, VolumeDelimiter, 2)
+	name = parts[0]
+	mountPath = "/" + name
+
+	if len(parts) == 2 {
+		mountPath = parts[1]
+	}
+
+	if name == "" || mountPath == "" || mountPath[0] != '/' {
+		return "", "", fmt.Errorf("invalid volume \"%s\", use <volume>[:<mount path>]", arg)
+	}
+
+	return
+}
 
 // CreateLocalVolume creates volume on ops directory
 // creates a volume named <name>:<uuid>
@@ -76,6 +126,11 @@ func CreateLocalVolume(config *types.Config, name, data, size, provider string)
 
 	uuid := mkfsCommand.GetUUID()
 
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return vol, err
+	}
+
 	raw := fmt.Sprintf("%s%s%s.raw", name, VolumeDelimiter, uuid)
 	rawPath := path.Join(config.VolumesDir, raw)
 	err = os.Rename(tmpPath, rawPath)
@@ -88,15 +143,100 @@ func CreateLocalVolume(config *types.Config, name, data, size, provider string)
 	}
 
 	vol = NanosVolume{
-		ID:    uuid,
-		Name:  name,
-		Label: name,
-		Data:  data,
-		Path:  rawPath,
+		ID:        uuid,
+		Name:      name,
+		Label:     name,
+		Data:      data,
+		Size:      VolumeSize(info.Size()),
+		Path:      rawPath,
+		CreatedAt: time.Now().String(),
+	}
+	return vol, saveLocalVolume(vol)
+}
+
+// CloneLocalVolume copies the local volume to a volume named <name>:<uuid>, the
+// filesystem of the copy gets a new uuid and the name as label
+func CloneLocalVolume(config *types.Config, vol NanosVolume, name string) (NanosVolume, error) {
+	var clone NanosVolume
+
+	tmpPath := path.Join(config.VolumesDir, fmt.Sprintf("%s.raw.tmp", name))
+	err := copyFile(vol.Path, tmpPath)
+	if err != nil {
+		return clone, err
+	}
+
+	uuid, err := fs.Relabel(tmpPath, name)
+	if err != nil {
+		os.Remove(tmpPath)
+		return clone, err
+	}
+
+	rawPath := path.Join(config.VolumesDir, fmt.Sprintf("%s%s%s.raw", name, VolumeDelimiter, uuid))
+	err = os.Rename(tmpPath, rawPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return clone, err
 	}
+
+	err = symlinkVolume(config.VolumesDir, name, uuid)
+	if err != nil {
+		return clone, err
+	}
+
+	clone = NanosVolume{
+		ID:        uuid,
+		Name:      name,
+		Label:     name,
+		Data:      vol.Data,
+		Size:      vol.Size,
+		Path:      rawPath,
+		CreatedAt: time.Now().String(),
+	}
+	return clone, saveLocalVolume(clone)
+}
+
+// ResizeLocalVolume grows the filesystem of the local volume to size
+func ResizeLocalVolume(vol NanosVolume, size VolumeSize) (NanosVolume, error) {
+	err := CheckVolumeGrow(vol.Name, vol.Size, size)
+	if err != nil {
+		return vol, err
+	}
+
+	err = fs.GrowFilesystem(vol.Path, int64(size))
+	if err != nil {
+		return vol, err
+	}
+
+	info, err := os.Stat(vol.Path)
+	if err != nil {
+		return vol, err
+	}
+	vol.Size = VolumeSize(info.Size())
+
 	return vol, nil
 }
 
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
 // symlinkVolume creates a symlink to volume that acts as volume label
 // if label of the same name exists for a volume, removes the label from the older volume
 // and assigns it to the newly created volume
@@ -151,7 +291,7 @@ func buildVolumeManifest(conf *types.Config) (*fs.Manifest, error) {
 // PrintVolumesList writes into console a table with volumes details
 func PrintVolumesList(volumes *[]NanosVolume) {
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"UUID", "Name", "Status", "Size (GB)", "Location", "Created", "Attached"})
+	table.SetHeader([]string{"UUID", "Name", "Status", "Size", "Location", "Created", "Attached", "Encrypted"})
 	table.SetHeaderColor(
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
@@ -160,6 +300,7 @@ func PrintVolumesList(volumes *[]NanosVolume) {
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 	)
 	table.SetRowLine(true)
 
@@ -168,12 +309,22 @@ func PrintVolumesList(volumes *[]NanosVolume) {
 		row = append(row, vol.ID)
 		row = append(row, vol.Name)
 		row = append(row, vol.Status)
-		row = append(row, vol.Size)
+		row = append(row, vol.Size.String())
 		row = append(row, vol.Path)
 		row = append(row, vol.CreatedAt)
 		row = append(row, vol.AttachedTo)
+		row = append(row, encryptionStatus(vol))
 		table.Append(row)
 	}
 
 	table.Render()
 }
+
+func encryptionStatus(vol NanosVolume) string {
+	if vol.EncryptionKey != "" {
+		return vol.EncryptionKey
+	} else if vol.Encrypted {
+		return "yes"
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package lepton
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// VolumeSize is the size of a volume in bytes
+type VolumeSize int64
+
+// Volume size units, cloud providers size disks in GiB
+const (
+	KiB VolumeSize = 1 << (10 * (iota + 1))
+	MiB
+	GiB
+	TiB
+)
+
+var volumeSizeUnits = map[string]VolumeSize{
+	"":  1,
+	"b": 1,
+	"k": KiB,
+	"m": MiB,
+	"g": GiB,
+	"t": TiB,
+}
+
+// ParseVolumeSize parses a size in bytes with an optional k, m, g or t unit, as
+// accepted by mkfs, units can be written as kb or kib
+func ParseVolumeSize(s string) (VolumeSize, error) {
+	s = strings.TrimSpace(s)
+	unitsIndex := strings.IndexFunc(s, func(c rune) bool { return !unicode.IsDigit(c) })
+	if unitsIndex < 0 {
+		unitsIndex = len(s)
+	}
+	if unitsIndex == 0 {
+		return 0, fmt.Errorf("invalid size \"%s\"", s)
+	}
+
+	units := strings.ToLower(strings.TrimSpace(s[unitsIndex:]))
+	if len(units) > 1 {
+		units = strings.TrimSuffix(strings.TrimSuffix(units, "b"), "i")
+	}
+	mul, ok := volumeSizeUnits[units]
+	if !ok {
+		return 0, fmt.Errorf("invalid size units \"%s\"", s[unitsIndex:])
+	}
+
+	n, err := strconv.ParseInt(s[:unitsIndex], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size \"%s\": %v", s, err)
+	}
+
+	return VolumeSize(n) * mul, nil
+}
+
+// GB returns the size in GiB rounded up, the unit of cloud disk sizes, a disk
+// has at least 1 GiB
+func (s VolumeSize) GB() int64 {
+	gb := int64((s + GiB - 1) / GiB)
+	if gb < 1 {
+		return 1
+	}
+	return gb
+}
+
+func (s VolumeSize) String() string {
+	if s < KiB {
+		return fmt.Sprintf("%d B", s)
+	}
+	div, exp := KiB, 0
+	for n := s / KiB; n >= KiB; n /= KiB {
+		div *= KiB
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(s)/float64(div), "KMGTPE"[exp])
+}
+
+// UnmarshalJSON decodes the size in bytes, sizes saved as strings before sizes
+// were typed are parsed when possible
+func (s *VolumeSize) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = VolumeSize(n)
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	// local volumes are sized from their file when listed
+	*s, _ = ParseVolumeSize(strings.ReplaceAll(str, " ", ""))
+	return nil
+}
+
+// CheckVolumeGrow returns an error if the volume can not be resized from its
+// current size to size, volumes can only grow
+func CheckVolumeGrow(name string, current, size VolumeSize) error {
+	if size <= current {
+		return fmt.Errorf("volume %s is %s, the new size %s must be larger", name, current, size)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package lepton
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// LocalVolumes returns the volumes of the directory saved in the local state, the
+// volumes whose file was removed are dropped. The state is only locked for writing
+// when the directory is imported or volumes are dropped.
+func LocalVolumes(dir string) (vols []NanosVolume, err error) {
+	var update bool
+	err = ViewState(func(tx *StateTx) error {
+		if !volumesImported(tx, dir) {
+			update = true
+			return nil
+		}
+
+		var removed []string
+		vols, removed, err = readLocalVolumes(tx, dir)
+		update = len(removed) != 0
+		return err
+	})
+	if err != nil || !update {
+		return
+	}
+
+	err = UpdateState(func(tx *StateTx) error {
+		err := importVolumes(tx, dir)
+		if err != nil {
+			return err
+		}
+
+		var removed []string
+		vols, removed, err = readLocalVolumes(tx, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range removed {
+			if err := tx.Delete(StateVolumes, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return
+}
+
+// readLocalVolumes returns the volumes of the directory saved in the local state and
+// the keys of the volumes whose file was removed
+func readLocalVolumes(tx *StateTx, dir string) (vols []NanosVolume, removed []string, err error) {
+	err = tx.ForEach(StateVolumes, func(key string, value []byte) error {
+		if path.Dir(key) != path.Clean(dir) {
+			return nil
+		}
+
+		info, err := os.Stat(key)
+		if os.IsNotExist(err) {
+			removed = append(removed, key)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var vol NanosVolume
+		if err := json.Unmarshal(value, &vol); err != nil {
+			return err
+		}
+		vol.Size = VolumeSize(info.Size())
+		vols = append(vols, vol)
+		return nil
+	})
+
+	return
+}
+
+// saveLocalVolume saves the volume in the local state, the volume takes the label
+// of the other volumes of its directory
+func saveLocalVolume(vol NanosVolume) error {
+	dir := path.Dir(vol.Path)
+
+	return UpdateState(func(tx *StateTx) error {
+		err := importVolumes(tx, dir)
+		if err != nil {
+			return err
+		}
+
+		var relabeled []NanosVolume
+		err = tx.ForEach(StateVolumes, func(key string, value []byte) error {
+			var other NanosVolume
+			if err := json.Unmarshal(value, &other); err != nil {
+				return err
+			}
+			if key != vol.Path && path.Dir(key) == dir && vol.Label != "" && other.Label == vol.Label {
+				other.Label = ""
+				relabeled = append(relabeled, other)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, other := range relabeled {
+			if err := tx.Put(StateVolumes, other.Path, other); err != nil {
+				return err
+			}
+		}
+
+		return tx.Put(StateVolumes, vol.Path, vol)
+	})
+}
+
+// DeleteLocalVolume removes the volume file, its label symlink and the volume from
+// the local state
+func DeleteLocalVolume(vol NanosVolume) error {
+	return UpdateState(func(tx *StateTx) error {
+		err := os.Remove(vol.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		symlinkPath := path.Join(path.Dir(vol.Path), vol.Name+".raw")
+		if link, err := os.Readlink(symlinkPath); err == nil && path.Base(link) == path.Base(vol.Path) {
+			err = os.Remove(symlinkPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(StateVolumes, vol.Path)
+	})
+}
+
+// importVolumes saves the volumes found in the directory the first time the
+// directory is used, volumes were not saved in the local state by previous versions
+func importVolumes(tx *StateTx, dir string) error {
+	meta, err := tx.tx.CreateBucketIfNotExists([]byte(stateMeta))
+	if err != nil {
+		return err
+	}
+
+	if volumesImported(tx, dir) {
+		return nil
+	}
+
+	vols, err := scanVolumes(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, vol := range vols {
+		if err := tx.Put(StateVolumes, vol.Path, vol); err != nil {
+			return err
+		}
+	}
+
+	return meta.Put([]byte(stateVolumeDirPrefix+path.Clean(dir)), []byte("1"))
+}
+
+// volumesImported returns true if the volumes of the directory were imported
+func volumesImported(tx *StateTx, dir string) bool {
+	meta := tx.tx.Bucket([]byte(stateMeta))
+	return meta != nil && meta.Get([]byte(stateVolumeDirPrefix+path.Clean(dir))) != nil
+}
+
+// scanVolumes returns the volumes of the directory, the label of a volume is the
+// name of the symlink to its file
+func scanVolumes(dir string) ([]NanosVolume, error) {
+	var vols []NanosVolume
+	mvols := make(map[string]NanosVolume)
+
+	fi, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return vols, err
+	}
+
+	// this scans the directory twice, which can be improved
+	// looking for symlink first
+	for _, info := range fi {
+		if info.IsDir() {
+			continue
+		}
+
+		link, err := os.Readlink(path.Join(dir, info.Name()))
+		if err != nil {
+			continue
+		}
+
+		var id string
+		var label string
+		nl := strings.Split(strings.TrimSuffix(info.Name(), ".raw"), VolumeDelimiter)
+		if len(nl) == 1 {
+			label = nl[0]
+		}
+		src, err := os.Stat(link)
+		// ignore dangling symlink
+		if err != nil {
+			continue
+		}
+		nu := strings.Split(strings.TrimSuffix(src.Name(), ".raw"), VolumeDelimiter)
+		if len(nu) == 2 {
+			id = nu[1]
+		}
+
+		mvols[src.Name()] = NanosVolume{
+			ID:        id,
+			Name:      label,
+			Label:     label,
+			Size:      VolumeSize(src.Size()),
+			Path:      path.Join(dir, src.Name()),
+			CreatedAt: src.ModTime().String(),
+		}
+	}
+	for _, info := range fi {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".raw") {
+			continue
+		}
+
+		link, _ := os.Readlink(path.Join(dir, info.Name()))
+		if link != "" {
+			continue
+		}
+
+		_, ok := mvols[info.Name()]
+		if ok {
+			continue
+		}
+
+		var id string
+		nu := strings.Split(strings.TrimSuffix(info.Name(), ".raw"), VolumeDelimiter)
+		if len(nu) == 2 {
+			id = nu[1]
+		}
+		mvols[info.Name()] = NanosVolume{
+			ID:        id,
+			Name:      nu[0],
+			Size:      VolumeSize(info.Size()),
+			Path:      path.Join(dir, info.Name()),
+			CreatedAt: info.ModTime().String(),
+		}
+	}
+
+	for _, vol := range mvols {
+		vols = append(vols, vol)
+	}
+
+	return vols, nil
+}
@@ -0,0 +1,135 @@
+package lepton_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
+)
+
+func TestParseVolumeAttachment(t *testing.T) {
+	tests := []struct {
+		arg       string
+		name      string
+		mountPath string
+	}{
+		{"data", "data", "/data"},
+		{"data:/mnt/data", "data", "/mnt/data"},
+	}
+
+	for _, tt := range tests {
+		name, mountPath, err := lepton.ParseVolumeAttachment(tt.arg)
+		if err != nil {
+			t.Errorf("%s: %v", tt.arg, err)
+			continue
+		}
+		if name != tt.name || mountPath != tt.mountPath {
+			t.Errorf("%s: got %s %s", tt.arg, name, mountPath)
+		}
+	}
+
+	for _, arg := range []string{"", ":/mnt", "data:", "data:mnt"} {
+		if _, _, err := lepton.ParseVolumeAttachment(arg); err == nil {
+			t.Errorf("%q: expected error", arg)
+		}
+	}
+}
+
+func TestCheckEncryption(t *testing.T) {
+	tests := []struct {
+		platform string
+		cloud    types.ProviderConfig
+		valid    bool
+	}{
+		{"onprem", types.ProviderConfig{}, true},
+		{"aws", types.ProviderConfig{Encrypt: true}, true},
+		{"gcp", types.ProviderConfig{EncryptionKey: "projects/p/locations/l/keyRings/r/cryptoKeys/k"}, true},
+		{"onprem", types.ProviderConfig{Encrypt: true}, false},
+		{"do", types.ProviderConfig{EncryptionKey: "key"}, false},
+	}
+
+	for _, tt := range tests {
+		c := &types.Config{CloudConfig: tt.cloud}
+		c.CloudConfig.Platform = tt.platform
+
+		err := lepton.CheckEncryption(c)
+		if tt.valid && err != nil {
+			t.Errorf("%s %+v: %v", tt.platform, tt.cloud, err)
+		} else if !tt.valid && err == nil {
+			t.Errorf("%s %+v: expected error", tt.platform, tt.cloud)
+		}
+	}
+}
+
+func TestParseVolumeSize(t *testing.T) {
+	tests := []struct {
+		arg  string
+		size lepton.VolumeSize
+	}{
+		{"1000000", 1000000},
+		{"512k", 512 * lepton.KiB},
+		{"16M", 16 * lepton.MiB},
+		{"10g", 10 * lepton.GiB},
+		{"10GB", 10 * lepton.GiB},
+		{"2GiB", 2 * lepton.GiB},
+		{"1t", lepton.TiB},
+	}
+
+	for _, tt := range tests {
+		size, err := lepton.ParseVolumeSize(tt.arg)
+		if err != nil {
+			t.Errorf("%s: %v", tt.arg, err)
+		} else if size != tt.size {
+			t.Errorf("%s: got %d, want %d", tt.arg, size, tt.size)
+		}
+	}
+
+	for _, arg := range []string{"", "g", "10x", "1.5g"} {
+		if _, err := lepton.ParseVolumeSize(arg); err == nil {
+			t.Errorf("%q: expected error", arg)
+		}
+	}
+}
+
+func TestVolumeSize(t *testing.T) {
+	t.Run("string", func(t *testing.T) {
+		if s := (1536 * lepton.KiB).String(); s != "1.5 MiB" {
+			t.Errorf("got %s", s)
+		}
+		if s := lepton.VolumeSize(100).String(); s != "100 B" {
+			t.Errorf("got %s", s)
+		}
+	})
+
+	t.Run("gb", func(t *testing.T) {
+		if gb := lepton.MiB.GB(); gb != 1 {
+			t.Errorf("got %d", gb)
+		}
+		if gb := (10*lepton.GiB + 1).GB(); gb != 11 {
+			t.Errorf("got %d", gb)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var vol lepton.NanosVolume
+		if err := json.Unmarshal([]byte(`{"size": 1048576}`), &vol); err != nil || vol.Size != lepton.MiB {
+			t.Errorf("got %d %v", vol.Size, err)
+		}
+		if err := json.Unmarshal([]byte(`{"size": "10"}`), &vol); err != nil || vol.Size != 10 {
+			t.Errorf("got %d %v", vol.Size, err)
+		}
+		if err := json.Unmarshal([]byte(`{"size": "1.0 MB"}`), &vol); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("grow", func(t *testing.T) {
+		if err := lepton.CheckVolumeGrow("data", lepton.GiB, 2*lepton.GiB); err != nil {
+			t.Error(err)
+		}
+		if err := lepton.CheckVolumeGrow("data", lepton.GiB, lepton.GiB); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
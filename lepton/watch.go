@@ -0,0 +1,85 @@
+package lepton
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// FileWatcher finds changes in files and directories by comparing their size and
+// modification time between calls to Changed
+type FileWatcher struct {
+	paths []string
+	files map[string]watchedFile
+}
+
+// NewFileWatcher returns a watcher of the files and directories, directories are
+// watched recursively and paths that do not exist are watched until they are created
+func NewFileWatcher(paths ...string) *FileWatcher {
+	w := &FileWatcher{paths: paths}
+	w.files = w.scan()
+	return w
+}
+
+// Changed returns the files created, modified or removed since the previous call
+func (w *FileWatcher) Changed() []string {
+	created, modified, removed := w.Changes()
+
+	changed := append(append(created, modified...), removed...)
+	sort.Strings(changed)
+
+	return changed
+}
+
+// Changes returns the files created, the files modified and the files removed since
+// the previous call
+func (w *FileWatcher) Changes() (created, modified, removed []string) {
+	files := w.scan()
+
+	for path, f := range files {
+		previous, ok := w.files[path]
+		if !ok {
+			created = append(created, path)
+		} else if previous.size != f.size || !previous.modTime.Equal(f.modTime) {
+			modified = append(modified, path)
+		}
+	}
+
+	for path := range w.files {
+		if _, ok := files[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+
+	w.files = files
+	sort.Strings(created)
+	sort.Strings(modified)
+	sort.Strings(removed)
+
+	return
+}
+
+func (w *FileWatcher) scan() map[string]watchedFile {
+	files := map[string]watchedFile{}
+
+	for _, root := range w.paths {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+
+			if !info.IsDir() {
+				files[path] = watchedFile{size: info.Size(), modTime: info.ModTime()}
+			}
+			return nil
+		})
+	}
+
+	return files
+}
@@ -0,0 +1,77 @@
+package lepton_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+)
+
+func TestFileWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	program := path.Join(dir, "program")
+	assets := path.Join(dir, "assets")
+	config := path.Join(dir, "config.json")
+
+	ioutil.WriteFile(program, []byte("elf"), 0755)
+	os.MkdirAll(path.Join(assets, "css"), 0755)
+	ioutil.WriteFile(path.Join(assets, "css", "style.css"), []byte("body {}"), 0644)
+
+	watcher := lepton.NewFileWatcher(program, assets, config)
+
+	if changed := watcher.Changed(); len(changed) != 0 {
+		t.Errorf("got changes %v before modifying files", changed)
+	}
+
+	ioutil.WriteFile(program, []byte("new elf"), 0755)
+	ioutil.WriteFile(path.Join(assets, "index.html"), []byte("<html>"), 0644)
+	ioutil.WriteFile(config, []byte("{}"), 0644)
+	os.Remove(path.Join(assets, "css", "style.css"))
+
+	expected := []string{
+		path.Join(assets, "css", "style.css"),
+		path.Join(assets, "index.html"),
+		config,
+		program,
+	}
+	if changed := watcher.Changed(); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("got %v, want %v", changed, expected)
+	}
+
+	if changed := watcher.Changed(); len(changed) != 0 {
+		t.Errorf("got changes %v reported twice", changed)
+	}
+
+	// same size, only the modification time changes
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(config, later, later)
+	if changed := watcher.Changed(); !reflect.DeepEqual(changed, []string{config}) {
+		t.Errorf("got %v, want %v", changed, []string{config})
+	}
+
+	t.Run("changes", func(t *testing.T) {
+		ioutil.WriteFile(program, []byte("newer elf"), 0755)
+		ioutil.WriteFile(path.Join(assets, "app.js"), []byte("main()"), 0644)
+		os.Remove(path.Join(assets, "index.html"))
+
+		created, modified, removed := watcher.Changes()
+		if !reflect.DeepEqual(created, []string{path.Join(assets, "app.js")}) {
+			t.Errorf("created: got %v", created)
+		}
+		if !reflect.DeepEqual(modified, []string{program}) {
+			t.Errorf("modified: got %v", modified)
+		}
+		if !reflect.DeepEqual(removed, []string{path.Join(assets, "index.html")}) {
+			t.Errorf("removed: got %v", removed)
+		}
+	})
+}
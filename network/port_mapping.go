@@ -0,0 +1,180 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Supported port mapping protocols
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// PortMapping describes a port, or a range of ports, forwarded from the host to the guest
+type PortMapping struct {
+	HostAddress string
+	HostFrom    int
+	HostTo      int
+	GuestFrom   int
+	GuestTo     int
+	Protocol    string
+}
+
+// HostPorts returns the host port or range of ports in the "from-to" notation
+func (pm PortMapping) HostPorts() string {
+	return portRangeString(pm.HostFrom, pm.HostTo)
+}
+
+// GuestPorts returns the guest port or range of ports in the "from-to" notation
+func (pm PortMapping) GuestPorts() string {
+	return portRangeString(pm.GuestFrom, pm.GuestTo)
+}
+
+// Contains checks whether the host port is forwarded by the mapping
+func (pm PortMapping) Contains(hostPort int) bool {
+	return hostPort >= pm.HostFrom && hostPort <= pm.HostTo
+}
+
+func (pm PortMapping) String() string {
+	var sb strings.Builder
+	if strings.Contains(pm.HostAddress, ":") {
+		sb.WriteString("[" + pm.HostAddress + "]:")
+	} else if pm.HostAddress != "" {
+		sb.WriteString(pm.HostAddress + ":")
+	}
+	sb.WriteString(pm.HostPorts())
+	sb.WriteString(":" + pm.GuestPorts())
+	sb.WriteString("/" + pm.Protocol)
+	return sb.String()
+}
+
+func portRangeString(from, to int) string {
+	if from == to {
+		return strconv.Itoa(from)
+	}
+	return fmt.Sprintf("%d-%d", from, to)
+}
+
+// ParsePortMapping parses a port mapping specification with the format
+// "[hostaddress:]hostport[:guestport][/protocol]" where ports may be ranges
+// like "8000-8010". The guest port defaults to the host port and the protocol
+// defaults to defaultProtocol.
+func ParsePortMapping(spec string, defaultProtocol string) (pm PortMapping, err error) {
+	pm.Protocol = defaultProtocol
+
+	ports := spec
+	if i := strings.LastIndex(spec, "/"); i != -1 {
+		ports = spec[:i]
+		pm.Protocol = strings.ToLower(spec[i+1:])
+	}
+
+	if pm.Protocol != ProtocolTCP && pm.Protocol != ProtocolUDP {
+		err = fmt.Errorf("\"%s\" protocol must be %s or %s", spec, ProtocolTCP, ProtocolUDP)
+		return
+	}
+
+	if strings.HasPrefix(ports, "[") {
+		end := strings.Index(ports, "]:")
+		if end == -1 {
+			err = fmt.Errorf("\"%s\" has an invalid host address", spec)
+			return
+		}
+		pm.HostAddress = ports[1:end]
+		ports = ports[end+2:]
+		if net.ParseIP(pm.HostAddress) == nil {
+			err = fmt.Errorf("\"%s\" has an invalid host address", spec)
+			return
+		}
+	}
+
+	parts := strings.Split(ports, ":")
+	if len(parts) == 3 || (len(parts) == 2 && net.ParseIP(parts[0]) != nil) {
+		if pm.HostAddress != "" || net.ParseIP(parts[0]) == nil {
+			err = fmt.Errorf("\"%s\" has an invalid host address", spec)
+			return
+		}
+		pm.HostAddress = parts[0]
+		parts = parts[1:]
+	}
+
+	if len(parts) > 2 {
+		err = fmt.Errorf("\"%s\" must have the format [hostaddress:]hostport[:guestport][/protocol]", spec)
+		return
+	}
+
+	pm.HostFrom, pm.HostTo, err = parsePortRange(parts[0])
+	if err != nil {
+		err = fmt.Errorf("\"%s\" %s", spec, err.Error())
+		return
+	}
+
+	pm.GuestFrom, pm.GuestTo = pm.HostFrom, pm.HostTo
+	if len(parts) == 2 {
+		pm.GuestFrom, pm.GuestTo, err = parsePortRange(parts[1])
+		if err != nil {
+			err = fmt.Errorf("\"%s\" %s", spec, err.Error())
+			return
+		}
+	}
+
+	if pm.HostTo-pm.HostFrom != pm.GuestTo-pm.GuestFrom {
+		err = fmt.Errorf("\"%s\" host and guest port ranges must have the same size", spec)
+	}
+
+	return
+}
+
+// ParsePortMappings parses every port mapping specification with ParsePortMapping
+func ParsePortMappings(specs []string, defaultProtocol string) (mappings []PortMapping, err error) {
+	for _, spec := range specs {
+		var pm PortMapping
+		pm, err = ParsePortMapping(spec, defaultProtocol)
+		if err != nil {
+			return
+		}
+		mappings = append(mappings, pm)
+	}
+	return
+}
+
+func parsePortRange(ports string) (from int, to int, err error) {
+	rangeParts := strings.Split(ports, "-")
+	if len(rangeParts) > 2 {
+		err = errors.New("may have only one hyphen")
+		return
+	}
+
+	from, err = parsePort(rangeParts[0])
+	if err != nil {
+		return
+	}
+
+	to = from
+	if len(rangeParts) == 2 {
+		to, err = parsePort(rangeParts[1])
+		if err != nil {
+			return
+		}
+	}
+
+	if from > to {
+		err = errors.New("port range must be ascending")
+	}
+
+	return
+}
+
+func parsePort(port string) (int, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || strings.HasPrefix(port, "+") {
+		return 0, errors.New("ports must be numbers")
+	}
+	if n < 1 || n > 65535 {
+		return 0, errors.New("ports must be between 1 and 65535")
+	}
+	return n, nil
+}
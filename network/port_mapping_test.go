@@ -0,0 +1,66 @@
+package network_test
+
+import (
+	"testing"
+
+	"github.com/nanovms/ops/network"
+	"gotest.tools/assert"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	t.Run("should map a port to the same guest port with the default protocol", func(t *testing.T) {
+		pm, err := network.ParsePortMapping("80", network.ProtocolTCP)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pm, network.PortMapping{HostFrom: 80, HostTo: 80, GuestFrom: 80, GuestTo: 80, Protocol: "tcp"})
+	})
+
+	t.Run("should map a host port to a different guest port", func(t *testing.T) {
+		pm, err := network.ParsePortMapping("8080:80/udp", network.ProtocolTCP)
+
+		assert.NilError(t, err)
+		assert.DeepEqual(t, pm, network.PortMapping{HostFrom: 8080, HostTo: 8080, GuestFrom: 80, GuestTo: 80, Protocol: "udp"})
+	})
+
+	t.Run("should map a host range to a guest range", func(t *testing.T) {
+		pm, err := network.ParsePortMapping("8000-8010:9000-9010", network.ProtocolTCP)
+
+		assert.NilError(t, err)
+		assert.Equal(t, pm.HostPorts(), "8000-8010")
+		assert.Equal(t, pm.GuestPorts(), "9000-9010")
+	})
+
+	t.Run("should bind to a host address", func(t *testing.T) {
+		pm, err := network.ParsePortMapping("127.0.0.1:8080:80", network.ProtocolTCP)
+		assert.NilError(t, err)
+		assert.Equal(t, pm.String(), "127.0.0.1:8080:80/tcp")
+
+		pm, err = network.ParsePortMapping("127.0.0.1:8080", network.ProtocolTCP)
+		assert.NilError(t, err)
+		assert.Equal(t, pm.String(), "127.0.0.1:8080:8080/tcp")
+
+		pm, err = network.ParsePortMapping("[::1]:8080:80", network.ProtocolTCP)
+		assert.NilError(t, err)
+		assert.Equal(t, pm.HostAddress, "::1")
+		assert.Equal(t, pm.String(), "[::1]:8080:80/tcp")
+	})
+
+	t.Run("should return error if the mapping is invalid", func(t *testing.T) {
+		tests := []struct {
+			spec        string
+			errExpected string
+		}{
+			{"80/sctp", "\"80/sctp\" protocol must be tcp or udp"},
+			{"80-90:80-85", "\"80-90:80-85\" host and guest port ranges must have the same size"},
+			{"90-80", "\"90-80\" port range must be ascending"},
+			{"0", "\"0\" ports must be between 1 and 65535"},
+			{"http", "\"http\" ports must be numbers"},
+			{"host:80:80", "\"host:80:80\" has an invalid host address"},
+		}
+
+		for _, tt := range tests {
+			_, err := network.ParsePortMapping(tt.spec, network.ProtocolTCP)
+			assert.Error(t, err, tt.errExpected)
+		}
+	})
+}
@@ -1,13 +1,72 @@
 package onprem
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/nanovms/ops/types"
 )
 
+// errProcessArgsUnsupported is returned where the arguments of a process can not be
+// read to check the process of an instance
+var errProcessArgsUnsupported = errors.New("process arguments are not supported")
+
 type instance struct {
 	Instance string   `json:"instance"`
 	Image    string   `json:"image"`
 	Ports    []string `json:"ports"`
+	Memory   string   `json:"memory,omitempty"`
+	CPUs     int      `json:"cpus,omitempty"`
+
+	// Tap is the tap device of bridged instances
+	Tap string `json:"tap,omitempty"`
+
+	// Mounts are the volume files attached as disks when the instance was started
+	// and Shares the host directories exposed to it
+	Mounts []string          `json:"mounts,omitempty"`
+	Shares []types.SharedDir `json:"shares,omitempty"`
+
+	// Created is when the instance was saved
+	Created time.Time `json:"created"`
+
+	// Restart is the restart policy of instances run by a supervisor, supervised
+	// instances are saved with the supervisor pid
+	Restart  string `json:"restart,omitempty"`
+	Restarts int    `json:"restarts,omitempty"`
+	LastExit string `json:"last_exit,omitempty"`
+	Status   string `json:"status,omitempty"`
+
+	// HypervisorPID is the pid of the hypervisor running a supervised instance
+	HypervisorPID int `json:"hypervisor_pid,omitempty"`
+
+	// Volumes are the volumes hot-plugged with `ops volume attach`
+	Volumes []attachedVolume `json:"volumes,omitempty"`
+}
+
+func (in *instance) supervised() bool {
+	return in.Restart != "" && in.Restart != RestartNo
+}
+
+func (in *instance) status() string {
+	if in.Status != "" {
+		return in.Status
+	}
+	return "Running"
+}
+
+// restartsDescription returns the restart count and the last exit reason of supervised instances
+func (in *instance) restartsDescription() string {
+	if !in.supervised() {
+		return ""
+	}
+
+	if in.LastExit == "" {
+		return strconv.Itoa(in.Restarts)
+	}
+	return fmt.Sprintf("%d (%s)", in.Restarts, in.LastExit)
 }
 
 func (in *instance) portList() string {
@@ -1,6 +1,7 @@
 package onprem
 
 import (
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -116,7 +117,9 @@ func (p *OnPrem) DeleteImage(ctx *lepton.Context, imagename string) error {
 	if err != nil {
 		return err
 	}
-	return nil
+	return lepton.UpdateState(func(tx *lepton.StateTx) error {
+		return tx.Delete(lepton.StateImages, imgpath)
+	})
 }
 
 // SyncImage syncs image from onprem to target provider provided in Context
@@ -124,19 +127,33 @@ func (p *OnPrem) SyncImage(config *types.Config, target lepton.Provider, image s
 	imagePath := path.Join(lepton.LocalImageDir, image+".img")
 	_, err := os.Stat(imagePath)
 	if err != nil {
-		return nil
+		return err
 	}
-	config.RunConfig.Imagename = imagePath
-	config.CloudConfig.ImageName = image
 
 	// customizes image for target
-	ctx := lepton.NewContext(config)
-	archive, err := target.CustomizeImage(ctx)
+	return lepton.ImportImage(lepton.NewContext(config), target, image, imagePath)
+}
+
+// ExportImage copies the local image to imagePath
+func (p *OnPrem) ExportImage(ctx *lepton.Context, image, imagePath string) error {
+	in, err := os.Open(path.Join(lepton.LocalImageDir, image+".img"))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(imagePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
 	if err != nil {
+		out.Close()
 		return err
 	}
 
-	return target.CreateImage(ctx, archive)
+	return out.Close()
 }
 
 // CustomizeImage for onprem as stub to satisfy interface
@@ -3,12 +3,16 @@ package onprem
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/nanovms/ops/fs"
 	"github.com/nanovms/ops/lepton"
 	"github.com/nanovms/ops/qemu"
 	"github.com/olekukonko/tablewriter"
@@ -35,33 +39,70 @@ func (p *OnPrem) CreateInstance(ctx *lepton.Context) error {
 	opshome := lepton.GetOpsHome()
 	imgpath := path.Join(opshome, "images", c.CloudConfig.ImageName)
 
+	// restored instances run a copy of the snapshot disk kept with the snapshot
+	if c.RunConfig.Incoming != "" {
+		imgpath = c.RunConfig.Imagename
+	}
+
 	c.RunConfig.Imagename = imgpath
 	c.RunConfig.Background = true
 
-	err := hypervisor.Start(&c.RunConfig)
+	policy, err := ParseRestartPolicy(c.RunConfig.Restart)
 	if err != nil {
 		return err
 	}
 
-	pid, err := hypervisor.PID()
+	c.RunConfig.Mounts, err = addImageVolumes(imgpath, c.RunConfig.Mounts)
+	if err != nil {
+		return err
+	}
+
+	removeInstanceLog(c.RunConfig.InstanceName)
+
+	// the kernel log dump of the image is the dump of the last crash of the instance
+	err = fs.ClearKlogDump(imgpath)
+	if err != nil {
+		fmt.Printf("warning: %v\n", err)
+	}
+
+	if policy.Mode != RestartNo {
+		return StartSupervisor(&c.RunConfig)
+	}
+
+	err = StartSerialLogger(c.RunConfig.InstanceName)
 	if err != nil {
 		return err
 	}
 
-	instances := path.Join(opshome, "instances")
+	err = hypervisor.Start(&c.RunConfig)
+	if err != nil {
+		stopSerialLogger(c.RunConfig.InstanceName)
+		return err
+	}
+
+	pid, err := hypervisor.PID()
+	if err != nil {
+		hypervisor.Stop()
+		stopSerialLogger(c.RunConfig.InstanceName)
+		return err
+	}
 
 	i := instance{
 		Instance: c.RunConfig.InstanceName,
 		Image:    c.RunConfig.Imagename,
 		Ports:    c.RunConfig.Ports,
+		Memory:   c.RunConfig.Memory,
+		CPUs:     c.RunConfig.CPUs,
+		Mounts:   c.RunConfig.Mounts,
+		Shares:   c.RunConfig.Shares,
+		Created:  time.Now(),
 	}
 
-	d1, err := json.Marshal(i)
-	if err != nil {
-		fmt.Println(err)
+	if c.RunConfig.Bridged {
+		i.Tap = c.RunConfig.TapName
 	}
 
-	err = ioutil.WriteFile(instances+"/"+pid, d1, 0644)
+	err = saveInstance(&savedInstance{instance: i, ID: pid})
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -85,36 +126,108 @@ func (p *OnPrem) GetInstanceByID(ctx *lepton.Context, instanceName string) (*lep
 	return nil, fmt.Errorf("instance with name \"%s\" not found", instanceName)
 }
 
-// GetInstances return all instances on prem
-func (p *OnPrem) GetInstances(ctx *lepton.Context) (instances []lepton.CloudInstance, err error) {
-	opshome := lepton.GetOpsHome()
-	instancesPath := path.Join(opshome, "instances")
+// savedInstance is an instance saved in the local state with the pid of the process
+// running the instance
+type savedInstance struct {
+	instance
+	ID string
+}
 
-	files, err := ioutil.ReadDir(instancesPath)
-	if err != nil {
-		return
-	}
+// readInstances returns the saved instances
+func readInstances() (instances []savedInstance, err error) {
+	err = lepton.ViewState(func(tx *lepton.StateTx) error {
+		return tx.ForEach(lepton.StateInstances, func(key string, value []byte) error {
+			var i instance
+			if err := json.Unmarshal(value, &i); err != nil {
+				return err
+			}
+
+			instances = append(instances, savedInstance{instance: i, ID: key})
+			return nil
+		})
+	})
 
-	for _, f := range files {
-		fullpath := path.Join(instancesPath, f.Name())
-		body, err := ioutil.ReadFile(fullpath)
+	return
+}
+
+// saveInstance saves the instance in the local state
+func saveInstance(i *savedInstance) error {
+	return lepton.UpdateState(func(tx *lepton.StateTx) error {
+		return tx.Put(lepton.StateInstances, i.ID, i.instance)
+	})
+}
+
+// updateInstance applies fn to the saved instance in a single transaction, so the
+// changes made by other ops processes are not lost
+func updateInstance(id string, fn func(i *instance) error) error {
+	return lepton.UpdateState(func(tx *lepton.StateTx) error {
+		var i instance
+		found, err := tx.Get(lepton.StateInstances, id, &i)
 		if err != nil {
-			return nil, err
+			return err
+		} else if !found {
+			return fmt.Errorf("instance %s not found", id)
 		}
 
-		var i instance
-		if err := json.Unmarshal(body, &i); err != nil {
-			return nil, err
+		err = fn(&i)
+		if err != nil {
+			return err
+		}
+
+		return tx.Put(lepton.StateInstances, id, i)
+	})
+}
+
+// removeInstance removes the instance from the local state
+func removeInstance(id string) error {
+	return lepton.UpdateState(func(tx *lepton.StateTx) error {
+		return tx.Delete(lepton.StateInstances, id)
+	})
+}
+
+// instanceSaved returns true if the instance with the id is saved
+func instanceSaved(id string) bool {
+	var found bool
+	lepton.ViewState(func(tx *lepton.StateTx) (err error) {
+		found, err = tx.Get(lepton.StateInstances, id, &instance{})
+		return
+	})
+	return found
+}
+
+// getInstance returns the saved configuration of the instance with the name passed by argument
+func (p *OnPrem) getInstance(instanceName string) (*instance, error) {
+	instances, err := readInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range instances {
+		if i.Instance == instanceName {
+			return &i.instance, nil
 		}
+	}
+
+	return nil, fmt.Errorf("instance with name \"%s\" not found", instanceName)
+}
 
+// GetInstances return all instances on prem
+func (p *OnPrem) GetInstances(ctx *lepton.Context) (instances []lepton.CloudInstance, err error) {
+	saved, err := readInstances()
+	if err != nil {
+		return
+	}
+
+	// the ports are forwarded from the host, the instances have no address of
+	// their own
+	for _, i := range saved {
 		instances = append(instances, lepton.CloudInstance{
-			ID:         f.Name(),
+			ID:         i.ID,
 			Name:       i.Instance,
 			Image:      i.Image,
-			Status:     "Running",
-			Created:    lepton.Time2Human(f.ModTime()),
+			Status:     i.status(),
+			Created:    lepton.Time2Human(i.Created),
 			PrivateIps: []string{"127.0.0.1"},
-			PublicIps:  strings.Split(i.portList(), ","),
 		})
 	}
 
@@ -123,13 +236,13 @@ func (p *OnPrem) GetInstances(ctx *lepton.Context) (instances []lepton.CloudInst
 
 // ListInstances on premise
 func (p *OnPrem) ListInstances(ctx *lepton.Context) error {
-	instances, err := p.GetInstances(ctx)
+	instances, err := readInstances()
 	if err != nil {
 		return err
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"PID", "Name", "Image", "Status", "Created", "Private Ips", "Port"})
+	table.SetHeader([]string{"PID", "Name", "Image", "Status", "Created", "Private Ips", "Port", "Restarts"})
 	table.SetHeaderColor(
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
@@ -137,6 +250,7 @@ func (p *OnPrem) ListInstances(ctx *lepton.Context) error {
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
 
 	table.SetRowLine(true)
@@ -145,12 +259,13 @@ func (p *OnPrem) ListInstances(ctx *lepton.Context) error {
 		var rows []string
 
 		rows = append(rows, i.ID)
-		rows = append(rows, i.Name)
+		rows = append(rows, i.Instance)
 		rows = append(rows, i.Image)
-		rows = append(rows, i.Status)
-		rows = append(rows, i.Created)
-		rows = append(rows, strings.Join(i.PrivateIps, ","))
-		rows = append(rows, strings.Join(i.PublicIps, ","))
+		rows = append(rows, i.status())
+		rows = append(rows, lepton.Time2Human(i.Created))
+		rows = append(rows, "127.0.0.1")
+		rows = append(rows, i.portList())
+		rows = append(rows, i.restartsDescription())
 
 		table.Append(rows)
 	}
@@ -173,52 +288,219 @@ func (p *OnPrem) StopInstance(ctx *lepton.Context, instancename string) error {
 
 // DeleteInstance from on premise
 func (p *OnPrem) DeleteInstance(ctx *lepton.Context, instancename string) error {
-
-	var pid int
-	instance, err := p.GetInstanceByID(ctx, instancename)
+	instances, err := readInstances()
 	if err != nil {
 		return err
 	}
 
-	pid, _ = strconv.Atoi(instance.ID)
+	var instance *savedInstance
+	for i := range instances {
+		if instances[i].Instance == instancename {
+			instance = &instances[i]
+			break
+		}
+	}
+
+	if instance == nil {
+		return fmt.Errorf("instance with name \"%s\" not found", instancename)
+	}
+
+	pid, _ := strconv.Atoi(instance.ID)
 
 	if pid == 0 {
 		fmt.Printf("did not find pid of instance \"%s\"\n", instancename)
 		return nil
 	}
 
-	err = sysKill(pid)
-	if err != nil {
-		fmt.Println(err)
+	isSupervisor := func(args []string) bool {
+		return hasArgs(args, supervisorArgs(instancename)...)
+	}
+	isHypervisor := func(args []string) bool {
+		return isInstanceHypervisor(args, instance)
 	}
 
-	opshome := lepton.GetOpsHome()
-	ipath := path.Join(opshome, "instances", strconv.Itoa(pid))
-	err = os.Remove(ipath)
-	if err != nil {
+	if instance.supervised() {
+		running, err := processRunsInstance(pid, isSupervisor)
+		if err != nil {
+			return fmt.Errorf("cannot delete instance \"%s\": %v", instancename, err)
+		}
+		if running && stopSupervisor(pid, instance.ID) {
+			removeInstanceFiles(instance)
+			return nil
+		}
+
+		// the supervisor already exited or did not respond
+		if instance.HypervisorPID != 0 {
+			err = killInstanceProcess(instance.HypervisorPID, isHypervisor)
+			if err != nil {
+				return fmt.Errorf("cannot delete instance \"%s\": %v", instancename, err)
+			}
+		}
+		err = killInstanceProcess(pid, isSupervisor)
+		if err != nil {
+			return fmt.Errorf("cannot delete instance \"%s\": %v", instancename, err)
+		}
+	} else {
+		err = killInstanceProcess(pid, isHypervisor)
+		if err != nil {
+			return fmt.Errorf("cannot delete instance \"%s\": %v", instancename, err)
+		}
+	}
+
+	removeInstanceFiles(instance)
+	return removeInstance(instance.ID)
+}
+
+// removeInstanceFiles removes the cgroup and the restore disk of a stopped instance
+func removeInstanceFiles(instance *savedInstance) {
+	// the cgroup with the resource limits is named after the hypervisor
+	qemu.RemoveCgroup(instance.hypervisorPID())
+	removeRestoreDisk(instance.Image)
+}
+
+// isInstanceHypervisor returns true if the arguments are the arguments of the
+// hypervisor of the instance. The hypervisor is found by its monitor socket, which is
+// named after the instance, hypervisors started without monitor by their image or
+// the instance name.
+func isInstanceHypervisor(args []string, instance *savedInstance) bool {
+	if hasArgs(args, "-qmp") {
+		return hasArgs(args, "-qmp", "unix:"+qemu.QMPSocketPath(instance.Instance)+",server,nowait")
+	}
+
+	for _, arg := range args {
+		if instance.Image != "" && strings.Contains(arg, instance.Image) {
+			return true
+		}
+		if instance.Instance != "" && strings.Contains(arg, instance.Instance) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasArgs returns true if the arguments contain the expected arguments in order
+func hasArgs(args []string, expected ...string) bool {
+	for i := 0; i+len(expected) <= len(args); i++ {
+		if reflect.DeepEqual(args[i:i+len(expected)], expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// processRunsInstance returns true if the process is running and matches the
+// instance, the pid saved for an instance can be reused by another process after the
+// instance exits. It returns an error if the pid is used by another process. Where
+// the arguments of processes can not be read, the saved pid is trusted.
+func processRunsInstance(pid int, matches func(args []string) bool) (bool, error) {
+	args, err := processArgs(pid)
+	if err == errProcessArgsUnsupported {
+		return true, nil
+	} else if err != nil {
+		// the process already exited
+		return false, nil
+	}
+
+	if !matches(args) {
+		return false, fmt.Errorf("process %d is not running the instance", pid)
+	}
+	return true, nil
+}
+
+// killInstanceProcess kills the process if it is still the process of the instance,
+// it returns an error without killing it if the pid is used by another process
+func killInstanceProcess(pid int, matches func(args []string) bool) error {
+	running, err := processRunsInstance(pid, matches)
+	if err != nil || !running {
 		return err
 	}
 
+	if err := sysKill(pid); err != nil {
+		fmt.Println(err)
+	}
 	return nil
 }
 
+// stopSupervisor terminates the supervisor of an instance and returns true if it
+// removed the instance before exiting
+func stopSupervisor(pid int, id string) bool {
+	if err := sysTerminate(pid); err != nil {
+		return false
+	}
+
+	for i := 0; i < 100; i++ {
+		if !instanceSaved(id) {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return false
+}
+
 // PrintInstanceLogs writes instance logs to console
-func (p *OnPrem) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := p.GetInstanceLogs(ctx, instancename)
+func (p *OnPrem) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	logFile, err := os.Open(InstanceLogPath(instancename))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	if !opts.Since.IsZero() {
+		indexFile, err := os.Open(instanceLogIndexPath(instancename))
+		if err != nil {
+			return err
+		}
+		offset, err := logOffsetSince(indexFile, opts.Since)
+		indexFile.Close()
+		if err != nil {
+			return err
+		}
+
+		if offset == -1 {
+			_, err = logFile.Seek(0, io.SeekEnd)
+		} else {
+			_, err = logFile.Seek(offset, io.SeekStart)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	body, err := ioutil.ReadAll(logFile)
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
+	w := opts.Writer()
+	fmt.Fprint(w, lepton.TailLines(string(body), opts.Tail))
+
+	buf := make([]byte, 4096)
+	for opts.Watch {
+		n, err := logFile.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// the console socket is removed when the instance stops
+		if _, err := os.Stat(ConsoleSocketPath(instancename)); err != nil {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
 	return nil
 }
 
 // GetInstanceLogs for onprem instance logs
 func (p *OnPrem) GetInstanceLogs(ctx *lepton.Context, instancename string) (string, error) {
 
-	body, err := ioutil.ReadFile("/tmp/" + instancename + ".log")
+	body, err := ioutil.ReadFile(InstanceLogPath(instancename))
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return "", err
 	}
 
 	return string(body), nil
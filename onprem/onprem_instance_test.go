@@ -0,0 +1,113 @@
+package onprem
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/qemu"
+	"github.com/nanovms/ops/types"
+)
+
+func TestGetInstancesAddresses(t *testing.T) {
+	testOpsHome(t)
+
+	saved := &savedInstance{instance: instance{Instance: "web", Ports: []string{"8080", "9000"}}, ID: "1"}
+	if err := saveInstance(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &OnPrem{}
+	instances, err := p.GetInstances(lepton.NewContext(&types.Config{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 1 {
+		t.Fatalf("got %d instances", len(instances))
+	}
+
+	i := instances[0]
+	if len(i.PublicIps) != 0 {
+		t.Errorf("ports reported as public ips: %v", i.PublicIps)
+	}
+	if len(i.PrivateIps) != 1 || i.PrivateIps[0] != "127.0.0.1" {
+		t.Errorf("private ips: got %v", i.PrivateIps)
+	}
+}
+
+func TestIsInstanceHypervisor(t *testing.T) {
+	web := &savedInstance{instance: instance{Instance: "web", Image: "/root/.ops/images/web.img"}}
+	drive := "file=/root/.ops/images/web.img,format=raw,if=none,id=hd0"
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected bool
+	}{
+		{"monitor of the instance", []string{"qemu-system-x86_64", "-drive", drive, "-qmp", "unix:" + qemu.QMPSocketPath("web") + ",server,nowait"}, true},
+		{"monitor of another instance", []string{"qemu-system-x86_64", "-drive", drive, "-qmp", "unix:" + qemu.QMPSocketPath("db") + ",server,nowait"}, false},
+		{"image without monitor", []string{"qemu-system-x86_64", "-drive", drive}, true},
+		{"other process", []string{"sleep", "30"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isInstanceHypervisor(tt.args, web); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKillInstanceProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start process: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	pid := cmd.Process.Pid
+
+	t.Run("other process", func(t *testing.T) {
+		err := killInstanceProcess(pid, func(args []string) bool {
+			return hasArgs(args, supervisorArgs("web")...)
+		})
+		if err == nil {
+			t.Error("expected error for a process that is not running the instance")
+		}
+
+		select {
+		case <-exited:
+			t.Fatal("killed a process that is not running the instance")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("instance process", func(t *testing.T) {
+		err := killInstanceProcess(pid, func(args []string) bool {
+			return hasArgs(args, "sleep", "30")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			t.Fatal("process not killed")
+		}
+	})
+
+	t.Run("exited process", func(t *testing.T) {
+		if err := killInstanceProcess(pid, func([]string) bool { return false }); err != nil {
+			t.Errorf("got %v for an exited process", err)
+		}
+	})
+}
@@ -3,9 +3,6 @@ package onprem
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path"
 	"strings"
 
 	"github.com/nanovms/ops/lepton"
@@ -32,7 +29,8 @@ func (op *OnPrem) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, err
 	return &vols, nil
 }
 
-// DeleteVolume deletes nanos-managed volume (filename and symlink)
+// DeleteVolume deletes nanos-managed volume (filename and symlink), volumes attached
+// to an image or in use by an instance are not deleted
 func (op *OnPrem) DeleteVolume(ctx *lepton.Context, name string) error {
 	query := map[string]string{
 		"label": name,
@@ -47,134 +45,44 @@ func (op *OnPrem) DeleteVolume(ctx *lepton.Context, name string) error {
 	}
 
 	if len(volumes) == 1 {
-		volumePath := path.Join(volumes[0].Path)
-		err := os.Remove(volumePath)
+		err = checkVolumeDetached(volumes[0])
 		if err != nil {
-			return err
-		}
-		symlinkPath := path.Join(buildDir, volumes[0].Name+".raw")
-		err = os.Remove(symlinkPath)
-		if err != nil {
-			return err
+			return fmt.Errorf("cannot delete volume: %v", err)
 		}
-	}
-
-	return nil
-}
 
-// AttachVolume attaches volume to instance on `ops instance create -t onprem`
-// or `ops run --mounts`
-// on `ops image create --mount`, it simply creates a mount path
-// with the given volume label
-// label can refer to volume UUID or volume label
-func (op *OnPrem) AttachVolume(ctx *lepton.Context, image, name string) error {
-	fmt.Println("not implemented")
-	fmt.Println("use <ops run> or <ops pkg load> with --mounts flag instead")
-	fmt.Println("alternatively, use <ops image create -t onprem> with --mounts flag")
-	fmt.Println("and run it with <ops instance create -t onprem>")
-	return nil
-}
+		return lepton.DeleteLocalVolume(volumes[0])
+	}
 
-// DetachVolume detaches volume
-func (op *OnPrem) DetachVolume(ctx *lepton.Context, image, name string) error {
-	fmt.Println("not implemented")
 	return nil
 }
 
-// parseSize parses the size of the lepton.NanosVolume to human readable format.
-// If the size value is empty, it returns 1 MB (the default size of volumes).
-func (op *OnPrem) parseSize(vol lepton.NanosVolume) string {
-	if vol.Size == "" {
-		// return the default size of a volume
-		return lepton.Bytes2Human(MiByte)
+// ResizeVolume grows the raw file and the filesystem of the volume, volumes in use by
+// an instance are not resized
+func (op *OnPrem) ResizeVolume(ctx *lepton.Context, name string, size lepton.VolumeSize) (lepton.NanosVolume, error) {
+	vol, err := findVolume(ctx.Config().VolumesDir, name)
+	if err != nil {
+		return vol, err
 	}
-	bytes, err := parseBytes(vol.Size)
+
+	i, err := volumeInstance(vol.Path)
 	if err != nil {
-		fmt.Printf("warning: invalid size value for volume %s with UUID %s: %s\n", vol.Name, vol.ID, err.Error())
+		return vol, err
+	}
+	if i != nil {
+		return vol, fmt.Errorf("cannot resize volume %s in use by instance %s", vol.Name, i.Instance)
 	}
-	size := lepton.Bytes2Human(bytes)
-	return size
+
+	return lepton.ResizeLocalVolume(vol, size)
 }
 
 // GetVolumes get nanos volume using filter
 // TODO might be better to interface this
 func GetVolumes(dir string, query map[string]string) ([]lepton.NanosVolume, error) {
-	var vols []lepton.NanosVolume
-	mvols := make(map[string]lepton.NanosVolume)
-
-	fi, err := ioutil.ReadDir(dir)
+	vols, err := lepton.LocalVolumes(dir)
 	if err != nil {
 		return vols, err
 	}
 
-	// this scans the directory twice, which can be improved
-	// looking for symlink first
-	for _, info := range fi {
-		if info.IsDir() {
-			continue
-		}
-
-		link, err := os.Readlink(path.Join(dir, info.Name()))
-		if err != nil {
-			continue
-		}
-
-		var id string
-		var label string
-		nl := strings.Split(strings.TrimSuffix(info.Name(), ".raw"), lepton.VolumeDelimiter)
-		if len(nl) == 1 {
-			label = nl[0]
-		}
-		src, err := os.Stat(link)
-		// ignore dangling symlink
-		if err != nil {
-			continue
-		}
-		nu := strings.Split(strings.TrimSuffix(src.Name(), ".raw"), lepton.VolumeDelimiter)
-		if len(nu) == 2 {
-			id = nu[1]
-		}
-
-		mvols[src.Name()] = lepton.NanosVolume{
-			ID:        id,
-			Name:      label,
-			Label:     label,
-			Size:      lepton.Bytes2Human(src.Size()),
-			Path:      path.Join(dir, src.Name()),
-			CreatedAt: src.ModTime().String(),
-		}
-	}
-	for _, info := range fi {
-		if info.IsDir() {
-			continue
-		}
-
-		link, _ := os.Readlink(path.Join(dir, info.Name()))
-		if link != "" {
-			continue
-		}
-
-		_, ok := mvols[info.Name()]
-		if ok {
-			continue
-		}
-
-		var id string
-		nu := strings.Split(strings.TrimSuffix(info.Name(), ".raw"), lepton.VolumeDelimiter)
-		if len(nu) == 2 {
-			id = nu[1]
-		}
-		mvols[info.Name()] = lepton.NanosVolume{
-			ID:   id,
-			Name: nu[0],
-			Size: lepton.Bytes2Human(info.Size()),
-			Path: path.Join(dir, info.Name()),
-		}
-	}
-
-	for _, vol := range mvols {
-		vols = append(vols, vol)
-	}
 	if query == nil {
 		return vols, nil
 	}
@@ -218,8 +126,6 @@ func AddMounts(mounts []string, config *types.Config) error {
 	if config.Mounts == nil {
 		config.Mounts = make(map[string]string)
 	}
-	query := make(map[string]string)
-
 	for _, mnt := range mounts {
 		lm := strings.Split(mnt, lepton.VolumeDelimiter)
 		if len(lm) != 2 {
@@ -229,24 +135,16 @@ func AddMounts(mounts []string, config *types.Config) error {
 			return fmt.Errorf("mount config invalid: %s", mnt)
 		}
 
-		query["id"] = lm[0]
-		query["label"] = lm[0]
-		vols, err := GetVolumes(config.VolumesDir, query)
+		vol, err := findVolume(config.VolumesDir, lm[0])
 		if err != nil {
 			return err
 		}
-
-		if len(vols) == 0 {
-			return fmt.Errorf("volume with uuid/label %s not found", lm[0])
-		} else if len(vols) > 1 {
-			return fmt.Errorf("ambiguous volume uuid/label: %s: multiple volumes found", lm[0])
-		}
 		_, ok := config.Mounts[lm[0]]
 		if ok {
 			return fmt.Errorf("mount path occupied: %s", lm[0])
 		}
 		config.Mounts[lm[0]] = lm[1]
-		config.RunConfig.Mounts = append(config.RunConfig.Mounts, vols[0].Path)
+		config.RunConfig.Mounts = append(config.RunConfig.Mounts, vol.Path)
 	}
 
 	return nil
@@ -258,22 +156,12 @@ func AddMountsFromConfig(config *types.Config) error {
 	if config.Mounts == nil {
 		return fmt.Errorf("no mount configuration found for image")
 	}
-	query := make(map[string]string)
-
 	for label := range config.Mounts {
-		query["id"] = label
-		query["label"] = label
-		vols, err := GetVolumes(config.VolumesDir, query)
+		vol, err := findVolume(config.VolumesDir, label)
 		if err != nil {
 			return err
 		}
-
-		if len(vols) == 0 {
-			return fmt.Errorf("volume with uuid/label %s not found", label)
-		} else if len(vols) > 1 {
-			return fmt.Errorf("ambiguous volume uuid/label: %s: multiple volumes found", label)
-		}
-		config.RunConfig.Mounts = append(config.RunConfig.Mounts, vols[0].Path)
+		config.RunConfig.Mounts = append(config.RunConfig.Mounts, vol.Path)
 	}
 
 	return nil
@@ -0,0 +1,197 @@
+package onprem
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the frequency the kernel reports process cpu times in
+const clockTicks = 100
+
+// cgroupRoot is the mount point of the cgroup v2 hierarchy
+var cgroupRoot = "/sys/fs/cgroup"
+
+// procRoot is the mount point of procfs
+var procRoot = "/proc"
+
+// readProcessStats samples the resource usage of the process from procfs, or from its
+// cgroup when the process is the only one in it
+func readProcessStats(pid int) (stats processStats, err error) {
+	stats.sampled = time.Now()
+
+	stats.cpuTime, err = readProcessCPUTime(pid)
+	if err != nil {
+		return
+	}
+
+	stats.memory, err = readProcessMemory(pid)
+	if err != nil {
+		return
+	}
+
+	// reading the io counters of processes of other users is not allowed
+	stats.readBytes, stats.writtenBytes, _ = readProcessIO(pid)
+
+	if cgroup := processCgroup(pid); cgroup != "" {
+		readCgroupStats(cgroup, &stats)
+	}
+
+	return
+}
+
+// readProcessCPUTime returns the user and system time of the process
+func readProcessCPUTime(pid int) (time.Duration, error) {
+	data, err := ioutil.ReadFile(path.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+
+	// the command name between parentheses may contain spaces
+	stat := string(data)
+	end := strings.LastIndex(stat, ")")
+	if end == -1 {
+		return 0, errors.New("invalid process stat")
+	}
+
+	// utime and stime are the fields 14 and 15, the fields after the name start at 3
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 13 {
+		return 0, errors.New("invalid process stat")
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(utime+stime) * time.Second / clockTicks, nil
+}
+
+// readProcessMemory returns the resident memory of the process
+func readProcessMemory(pid int) (uint64, error) {
+	f, err := os.Open(path.Join(procRoot, strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+
+	return 0, fmt.Errorf("resident memory of process %d not found", pid)
+}
+
+// readProcessIO returns the bytes the process read from and wrote to storage
+func readProcessIO(pid int) (read, written uint64, err error) {
+	f, err := os.Open(path.Join(procRoot, strconv.Itoa(pid), "io"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "read_bytes:":
+			read, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "write_bytes:":
+			written, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	return read, written, scanner.Err()
+}
+
+// processCgroup returns the cgroup v2 directory of the process if no other process
+// is in it
+func processCgroup(pid int) string {
+	data, err := ioutil.ReadFile(path.Join(procRoot, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "0::") {
+			continue
+		}
+
+		dir := path.Join(cgroupRoot, strings.TrimPrefix(line, "0::"))
+
+		procs, err := ioutil.ReadFile(path.Join(dir, "cgroup.procs"))
+		if err != nil || strings.TrimSpace(string(procs)) != strconv.Itoa(pid) {
+			return ""
+		}
+		return dir
+	}
+
+	return ""
+}
+
+// readCgroupStats replaces the process cpu and memory usage by the usage of its
+// cgroup, which includes the memory used by the kernel for the process
+func readCgroupStats(dir string, stats *processStats) {
+	if usage, ok := readCgroupKey(path.Join(dir, "cpu.stat"), "usage_usec"); ok {
+		stats.cpuTime = time.Duration(usage) * time.Microsecond
+	}
+
+	if memory, err := readCgroupValue(path.Join(dir, "memory.current")); err == nil {
+		stats.memory = memory
+	}
+
+	if limit, err := readCgroupValue(path.Join(dir, "memory.max")); err == nil {
+		stats.memoryLimit = limit
+	}
+}
+
+// readCgroupValue reads a file with a single number, it fails for "max"
+func readCgroupValue(file string) (uint64, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readCgroupKey reads a value of a flat keyed file
+func readCgroupKey(file, key string) (uint64, bool) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			value, err := strconv.ParseUint(fields[1], 10, 64)
+			return value, err == nil
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,108 @@
+package onprem
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		file := path.Join(root, name)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadProcessStats(t *testing.T) {
+	root, err := ioutil.TempDir("", "procstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	oldProcRoot, oldCgroupRoot := procRoot, cgroupRoot
+	procRoot, cgroupRoot = path.Join(root, "proc"), path.Join(root, "cgroup")
+	defer func() { procRoot, cgroupRoot = oldProcRoot, oldCgroupRoot }()
+
+	writeTestFiles(t, root, map[string]string{
+		"proc/42/stat":   "42 (qemu-system x86) S 1 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 3 0 100 0 0",
+		"proc/42/status": "Name:\tqemu\nVmPeak:\t  900000 kB\nVmRSS:\t  524288 kB\n",
+		"proc/42/io":     "rchar: 100\nwchar: 200\nread_bytes: 4096\nwrite_bytes: 8192\n",
+		"proc/42/cgroup": "0::/user.slice/session-1.scope\n",
+
+		"cgroup/user.slice/session-1.scope/cgroup.procs": "42\n1000\n",
+
+		"proc/43/stat":   "43 (qemu) S 1 43 43 0 -1 4194560 100 0 0 0 100 100 0 0 20 0 3 0 100 0 0",
+		"proc/43/status": "VmRSS:\t  1024 kB\n",
+		"proc/43/cgroup": "0::/ops/vm1\n",
+
+		"cgroup/ops/vm1/cgroup.procs":   "43\n",
+		"cgroup/ops/vm1/cpu.stat":       "usage_usec 7500000\nuser_usec 5000000\n",
+		"cgroup/ops/vm1/memory.current": "2097152\n",
+		"cgroup/ops/vm1/memory.max":     "1073741824\n",
+	})
+
+	t.Run("shared cgroup", func(t *testing.T) {
+		stats, err := readProcessStats(42)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stats.cpuTime != 3*time.Second {
+			t.Errorf("cpu time: got %v", stats.cpuTime)
+		}
+		if stats.memory != 512*1024*1024 {
+			t.Errorf("memory: got %d", stats.memory)
+		}
+		if stats.memoryLimit != 0 {
+			t.Errorf("memory limit: got %d", stats.memoryLimit)
+		}
+		if stats.readBytes != 4096 || stats.writtenBytes != 8192 {
+			t.Errorf("io: got %d %d", stats.readBytes, stats.writtenBytes)
+		}
+	})
+
+	t.Run("own cgroup", func(t *testing.T) {
+		stats, err := readProcessStats(43)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stats.cpuTime != 7500*time.Millisecond {
+			t.Errorf("cpu time: got %v", stats.cpuTime)
+		}
+		if stats.memory != 2097152 {
+			t.Errorf("memory: got %d", stats.memory)
+		}
+		if stats.memoryLimit != 1073741824 {
+			t.Errorf("memory limit: got %d", stats.memoryLimit)
+		}
+	})
+
+	t.Run("process not found", func(t *testing.T) {
+		if _, err := readProcessStats(44); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestCPUPercent(t *testing.T) {
+	now := time.Now()
+	first := processStats{cpuTime: time.Second, sampled: now}
+	last := processStats{cpuTime: 2500 * time.Millisecond, sampled: now.Add(time.Second)}
+
+	if got := cpuPercent(first, last); got != 150 {
+		t.Errorf("got %v, want 150", got)
+	}
+
+	if got := cpuPercent(first, first); got != 0 {
+		t.Errorf("got %v, want 0", got)
+	}
+}
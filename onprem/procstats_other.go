@@ -0,0 +1,10 @@
+// +build !linux
+
+package onprem
+
+import "errors"
+
+// readProcessStats is only supported on linux, where procfs is available
+func readProcessStats(pid int) (processStats, error) {
+	return processStats{}, errors.New("instance stats are only supported on linux")
+}
@@ -0,0 +1,128 @@
+package onprem
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanovms/ops/qemu"
+)
+
+// Restart policies of onprem instances
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+var (
+	// restartBackoffMin is the delay before the first restart
+	restartBackoffMin = time.Second
+
+	// restartBackoffMax is the maximum delay between restarts
+	restartBackoffMax = time.Minute
+
+	// restartBackoffReset is the time an instance must run for the delay to be reset
+	restartBackoffReset = 5 * time.Minute
+)
+
+// RestartPolicy specifies when a supervised instance is relaunched after it exits
+type RestartPolicy struct {
+	Mode string
+
+	// MaxRetries limits the restarts of the on-failure policy, 0 is unlimited
+	MaxRetries int
+}
+
+// ParseRestartPolicy parses policies with the format no, on-failure[:max-retries] or always
+func ParseRestartPolicy(spec string) (RestartPolicy, error) {
+	if spec == "" {
+		return RestartPolicy{Mode: RestartNo}, nil
+	}
+
+	mode := spec
+	maxRetries := ""
+	hasMaxRetries := false
+	if i := strings.Index(spec, ":"); i != -1 {
+		mode, maxRetries, hasMaxRetries = spec[:i], spec[i+1:], true
+	}
+
+	policy := RestartPolicy{Mode: mode}
+
+	switch mode {
+	case RestartNo, RestartAlways:
+		if hasMaxRetries {
+			return policy, fmt.Errorf("restart policy \"%s\" does not accept a maximum of retries", spec)
+		}
+	case RestartOnFailure:
+		if hasMaxRetries {
+			n, err := strconv.Atoi(maxRetries)
+			if err != nil || n <= 0 {
+				return policy, fmt.Errorf("invalid maximum of retries in restart policy \"%s\"", spec)
+			}
+			policy.MaxRetries = n
+		}
+	default:
+		return policy, fmt.Errorf("invalid restart policy \"%s\", use no, on-failure[:max-retries] or always", spec)
+	}
+
+	return policy, nil
+}
+
+// ShouldRestart returns true if the instance must be relaunched after exiting with
+// the hypervisor error exitErr having been restarted the times specified
+func (p RestartPolicy) ShouldRestart(exitErr error, restarts int) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		if p.MaxRetries > 0 && restarts >= p.MaxRetries {
+			return false
+		}
+		return exitFailed(exitErr)
+	}
+
+	return false
+}
+
+// exitFailed returns true unless the guest program exited successfully
+func exitFailed(exitErr error) bool {
+	status, reported := qemu.GuestExitStatus(exitErr)
+	if reported {
+		return status != 0
+	}
+	return exitErr != nil
+}
+
+// exitReason describes how the hypervisor exited
+func exitReason(exitErr error) string {
+	status, reported := qemu.GuestExitStatus(exitErr)
+
+	switch {
+	case reported && status == qemu.GuestExitFault:
+		return "unhandled fault"
+	case reported && status == qemu.GuestExitHalt:
+		return "kernel halted"
+	case reported:
+		return fmt.Sprintf("exit status %d", status)
+	case exitErr != nil:
+		return exitErr.Error()
+	}
+
+	return "stopped"
+}
+
+// restartBackoff returns the delay before relaunching an instance that ran for the
+// time specified, doubling the previous delay while the instance keeps failing fast
+func restartBackoff(previous, ran time.Duration) time.Duration {
+	if previous == 0 || ran >= restartBackoffReset {
+		return restartBackoffMin
+	}
+
+	next := previous * 2
+	if next > restartBackoffMax {
+		next = restartBackoffMax
+	}
+	return next
+}
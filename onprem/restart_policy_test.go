@@ -0,0 +1,112 @@
+package onprem
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/qemu"
+)
+
+func TestParseRestartPolicy(t *testing.T) {
+	valid := map[string]RestartPolicy{
+		"":              {Mode: RestartNo},
+		"no":            {Mode: RestartNo},
+		"always":        {Mode: RestartAlways},
+		"on-failure":    {Mode: RestartOnFailure},
+		"on-failure:5":  {Mode: RestartOnFailure, MaxRetries: 5},
+		"on-failure:10": {Mode: RestartOnFailure, MaxRetries: 10},
+	}
+
+	for spec, expected := range valid {
+		policy, err := ParseRestartPolicy(spec)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", spec, err)
+		} else if policy != expected {
+			t.Errorf("%q: got %+v, want %+v", spec, policy, expected)
+		}
+	}
+
+	for _, spec := range []string{"sometimes", "always:3", "no:1", "on-failure:", "on-failure:x", "on-failure:0", "on-failure:-1"} {
+		if _, err := ParseRestartPolicy(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	// exits with a non zero guest status on every architecture
+	failure := exec.Command("sh", "-c", "exit 3").Run()
+	if failure == nil {
+		t.Fatal("expected exit error")
+	}
+	killed := errors.New("signal: killed")
+
+	// qemu exits with 1 when it fails to start, the guest exit status 0 on x86
+	bootDetector := &qemu.BootDetector{}
+	bootDetector.Write([]byte("qemu-system-x86_64: failed to initialize kvm\n"))
+	bootFailure := bootDetector.Check(exec.Command("sh", "-c", "exit 1").Run())
+
+	tests := []struct {
+		name     string
+		policy   RestartPolicy
+		exitErr  error
+		restarts int
+		expected bool
+	}{
+		{"no policy after failure", RestartPolicy{Mode: RestartNo}, failure, 0, false},
+		{"always after clean exit", RestartPolicy{Mode: RestartAlways}, nil, 0, true},
+		{"always after many restarts", RestartPolicy{Mode: RestartAlways}, failure, 100, true},
+		{"on-failure after clean exit", RestartPolicy{Mode: RestartOnFailure}, nil, 0, false},
+		{"on-failure after failure", RestartPolicy{Mode: RestartOnFailure}, failure, 0, true},
+		{"on-failure after kill", RestartPolicy{Mode: RestartOnFailure}, killed, 0, true},
+		{"on-failure after boot failure", RestartPolicy{Mode: RestartOnFailure}, bootFailure, 0, true},
+		{"on-failure below max retries", RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}, failure, 2, true},
+		{"on-failure at max retries", RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}, failure, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.ShouldRestart(tt.exitErr, tt.restarts); got != tt.expected {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	backoff := restartBackoff(0, time.Second)
+	if backoff != restartBackoffMin {
+		t.Fatalf("first backoff: got %v, want %v", backoff, restartBackoffMin)
+	}
+
+	for i := 0; i < 10; i++ {
+		backoff = restartBackoff(backoff, time.Second)
+	}
+	if backoff != restartBackoffMax {
+		t.Errorf("backoff of instances failing fast: got %v, want %v", backoff, restartBackoffMax)
+	}
+
+	if got := restartBackoff(backoff, restartBackoffReset); got != restartBackoffMin {
+		t.Errorf("backoff after running long enough: got %v, want %v", got, restartBackoffMin)
+	}
+}
+
+func TestInstanceRestartsDescription(t *testing.T) {
+	unsupervised := instance{Instance: "test"}
+	if got := unsupervised.restartsDescription(); got != "" {
+		t.Errorf("unsupervised instance: got %q", got)
+	}
+
+	supervised := instance{Instance: "test", Restart: RestartAlways}
+	if got := supervised.restartsDescription(); got != "0" {
+		t.Errorf("instance not restarted: got %q", got)
+	}
+
+	supervised.Restarts = 2
+	supervised.LastExit = exitReason(errors.New("signal: killed"))
+	if got := supervised.restartsDescription(); got != "2 (signal: killed)" {
+		t.Errorf("restarted instance: got %q", got)
+	}
+}
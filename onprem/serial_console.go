@@ -0,0 +1,288 @@
+package onprem
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/nanovms/ops/qemu"
+)
+
+// consoleDetachKey is the key used to detach from an instance console (Ctrl-])
+const consoleDetachKey = 0x1d
+
+// InstanceLogPath returns the path of the file with the serial output of the instance
+func InstanceLogPath(instanceName string) string {
+	return "/tmp/" + instanceName + ".log"
+}
+
+// instanceLogIndexPath returns the path of the file with the time each line of the instance log was written
+func instanceLogIndexPath(instanceName string) string {
+	return InstanceLogPath(instanceName) + ".idx"
+}
+
+// removeInstanceLog removes the log of a previous instance with the same name
+func removeInstanceLog(instanceName string) {
+	os.Remove(InstanceLogPath(instanceName))
+	os.Remove(instanceLogIndexPath(instanceName))
+}
+
+// ConsoleSocketPath returns the path of the unix socket used to attach to the instance console
+func ConsoleSocketPath(instanceName string) string {
+	return "/tmp/" + instanceName + ".console.sock"
+}
+
+// StartSerialLogger launches the ops process that captures the serial output of the
+// instance and waits until it is ready to receive the hypervisor connection
+func StartSerialLogger(instanceName string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	serialPath := qemu.SerialSocketPath(instanceName)
+	os.Remove(serialPath)
+
+	cmd := exec.Command(executable, "instance", "serial-logger", instanceName)
+	cmd.SysProcAttr = sysProcAttrDetached()
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	cmd.Process.Release()
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(serialPath); err == nil {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fmt.Errorf("serial logger of instance \"%s\" did not start", instanceName)
+}
+
+// stopSerialLogger stops the serial logger of an instance whose hypervisor did not
+// start, the logger returns once the serial connection it waits for is closed
+func stopSerialLogger(instanceName string) {
+	conn, err := net.Dial("unix", qemu.SerialSocketPath(instanceName))
+	if err == nil {
+		conn.Close()
+	}
+}
+
+// RunSerialLogger receives the hypervisor serial connection of the instance, appends
+// its output to the instance log and forwards it to the attached console.
+// It returns when the hypervisor closes the connection.
+func RunSerialLogger(instanceName string) error {
+	logFile, err := os.OpenFile(InstanceLogPath(instanceName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	// the log of restarted instances keeps the output of previous runs
+	logInfo, err := logFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	indexFile, err := os.OpenFile(instanceLogIndexPath(instanceName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer indexFile.Close()
+
+	logger := &serialLogger{
+		serialPath:  qemu.SerialSocketPath(instanceName),
+		consolePath: ConsoleSocketPath(instanceName),
+		log:         logFile,
+		index:       indexFile,
+		offset:      logInfo.Size(),
+	}
+
+	return logger.run()
+}
+
+// serialLogger multiplexes the hypervisor serial connection between the log and
+// one attached console at a time. The log offset and time of every line are
+// written to the index.
+type serialLogger struct {
+	serialPath  string
+	consolePath string
+	log         io.Writer
+	index       io.Writer
+
+	offset    int64
+	midOfLine bool
+
+	mu      sync.Mutex
+	serial  net.Conn
+	console net.Conn
+}
+
+func (l *serialLogger) run() error {
+	os.Remove(l.consolePath)
+	consoleListener, err := net.Listen("unix", l.consolePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(l.consolePath)
+	defer consoleListener.Close()
+
+	serialListener, err := net.Listen("unix", l.serialPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(l.serialPath)
+
+	l.serial, err = serialListener.Accept()
+	serialListener.Close()
+	if err != nil {
+		return err
+	}
+	defer l.serial.Close()
+
+	go l.acceptConsoles(consoleListener)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := l.serial.Read(buf)
+		if n > 0 {
+			l.writeLog(buf[:n])
+
+			l.mu.Lock()
+			if l.console != nil {
+				l.console.Write(buf[:n])
+			}
+			l.mu.Unlock()
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	l.mu.Lock()
+	if l.console != nil {
+		l.console.Close()
+	}
+	l.mu.Unlock()
+
+	return nil
+}
+
+func (l *serialLogger) writeLog(output []byte) {
+	if l.index != nil {
+		now := time.Now().UnixNano()
+		for i, c := range output {
+			if !l.midOfLine {
+				fmt.Fprintf(l.index, "%d %d\n", l.offset+int64(i), now)
+			}
+			l.midOfLine = c != '\n'
+		}
+	}
+
+	l.log.Write(output)
+	l.offset += int64(len(output))
+}
+
+// logOffsetSince returns the offset of the first line of the log written after the
+// time specified or -1 if there is none
+func logOffsetSince(index io.Reader, since time.Time) (int64, error) {
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		var offset, timestamp int64
+		_, err := fmt.Sscanf(scanner.Text(), "%d %d", &offset, &timestamp)
+		if err != nil {
+			return 0, err
+		}
+
+		if timestamp >= since.UnixNano() {
+			return offset, nil
+		}
+	}
+
+	return -1, scanner.Err()
+}
+
+func (l *serialLogger) acceptConsoles(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		l.mu.Lock()
+		if l.console != nil {
+			l.mu.Unlock()
+			conn.Write([]byte("console already attached\n"))
+			conn.Close()
+			continue
+		}
+		l.console = conn
+		l.mu.Unlock()
+
+		go func() {
+			io.Copy(l.serial, conn)
+
+			l.mu.Lock()
+			l.console = nil
+			l.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// AttachConsole connects the terminal to the serial console of a background instance
+// until the instance stops or the user presses Ctrl-]
+func AttachConsole(instanceName string) error {
+	conn, err := net.Dial("unix", ConsoleSocketPath(instanceName))
+	if err != nil {
+		return fmt.Errorf("instance \"%s\" has no console available: %v", instanceName, err)
+	}
+	defer conn.Close()
+
+	fmt.Printf("attached to %s console, press Ctrl-] to detach\n", instanceName)
+
+	restore, err := makeRaw(int(os.Stdin.Fd()))
+	if err == nil {
+		defer restore()
+	}
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(os.Stdout, conn)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			for i := 0; i < n; i++ {
+				if buf[i] == consoleDetachKey {
+					conn.Write(buf[:i])
+					done <- struct{}{}
+					return
+				}
+			}
+			if n > 0 {
+				conn.Write(buf[:n])
+			}
+			if err != nil {
+				done <- struct{}{}
+				return
+			}
+		}
+	}()
+
+	<-done
+	fmt.Printf("\r\ndetached from %s console\n", instanceName)
+
+	return nil
+}
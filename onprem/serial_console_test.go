@@ -0,0 +1,161 @@
+package onprem
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/qemu"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func dialWhenReady(t *testing.T, socketPath string) net.Conn {
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("unix", socketPath)
+		if err == nil {
+			return conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("socket %s not available", socketPath)
+	return nil
+}
+
+func TestSerialLogger(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ops-serial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	log := &syncBuffer{}
+	index := &syncBuffer{}
+	logger := &serialLogger{
+		serialPath:  path.Join(tmp, "serial.sock"),
+		consolePath: path.Join(tmp, "console.sock"),
+		log:         log,
+		index:       index,
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- logger.run()
+	}()
+
+	serial := dialWhenReady(t, logger.serialPath)
+	serial.Write([]byte("booting\n"))
+	for i := 0; i < 100 && log.String() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	console := dialWhenReady(t, logger.consolePath)
+	console.Write([]byte("input\n"))
+
+	line, err := bufio.NewReader(serial).ReadString('\n')
+	if err != nil || line != "input\n" {
+		t.Errorf("expected console input to reach serial, got %q (%v)", line, err)
+	}
+
+	serial.Write([]byte("listening\n"))
+	line, err = bufio.NewReader(console).ReadString('\n')
+	if err != nil || line != "listening\n" {
+		t.Errorf("expected serial output to reach console, got %q (%v)", line, err)
+	}
+
+	serial.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if log.String() != "booting\nlistening\n" {
+		t.Errorf("expected serial output to be logged, got %q", log.String())
+	}
+
+	offset, err := logOffsetSince(strings.NewReader(index.String()), time.Unix(0, 0))
+	if err != nil || offset != 0 {
+		t.Errorf("expected first line offset 0, got %d (%v)", offset, err)
+	}
+}
+
+func TestStopSerialLogger(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "ops-serial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	instanceName := path.Base(tmp)
+	logger := &serialLogger{
+		serialPath:  qemu.SerialSocketPath(instanceName),
+		consolePath: path.Join(tmp, "console.sock"),
+		log:         &syncBuffer{},
+		index:       &syncBuffer{},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- logger.run()
+	}()
+
+	// the hypervisor connects once the serial socket exists
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(logger.serialPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stopSerialLogger(instanceName)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serial logger not stopped")
+	}
+}
+
+func TestLogOffsetSince(t *testing.T) {
+	index := "0 100\n8 200\n18 300\n"
+
+	tests := []struct {
+		since int64
+		want  int64
+	}{
+		{50, 0},
+		{200, 8},
+		{250, 18},
+		{400, -1},
+	}
+
+	for _, tt := range tests {
+		got, err := logOffsetSince(strings.NewReader(index), time.Unix(0, tt.since))
+		if err != nil || got != tt.want {
+			t.Errorf("since %d got %d (%v), want %d", tt.since, got, err, tt.want)
+		}
+	}
+}
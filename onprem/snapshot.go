@@ -0,0 +1,313 @@
+package onprem
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/qemu"
+	"github.com/nanovms/ops/types"
+)
+
+const (
+	snapshotMetadataFile = "snapshot.json"
+	snapshotStateFile    = "state"
+	snapshotDiskFile     = "disk.img"
+	snapshotRestoresDir  = "restores"
+)
+
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validateSnapshotName returns an error if the name can not be the directory of a
+// snapshot in the snapshots directory
+func validateSnapshotName(name string) error {
+	return validateFileName("snapshot", name)
+}
+
+// validateFileName returns an error if the name of the kind of object can not be a
+// file name in the snapshots directory
+func validateFileName(kind, name string) error {
+	if !snapshotNamePattern.MatchString(name) || strings.HasPrefix(name, ".") || strings.Contains(name, "..") {
+		return fmt.Errorf("invalid %s name \"%s\", use letters, digits, '.', '_' and '-'", kind, name)
+	}
+	return nil
+}
+
+// Snapshot is the saved state of an onprem instance, memory and devices, and a copy
+// of its disk
+type Snapshot struct {
+	Name     string    `json:"name"`
+	Instance string    `json:"instance"`
+	Image    string    `json:"image"`
+	Ports    []string  `json:"ports"`
+	Memory   string    `json:"memory"`
+	CPUs     int       `json:"cpus"`
+	Created  time.Time `json:"created"`
+
+	// Mounts are the volume files attached as disks when the instance was started,
+	// Volumes the volumes hot-plugged afterwards and Shares the host directories
+	// exposed to it, the machine is restored with the same devices
+	Mounts  []string          `json:"mounts,omitempty"`
+	Volumes []attachedVolume  `json:"volumes,omitempty"`
+	Shares  []types.SharedDir `json:"shares,omitempty"`
+
+	// Size is the size of the state and disk files
+	Size int64 `json:"-"`
+}
+
+// SnapshotsDir returns the directory with the instance snapshots
+func SnapshotsDir() string {
+	return path.Join(lepton.GetOpsHome(), "snapshots")
+}
+
+func snapshotDir(name string) string {
+	return path.Join(SnapshotsDir(), name)
+}
+
+// StatePath returns the path of the file with the machine state
+func (s *Snapshot) StatePath() string {
+	return path.Join(snapshotDir(s.Name), snapshotStateFile)
+}
+
+// DiskPath returns the path of the copy of the instance disk
+func (s *Snapshot) DiskPath() string {
+	return path.Join(snapshotDir(s.Name), snapshotDiskFile)
+}
+
+// RestoreDiskPath returns the path of the copy of the snapshot disk run by the
+// instance restored in the background, it is removed with the instance. The disk is
+// named after the instance, so the instance name is validated as snapshot names are.
+func (s *Snapshot) RestoreDiskPath(instanceName string) (string, error) {
+	err := validateFileName("instance", instanceName)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(snapshotDir(s.Name), snapshotRestoresDir, instanceName+".img"), nil
+}
+
+// removeRestoreDisk removes the image of an instance if it is a copy of a snapshot disk
+func removeRestoreDisk(imagePath string) {
+	dir := path.Dir(imagePath)
+	if path.Base(dir) == snapshotRestoresDir && path.Dir(path.Dir(dir)) == SnapshotsDir() {
+		os.Remove(imagePath)
+	}
+}
+
+// CreateSnapshot saves the state of a running instance. The instance is paused while
+// its disk is copied and resumed afterwards unless stop is true, in which case it is deleted.
+func (p *OnPrem) CreateSnapshot(ctx *lepton.Context, instanceName, snapshotName string, stop bool) (*Snapshot, error) {
+	instance, err := p.getInstance(instanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if snapshotName == "" {
+		snapshotName = fmt.Sprintf("%s-%d", instanceName, time.Now().Unix())
+	}
+
+	err = validateSnapshotName(snapshotName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(snapshotDir(snapshotName)); err == nil {
+		return nil, fmt.Errorf("snapshot \"%s\" already exists", snapshotName)
+	}
+
+	monitor, err := qemu.DialQMP(qemu.QMPSocketPath(instanceName))
+	if err != nil {
+		return nil, fmt.Errorf("instance \"%s\" has no monitor available: %v", instanceName, err)
+	}
+	defer monitor.Close()
+
+	err = os.MkdirAll(snapshotDir(snapshotName), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Name:     snapshotName,
+		Instance: instanceName,
+		Image:    path.Base(instance.Image),
+		Ports:    instance.Ports,
+		Memory:   instance.Memory,
+		CPUs:     instance.CPUs,
+		Created:  time.Now(),
+		Mounts:   instance.Mounts,
+		Volumes:  instance.Volumes,
+		Shares:   instance.Shares,
+	}
+
+	err = saveSnapshot(monitor, snapshot, instance.Image)
+	if err != nil {
+		os.RemoveAll(snapshotDir(snapshotName))
+		monitor.Continue()
+		return nil, err
+	}
+
+	if stop {
+		err = p.DeleteInstance(ctx, instanceName)
+	} else {
+		err = monitor.Continue()
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	return snapshot, nil
+}
+
+func saveSnapshot(monitor *qemu.QMP, snapshot *Snapshot, imagePath string) error {
+	err := monitor.SaveState(snapshot.StatePath())
+	if err != nil {
+		return err
+	}
+
+	// the machine is paused until it is resumed, so the disk is consistent with the state
+	err = copyFile(imagePath, snapshot.DiskPath())
+	if err != nil {
+		return err
+	}
+
+	metadata, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.Join(snapshotDir(snapshot.Name), snapshotMetadataFile), metadata, 0644)
+}
+
+// GetSnapshot returns the snapshot with the name passed by argument if it exists
+func GetSnapshot(name string) (*Snapshot, error) {
+	if err := validateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadFile(path.Join(snapshotDir(name), snapshotMetadataFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot \"%s\" not found", name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal(body, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range []string{snapshot.StatePath(), snapshot.DiskPath()} {
+		if info, err := os.Stat(file); err == nil {
+			snapshot.Size += info.Size()
+		}
+	}
+
+	return &snapshot, nil
+}
+
+// GetSnapshots returns every saved snapshot
+func GetSnapshots() (snapshots []Snapshot, err error) {
+	dirs, err := ioutil.ReadDir(SnapshotsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		snapshot, err := GetSnapshot(dir.Name())
+		if err != nil {
+			// snapshots still being saved have no metadata
+			continue
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	return
+}
+
+// DeleteSnapshot removes the snapshot files
+func DeleteSnapshot(name string) error {
+	if _, err := GetSnapshot(name); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(snapshotDir(name))
+}
+
+// RestoreSnapshotConfig configures the run configuration to restore the snapshot in a
+// copy of its disk saved to diskPath. The hot-plugged volumes are attached as disks
+// after the mounts, in the order they were attached, so the devices of the machine
+// are the ones of the saved state.
+func RestoreSnapshotConfig(snapshot *Snapshot, rconfig *types.RunConfig, diskPath string) error {
+	mounts := append([]string{}, snapshot.Mounts...)
+	for _, v := range snapshot.Volumes {
+		mounts = append(mounts, v.Path)
+	}
+
+	for _, file := range mounts {
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("volume of snapshot \"%s\": %v", snapshot.Name, err)
+		}
+	}
+	for _, share := range snapshot.Shares {
+		if _, err := os.Stat(share.HostDir); err != nil {
+			return fmt.Errorf("shared directory of snapshot \"%s\": %v", snapshot.Name, err)
+		}
+	}
+
+	err := os.MkdirAll(path.Dir(diskPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = copyFile(snapshot.DiskPath(), diskPath)
+	if err != nil {
+		return err
+	}
+
+	rconfig.Imagename = diskPath
+	rconfig.Incoming = snapshot.StatePath()
+	rconfig.Ports = snapshot.Ports
+	rconfig.CPUs = snapshot.CPUs
+	rconfig.Mounts = mounts
+	rconfig.Shares = snapshot.Shares
+	if snapshot.Memory != "" {
+		rconfig.Memory = snapshot.Memory
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
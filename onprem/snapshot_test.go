@@ -0,0 +1,157 @@
+package onprem
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
+)
+
+// testOpsHome points HOME to a temporary directory for the test and returns the
+// ops home in it
+func testOpsHome(t *testing.T) string {
+	home, err := ioutil.TempDir("", "ops-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+	t.Setenv("HOME", home)
+
+	return lepton.GetOpsHome()
+}
+
+func TestSnapshots(t *testing.T) {
+	opshome := testOpsHome(t)
+
+	saved := &Snapshot{
+		Name:     "webapp-1",
+		Instance: "webapp",
+		Image:    "webapp.img",
+		Ports:    []string{"8080"},
+		Memory:   "1G",
+		CPUs:     2,
+		Created:  time.Now(),
+	}
+
+	err := os.MkdirAll(snapshotDir(saved.Name), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(saved.StatePath(), []byte("state"), 0644)
+	ioutil.WriteFile(saved.DiskPath(), []byte("disk"), 0644)
+	metadata, _ := json.Marshal(saved)
+	ioutil.WriteFile(path.Join(snapshotDir(saved.Name), snapshotMetadataFile), metadata, 0644)
+
+	// snapshot being saved
+	os.MkdirAll(snapshotDir("webapp-2"), 0755)
+
+	snapshots, err := GetSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "webapp-1" || snapshots[0].Size != 9 {
+		t.Fatalf("got %+v", snapshots)
+	}
+
+	t.Run("restore disk outside of the snapshot", func(t *testing.T) {
+		if _, err := snapshots[0].RestoreDiskPath("../../web"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("restore config", func(t *testing.T) {
+		rconfig := types.NewConfig().RunConfig
+		diskPath, err := snapshots[0].RestoreDiskPath("webapp-restored")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = RestoreSnapshotConfig(&snapshots[0], &rconfig, diskPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rconfig.Imagename != diskPath || rconfig.Incoming != saved.StatePath() {
+			t.Errorf("got image %s and incoming %s", rconfig.Imagename, rconfig.Incoming)
+		}
+		if rconfig.Memory != "1G" || rconfig.CPUs != 2 || len(rconfig.Ports) != 1 {
+			t.Errorf("got %+v", rconfig)
+		}
+
+		disk, _ := ioutil.ReadFile(diskPath)
+		if string(disk) != "disk" {
+			t.Errorf("got disk %q", disk)
+		}
+
+		removeRestoreDisk(diskPath)
+		if _, err := os.Stat(diskPath); !os.IsNotExist(err) {
+			t.Errorf("restore disk not removed: %v", err)
+		}
+
+		image := path.Join(opshome, "images", "webapp.img")
+		os.MkdirAll(path.Dir(image), 0755)
+		ioutil.WriteFile(image, []byte("image"), 0644)
+		removeRestoreDisk(image)
+		if _, err := os.Stat(image); err != nil {
+			t.Errorf("image removed: %v", err)
+		}
+	})
+
+	t.Run("restore devices", func(t *testing.T) {
+		data := path.Join(opshome, "data.raw")
+		logs := path.Join(opshome, "logs.raw")
+		ioutil.WriteFile(data, []byte("data"), 0644)
+		ioutil.WriteFile(logs, []byte("logs"), 0644)
+
+		snapshot := snapshots[0]
+		snapshot.Mounts = []string{data}
+		snapshot.Volumes = []attachedVolume{{Name: "logs", Path: logs, MountPath: "/logs"}}
+		snapshot.Shares = []types.SharedDir{{HostDir: opshome, GuestPath: "/src", Tag: "share0"}}
+
+		rconfig := types.NewConfig().RunConfig
+		err := RestoreSnapshotConfig(&snapshot, &rconfig, path.Join(opshome, "devices.img"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rconfig.Mounts) != 2 || rconfig.Mounts[0] != data || rconfig.Mounts[1] != logs {
+			t.Errorf("got mounts %v", rconfig.Mounts)
+		}
+		if len(rconfig.Shares) != 1 || rconfig.Shares[0].Tag != "share0" {
+			t.Errorf("got shares %v", rconfig.Shares)
+		}
+
+		snapshot.Volumes[0].Path = path.Join(opshome, "missing.raw")
+		if err := RestoreSnapshotConfig(&snapshot, &rconfig, path.Join(opshome, "devices.img")); err == nil {
+			t.Error("expected error for a missing volume")
+		}
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		for _, name := range []string{"x;rm -rf ~", "../../etc", "..", ".", ".hidden", "a/b", "with space", ""} {
+			if _, err := GetSnapshot(name); err == nil || err.Error() == "snapshot \""+name+"\" not found" {
+				t.Errorf("%q: got %v, want invalid name error", name, err)
+			}
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		err := DeleteSnapshot("webapp-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := GetSnapshot("webapp-1"); err == nil {
+			t.Error("snapshot not deleted")
+		}
+
+		if err := DeleteSnapshot("missing"); err == nil {
+			t.Error("expected error deleting missing snapshot")
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package onprem
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nanovms/ops/qemu"
+)
+
+// StatsInterval is the interval the cpu usage of the instances is measured over
+var StatsInterval = time.Second
+
+// InstanceStats is the resource usage of a running onprem instance
+type InstanceStats struct {
+	Name string `json:"name"`
+	PID  int    `json:"pid"`
+
+	// CPUPercent is the cpu usage of the hypervisor, 100 is a fully used host cpu
+	CPUPercent float64 `json:"cpu_percent"`
+	CPUs       int     `json:"cpus"`
+
+	// MemoryUsage is the memory used by the hypervisor process or its cgroup
+	MemoryUsage uint64 `json:"memory_usage"`
+
+	// MemoryLimit is the memory of the guest or the limit of the cgroup, 0 if unknown
+	MemoryLimit uint64 `json:"memory_limit"`
+
+	BlockRead    uint64 `json:"block_read"`
+	BlockWritten uint64 `json:"block_written"`
+
+	// NetworkReceived and NetworkSent are counted from the guest perspective, they
+	// are only available for instances connected to a tap device
+	NetworkReceived *uint64 `json:"network_received,omitempty"`
+	NetworkSent     *uint64 `json:"network_sent,omitempty"`
+}
+
+// processStats is a sample of the resource usage of a process
+type processStats struct {
+	cpuTime      time.Duration
+	memory       uint64
+	memoryLimit  uint64
+	readBytes    uint64
+	writtenBytes uint64
+	sampled      time.Time
+}
+
+// GetInstanceStats measures the resource usage of the running instances during
+// StatsInterval, of every instance when instanceName is empty
+func (p *OnPrem) GetInstanceStats(instanceName string) ([]InstanceStats, error) {
+	instances, err := readInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	var running []savedInstance
+	for _, i := range instances {
+		if instanceName != "" && i.Instance != instanceName {
+			continue
+		}
+		if i.hypervisorPID() == 0 {
+			continue
+		}
+		running = append(running, i)
+	}
+
+	if instanceName != "" && len(running) == 0 {
+		return nil, fmt.Errorf("instance \"%s\" is not running", instanceName)
+	}
+
+	first := make([]processStats, len(running))
+	for n, i := range running {
+		first[n], err = readProcessStats(i.hypervisorPID())
+		if err != nil {
+			return nil, fmt.Errorf("failed reading stats of instance \"%s\": %v", i.Instance, err)
+		}
+	}
+
+	time.Sleep(StatsInterval)
+
+	var stats []InstanceStats
+	for n, i := range running {
+		last, err := readProcessStats(i.hypervisorPID())
+		if err != nil {
+			// the instance stopped while it was measured
+			continue
+		}
+
+		s := InstanceStats{
+			Name:         i.Instance,
+			PID:          i.hypervisorPID(),
+			CPUPercent:   cpuPercent(first[n], last),
+			CPUs:         i.CPUs,
+			MemoryUsage:  last.memory,
+			MemoryLimit:  last.memoryLimit,
+			BlockRead:    last.readBytes,
+			BlockWritten: last.writtenBytes,
+		}
+
+		if s.CPUs == 0 {
+			s.CPUs = 1
+		}
+
+		if s.MemoryLimit == 0 && i.Memory != "" {
+			if memory, err := parseBytes(i.Memory); err == nil {
+				s.MemoryLimit = uint64(memory)
+			}
+		}
+
+		// the monitor counts the guest drive operations only
+		if monitor, err := qemu.DialQMP(qemu.QMPSocketPath(i.Instance)); err == nil {
+			if read, written, err := monitor.BlockStats(); err == nil {
+				s.BlockRead, s.BlockWritten = read, written
+			}
+			monitor.Close()
+		}
+
+		if i.Tap != "" {
+			// the tap device receives what the guest sends
+			received, errReceived := readNetworkCounter(i.Tap, "tx_bytes")
+			sent, errSent := readNetworkCounter(i.Tap, "rx_bytes")
+			if errReceived == nil && errSent == nil {
+				s.NetworkReceived, s.NetworkSent = &received, &sent
+			}
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats, nil
+}
+
+// hypervisorPID returns the pid of the hypervisor or 0 if it is not running
+func (i *savedInstance) hypervisorPID() int {
+	if i.supervised() {
+		return i.HypervisorPID
+	}
+
+	pid, _ := strconv.Atoi(i.ID)
+	return pid
+}
+
+// cpuPercent returns the cpu usage between the samples
+func cpuPercent(first, last processStats) float64 {
+	elapsed := last.sampled.Sub(first.sampled)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(last.cpuTime-first.cpuTime) / float64(elapsed) * 100
+}
+
+// readNetworkCounter reads a statistic of a host network interface
+func readNetworkCounter(ifname, counter string) (uint64, error) {
+	data, err := ioutil.ReadFile(path.Join("/sys/class/net", ifname, "statistics", counter))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,264 @@
+package onprem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/qemu"
+	"github.com/nanovms/ops/types"
+)
+
+// StartSupervisor launches the ops process that runs the instance applying its
+// restart policy and waits until the instance is saved
+func StartSupervisor(rconfig *types.RunConfig) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	config, err := json.Marshal(rconfig)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executable, supervisorArgs(rconfig.InstanceName)...)
+	cmd.SysProcAttr = sysProcAttrDetached()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	_, err = stdin.Write(config)
+	stdin.Close()
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < 100; i++ {
+		if instanceSaved(strconv.Itoa(pid)) {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fmt.Errorf("supervisor of instance \"%s\" did not start", rconfig.InstanceName)
+}
+
+// supervisorArgs returns the arguments of the command supervising the instance
+func supervisorArgs(instanceName string) []string {
+	return []string{"instance", "supervise", instanceName}
+}
+
+// RunSupervisor reads the run configuration of the instance from r and runs it,
+// relaunching the hypervisor when it exits as specified by the restart policy.
+// The instance is saved with the supervisor pid and removed when the
+// supervisor is terminated. It returns when the instance is not restarted anymore.
+func RunSupervisor(r io.Reader) error {
+	var rconfig types.RunConfig
+	err := json.NewDecoder(r).Decode(&rconfig)
+	if err != nil {
+		return err
+	}
+
+	policy, err := ParseRestartPolicy(rconfig.Restart)
+	if err != nil {
+		return err
+	}
+
+	hypervisor := qemu.HypervisorInstance()
+	if hypervisor == nil {
+		return errors.New("No hypervisor found on $PATH")
+	}
+
+	s := &supervisor{
+		rconfig:    rconfig,
+		policy:     policy,
+		hypervisor: hypervisor,
+		id:         strconv.Itoa(os.Getpid()),
+		instance: instance{
+			Instance: rconfig.InstanceName,
+			Image:    rconfig.Imagename,
+			Ports:    rconfig.Ports,
+			Memory:   rconfig.Memory,
+			CPUs:     rconfig.CPUs,
+			Mounts:   rconfig.Mounts,
+			Shares:   rconfig.Shares,
+			Restart:  rconfig.Restart,
+			Created:  time.Now(),
+		},
+	}
+
+	if rconfig.Bridged {
+		s.instance.Tap = rconfig.TapName
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	return s.run(signals)
+}
+
+type supervisor struct {
+	rconfig    types.RunConfig
+	policy     RestartPolicy
+	hypervisor qemu.Hypervisor
+	id         string
+	instance   instance
+}
+
+func (s *supervisor) run(signals chan os.Signal) error {
+	var backoff time.Duration
+
+	for {
+		started := time.Now()
+		cmd, bootDetector, err := s.launch()
+		if err != nil {
+			s.instance.LastExit = err.Error()
+			s.instance.Status = "Stopped"
+			if saveErr := s.save(); saveErr != nil {
+				fmt.Println(saveErr)
+			}
+			return err
+		}
+
+		exited := make(chan error, 1)
+		go func() {
+			err := cmd.Wait()
+			if qemu.HasResourceLimits(&s.rconfig) {
+				qemu.RemoveCgroup(cmd.Process.Pid)
+			}
+			exited <- bootDetector.Check(err)
+		}()
+
+		select {
+		case <-signals:
+			cmd.Process.Kill()
+			<-exited
+			return removeInstance(s.id)
+		case exitErr := <-exited:
+			s.instance.HypervisorPID = 0
+			s.instance.LastExit = exitReason(exitErr)
+
+			if !s.policy.ShouldRestart(exitErr, s.instance.Restarts) {
+				s.instance.Status = "Stopped"
+				return s.save()
+			}
+
+			backoff = restartBackoff(backoff, time.Since(started))
+			// the failures are logged, the instance is saved again once restarted
+			s.instance.Status = "Restarting"
+			s.save()
+		}
+
+		select {
+		case <-signals:
+			return removeInstance(s.id)
+		case <-time.After(backoff):
+		}
+
+		s.instance.Restarts++
+	}
+}
+
+// launch starts the serial logger and the hypervisor of the instance, the boot
+// detector is written the errors of the hypervisor
+func (s *supervisor) launch() (*exec.Cmd, *qemu.BootDetector, error) {
+	err := StartSerialLogger(s.rconfig.InstanceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bootDetector := &qemu.BootDetector{}
+	cmd, err := s.startHypervisor(bootDetector)
+	if err != nil {
+		stopSerialLogger(s.rconfig.InstanceName)
+		return nil, nil, err
+	}
+
+	// the hypervisor is not left running without its pid in the state
+	s.instance.HypervisorPID = cmd.Process.Pid
+	s.instance.Status = "Running"
+	err = s.save()
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if qemu.HasResourceLimits(&s.rconfig) {
+			qemu.RemoveCgroup(cmd.Process.Pid)
+		}
+		stopSerialLogger(s.rconfig.InstanceName)
+		return nil, nil, err
+	}
+
+	// volumes attached while the previous hypervisor was running
+	err = plugInstanceVolumes(s.rconfig.InstanceName, s.instance.Volumes)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	return cmd, bootDetector, nil
+}
+
+// startHypervisor starts the hypervisor of the instance writing its errors to stderr.
+// A restored instance loads the machine state of the snapshot on its first start only,
+// restarts boot the restore disk the guest has written to since.
+func (s *supervisor) startHypervisor(stderr io.Writer) (*exec.Cmd, error) {
+	cmd, err := s.hypervisor.Command(&s.rconfig)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = stderr
+
+	err = qemu.StartCommand(cmd, &s.rconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	s.rconfig.Incoming = ""
+	return cmd, nil
+}
+
+// saveAttempts is the number of times the supervisor tries to save the instance, the
+// state can be locked by other ops processes for longer than the lock timeout
+const saveAttempts = 5
+
+// save saves the instance, retrying while the state can not be updated so delete and
+// stats do not act on a stale hypervisor pid
+func (s *supervisor) save() (err error) {
+	for attempt := 1; attempt <= saveAttempts; attempt++ {
+		err = lepton.UpdateState(func(tx *lepton.StateTx) error {
+			// the volumes are attached by other ops processes
+			var saved instance
+			if found, _ := tx.Get(lepton.StateInstances, s.id, &saved); found {
+				s.instance.Volumes = saved.Volumes
+			}
+
+			return tx.Put(lepton.StateInstances, s.id, s.instance)
+		})
+		if err == nil {
+			return nil
+		}
+
+		fmt.Printf("failed saving instance %s (attempt %d of %d): %v\n", s.instance.Instance, attempt, saveAttempts, err)
+	}
+
+	return err
+}
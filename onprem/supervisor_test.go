@@ -0,0 +1,52 @@
+package onprem
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/nanovms/ops/types"
+)
+
+// fakeHypervisor runs true and records the machine state of every command
+type fakeHypervisor struct {
+	incoming []string
+}
+
+func (h *fakeHypervisor) Start(rconfig *types.RunConfig) error {
+	return nil
+}
+
+func (h *fakeHypervisor) Command(rconfig *types.RunConfig) (*exec.Cmd, error) {
+	h.incoming = append(h.incoming, rconfig.Incoming)
+	return exec.Command("true"), nil
+}
+
+func (h *fakeHypervisor) Stop() {}
+
+func (h *fakeHypervisor) PID() (string, error) {
+	return "", nil
+}
+
+func TestSupervisorRestoreOnce(t *testing.T) {
+	hypervisor := &fakeHypervisor{}
+	s := &supervisor{
+		rconfig:    types.RunConfig{InstanceName: "web", Incoming: "/tmp/web.state"},
+		hypervisor: hypervisor,
+	}
+
+	for i := 0; i < 2; i++ {
+		cmd, err := s.startHypervisor(ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd.Wait()
+	}
+
+	// the restart boots the restore disk instead of loading the snapshot again
+	expected := []string{"/tmp/web.state", ""}
+	if !reflect.DeepEqual(hypervisor.incoming, expected) {
+		t.Errorf("got machine states %q, want %q", hypervisor.incoming, expected)
+	}
+}
@@ -1,10 +1,78 @@
 package onprem
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 // sysKill wraps syscall.Kill
 func sysKill(pid int) error {
 	return syscall.Kill(pid, 9)
 }
+
+// sysTerminate asks the process to terminate
+func sysTerminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// processArgs returns the command line arguments of the process
+func processArgs(pid int) ([]string, error) {
+	// the argument count is followed by the executable path, its padding and the
+	// arguments, all terminated by a NUL byte
+	procArgs, err := unix.SysctlRaw("kern.procargs2", pid)
+	if err != nil {
+		return nil, err
+	}
+	if len(procArgs) < 4 {
+		return nil, errors.New("invalid process arguments")
+	}
+
+	argc := int(binary.LittleEndian.Uint32(procArgs))
+	fields := bytes.Split(procArgs[4:], []byte{0})
+
+	var args []string
+	for _, field := range fields[1:] {
+		if len(args) == argc {
+			break
+		}
+		if len(field) == 0 && len(args) == 0 {
+			continue
+		}
+		args = append(args, string(field))
+	}
+	return args, nil
+}
+
+// sysProcAttrDetached returns the attributes of a process running in its own session
+func sysProcAttrDetached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// makeRaw puts the terminal in raw mode keeping local echo and returns a function
+// to restore the previous state
+func makeRaw(fd int) (func() error, error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TIOCGETA)
+	if err != nil {
+		return nil, err
+	}
+	oldState := *termios
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Lflag &^= unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, unix.TIOCSETA, termios); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return unix.IoctlSetTermios(fd, unix.TIOCSETA, &oldState)
+	}, nil
+}
@@ -1,10 +1,64 @@
 package onprem
 
 import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
 	"syscall"
+
+	"golang.org/x/sys/unix"
 )
 
 // sysKill wraps syscall.Kill
 func sysKill(pid int) error {
 	return syscall.Kill(pid, 9)
 }
+
+// sysTerminate asks the process to terminate
+func sysTerminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// processArgs returns the command line arguments of the process
+func processArgs(pid int) ([]string, error) {
+	cmdline, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for _, arg := range bytes.Split(bytes.TrimSuffix(cmdline, []byte{0}), []byte{0}) {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+// sysProcAttrDetached returns the attributes of a process running in its own session
+func sysProcAttrDetached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// makeRaw puts the terminal in raw mode keeping local echo and returns a function
+// to restore the previous state
+func makeRaw(fd int) (func() error, error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+	oldState := *termios
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Lflag &^= unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return unix.IoctlSetTermios(fd, unix.TCSETS, &oldState)
+	}, nil
+}
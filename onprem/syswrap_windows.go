@@ -2,9 +2,31 @@ package onprem
 
 import (
 	"errors"
+	"syscall"
 )
 
 // sysKill wraps syscall.Kill
 func sysKill(pid int) error {
 	return errors.New("not supported")
 }
+
+// sysTerminate asks the process to terminate
+func sysTerminate(pid int) error {
+	return errors.New("not supported")
+}
+
+// processArgs returns the command line arguments of the process
+func processArgs(pid int) ([]string, error) {
+	return nil, errProcessArgsUnsupported
+}
+
+// sysProcAttrDetached returns the attributes of a process running in its own session
+func sysProcAttrDetached() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{}
+}
+
+// makeRaw puts the terminal in raw mode keeping local echo and returns a function
+// to restore the previous state
+func makeRaw(fd int) (func() error, error) {
+	return nil, errors.New("not supported")
+}
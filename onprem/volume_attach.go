@@ -0,0 +1,405 @@
+package onprem
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/nanovms/ops/fs"
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/qemu"
+)
+
+// attachedVolume is a volume attached to an image or to a running instance
+type attachedVolume struct {
+	Name      string `json:"name"`
+	ID        string `json:"id,omitempty"`
+	Path      string `json:"path"`
+	MountPath string `json:"mount_path"`
+}
+
+// deviceID returns the id of the disk hot-plugged in the hypervisor
+func (v *attachedVolume) deviceID() string {
+	return "vol-" + v.Name
+}
+
+func (v *attachedVolume) matches(name string) bool {
+	return v.Name == name || (v.ID != "" && v.ID == name)
+}
+
+// findVolume returns the volume with the uuid or label
+func findVolume(volumesDir, name string) (lepton.NanosVolume, error) {
+	vols, err := GetVolumes(volumesDir, map[string]string{"id": name, "label": name})
+	if err != nil {
+		return lepton.NanosVolume{}, err
+	}
+
+	if len(vols) == 0 {
+		return lepton.NanosVolume{}, fmt.Errorf("volume with uuid/label %s not found", name)
+	} else if len(vols) > 1 {
+		return lepton.NanosVolume{}, fmt.Errorf("ambiguous volume uuid/label: %s: multiple volumes found", name)
+	}
+
+	return vols[0], nil
+}
+
+// localImagePath returns the path of the local image with the name
+func localImagePath(image string) (string, error) {
+	images := path.Join(lepton.GetOpsHome(), "images")
+
+	for _, name := range []string{image, image + ".img"} {
+		imagePath := path.Join(images, name)
+		if _, err := os.Stat(imagePath); err == nil {
+			return imagePath, nil
+		}
+	}
+
+	return "", fmt.Errorf("image or instance \"%s\" not found", image)
+}
+
+// imageRecord is the state of a local image
+type imageRecord struct {
+	Path    string           `json:"path"`
+	Volumes []attachedVolume `json:"volumes,omitempty"`
+}
+
+// readImageVolumes returns the volumes attached to the image
+func readImageVolumes(imagePath string) (vols []attachedVolume, err error) {
+	err = lepton.ViewState(func(tx *lepton.StateTx) error {
+		var image imageRecord
+		_, err := tx.Get(lepton.StateImages, imagePath, &image)
+		vols = image.Volumes
+		return err
+	})
+
+	return
+}
+
+// updateImageVolumes applies fn to the volumes attached to the image in a single
+// transaction, the image is removed from the state when it has no volumes
+func updateImageVolumes(imagePath string, fn func(vols []attachedVolume) ([]attachedVolume, error)) error {
+	return lepton.UpdateState(func(tx *lepton.StateTx) error {
+		image := imageRecord{Path: imagePath}
+		_, err := tx.Get(lepton.StateImages, imagePath, &image)
+		if err != nil {
+			return err
+		}
+
+		image.Volumes, err = fn(image.Volumes)
+		if err != nil {
+			return err
+		}
+
+		if len(image.Volumes) == 0 {
+			return tx.Delete(lepton.StateImages, imagePath)
+		}
+		return tx.Put(lepton.StateImages, imagePath, image)
+	})
+}
+
+// addImageVolumes adds the volumes attached to the image to the drives of the instance
+func addImageVolumes(imagePath string, mounts []string) ([]string, error) {
+	vols, err := readImageVolumes(imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range vols {
+		if _, err := os.Stat(v.Path); err != nil {
+			return nil, fmt.Errorf("volume %s attached to image %s: %v", v.Name, path.Base(imagePath), err)
+		}
+		mounts = append(mounts, v.Path)
+	}
+
+	return mounts, nil
+}
+
+// setImageMount sets the mount path of the volume in the manifest of the image, the
+// kernel mounts the volumes listed in the manifest only. An empty mount path removes
+// the volume from the manifest.
+func setImageMount(imagePath, label, mountPath string) error {
+	mounts, err := fs.ReadImageMounts(imagePath)
+	if err != nil {
+		return err
+	}
+
+	if mountPath == "" {
+		delete(mounts, label)
+	} else {
+		for l, p := range mounts {
+			if l != label && p == mountPath {
+				return fmt.Errorf("mount path occupied: %s", mountPath)
+			}
+		}
+		mounts[label] = mountPath
+	}
+
+	return fs.SetImageMounts(imagePath, mounts)
+}
+
+// AttachVolume attaches the volume to an image or to a running instance. The name
+// is <volume>[:<mount path>], with the volume uuid or label.
+// Volumes attached to an image are added as disks of the instances created from
+// it with `ops instance create -t onprem` and their mount paths are written in the
+// manifest of the image. Volumes attached to an instance are hot-plugged and kept
+// attached when the instance is restarted, the kernel mounts them at the path set
+// in the manifest of the image of the instance.
+func (op *OnPrem) AttachVolume(ctx *lepton.Context, image, name string) error {
+	volumeName, mountPath, err := lepton.ParseVolumeAttachment(name)
+	if err != nil {
+		return err
+	}
+
+	vol, err := findVolume(ctx.Config().VolumesDir, volumeName)
+	if err != nil {
+		return err
+	}
+
+	attached := attachedVolume{Name: vol.Name, ID: vol.ID, Path: vol.Path, MountPath: mountPath}
+
+	instances, err := readInstances()
+	if err != nil {
+		return err
+	}
+
+	for n := range instances {
+		if instances[n].Instance == image {
+			return attachInstanceVolume(&instances[n], attached)
+		}
+	}
+
+	imagePath, err := localImagePath(image)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range instances {
+		if i.Image == imagePath {
+			return fmt.Errorf("image %s is in use by instance %s", image, i.Instance)
+		}
+	}
+
+	return updateImageVolumes(imagePath, func(vols []attachedVolume) ([]attachedVolume, error) {
+		for _, v := range vols {
+			if v.Path == attached.Path {
+				return nil, fmt.Errorf("volume %s is already attached to image %s", vol.Name, image)
+			}
+			if v.MountPath == attached.MountPath {
+				return nil, fmt.Errorf("mount path occupied: %s", mountPath)
+			}
+		}
+
+		err := setImageMount(imagePath, attached.Name, attached.MountPath)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(vols, attached), nil
+	})
+}
+
+func attachInstanceVolume(i *savedInstance, attached attachedVolume) error {
+	if i.hypervisorPID() == 0 {
+		return fmt.Errorf("instance \"%s\" is not running", i.Instance)
+	}
+
+	for _, v := range i.Volumes {
+		if v.Path == attached.Path {
+			return fmt.Errorf("volume %s is already attached to instance %s", attached.Name, i.Instance)
+		}
+	}
+
+	// the image can not be updated while the kernel writes to it, the volume must
+	// already be in its manifest
+	mounts, err := fs.ReadImageMounts(i.Image)
+	if err != nil {
+		return err
+	}
+	if mounts[attached.Name] != attached.MountPath {
+		return fmt.Errorf("image of instance %s does not mount volume %s at %s, attach the volume to image %s before creating the instance", i.Instance, attached.Name, attached.MountPath, path.Base(i.Image))
+	}
+
+	monitor, err := qemu.DialQMP(qemu.QMPSocketPath(i.Instance))
+	if err != nil {
+		return err
+	}
+	defer monitor.Close()
+
+	err = monitor.AddVolume(attached.deviceID(), attached.Path)
+	if err != nil {
+		return err
+	}
+
+	return updateInstance(i.ID, func(i *instance) error {
+		i.Volumes = append(i.Volumes, attached)
+		return nil
+	})
+}
+
+// DetachVolume detaches the volume from an image or from a running instance. Volumes
+// can not be detached from an image while instances created from it are running.
+func (op *OnPrem) DetachVolume(ctx *lepton.Context, image, name string) error {
+	volumeName, _, err := lepton.ParseVolumeAttachment(name)
+	if err != nil {
+		return err
+	}
+
+	instances, err := readInstances()
+	if err != nil {
+		return err
+	}
+
+	for n := range instances {
+		if instances[n].Instance == image {
+			return detachInstanceVolume(&instances[n], volumeName)
+		}
+	}
+
+	imagePath, err := localImagePath(image)
+	if err != nil {
+		return err
+	}
+
+	return updateImageVolumes(imagePath, func(vols []attachedVolume) ([]attachedVolume, error) {
+		for n, v := range vols {
+			if !v.matches(volumeName) {
+				continue
+			}
+
+			for _, i := range instances {
+				if i.Image == imagePath {
+					return nil, fmt.Errorf("volume %s is in use by instance %s", v.Name, i.Instance)
+				}
+			}
+
+			err := setImageMount(imagePath, v.Name, "")
+			if err != nil {
+				return nil, err
+			}
+
+			return append(vols[:n], vols[n+1:]...), nil
+		}
+
+		return nil, fmt.Errorf("volume %s is not attached to image %s", volumeName, image)
+	})
+}
+
+func detachInstanceVolume(i *savedInstance, volumeName string) error {
+	for _, v := range i.Volumes {
+		if !v.matches(volumeName) {
+			continue
+		}
+
+		if i.hypervisorPID() != 0 {
+			monitor, err := qemu.DialQMP(qemu.QMPSocketPath(i.Instance))
+			if err != nil {
+				return err
+			}
+
+			err = monitor.RemoveVolume(v.deviceID())
+			monitor.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		return updateInstance(i.ID, func(i *instance) error {
+			for n, v := range i.Volumes {
+				if v.matches(volumeName) {
+					i.Volumes = append(i.Volumes[:n], i.Volumes[n+1:]...)
+					break
+				}
+			}
+			return nil
+		})
+	}
+
+	return fmt.Errorf("volume %s is not attached to instance %s", volumeName, i.Instance)
+}
+
+// volumeInstance returns the instance using the volume file as a disk, attached when
+// the instance was started or hot-plugged, or nil if no instance uses it
+func volumeInstance(volumePath string) (*savedInstance, error) {
+	instances, err := readInstances()
+	if err != nil {
+		return nil, err
+	}
+
+	for n, i := range instances {
+		for _, mount := range i.Mounts {
+			if mount == volumePath {
+				return &instances[n], nil
+			}
+		}
+		for _, v := range i.Volumes {
+			if v.Path == volumePath {
+				return &instances[n], nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// checkVolumeDetached returns an error if the volume is attached to an image or in
+// use by an instance
+func checkVolumeDetached(vol lepton.NanosVolume) error {
+	i, err := volumeInstance(vol.Path)
+	if err != nil {
+		return err
+	}
+	if i != nil {
+		return fmt.Errorf("volume %s is in use by instance %s", vol.Name, i.Instance)
+	}
+
+	return lepton.ViewState(func(tx *lepton.StateTx) error {
+		return tx.ForEach(lepton.StateImages, func(key string, value []byte) error {
+			var image imageRecord
+			if err := json.Unmarshal(value, &image); err != nil {
+				return err
+			}
+
+			for _, v := range image.Volumes {
+				if v.Path == vol.Path {
+					return fmt.Errorf("volume %s is attached to image %s", vol.Name, path.Base(image.Path))
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// plugInstanceVolumes hot-plugs the volumes attached to the instance once its
+// hypervisor was started again
+func plugInstanceVolumes(instanceName string, vols []attachedVolume) error {
+	if len(vols) == 0 {
+		return nil
+	}
+
+	var monitor *qemu.QMP
+	var err error
+
+	// the monitor socket is created when the hypervisor starts
+	for n := 0; n < 50; n++ {
+		monitor, err = qemu.DialQMP(qemu.QMPSocketPath(instanceName))
+		if err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		return err
+	}
+	defer monitor.Close()
+
+	for _, v := range vols {
+		err = monitor.AddVolume(v.deviceID(), v.Path)
+		if err != nil {
+			return fmt.Errorf("failed attaching volume %s: %v", v.Name, err)
+		}
+	}
+
+	return nil
+}
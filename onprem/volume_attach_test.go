@@ -0,0 +1,177 @@
+package onprem
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/nanovms/ops/fs"
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
+)
+
+// writeTestImage writes an image with a boot record and an empty program, the
+// boot record has the signature and the filesystem region entry only
+func writeTestImage(t *testing.T, imagePath string) {
+	dir := t.TempDir()
+
+	boot := make([]byte, 512)
+	boot[510], boot[511] = 0x55, 0xAA
+	binary.LittleEndian.PutUint32(boot[442:], 12) // filesystem region before the partitions
+	bootPath := path.Join(dir, "boot.img")
+	if err := ioutil.WriteFile(bootPath, boot, 0644); err != nil {
+		t.Fatal(err)
+	}
+	kernel := path.Join(dir, "kernel.img")
+	if err := ioutil.WriteFile(kernel, []byte("kernel"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := fs.NewManifest("")
+	m.AddKernel(kernel)
+
+	mkfs := fs.NewMkfsCommand(m)
+	mkfs.SetBoot(bootPath)
+	mkfs.SetFileSystemPath(imagePath)
+	if err := mkfs.Execute(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttachVolume(t *testing.T) {
+	testOpsHome(t)
+
+	config := &types.Config{VolumesDir: path.Join(lepton.GetOpsHome(), "volumes")}
+	ctx := lepton.NewContext(config)
+
+	vol, err := lepton.CreateLocalVolume(config, "data", "", "", "onprem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imagePath := path.Join(lepton.GetOpsHome(), "images", "web.img")
+	writeTestImage(t, imagePath)
+
+	p := &OnPrem{}
+
+	t.Run("attach to image", func(t *testing.T) {
+		err := p.AttachVolume(ctx, "web", "data:/var/data")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vols, err := readImageVolumes(imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(vols) != 1 || vols[0].Path != vol.Path || vols[0].MountPath != "/var/data" {
+			t.Fatalf("got %+v", vols)
+		}
+
+		imageMounts, err := fs.ReadImageMounts(imagePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(imageMounts) != 1 || imageMounts["data"] != "/var/data" {
+			t.Errorf("image mounts: got %v", imageMounts)
+		}
+
+		if err := p.AttachVolume(ctx, "web.img", vol.ID); err == nil {
+			t.Error("expected error attaching the volume twice")
+		}
+
+		mounts, err := addImageVolumes(imagePath, []string{"other.raw"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mounts) != 2 || mounts[1] != vol.Path {
+			t.Errorf("mounts: got %v", mounts)
+		}
+	})
+
+	t.Run("unknown volume or image", func(t *testing.T) {
+		if err := p.AttachVolume(ctx, "web", "logs"); err == nil {
+			t.Error("expected error for unknown volume")
+		}
+		if err := p.AttachVolume(ctx, "api", "data"); err == nil {
+			t.Error("expected error for unknown image")
+		}
+	})
+
+	stopped := &savedInstance{instance: instance{Instance: "web-1", Image: imagePath}, ID: "stopped"}
+	if err := saveInstance(stopped); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("attach to stopped instance", func(t *testing.T) {
+		if err := p.AttachVolume(ctx, "web-1", "data"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("attach to image in use", func(t *testing.T) {
+		if err := p.AttachVolume(ctx, "web", "data:/other"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("delete volume attached to image", func(t *testing.T) {
+		if err := p.DeleteVolume(ctx, "data"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("detach from image in use", func(t *testing.T) {
+		if err := p.DetachVolume(ctx, "web", "data"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	if err := removeInstance(stopped.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("detach from image", func(t *testing.T) {
+		err := p.DetachVolume(ctx, "web", "data")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if vols, _ := readImageVolumes(imagePath); len(vols) != 0 {
+			t.Errorf("attached volumes not removed: %+v", vols)
+		}
+		if mounts, _ := fs.ReadImageMounts(imagePath); len(mounts) != 0 {
+			t.Errorf("image mounts not removed: %v", mounts)
+		}
+
+		if err := p.DetachVolume(ctx, "web", "data"); err == nil {
+			t.Error("expected error detaching the volume twice")
+		}
+	})
+
+	t.Run("delete volume in use by instance", func(t *testing.T) {
+		running := &savedInstance{instance: instance{Instance: "db", Mounts: []string{vol.Path}}, ID: "running"}
+		if err := saveInstance(running); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.DeleteVolume(ctx, "data"); err == nil {
+			t.Error("expected error")
+		}
+
+		if err := removeInstance(running.ID); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("delete detached volume", func(t *testing.T) {
+		if err := p.DeleteVolume(ctx, "data"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(vol.Path); !os.IsNotExist(err) {
+			t.Errorf("volume file not removed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package onprem
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nanovms/ops/fs"
+	"github.com/nanovms/ops/lepton"
+)
+
+// SnapshotVolume copies the volume to a volume named <volume>-<timestamp>
+func (op *OnPrem) SnapshotVolume(ctx *lepton.Context, name string) (lepton.NanosVolume, error) {
+	vol, err := findVolume(ctx.Config().VolumesDir, name)
+	if err != nil {
+		return lepton.NanosVolume{}, err
+	}
+
+	return op.CloneVolume(ctx, name, vol.Name+"-"+time.Now().Format("20060102150405"))
+}
+
+// CloneVolume copies the volume to a new volume with its own uuid and label, volumes
+// in use by an instance are not copied as the copy would not be consistent
+func (op *OnPrem) CloneVolume(ctx *lepton.Context, name, newName string) (lepton.NanosVolume, error) {
+	volumesDir := ctx.Config().VolumesDir
+
+	vol, err := findVolume(volumesDir, name)
+	if err != nil {
+		return lepton.NanosVolume{}, err
+	}
+
+	i, err := volumeInstance(vol.Path)
+	if err != nil {
+		return lepton.NanosVolume{}, err
+	}
+	if i != nil {
+		return lepton.NanosVolume{}, fmt.Errorf("cannot copy volume %s in use by instance %s", vol.Name, i.Instance)
+	}
+
+	err = checkVolumeName(volumesDir, newName)
+	if err != nil {
+		return lepton.NanosVolume{}, err
+	}
+
+	return lepton.CloneLocalVolume(ctx.Config(), vol, newName)
+}
+
+// checkVolumeName returns an error if the name can not be used for a new volume
+func checkVolumeName(volumesDir, name string) error {
+	if name == "" || strings.Contains(name, lepton.VolumeDelimiter) || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid volume name \"%s\"", name)
+	}
+
+	vols, err := GetVolumes(volumesDir, map[string]string{"label": name})
+	if err != nil {
+		return err
+	}
+	if len(vols) != 0 {
+		return fmt.Errorf("volume %s already exists", name)
+	}
+
+	return nil
+}
+
+// ExportVolume writes the files of the volume to w as a tar archive
+func (op *OnPrem) ExportVolume(ctx *lepton.Context, name string, w io.Writer) error {
+	vol, err := findVolume(ctx.Config().VolumesDir, name)
+	if err != nil {
+		return err
+	}
+
+	return fs.ExportTar(vol.Path, w)
+}
+
+// ImportVolume creates a volume with the files of the tar archive
+func (op *OnPrem) ImportVolume(ctx *lepton.Context, name, size string, r io.Reader) (lepton.NanosVolume, error) {
+	err := checkVolumeName(ctx.Config().VolumesDir, name)
+	if err != nil {
+		return lepton.NanosVolume{}, err
+	}
+
+	dir, err := ioutil.TempDir("", "ops-volume-import")
+	if err != nil {
+		return lepton.NanosVolume{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	err = extractTar(r, dir)
+	if err != nil {
+		return lepton.NanosVolume{}, fmt.Errorf("cannot import volume %s: %v", name, err)
+	}
+
+	return lepton.CreateLocalVolume(ctx.Config(), name, dir, size, "onprem")
+}
+
+// extractTar extracts the directories, files and symbolic links of the archive to dir.
+// The links are created last and nothing is written through a link, so an archive
+// can not write outside of dir. Link targets are kept as they are, they are resolved
+// in the guest.
+func extractTar(r io.Reader, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	var links []*tar.Header
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+		if target == dir {
+			continue
+		}
+
+		if hdr.Typeflag == tar.TypeSymlink {
+			links = append(links, hdr)
+			continue
+		}
+
+		err = makeParentDirs(dir, target)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.Mkdir(target, 0755)
+			if os.IsExist(err) {
+				err = checkNotLink(target)
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractTarFile(tr, target)
+		default:
+			fmt.Printf("warning: skipping %s, unsupported file type\n", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, hdr := range links {
+		target := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+
+		err := makeParentDirs(dir, target)
+		if err != nil {
+			return err
+		}
+
+		err = os.Symlink(hdr.Linkname, target)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// makeParentDirs creates the missing parent directories of target in dir, it fails if
+// one of them is a link
+func makeParentDirs(dir, target string) error {
+	rel, err := filepath.Rel(dir, filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	parent := dir
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		parent = filepath.Join(parent, name)
+
+		err = os.Mkdir(parent, 0755)
+		if os.IsExist(err) {
+			err = checkNotLink(parent)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkNotLink returns an error if the existing path is a symbolic link
+func checkNotLink(p string) error {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symbolic link", p)
+	}
+	return nil
+}
+
+func extractTarFile(r io.Reader, target string) error {
+	err := checkNotLink(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,219 @@
+package onprem
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
+)
+
+func TestCloneVolume(t *testing.T) {
+	testOpsHome(t)
+
+	config := &types.Config{VolumesDir: path.Join(lepton.GetOpsHome(), "volumes")}
+	ctx := lepton.NewContext(config)
+	op := &OnPrem{}
+
+	vol, err := lepton.CreateLocalVolume(config, "data", "", "", "onprem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("clone", func(t *testing.T) {
+		clone, err := op.CloneVolume(ctx, "data", "copy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clone.ID == vol.ID {
+			t.Error("clone has the uuid of the volume")
+		}
+
+		found, err := findVolume(config.VolumesDir, "copy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.ID != clone.ID {
+			t.Errorf("got uuid %s, want %s", found.ID, clone.ID)
+		}
+	})
+
+	t.Run("clone to existing volume", func(t *testing.T) {
+		if _, err := op.CloneVolume(ctx, "data", "copy"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		snapshot, err := op.SnapshotVolume(ctx, "data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(snapshot.Name, "data-") {
+			t.Errorf("snapshot name %s", snapshot.Name)
+		}
+	})
+
+	t.Run("resize", func(t *testing.T) {
+		resized, err := op.ResizeVolume(ctx, "data", 8*lepton.MiB)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resized.Size != 8*lepton.MiB {
+			t.Errorf("got size %s", resized.Size)
+		}
+
+		found, err := findVolume(config.VolumesDir, "data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Size != 8*lepton.MiB {
+			t.Errorf("listed size %s", found.Size)
+		}
+
+		if _, err := op.ResizeVolume(ctx, "data", lepton.MiB); err == nil {
+			t.Error("expected error when shrinking")
+		}
+	})
+
+	t.Run("volume in use", func(t *testing.T) {
+		running := &savedInstance{instance: instance{Instance: "web", Volumes: []attachedVolume{{Name: "data", Path: vol.Path}}}, ID: "running"}
+		if err := saveInstance(running); err != nil {
+			t.Fatal(err)
+		}
+		defer removeInstance(running.ID)
+
+		if _, err := op.ResizeVolume(ctx, "data", 16*lepton.MiB); err == nil {
+			t.Error("expected error")
+		}
+		if _, err := op.SnapshotVolume(ctx, "data"); err == nil {
+			t.Error("expected error for snapshot")
+		}
+		if _, err := op.CloneVolume(ctx, "data", "other"); err == nil {
+			t.Error("expected error for clone")
+		}
+	})
+}
+
+func TestExportImportVolume(t *testing.T) {
+	opshome := testOpsHome(t)
+
+	data := path.Join(opshome, "data")
+	writeTestFiles(t, data, map[string]string{
+		"a.txt":     "hello",
+		"dir/b.txt": strings.Repeat("nanos", 1000),
+	})
+
+	config := &types.Config{VolumesDir: path.Join(lepton.GetOpsHome(), "volumes")}
+	ctx := lepton.NewContext(config)
+	op := &OnPrem{}
+
+	if _, err := lepton.CreateLocalVolume(config, "data", data, "", "onprem"); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	if err := op.ExportVolume(ctx, "data", &archive); err != nil {
+		t.Fatal(err)
+	}
+
+	vol, err := op.ImportVolume(ctx, "imported", "", bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var exported bytes.Buffer
+	if err := op.ExportVolume(ctx, vol.ID, &exported); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := path.Join(opshome, "extracted")
+	if err := extractTar(&exported, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.txt", "dir/b.txt"} {
+		want, _ := ioutil.ReadFile(path.Join(data, name))
+		got, err := ioutil.ReadFile(path.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, want %d", name, len(got), len(want))
+		}
+	}
+}
+
+func TestExtractTarLinks(t *testing.T) {
+	home, err := ioutil.TempDir("", "ops-extract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	outside := path.Join(home, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := func(entries ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range entries {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Size > 0 {
+				tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size)))
+			}
+		}
+		tw.Close()
+		return &buf
+	}
+
+	t.Run("file through link", func(t *testing.T) {
+		dir := path.Join(home, "file")
+		err := extractTar(archive(
+			&tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: outside},
+			&tar.Header{Name: "evil/pwned", Typeflag: tar.TypeReg, Size: 1, Mode: 0644},
+		), dir)
+		if err == nil {
+			t.Error("expected error")
+		}
+		if _, err := os.Stat(path.Join(outside, "pwned")); !os.IsNotExist(err) {
+			t.Errorf("file written outside: %v", err)
+		}
+	})
+
+	t.Run("link through link", func(t *testing.T) {
+		dir := path.Join(home, "link")
+		err := extractTar(archive(
+			&tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: outside},
+			&tar.Header{Name: "evil/pwned", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		), dir)
+		if err == nil {
+			t.Error("expected error")
+		}
+		if _, err := os.Lstat(path.Join(outside, "pwned")); !os.IsNotExist(err) {
+			t.Errorf("link created outside: %v", err)
+		}
+	})
+
+	t.Run("links", func(t *testing.T) {
+		dir := path.Join(home, "links")
+		err := extractTar(archive(
+			&tar.Header{Name: "lib", Typeflag: tar.TypeSymlink, Linkname: "/usr/lib"},
+			&tar.Header{Name: "usr/lib/libc.so", Typeflag: tar.TypeReg, Size: 1, Mode: 0644},
+		), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target, err := os.Readlink(path.Join(dir, "lib")); err != nil || target != "/usr/lib" {
+			t.Errorf("got link %s: %v", target, err)
+		}
+	})
+}
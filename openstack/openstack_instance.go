@@ -352,13 +352,10 @@ func (o *OpenStack) findInstance(name string) (volume *servers.Server, err error
 }
 
 // PrintInstanceLogs writes instance logs to console
-func (o *OpenStack) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := o.GetInstanceLogs(ctx, instancename)
-	if err != nil {
-		return err
-	}
-	fmt.Printf(l)
-	return nil
+func (o *OpenStack) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	return lepton.PrintLogs(opts.Writer(), opts, func() (string, error) {
+		return o.GetInstanceLogs(ctx, instancename)
+	})
 }
 
 // GetInstanceLogs gets instance related logs.
@@ -3,9 +3,7 @@ package openstack
 import (
 	"errors"
 	"fmt"
-	"math"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
@@ -52,19 +50,14 @@ func (o *OpenStack) CreateVolume(ctx *lepton.Context, name, data, size, provider
 		return vol, err
 	}
 
-	sizeNum, err := strconv.ParseFloat(size, 64)
+	volumeSize, err := lepton.ParseVolumeSize(size)
 	if err != nil {
 		return vol, err
 	}
 
-	sizeNum = sizeNum / 1000 / 1000 / 1000 // convert B to GB
-	if sizeNum < 1 {
-		sizeNum = 1
-	}
-
 	createOpts := volumes.CreateOpts{
 		Name:    name,
-		Size:    int(math.Round(sizeNum)),
+		Size:    int(volumeSize.GB()),
 		ImageID: image.ID,
 	}
 
@@ -122,7 +115,7 @@ func (o *OpenStack) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, e
 			Status:     volume.Status,
 			CreatedAt:  volume.CreatedAt.String(),
 			AttachedTo: strings.Join(attachments, ";"),
-			Size:       strconv.Itoa(volume.Size),
+			Size:       lepton.VolumeSize(volume.Size) * lepton.GiB,
 		}
 
 		vols = append(vols, vol)
@@ -195,8 +188,8 @@ func (o *OpenStack) AttachVolume(ctx *lepton.Context, image, name string) error
 		return err
 	}
 
+	// the device is picked by nova
 	createOpts := volumeattach.CreateOpts{
-		Device:   "/dev/" + name,
 		VolumeID: volume.ID,
 	}
 
@@ -0,0 +1,387 @@
+// Package opstest boots unikernels from Go tests.
+//
+// Run builds an image with the program, boots it in the local hypervisor with the
+// guest ports forwarded to free host ports, waits until it is ready and stops it
+// when the test finishes:
+//
+//	func TestServer(t *testing.T) {
+//		t.Parallel()
+//
+//		instance := opstest.Run(t, opstest.Options{
+//			Program: "./server",
+//			Ports:   []int{8080},
+//			WaitFor: "http://:8080/health",
+//		})
+//
+//		resp, err := http.Get(instance.URL(8080, "/hello"))
+//		...
+//	}
+package opstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/qemu"
+	"github.com/nanovms/ops/types"
+)
+
+var (
+	// DefaultTimeout is the time waited for an instance to be ready when no timeout is specified
+	DefaultTimeout = time.Minute
+
+	// checkInterval is the interval between readiness checks
+	checkInterval = 100 * time.Millisecond
+)
+
+// Options specifies how a test instance is built and booted
+type Options struct {
+	// Config is the base configuration of the image, it may be nil
+	Config *types.Config
+
+	// Program is the path of the ELF binary run by the instance
+	Program string
+
+	// Args are passed to the program
+	Args []string
+
+	// Env is the environment of the program
+	Env map[string]string
+
+	// Ports are the guest tcp ports forwarded to free host ports
+	Ports []int
+
+	// WaitFor is a readiness probe with the format tcp:port, http://:port/path or
+	// log:pattern, ports are guest ports
+	WaitFor string
+
+	// Timeout is the time waited for the instance to be ready
+	Timeout time.Duration
+}
+
+// Instance is a unikernel booted by a test
+type Instance struct {
+	// Config is the configuration used to build and boot the instance
+	Config *types.Config
+
+	// Host is the host address the guest ports are forwarded to
+	Host string
+
+	hostPorts map[int]int
+	cmd       *exec.Cmd
+	log       *syncBuffer
+	exited    chan struct{}
+	exitErr   error
+	stopOnce  sync.Once
+}
+
+// Run builds and boots an instance and registers its teardown in t.Cleanup. The test
+// fails if the instance is not ready before the timeout and is skipped if there is no
+// hypervisor available.
+func Run(t testing.TB, opts Options) *Instance {
+	t.Helper()
+
+	hypervisor := qemu.HypervisorInstance()
+	if hypervisor == nil {
+		t.Skip("no hypervisor found on $PATH")
+	}
+
+	var probe *lepton.ReadinessProbe
+	if opts.WaitFor != "" {
+		var err error
+		probe, err = lepton.ParseReadinessProbe(opts.WaitFor)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buildDir, err := ioutil.TempDir("", "opstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(buildDir) })
+
+	c, err := newConfig(opts, buildDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instance := &Instance{
+		Config:    c,
+		Host:      "127.0.0.1",
+		hostPorts: map[int]int{},
+		log:       &syncBuffer{},
+		exited:    make(chan struct{}),
+	}
+
+	for _, guestPort := range opts.Ports {
+		hostPort, err := freePort()
+		if err != nil {
+			t.Fatal(err)
+		}
+		instance.hostPorts[guestPort] = hostPort
+		c.RunConfig.Ports = append(c.RunConfig.Ports, fmt.Sprintf("%s:%d:%d", instance.Host, hostPort, guestPort))
+	}
+
+	err = lepton.BuildImage(*c)
+	if err != nil {
+		t.Fatalf("failed building image: %v", err)
+	}
+
+	instance.cmd, err = hypervisor.Command(&c.RunConfig)
+	if err != nil {
+		t.Fatalf("failed configuring instance: %v", err)
+	}
+	instance.cmd.Stdout = instance.log
+	instance.cmd.Stderr = instance.log
+
+	err = instance.cmd.Start()
+	if err != nil {
+		t.Fatalf("failed booting instance: %v", err)
+	}
+
+	go func() {
+		instance.exitErr = instance.cmd.Wait()
+		close(instance.exited)
+	}()
+
+	t.Cleanup(instance.Stop)
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	err = instance.waitFor(probe, timeout)
+	if err != nil {
+		t.Fatalf("instance not ready: %v\n%s", err, instance.Log())
+	}
+
+	return instance
+}
+
+func newConfig(opts Options, buildDir string) (*types.Config, error) {
+	c := types.NewConfig()
+	if opts.Config != nil {
+		var err error
+		c, err = copyConfig(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Program != "" {
+		c.Program = opts.Program
+	}
+	if c.Program == "" {
+		return nil, fmt.Errorf("no program to run")
+	}
+
+	programPath, err := filepath.Abs(c.Program)
+	if err != nil {
+		return nil, err
+	}
+	c.ProgramPath = programPath
+	c.Args = append([]string{c.Program}, opts.Args...)
+
+	if len(opts.Env) > 0 {
+		env := map[string]string{}
+		for k, v := range c.Env {
+			env[k] = v
+		}
+		for k, v := range opts.Env {
+			env[k] = v
+		}
+		c.Env = env
+	}
+
+	err = setNanosPaths(c)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.Split(filepath.Base(c.Program), ".")[0]
+	c.CloudConfig.ImageName = name
+	c.RunConfig.InstanceName = filepath.Base(buildDir)
+	c.RunConfig.Imagename = path.Join(buildDir, name+".img")
+	c.RunConfig.Background = false
+
+	return c, nil
+}
+
+// copyConfig returns a deep copy of the configuration, so the slices and maps of the
+// configuration shared by parallel tests are not changed. Configurations are read
+// from json, so the copy is made through json.
+func copyConfig(c *types.Config) (*types.Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := &types.Config{}
+	err = json.Unmarshal(data, copied)
+	if err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
+
+// setNanosPaths uses the boot and kernel images of the local nanos release when the
+// configuration does not specify them
+func setNanosPaths(c *types.Config) error {
+	if c.Boot == "" || c.Kernel == "" {
+		version := lepton.LocalReleaseVersion
+		if version == "0.0" {
+			version = lepton.LatestReleaseVersion
+			err := lepton.DownloadReleaseImages(version)
+			if err != nil {
+				return err
+			}
+		}
+
+		if c.Boot == "" {
+			c.Boot = path.Join(lepton.GetOpsHome(), version, "boot.img")
+		}
+
+		if c.Kernel == "" {
+			c.Kernel = path.Join(lepton.GetOpsHome(), version, "kernel.img")
+		}
+	}
+
+	if c.NameServer == "" {
+		c.NameServer = "8.8.8.8"
+	}
+
+	for _, file := range []string{c.Boot, c.Kernel} {
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (i *Instance) waitFor(probe *lepton.ReadinessProbe, timeout time.Duration) error {
+	if probe == nil {
+		return nil
+	}
+
+	host := i.Host
+	if probe.NeedsAddress() && probe.Host == "" {
+		hostProbe := *probe
+		hostProbe.Host = i.Host
+		hostProbe.Port = i.HostPort(probe.Port)
+		probe = &hostProbe
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := probe.Check(host, func() (string, error) { return i.Log(), nil })
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-i.exited:
+			return fmt.Errorf("instance exited: %v", i.exitErr)
+		default:
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout after %v: %v", timeout, err)
+		}
+		time.Sleep(checkInterval)
+	}
+}
+
+// HostPort returns the host port the guest port is forwarded to
+func (i *Instance) HostPort(guestPort int) int {
+	if hostPort, ok := i.hostPorts[guestPort]; ok {
+		return hostPort
+	}
+	return guestPort
+}
+
+// Address returns the host address the guest port is forwarded to
+func (i *Instance) Address(guestPort int) string {
+	return net.JoinHostPort(i.Host, strconv.Itoa(i.HostPort(guestPort)))
+}
+
+// URL returns the http url of the path in the guest port
+func (i *Instance) URL(guestPort int, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return "http://" + i.Address(guestPort) + path
+}
+
+// Log returns the serial output of the instance
+func (i *Instance) Log() string {
+	return i.log.String()
+}
+
+// WaitForLog waits until the pattern is written to the serial output
+func (i *Instance) WaitForLog(pattern string, timeout time.Duration) error {
+	return i.waitFor(&lepton.ReadinessProbe{Type: lepton.ProbeLog, Pattern: pattern}, timeout)
+}
+
+// Wait waits until the instance exits and returns the hypervisor error
+func (i *Instance) Wait() error {
+	<-i.exited
+	return i.exitErr
+}
+
+// Stop stops the instance, it is called when the test finishes
+func (i *Instance) Stop() {
+	i.stopOnce.Do(func() {
+		select {
+		case <-i.exited:
+		default:
+			i.cmd.Process.Kill()
+			<-i.exited
+		}
+	})
+}
+
+// freePort returns a tcp port not used in the host
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// syncBuffer is a buffer safe to write by the hypervisor while the test reads it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
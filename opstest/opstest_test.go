@@ -0,0 +1,115 @@
+package opstest
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
+)
+
+func TestNewConfig(t *testing.T) {
+	base := types.NewConfig()
+	base.Boot = "/dev/null"
+	base.Kernel = "/dev/null"
+	base.Env = map[string]string{"MODE": "test", "LEVEL": "debug"}
+
+	c, err := newConfig(Options{
+		Config:  base,
+		Program: "testdata/server.bin",
+		Args:    []string{"-v"},
+		Env:     map[string]string{"LEVEL": "info"},
+	}, "/tmp/opstest123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.CloudConfig.ImageName != "server" {
+		t.Errorf("got image name %s", c.CloudConfig.ImageName)
+	}
+	if c.RunConfig.Imagename != path.Join("/tmp/opstest123", "server.img") {
+		t.Errorf("got image path %s", c.RunConfig.Imagename)
+	}
+	if strings.Join(c.Args, " ") != "testdata/server.bin -v" {
+		t.Errorf("got args %v", c.Args)
+	}
+	if c.Env["MODE"] != "test" || c.Env["LEVEL"] != "info" {
+		t.Errorf("got env %v", c.Env)
+	}
+	if base.Env["LEVEL"] != "debug" {
+		t.Error("base configuration environment changed")
+	}
+
+	_, err = newConfig(Options{Config: base}, "/tmp/opstest123")
+	if err == nil {
+		t.Error("expected error without program")
+	}
+}
+
+func TestNewConfigCopy(t *testing.T) {
+	base := types.NewConfig()
+	base.Boot = "/dev/null"
+	base.Kernel = "/dev/null"
+	base.Program = "testdata/server.bin"
+	base.Env = map[string]string{"MODE": "test"}
+	base.Mounts = map[string]string{"data": "/data"}
+	base.Files = []string{"config.json"}
+	base.RunConfig.Ports = []string{"8080"}
+
+	c, err := newConfig(Options{Config: base}, "/tmp/opstest123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Env["MODE"] = "changed"
+	c.Mounts["data"] = "/changed"
+	c.Files[0] = "changed"
+	c.RunConfig.Ports[0] = "9090"
+
+	if base.Env["MODE"] != "test" || base.Mounts["data"] != "/data" || base.Files[0] != "config.json" || base.RunConfig.Ports[0] != "8080" {
+		t.Errorf("base configuration changed: %v %v %v %v", base.Env, base.Mounts, base.Files, base.RunConfig.Ports)
+	}
+}
+
+func TestInstanceAddress(t *testing.T) {
+	instance := &Instance{Host: "127.0.0.1", hostPorts: map[int]int{8080: 41234}}
+
+	if got := instance.Address(8080); got != "127.0.0.1:41234" {
+		t.Errorf("got %s", got)
+	}
+	if got := instance.Address(9090); got != "127.0.0.1:9090" {
+		t.Errorf("got %s for a port not forwarded", got)
+	}
+	if got := instance.URL(8080, "health"); got != "http://127.0.0.1:41234/health" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestInstanceWaitFor(t *testing.T) {
+	t.Run("log written", func(t *testing.T) {
+		instance := &Instance{log: &syncBuffer{}, exited: make(chan struct{})}
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			instance.log.Write([]byte("booting\nlistening on 8080\n"))
+		}()
+
+		err := instance.WaitForLog("listening", time.Second)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("instance exited", func(t *testing.T) {
+		instance := &Instance{log: &syncBuffer{}, exited: make(chan struct{}), exitErr: errors.New("exit status 1")}
+		close(instance.exited)
+
+		err := instance.waitFor(&lepton.ReadinessProbe{Type: lepton.ProbeLog, Pattern: "listening"}, time.Second)
+		if err == nil || !strings.Contains(err.Error(), "exit status 1") {
+			t.Errorf("got %v, want instance exited error", err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package qemu
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// qemuErrorExitCode is the exit code of qemu when it fails to start the guest, on
+// x86 it is also the exit code of a guest exiting with status 0
+const qemuErrorExitCode = 1
+
+// BootError is returned for a hypervisor that exited because qemu failed to start
+// the guest, it has the error printed by qemu
+type BootError struct {
+	Message string
+	Err     error
+}
+
+func (e *BootError) Error() string {
+	return "qemu failed to start: " + e.Message
+}
+
+func (e *BootError) Unwrap() error {
+	return e.Err
+}
+
+// BootDetector tells whether the guest booted from the output of qemu. It is written
+// the stderr of qemu, where qemu prints its errors prefixed with its program name,
+// and the serial output of the guest returned by Guest.
+type BootDetector struct {
+	mu           sync.Mutex
+	line         []byte
+	qemuError    string
+	guestStarted bool
+}
+
+// Write records the errors printed by qemu on stderr
+func (d *BootDetector) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.line = append(d.line, p...)
+	for {
+		i := bytes.IndexByte(d.line, '\n')
+		if i < 0 {
+			break
+		}
+		d.addLine(string(d.line[:i]))
+		d.line = d.line[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (d *BootDetector) addLine(line string) {
+	line = strings.TrimSpace(line)
+	if d.qemuError == "" && strings.HasPrefix(line, "qemu-") && !strings.Contains(line, ": warning: ") {
+		d.qemuError = line
+	}
+}
+
+// Guest returns the writer of the serial output of the guest, any output means the
+// guest booted
+func (d *BootDetector) Guest() io.Writer {
+	return guestOutput{d}
+}
+
+type guestOutput struct {
+	d *BootDetector
+}
+
+func (g guestOutput) Write(p []byte) (int, error) {
+	g.d.mu.Lock()
+	defer g.d.mu.Unlock()
+
+	if len(p) > 0 {
+		g.d.guestStarted = true
+	}
+	return len(p), nil
+}
+
+// Check returns a BootError wrapping the error of the hypervisor if qemu exited
+// after printing an error without the guest printing anything, qemu exits with 1
+// then and the exit code must not be read as a guest exit status
+func (d *BootDetector) Check(err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.line) > 0 {
+		d.addLine(string(d.line))
+		d.line = nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != qemuErrorExitCode {
+		return err
+	}
+
+	if d.guestStarted || d.qemuError == "" {
+		return err
+	}
+
+	return &BootError{Message: d.qemuError, Err: err}
+}
@@ -0,0 +1,75 @@
+// +build linux darwin
+
+package qemu
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func exitError(t *testing.T, code string) error {
+	err := exec.Command("sh", "-c", "exit "+code).Run()
+	if err == nil {
+		t.Fatal("expected exit error")
+	}
+	return err
+}
+
+func TestBootDetector(t *testing.T) {
+	t.Run("qemu error", func(t *testing.T) {
+		d := &BootDetector{}
+		d.Write([]byte("qemu-system-x86_64: warning: host doesn't support requested feature\n"))
+		d.Write([]byte("qemu-system-x86_64: -drive file=missing.img: Could not open 'missing.img'"))
+
+		err := d.Check(exitError(t, "1"))
+
+		var bootErr *BootError
+		if !errors.As(err, &bootErr) {
+			t.Fatalf("got %v, want boot error", err)
+		}
+		if bootErr.Message != "qemu-system-x86_64: -drive file=missing.img: Could not open 'missing.img'" {
+			t.Errorf("got message %q", bootErr.Message)
+		}
+		if _, reported := GuestExitStatus(err); reported {
+			t.Error("qemu error reported as guest exit status")
+		}
+	})
+
+	t.Run("guest exit", func(t *testing.T) {
+		d := &BootDetector{}
+		d.Guest().Write([]byte("hello\n"))
+		d.Write([]byte("qemu-system-x86_64: terminating on signal\n"))
+
+		err := d.Check(exitError(t, "1"))
+
+		var bootErr *BootError
+		if errors.As(err, &bootErr) {
+			t.Fatalf("got boot error %v after guest output", err)
+		}
+		if isx86() {
+			if status, reported := GuestExitStatus(err); !reported || status != 0 {
+				t.Errorf("got status %d reported %v, want 0", status, reported)
+			}
+		}
+	})
+
+	t.Run("guest exit status", func(t *testing.T) {
+		d := &BootDetector{}
+		d.Write([]byte("qemu-system-x86_64: some error\n"))
+
+		err := d.Check(exitError(t, "5"))
+		if isx86() {
+			if status, reported := GuestExitStatus(err); !reported || status != 2 {
+				t.Errorf("got status %d reported %v, want 2", status, reported)
+			}
+		}
+	})
+
+	t.Run("clean exit", func(t *testing.T) {
+		d := &BootDetector{}
+		if err := d.Check(nil); err != nil {
+			t.Errorf("got %v", err)
+		}
+	})
+}
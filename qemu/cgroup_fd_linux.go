@@ -0,0 +1,12 @@
+// +build linux,go1.20
+
+package qemu
+
+import "syscall"
+
+// setCgroupFD sets the process to start in the cgroup of the directory descriptor
+func setCgroupFD(attr *syscall.SysProcAttr, fd int) bool {
+	attr.UseCgroupFD = true
+	attr.CgroupFD = fd
+	return true
+}
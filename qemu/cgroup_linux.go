@@ -0,0 +1,210 @@
+package qemu
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/nanovms/ops/types"
+)
+
+// CgroupRoot is the cgroup v2 directory the cgroups of the hypervisors are created in
+var CgroupRoot = "/sys/fs/cgroup/ops"
+
+// CgroupPath returns the cgroup directory of the hypervisor process
+func CgroupPath(pid int) string {
+	return path.Join(CgroupRoot, strconv.Itoa(pid))
+}
+
+// ApplyResourceLimits moves the hypervisor process to a cgroup of its own with the
+// cpu, memory and I/O limits of the configuration
+func ApplyResourceLimits(rconfig *types.RunConfig, pid int) error {
+	dir := CgroupPath(pid)
+	err := createCgroup(rconfig, dir)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+	if err != nil {
+		os.Remove(dir)
+		return cgroupError(err)
+	}
+
+	return nil
+}
+
+// createCgroup creates the cgroup directory with the limits of the configuration
+func createCgroup(rconfig *types.RunConfig, dir string) error {
+	controllers := cgroupControllers(rconfig)
+
+	// the controllers must be enabled in every ancestor of the cgroup
+	for _, parent := range []string{path.Dir(CgroupRoot), CgroupRoot} {
+		if parent == CgroupRoot {
+			if err := os.MkdirAll(parent, 0755); err != nil {
+				return cgroupError(err)
+			}
+		}
+
+		for _, controller := range controllers {
+			err := ioutil.WriteFile(path.Join(parent, "cgroup.subtree_control"), []byte("+"+controller), 0644)
+			if err != nil {
+				return cgroupError(fmt.Errorf("failed enabling %s controller: %v", controller, err))
+			}
+		}
+	}
+
+	err := os.Mkdir(dir, 0755)
+	if err != nil && !os.IsExist(err) {
+		return cgroupError(err)
+	}
+
+	limits := map[string]string{}
+	if rconfig.CPUQuota > 0 {
+		limits["cpu.max"] = cpuMax(rconfig.CPUQuota)
+	}
+	if rconfig.CPUSet != "" {
+		limits["cpuset.cpus"] = rconfig.CPUSet
+	}
+	if rconfig.MemoryLimit != "" {
+		limits["memory.max"] = rconfig.MemoryLimit
+	}
+	if rconfig.IOWeight > 0 {
+		limits["io.weight"] = "default " + strconv.Itoa(rconfig.IOWeight)
+	}
+
+	for file, value := range limits {
+		err = ioutil.WriteFile(path.Join(dir, file), []byte(value), 0644)
+		if err != nil && file == "cpuset.cpus" {
+			os.Remove(dir)
+			return fmt.Errorf("cpuset \"%s\" is not available to the hypervisor: %v", value, err)
+		} else if err != nil {
+			os.Remove(dir)
+			return cgroupError(fmt.Errorf("failed setting %s: %v", file, err))
+		}
+	}
+
+	return nil
+}
+
+// startCgroups counts the cgroups hypervisors are started in, so every start has a
+// cgroup of its own
+var startCgroups uint32
+
+// startInCgroup sets the command to start in a cgroup with the limits of the
+// configuration, so the hypervisor never runs without them. The cgroup of the
+// hypervisor is named after its pid, which is known once it started, so the command
+// starts in a temporary cgroup and release removes it after the hypervisor was moved
+// to its own cgroup. Starting in a cgroup requires linux 5.7, on older kernels the
+// command is left unchanged and runs without limits until it is moved.
+func startInCgroup(cmd *exec.Cmd, rconfig *types.RunConfig) (release func(), err error) {
+	release = func() {}
+	if !kernelAtLeast(5, 7) {
+		return
+	}
+
+	n := atomic.AddUint32(&startCgroups, 1)
+	dir := path.Join(CgroupRoot, fmt.Sprintf("start-%d-%d", os.Getpid(), n))
+	err = createCgroup(rconfig, dir)
+	if err != nil {
+		return
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		os.Remove(dir)
+		return release, cgroupError(err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if !setCgroupFD(cmd.SysProcAttr, int(f.Fd())) {
+		f.Close()
+		os.Remove(dir)
+		return
+	}
+
+	release = func() {
+		f.Close()
+		removeCgroupDir(dir)
+	}
+	return
+}
+
+// kernelAtLeast returns true if the version of the running kernel is at least
+// major.minor
+func kernelAtLeast(major, minor int) bool {
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		return false
+	}
+
+	release := string(bytes.TrimRight(uname.Release[:], "\x00"))
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	kernelMajor, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	kernelMinor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+	if err != nil {
+		return false
+	}
+
+	return kernelMajor > major || (kernelMajor == major && kernelMinor >= minor)
+}
+
+func cgroupControllers(rconfig *types.RunConfig) (controllers []string) {
+	if rconfig.CPUQuota > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if rconfig.CPUSet != "" {
+		controllers = append(controllers, "cpuset")
+	}
+	if rconfig.MemoryLimit != "" {
+		controllers = append(controllers, "memory")
+	}
+	if rconfig.IOWeight > 0 {
+		controllers = append(controllers, "io")
+	}
+	return
+}
+
+func cgroupError(err error) error {
+	return fmt.Errorf("failed placing the hypervisor in a cgroup of %s, resource limits require cgroup v2 and root: %v", CgroupRoot, err)
+}
+
+// RemoveCgroup removes the cgroup of the hypervisor process once it exited
+func RemoveCgroup(pid int) error {
+	return removeCgroupDir(CgroupPath(pid))
+}
+
+// removeCgroupDir removes the cgroup directory once its processes exited
+func removeCgroupDir(dir string) error {
+	var err error
+	for i := 0; i < 20; i++ {
+		err = os.Remove(dir)
+		if err == nil || os.IsNotExist(err) {
+			return nil
+		}
+
+		// the cgroup is busy until the killed process is reaped
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return err
+}
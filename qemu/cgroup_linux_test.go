@@ -0,0 +1,118 @@
+package qemu
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/nanovms/ops/types"
+)
+
+func TestApplyResourceLimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	oldCgroupRoot := CgroupRoot
+	CgroupRoot = path.Join(root, "ops")
+	defer func() { CgroupRoot = oldCgroupRoot }()
+
+	rconfig := &types.RunConfig{CPUQuota: 2, CPUSet: "0", MemoryLimit: "1G", IOWeight: 200}
+
+	err = ApplyResourceLimits(rconfig, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"cgroup.subtree_control":     "+io",
+		"ops/cgroup.subtree_control": "+io",
+		"ops/42/cpu.max":             "200000 100000",
+		"ops/42/cpuset.cpus":         "0",
+		"ops/42/memory.max":          "1G",
+		"ops/42/io.weight":           "default 200",
+		"ops/42/cgroup.procs":        "42",
+	}
+	for file, value := range expected {
+		data, err := ioutil.ReadFile(path.Join(root, file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		// the controllers are enabled one write at a time, a regular file keeps the last
+		if strings.TrimSpace(string(data)) != value {
+			t.Errorf("%s: got %q, want %q", file, data, value)
+		}
+	}
+
+	// a real cgroup directory has no regular files
+	files, _ := ioutil.ReadDir(CgroupPath(42))
+	for _, f := range files {
+		os.Remove(path.Join(CgroupPath(42), f.Name()))
+	}
+
+	err = RemoveCgroup(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(CgroupPath(42)); !os.IsNotExist(err) {
+		t.Error("cgroup not removed")
+	}
+}
+
+func TestStartInCgroup(t *testing.T) {
+	if !kernelAtLeast(5, 7) {
+		t.Skip("starting in a cgroup requires linux 5.7")
+	}
+
+	root, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	oldCgroupRoot := CgroupRoot
+	CgroupRoot = path.Join(root, "ops")
+	defer func() { CgroupRoot = oldCgroupRoot }()
+
+	cmd := exec.Command("true")
+	release, err := startInCgroup(cmd, &types.RunConfig{MemoryLimit: "1G"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, _ := ioutil.ReadDir(CgroupRoot)
+	var dir string
+	for _, d := range dirs {
+		if d.IsDir() {
+			dir = path.Join(CgroupRoot, d.Name())
+		}
+	}
+	if dir == "" {
+		t.Fatal("cgroup not created")
+	}
+
+	data, err := ioutil.ReadFile(path.Join(dir, "memory.max"))
+	if err != nil || string(data) != "1G" {
+		t.Errorf("memory.max: got %q %v", data, err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		t.Error("command does not start in the cgroup")
+	}
+
+	// a real cgroup directory has no regular files
+	os.Remove(path.Join(dir, "memory.max"))
+	release()
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("cgroup not removed")
+	}
+}
@@ -0,0 +1,10 @@
+// +build linux,!go1.20
+
+package qemu
+
+import "syscall"
+
+// setCgroupFD returns false as starting a process in a cgroup requires go 1.20
+func setCgroupFD(attr *syscall.SysProcAttr, fd int) bool {
+	return false
+}
@@ -0,0 +1,25 @@
+// +build !linux
+
+package qemu
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/nanovms/ops/types"
+)
+
+// ApplyResourceLimits is only supported on linux, where cgroups are available
+func ApplyResourceLimits(rconfig *types.RunConfig, pid int) error {
+	return errors.New("resource limits are only supported on linux")
+}
+
+// RemoveCgroup does nothing as cgroups are only created on linux
+func RemoveCgroup(pid int) error {
+	return nil
+}
+
+// startInCgroup leaves the command unchanged as cgroups are only created on linux
+func startInCgroup(cmd *exec.Cmd, rconfig *types.RunConfig) (func(), error) {
+	return func() {}, nil
+}
@@ -30,7 +30,7 @@ func HypervisorInstance() Hypervisor {
 // Hypervisor interface
 type Hypervisor interface {
 	Start(rconfig *types.RunConfig) error
-	Command(rconfig *types.RunConfig) *exec.Cmd
+	Command(rconfig *types.RunConfig) (*exec.Cmd, error)
 	Stop()
 	PID() (string, error)
 }
@@ -24,7 +24,7 @@ func HypervisorInstance() Hypervisor {
 // Hypervisor interface
 type Hypervisor interface {
 	Start(rconfig *RunConfig) error
-	Command(rconfig *RunConfig) *exec.Cmd
+	Command(rconfig *RunConfig) (*exec.Cmd, error)
 	Stop()
 }
 
@@ -5,6 +5,14 @@ import (
 	"strings"
 )
 
+// scsiController is the id of the scsi controller of the machine, the disks of the
+// volumes are attached to its bus on every architecture so that volumes can be
+// hot-plugged with QMP
+const scsiController = "scsi0"
+
+// volumeBus is the bus of the disks of the volumes
+const volumeBus = scsiController + ".0"
+
 type drive struct {
 	path   string
 	format string
@@ -63,6 +71,7 @@ type netdev struct {
 	ifname     string
 	script     string
 	downscript string
+	vhost      bool
 	hports     []portfwd
 }
 
@@ -83,6 +92,9 @@ func (nd netdev) String() string {
 		} else {
 			sb.WriteString(",downscript=no")
 		}
+		if nd.vhost {
+			sb.WriteString(",vhost=on")
+		}
 	}
 	for _, hport := range nd.hports {
 		sb.WriteString(fmt.Sprintf(",%s", hport))
@@ -91,21 +103,18 @@ func (nd netdev) String() string {
 }
 
 type portfwd struct {
-	port  string
-	proto string
+	hostaddr  string
+	hostport  int
+	guestport int
+	proto     string
 }
 
 func (pf portfwd) String() string {
-	fromPort := pf.port
-	toPort := pf.port
-
-	if strings.Contains(fromPort, "-") {
-		rangeParts := strings.Split(fromPort, "-")
-		fromPort = rangeParts[0]
-		toPort = rangeParts[1]
+	hostaddr := pf.hostaddr
+	if strings.Contains(hostaddr, ":") {
+		hostaddr = "[" + hostaddr + "]"
 	}
-
-	return fmt.Sprintf("hostfwd=%s::%v-:%v", pf.proto, fromPort, toPort)
+	return fmt.Sprintf("hostfwd=%s:%s:%d-:%d", pf.proto, hostaddr, pf.hostport, pf.guestport)
 }
 
 type display struct {
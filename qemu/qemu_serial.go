@@ -0,0 +1,7 @@
+package qemu
+
+// SerialSocketPath returns the path of the unix socket the hypervisor connects the
+// serial port of a background instance to
+func SerialSocketPath(instanceName string) string {
+	return "/tmp/" + instanceName + ".serial.sock"
+}
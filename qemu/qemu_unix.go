@@ -14,14 +14,20 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/nanovms/ops/constants"
+	"github.com/nanovms/ops/network"
 	"github.com/nanovms/ops/types"
 )
 
+// incomingFD is the file descriptor of the machine state in the hypervisor, the
+// first of the extra files of the command
+const incomingFD = 3
+
 type qemu struct {
 	cmd     *exec.Cmd
 	drives  []drive
@@ -30,6 +36,12 @@ type qemu struct {
 	display display
 	serial  serial
 	flags   []string
+
+	// exited is closed when the command waited by Start exits, so Stop does not wait
+	// for a command that is already waited
+	exited chan struct{}
+
+	signalOnce sync.Once
 }
 
 func newQemu() Hypervisor {
@@ -37,11 +49,16 @@ func newQemu() Hypervisor {
 }
 
 func (q *qemu) Stop() {
-	if q.cmd != nil {
+	if q.cmd != nil && q.cmd.Process != nil {
 		if err := q.cmd.Process.Kill(); err != nil {
 			fmt.Println(err)
 		}
 
+		if q.exited != nil {
+			<-q.exited
+			return
+		}
+
 		// do not print errors as the command could be started with Run()
 		q.cmd.Wait()
 	}
@@ -53,44 +70,77 @@ func logv(rconfig *types.RunConfig, msg string) {
 	}
 }
 
-func (q *qemu) Command(rconfig *types.RunConfig) *exec.Cmd {
-	args := q.Args(rconfig)
+func (q *qemu) Command(rconfig *types.RunConfig) (*exec.Cmd, error) {
+	args, err := q.Args(rconfig)
+	if err != nil {
+		return nil, err
+	}
 	logv(rconfig, qemuBaseCommand+" "+strings.Join(args, " "))
-	q.cmd = exec.Command(qemuBaseCommand, args...)
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c,
-		syscall.SIGHUP,
-		syscall.SIGINT,
-		syscall.SIGTERM,
-		syscall.SIGQUIT)
-	go func(chan os.Signal) {
-		<-c
-		q.Stop()
-	}(c)
-
-	return q.cmd
+	cmd := exec.Command(qemuBaseCommand, args...)
+
+	// the machine state is passed opened, so its path is never interpreted by qemu
+	if rconfig.Incoming != "" {
+		state, err := os.Open(rconfig.Incoming)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open machine state: %v", err)
+		}
+		cmd.ExtraFiles = []*os.File{state}
+	}
+	q.cmd = cmd
+
+	return q.cmd, nil
+}
+
+// stopOnSignal stops the command started by Start when ops is interrupted. Commands
+// returned by Command and started by the caller are waited by the caller only.
+func (q *qemu) stopOnSignal() {
+	// the last command started is stopped, so Start can be called again to restart
+	q.signalOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c,
+			syscall.SIGHUP,
+			syscall.SIGINT,
+			syscall.SIGTERM,
+			syscall.SIGQUIT)
+		go func(chan os.Signal) {
+			<-c
+			q.Stop()
+		}(c)
+	})
 }
 
 func (q *qemu) Start(rconfig *types.RunConfig) error {
 	if q.cmd == nil {
-		q.Command(rconfig)
+		_, err := q.Command(rconfig)
+		if err != nil {
+			return err
+		}
 		q.cmd.Stdout = os.Stdout
 		q.cmd.Stderr = os.Stderr
 	}
 
+	q.stopOnSignal()
+
 	if rconfig.Background {
-		err := q.cmd.Start()
-		if err != nil {
-			fmt.Println(err)
-		}
-	} else {
-		if err := q.cmd.Run(); err != nil {
-			fmt.Println(err)
-		}
+		q.exited = nil
+		return StartCommand(q.cmd, rconfig)
 	}
 
-	return nil
+	exited := make(chan struct{})
+	q.exited = exited
+	defer close(exited)
+
+	err := StartCommand(q.cmd, rconfig)
+	if err != nil {
+		return err
+	}
+
+	err = q.cmd.Wait()
+	if HasResourceLimits(rconfig) {
+		RemoveCgroup(q.cmd.Process.Pid)
+	}
+
+	return err
 }
 
 func (q *qemu) addDrive(id, image, ifaceType string) {
@@ -113,10 +163,11 @@ func (q *qemu) addSerial(serialType string) {
 
 // addDevice adds a device to the qemu for rendering to string arguments. If the
 // devType is "user" then the ifaceName is ignored and host forward ports are
-// added. If the mac address is empty then a random mac address is chosen.
+// added. Port ranges are forwarded port by port. If the mac address is empty
+// then a random mac address is chosen.
 // Backend interface are created for each device and their ids are auto
 // incremented.
-func (q *qemu) addNetDevice(devType, ifaceName, mac string, hostPorts []string, udp bool) {
+func (q *qemu) addNetDevice(devType, ifaceName, mac string, hostPorts []network.PortMapping) {
 	id := fmt.Sprintf("n%d", len(q.ifaces))
 	dv := device{
 		driver:  "virtio-net",
@@ -135,11 +186,14 @@ func (q *qemu) addNetDevice(devType, ifaceName, mac string, hostPorts []string,
 	if devType != "user" {
 		ndv.ifname = ifaceName
 	} else {
-		for _, p := range hostPorts {
-			ndv.hports = append(ndv.hports, portfwd{port: p, proto: "tcp"})
-
-			if udp {
-				ndv.hports = append(ndv.hports, portfwd{port: p, proto: "udp"})
+		for _, pm := range hostPorts {
+			for i := 0; i <= pm.HostTo-pm.HostFrom; i++ {
+				ndv.hports = append(ndv.hports, portfwd{
+					hostaddr:  pm.HostAddress,
+					hostport:  pm.HostFrom + i,
+					guestport: pm.GuestFrom + i,
+					proto:     pm.Protocol,
+				})
 			}
 		}
 	}
@@ -148,6 +202,62 @@ func (q *qemu) addNetDevice(devType, ifaceName, mac string, hostPorts []string,
 	q.ifaces = append(q.ifaces, ndv)
 }
 
+// maxForwardedPorts limits the ports forwarded from the host, port ranges are
+// forwarded port by port with an option each
+const maxForwardedPorts = 1024
+
+// portMappings returns the port mappings of the tcp and udp ports specified in the
+// configuration. If UDP is enabled the ports without explicit protocol are also
+// forwarded for udp.
+func portMappings(rconfig *types.RunConfig) (mappings []network.PortMapping, err error) {
+	mappings, err = network.ParsePortMappings(rconfig.Ports, network.ProtocolTCP)
+	if err != nil {
+		return
+	}
+
+	if rconfig.UDP {
+		var udpMappings []network.PortMapping
+		udpMappings, err = network.ParsePortMappings(rconfig.Ports, network.ProtocolUDP)
+		if err != nil {
+			return
+		}
+
+		for i, pm := range udpMappings {
+			if pm.Protocol != mappings[i].Protocol {
+				mappings = append(mappings, pm)
+			}
+		}
+	}
+
+	udpMappings, err := network.ParsePortMappings(rconfig.UDPPorts, network.ProtocolUDP)
+	if err != nil {
+		return
+	}
+
+	mappings = append(mappings, udpMappings...)
+
+	ports := 0
+	for _, pm := range mappings {
+		ports += pm.HostTo - pm.HostFrom + 1
+	}
+	if ports > maxForwardedPorts {
+		err = fmt.Errorf("%d ports forwarded, at most %d ports can be forwarded", ports, maxForwardedPorts)
+	}
+
+	return
+}
+
+// addIOThread adds the thread the disk controller emulation runs in if I/O threads
+// are enabled and returns the option of the controller device using it
+func (q *qemu) addIOThread(rconfig *types.RunConfig) string {
+	if !rconfig.IOThreads {
+		return ""
+	}
+
+	q.addOption("-object", "iothread,id=iothread0")
+	return ",iothread=iothread0"
+}
+
 func (q *qemu) addDiskDevice(id, driver string) {
 	dv := device{
 		driver:  driver,
@@ -218,8 +328,8 @@ func (q *qemu) addOption(flag, value string) {
 
 // setAccel - trying to set accel.
 // Shows Warning messages if can't enable.
-// May terminate ops (depends on error, see qemu_errors:qemuAccelWarningMessage for details).
-func (q *qemu) setAccel(rconfig *types.RunConfig) {
+// Returns an error when qemu can not run (see qemu_errors:qemuAccelWarningMessage for details).
+func (q *qemu) setAccel(rconfig *types.RunConfig) error {
 	var (
 		isAdded      bool  = false
 		supportedErr error = &errQemuHWAccelDisabledInConfig{errCustom{"Hardware acceleration disabled in config", nil}}
@@ -235,12 +345,14 @@ func (q *qemu) setAccel(rconfig *types.RunConfig) {
 			fmt.Println(msg)
 		}
 		if terminate {
-			os.Exit(1)
+			return supportedErr
 		}
 		if isAdded {
 			fmt.Printf(constants.WarningColor, "Anyway, we will try to enable hardware acceleration\n")
 		}
 	}
+
+	return nil
 }
 
 // addAccel - trying to enable hardware acceleration and check if it is supported.
@@ -291,7 +403,7 @@ func (q *qemu) addAccel() (bool, error) {
 	return false, nil
 }
 
-func (q *qemu) setConfig(rconfig *types.RunConfig) {
+func (q *qemu) setConfig(rconfig *types.RunConfig) error {
 	// add virtio drive
 	q.addDrive("hd0", rconfig.Imagename, "none")
 
@@ -311,8 +423,8 @@ func (q *qemu) setConfig(rconfig *types.RunConfig) {
 
 		// FIXME for multiple local tenants
 		// x86
-		q.addOption("-device", "virtio-scsi-pci,bus=pci.2,addr=0x0,id=scsi0")
-		q.addOption("-device", "scsi-hd,bus=scsi0.0,drive=hd0")
+		q.addOption("-device", "virtio-scsi-pci,bus=pci.2,addr=0x0,id="+scsiController+q.addIOThread(rconfig))
+		q.addOption("-device", "scsi-hd,bus="+volumeBus+",drive=hd0")
 
 		q.addOption("-vga", "none")
 
@@ -330,7 +442,8 @@ func (q *qemu) setConfig(rconfig *types.RunConfig) {
 		q.addOption("-machine", "highmem=off")
 		q.addOption("-kernel", "/home/ubuntu/.ops/0.1.31/kernel.img")
 
-		q.addOption("-device", "virtio-blk-pci,drive=hd0")
+		q.addOption("-device", "virtio-blk-pci,drive=hd0"+q.addIOThread(rconfig))
+		q.addOption("-device", "virtio-scsi-pci,id="+scsiController)
 
 		q.addFlag("-semihosting")
 
@@ -341,7 +454,13 @@ func (q *qemu) setConfig(rconfig *types.RunConfig) {
 	// add mounted volumes
 	for n, file := range rconfig.Mounts {
 		q.addDrive(fmt.Sprintf("hd%d", n+1), file, "none")
-		q.addOption("-device", fmt.Sprintf("scsi-hd,bus=scsi0.0,drive=hd%d", n+1))
+		q.addOption("-device", fmt.Sprintf("scsi-hd,bus=%s,drive=hd%d", volumeBus, n+1))
+	}
+
+	// add shared host directories
+	for _, share := range rconfig.Shares {
+		q.addOption("-fsdev", fmt.Sprintf("local,id=%s,path=%s,security_model=none", share.Tag, share.HostDir))
+		q.addOption("-device", fmt.Sprintf("virtio-9p-pci,fsdev=%s,mount_tag=%s", share.Tag, share.Tag))
 	}
 
 	netDevType := "user"
@@ -351,17 +470,34 @@ func (q *qemu) setConfig(rconfig *types.RunConfig) {
 		ifaceName = rconfig.TapName
 	}
 
-	q.setAccel(rconfig)
+	err := q.setAccel(rconfig)
+	if err != nil {
+		return err
+	}
 
-	q.addNetDevice(netDevType, ifaceName, "", rconfig.Ports, rconfig.UDP)
+	hostPorts, err := portMappings(rconfig)
+	if err != nil {
+		return err
+	}
+
+	q.addNetDevice(netDevType, ifaceName, "", hostPorts)
+	if rconfig.VhostNet && rconfig.Bridged {
+		// the tap device is handled by the host kernel instead of the qemu process
+		q.ifaces[len(q.ifaces)-1].vhost = true
+	}
 	q.addDisplay("none")
 
 	if rconfig.Background {
-		q.addSerial("file:/tmp/" + rconfig.InstanceName + ".log")
+		q.addSerial("unix:" + SerialSocketPath(rconfig.InstanceName))
+		q.addOption("-qmp", "unix:"+QMPSocketPath(rconfig.InstanceName)+",server,nowait")
 	} else {
 		q.addSerial("stdio")
 	}
 
+	if rconfig.Incoming != "" {
+		q.addOption("-incoming", "fd:"+strconv.Itoa(incomingFD))
+	}
+
 	q.addFlag("-no-reboot")
 	q.addOption("-cpu", "max")
 
@@ -380,6 +516,8 @@ func (q *qemu) setConfig(rconfig *types.RunConfig) {
 		fmt.Printf("Waiting for gdb connection. Connect to qemu through \"(gdb) target remote localhost:%s\"\n", gdbPort)
 		fmt.Println("See further instructions in https://nanovms.gitbook.io/ops/debugging")
 	}
+
+	return nil
 }
 
 func (q *qemu) isInstalled() bool {
@@ -401,8 +539,12 @@ func (q *qemu) isInstalled() bool {
 	return fi.Mode().Perm()&0111 != 0
 }
 
-func (q *qemu) Args(rconfig *types.RunConfig) []string {
-	q.setConfig(rconfig)
+func (q *qemu) Args(rconfig *types.RunConfig) ([]string, error) {
+	q.drives, q.devices, q.ifaces, q.flags = nil, nil, nil, nil
+	err := q.setConfig(rconfig)
+	if err != nil {
+		return nil, err
+	}
 	args := []string{}
 
 	// pci bus needs to be declared before devices using them
@@ -426,7 +568,7 @@ func (q *qemu) Args(rconfig *types.RunConfig) []string {
 	args = append(args, q.serial.String())
 
 	// The returned args must tokenized by whitespace
-	return strings.Fields(strings.Join(args, " "))
+	return strings.Fields(strings.Join(args, " ")), nil
 }
 
 func (q *qemu) PID() (string, error) {
@@ -437,6 +579,49 @@ func (q *qemu) PID() (string, error) {
 	return strconv.Itoa(q.cmd.Process.Pid), nil
 }
 
+// Exit status reported by nanos when the guest stops abnormally
+const (
+	// GuestExitFault is reported when an unhandled fault stops the guest
+	GuestExitFault = 0x7e
+	// GuestExitHalt is reported when the kernel halts, e.g. after a failed assertion
+	GuestExitHalt = 0x7f
+)
+
+// GuestExitStatus returns the exit status reported by the guest with the error returned by
+// Start. On x86 nanos writes the status to the isa-debug-exit device, which makes qemu exit
+// with (status << 1) | 1, so any other qemu exit means the guest did not report a status.
+// On arm the status is reported with semihosting and is the qemu exit code. Errors checked
+// by a BootDetector are not guest exit statuses when qemu failed to start the guest.
+func GuestExitStatus(err error) (status int, reported bool) {
+	var bootErr *BootError
+	if errors.As(err, &bootErr) {
+		return 0, false
+	}
+
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, false
+		}
+		code = exitErr.ExitCode()
+	}
+
+	if code < 0 {
+		return 0, false
+	}
+
+	if !isx86() {
+		return code, true
+	}
+
+	if code&1 == 0 {
+		return 0, false
+	}
+
+	return code >> 1, true
+}
+
 // Randomly generate Bytes for mac address
 func generateMac() string {
 	octets := make([]byte, 6)
@@ -5,7 +5,11 @@ package qemu
 import (
 	. "fmt"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/nanovms/ops/network"
+	"github.com/nanovms/ops/types"
 )
 
 func TestStringDriveWithIndex(t *testing.T) {
@@ -43,7 +47,7 @@ func TestStringNetDev(t *testing.T) {
 }
 
 func TestStringNetDevWithHostPortForwarding(t *testing.T) {
-	testHostPorts := []portfwd{{proto: "tcp", port: "80"}, {proto: "tcp", port: "443"}}
+	testHostPorts := []portfwd{{proto: "tcp", hostport: 80, guestport: 80}, {proto: "tcp", hostport: 443, guestport: 443}}
 	testNetDev := &netdev{nettype: "tap", id: "n0", hports: testHostPorts}
 	expected := "-netdev tap,id=n0,script=no,downscript=no,hostfwd=tcp::80-:80,hostfwd=tcp::443-:443"
 	checkQemuString(testNetDev, expected, t)
@@ -53,12 +57,22 @@ func TestStringNetDevWithTypeUser(t *testing.T) {
 	// The 'downscript' and 'script' parameters are not valid for 'user'
 	// device type so we don't render them to the string in that case even
 	// if they are populated in the type.
-	testHostPorts := []portfwd{{proto: "tcp", port: "80"}, {proto: "tcp", port: "443"}}
+	testHostPorts := []portfwd{{proto: "tcp", hostport: 80, guestport: 80}, {proto: "tcp", hostport: 443, guestport: 443}}
 	testNetDev := &netdev{nettype: "user", id: "n0", downscript: "no", script: "no", hports: testHostPorts}
 	expected := "-netdev user,id=n0,hostfwd=tcp::80-:80,hostfwd=tcp::443-:443"
 	checkQemuString(testNetDev, expected, t)
 }
 
+func TestStringPortForwardWithHostAddress(t *testing.T) {
+	testPortForward := &portfwd{proto: "udp", hostaddr: "127.0.0.1", hostport: 8053, guestport: 53}
+	expected := "hostfwd=udp:127.0.0.1:8053-:53"
+	checkQemuString(testPortForward, expected, t)
+
+	testPortForward = &portfwd{proto: "tcp", hostaddr: "::1", hostport: 8080, guestport: 80}
+	expected = "hostfwd=tcp:[::1]:8080-:80"
+	checkQemuString(testPortForward, expected, t)
+}
+
 func TestStringDisplay(t *testing.T) {
 	testDisplay := &display{disptype: "none"}
 	expected := "-display none"
@@ -73,7 +87,7 @@ func TestStringSerial(t *testing.T) {
 
 func TestRandomMacGen(t *testing.T) {
 	q := qemu{}
-	q.addNetDevice("tap", "tap0", "", []string{}, false)
+	q.addNetDevice("tap", "tap0", "", []network.PortMapping{})
 	if len(q.devices[0].mac) == 0 {
 		t.Errorf("No RandomMac was assigned %s", q.devices[0].mac)
 	}
@@ -83,12 +97,30 @@ func TestAddNetDevices(t *testing.T) {
 
 	t.Run("should add a port forward per tcp port", func(t *testing.T) {
 		q := qemu{}
-		q.addNetDevice("user", "", "", []string{"80", "8080", "9000"}, false)
+		hostPorts, _ := network.ParsePortMappings([]string{"80", "8080", "9000"}, network.ProtocolTCP)
+		q.addNetDevice("user", "", "", hostPorts)
+
+		want := []portfwd{
+			{hostport: 80, guestport: 80, proto: "tcp"},
+			{hostport: 8080, guestport: 8080, proto: "tcp"},
+			{hostport: 9000, guestport: 9000, proto: "tcp"},
+		}
+		got := q.ifaces[0].hports
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v,want %v", got, want)
+		}
+	})
+
+	t.Run("should add a port forward per port in range", func(t *testing.T) {
+		q := qemu{}
+		hostPorts, _ := network.ParsePortMappings([]string{"80-82"}, network.ProtocolTCP)
+		q.addNetDevice("user", "", "", hostPorts)
 
 		want := []portfwd{
-			{port: "80", proto: "tcp"},
-			{port: "8080", proto: "tcp"},
-			{port: "9000", proto: "tcp"},
+			{hostport: 80, guestport: 80, proto: "tcp"},
+			{hostport: 81, guestport: 81, proto: "tcp"},
+			{hostport: 82, guestport: 82, proto: "tcp"},
 		}
 		got := q.ifaces[0].hports
 
@@ -97,12 +129,15 @@ func TestAddNetDevices(t *testing.T) {
 		}
 	})
 
-	t.Run("should add a port forward range", func(t *testing.T) {
+	t.Run("should map host ports to guest ports", func(t *testing.T) {
 		q := qemu{}
-		q.addNetDevice("user", "", "", []string{"80-9000"}, false)
+		hostPorts, _ := network.ParsePortMappings([]string{"127.0.0.1:8080:80", "9000-9001:7000-7001/udp"}, network.ProtocolTCP)
+		q.addNetDevice("user", "", "", hostPorts)
 
 		want := []portfwd{
-			{port: "80-9000", proto: "tcp"},
+			{hostaddr: "127.0.0.1", hostport: 8080, guestport: 80, proto: "tcp"},
+			{hostport: 9000, guestport: 7000, proto: "udp"},
+			{hostport: 9001, guestport: 7001, proto: "udp"},
 		}
 		got := q.ifaces[0].hports
 
@@ -112,6 +147,47 @@ func TestAddNetDevices(t *testing.T) {
 	})
 }
 
+func TestPortMappings(t *testing.T) {
+	rconfig := &types.RunConfig{
+		Ports:    []string{"80", "8080:80/tcp", "53/udp"},
+		UDPPorts: []string{"5000"},
+		UDP:      true,
+	}
+
+	got, err := portMappings(rconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"80:80/tcp", "8080:80/tcp", "53:53/udp", "80:80/udp", "5000:5000/udp"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+
+	rconfig = &types.RunConfig{Ports: []string{"1-65535"}}
+	if _, err := portMappings(rconfig); err == nil {
+		t.Error("expected error forwarding every port")
+	}
+}
+
+func TestArgsInvalidPorts(t *testing.T) {
+	q := qemu{}
+	rconfig := &types.RunConfig{
+		Imagename: "image",
+		Memory:    "1G",
+		Ports:     []string{"http"},
+	}
+
+	if _, err := q.Args(rconfig); err == nil {
+		t.Error("expected error for an invalid port")
+	}
+}
+
 func TestQemuVersion(t *testing.T) {
 	testData := `
 QEMU emulator version 2.11.1(Debian 1:2.8+dfsg-6+deb9u5)
@@ -179,3 +255,69 @@ func checkQemuString(qr Stringer, expected string, t *testing.T) {
 		t.Errorf("Rendered string %q not %q", actual, expected)
 	}
 }
+
+func argsOf(t *testing.T, q *qemu, rconfig *types.RunConfig) []string {
+	args, err := q.Args(rconfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return args
+}
+
+func TestArgsSharedDirs(t *testing.T) {
+	q := qemu{}
+	rconfig := &types.RunConfig{
+		Imagename: "image",
+		Memory:    "1G",
+		Shares: []types.SharedDir{
+			{HostDir: "/home/user/assets", GuestPath: "/assets", Tag: "share0"},
+		},
+	}
+
+	args := strings.Join(argsOf(t, &q, rconfig), " ")
+
+	expected := []string{
+		"-fsdev local,id=share0,path=/home/user/assets,security_model=none",
+		"-device virtio-9p-pci,fsdev=share0,mount_tag=share0",
+	}
+	for _, e := range expected {
+		if !strings.Contains(args, e) {
+			t.Errorf("%q not found in %q", e, args)
+		}
+	}
+
+	// arguments are not accumulated when the command is created again
+	if again := strings.Join(argsOf(t, &q, rconfig), " "); strings.Count(again, "-fsdev") != 1 {
+		t.Errorf("got %q, want one -fsdev", again)
+	}
+}
+
+func TestArgsIOThreadsAndVhostNet(t *testing.T) {
+	q := qemu{}
+	rconfig := &types.RunConfig{
+		Imagename: "image",
+		Memory:    "1G",
+		Bridged:   true,
+		TapName:   "tap0",
+		IOThreads: true,
+		VhostNet:  true,
+	}
+
+	args := strings.Join(argsOf(t, &q, rconfig), " ")
+
+	expected := []string{
+		"-object iothread,id=iothread0",
+		"iothread=iothread0",
+		"ifname=tap0,script=no,downscript=no,vhost=on",
+	}
+	for _, e := range expected {
+		if !strings.Contains(args, e) {
+			t.Errorf("%q not found in %q", e, args)
+		}
+	}
+
+	rconfig.IOThreads, rconfig.VhostNet = false, false
+	if args := strings.Join(argsOf(t, &q, rconfig), " "); strings.Contains(args, "iothread") || strings.Contains(args, "vhost") {
+		t.Errorf("unexpected iothread or vhost option in %q", args)
+	}
+}
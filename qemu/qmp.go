@@ -0,0 +1,280 @@
+package qemu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// QMPSocketPath returns the path of the unix socket of the QEMU machine protocol
+// monitor of a background instance
+func QMPSocketPath(instanceName string) string {
+	return "/tmp/" + instanceName + ".qmp.sock"
+}
+
+// MigrationPollInterval is the interval between migration status requests
+var MigrationPollInterval = 100 * time.Millisecond
+
+// QMPTimeout is the time to connect to the monitor and to get the response of a
+// command, so a machine that stopped responding does not block the client
+var QMPTimeout = 10 * time.Second
+
+// QMP is a QEMU machine protocol client
+type QMP struct {
+	conn    net.Conn
+	decoder *json.Decoder
+	encoder *json.Encoder
+}
+
+type qmpResponse struct {
+	Return json.RawMessage `json:"return"`
+	Event  string          `json:"event"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+}
+
+type qmpCommand struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// DialQMP connects to the monitor socket and negotiates the protocol capabilities
+func DialQMP(socketPath string) (*QMP, error) {
+	conn, err := net.DialTimeout("unix", socketPath, QMPTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	q := NewQMP(conn)
+
+	err = conn.SetDeadline(time.Now().Add(QMPTimeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	var greeting map[string]interface{}
+	err = q.decoder.Decode(&greeting)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, ok := greeting["QMP"]; !ok {
+		conn.Close()
+		return nil, errors.New("unexpected QMP greeting")
+	}
+
+	err = q.Execute("qmp_capabilities", nil, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// NewQMP returns a client using a connection that was already negotiated
+func NewQMP(conn net.Conn) *QMP {
+	return &QMP{
+		conn:    conn,
+		decoder: json.NewDecoder(conn),
+		encoder: json.NewEncoder(conn),
+	}
+}
+
+// Execute runs the command and decodes its return value into result, events received
+// while waiting for the response are ignored
+func (q *QMP) Execute(command string, arguments interface{}, result interface{}) error {
+	err := q.conn.SetDeadline(time.Now().Add(QMPTimeout))
+	if err != nil {
+		return err
+	}
+
+	err = q.encoder.Encode(qmpCommand{Execute: command, Arguments: arguments})
+	if err != nil {
+		return err
+	}
+
+	return q.response(command, result)
+}
+
+// SendFile passes the file to the machine with the name, for the commands taking a
+// file descriptor name. The descriptor is sent with the getfd command.
+func (q *QMP) SendFile(name string, f *os.File) error {
+	conn, ok := q.conn.(*net.UnixConn)
+	if !ok {
+		return errors.New("files can only be passed to a monitor on a unix socket")
+	}
+
+	command, err := json.Marshal(qmpCommand{Execute: "getfd", Arguments: map[string]string{"fdname": name}})
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetDeadline(time.Now().Add(QMPTimeout))
+	if err != nil {
+		return err
+	}
+
+	_, _, err = conn.WriteMsgUnix(command, syscall.UnixRights(int(f.Fd())), nil)
+	if err != nil {
+		return err
+	}
+
+	return q.response("getfd", nil)
+}
+
+// response decodes the response of the command into result
+func (q *QMP) response(command string, result interface{}) error {
+	for {
+		var resp qmpResponse
+		err := q.decoder.Decode(&resp)
+		if err != nil {
+			return err
+		}
+
+		if resp.Event != "" {
+			continue
+		}
+
+		if resp.Error != nil {
+			return fmt.Errorf("%s failed: %s", command, resp.Error.Desc)
+		}
+
+		if result != nil && len(resp.Return) > 0 {
+			return json.Unmarshal(resp.Return, result)
+		}
+		return nil
+	}
+}
+
+// migrationFDName is the name of the file descriptor the state is migrated to
+const migrationFDName = "migration"
+
+// SaveState migrates the state of the machine to the file and waits until the
+// migration completes. The machine is paused when it returns, use Continue to resume.
+// The file is passed to the machine, so its path is never interpreted by qemu.
+func (q *QMP) SaveState(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = q.SendFile(migrationFDName, f)
+	if err != nil {
+		return err
+	}
+
+	err = q.Execute("migrate", map[string]string{"uri": "fd:" + migrationFDName}, nil)
+	if err != nil {
+		q.Execute("closefd", map[string]string{"fdname": migrationFDName}, nil)
+		return err
+	}
+
+	for {
+		var status struct {
+			Status    string `json:"status"`
+			ErrorDesc string `json:"error-desc"`
+		}
+
+		err = q.Execute("query-migrate", nil, &status)
+		if err != nil {
+			return err
+		}
+
+		switch status.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			if status.ErrorDesc != "" {
+				return fmt.Errorf("migration %s: %s", status.Status, status.ErrorDesc)
+			}
+			return fmt.Errorf("migration %s", status.Status)
+		}
+
+		time.Sleep(MigrationPollInterval)
+	}
+}
+
+// BlockStats returns the bytes read and written by the machine to all its drives
+func (q *QMP) BlockStats() (read, written uint64, err error) {
+	var devices []struct {
+		Device string `json:"device"`
+		Stats  struct {
+			ReadBytes    uint64 `json:"rd_bytes"`
+			WrittenBytes uint64 `json:"wr_bytes"`
+		} `json:"stats"`
+	}
+
+	err = q.Execute("query-blockstats", nil, &devices)
+	if err != nil {
+		return
+	}
+
+	for _, d := range devices {
+		read += d.Stats.ReadBytes
+		written += d.Stats.WrittenBytes
+	}
+
+	return
+}
+
+// AddVolume hot-plugs the volume file as a disk of the scsi controller
+func (q *QMP) AddVolume(id, file string) error {
+	err := q.Execute("blockdev-add", map[string]interface{}{
+		"node-name": id,
+		"driver":    "raw",
+		"file":      map[string]string{"driver": "file", "filename": file},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	err = q.Execute("device_add", map[string]string{
+		"driver": "scsi-hd",
+		"bus":    volumeBus,
+		"drive":  id,
+		"id":     id,
+	}, nil)
+	if err != nil {
+		q.Execute("blockdev-del", map[string]string{"node-name": id}, nil)
+		return err
+	}
+
+	return nil
+}
+
+// RemoveVolume unplugs the disk added with AddVolume
+func (q *QMP) RemoveVolume(id string) error {
+	err := q.Execute("device_del", map[string]string{"id": id}, nil)
+	if err != nil {
+		return err
+	}
+
+	// the disk is released once the guest acknowledges the unplug
+	for i := 0; ; i++ {
+		err = q.Execute("blockdev-del", map[string]string{"node-name": id}, nil)
+		if err == nil || i == 20 {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Continue resumes the machine
+func (q *QMP) Continue() error {
+	return q.Execute("cont", nil, nil)
+}
+
+// Close closes the monitor connection
+func (q *QMP) Close() error {
+	return q.conn.Close()
+}
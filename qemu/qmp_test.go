@@ -0,0 +1,248 @@
+package qemu
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// fakeQMP serves a QMP monitor that answers commands with the responses of the script
+func fakeQMP(t *testing.T, script map[string][]string) (socketPath string, commands chan string) {
+	dir, err := ioutil.TempDir("", "qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socketPath = path.Join(dir, "qmp.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	commands = make(chan string, 100)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte(`{"QMP": {"version": {}, "capabilities": []}}` + "\n"))
+
+		decoder := json.NewDecoder(conn)
+		for {
+			var cmd qmpCommand
+			if err := decoder.Decode(&cmd); err != nil {
+				return
+			}
+			commands <- cmd.Execute
+
+			responses := script[cmd.Execute]
+			response := `{"return": {}}`
+			if len(responses) > 0 {
+				response = responses[0]
+				script[cmd.Execute] = responses[1:]
+			}
+			conn.Write([]byte(response + "\n"))
+		}
+	}()
+
+	return
+}
+
+func TestQMPTimeout(t *testing.T) {
+	timeout := QMPTimeout
+	QMPTimeout = 50 * time.Millisecond
+	defer func() { QMPTimeout = timeout }()
+
+	socketPath := path.Join(t.TempDir(), "qmp.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// the monitor accepts the connection but never sends its greeting
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second)
+	}()
+
+	_, err = DialQMP(socketPath)
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Errorf("got %v, want timeout", err)
+	}
+}
+
+func TestQMPSaveState(t *testing.T) {
+	MigrationPollInterval = time.Millisecond
+
+	t.Run("completed", func(t *testing.T) {
+		socketPath, commands := fakeQMP(t, map[string][]string{
+			"query-migrate": {
+				`{"event": "MIGRATION", "data": {"status": "active"}}` + "\n" + `{"return": {"status": "active"}}`,
+				`{"return": {"status": "completed"}}`,
+			},
+		})
+
+		monitor, err := DialQMP(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer monitor.Close()
+
+		err = monitor.SaveState(path.Join(t.TempDir(), "state"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"qmp_capabilities", "getfd", "migrate", "query-migrate", "query-migrate"}
+		for _, e := range expected {
+			if got := <-commands; got != e {
+				t.Errorf("got command %s, want %s", got, e)
+			}
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		socketPath, _ := fakeQMP(t, map[string][]string{
+			"query-migrate": {`{"return": {"status": "failed", "error-desc": "no space left"}}`},
+		})
+
+		monitor, err := DialQMP(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer monitor.Close()
+
+		err = monitor.SaveState(path.Join(t.TempDir(), "state"))
+		if err == nil || err.Error() != "migration failed: no space left" {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("command error", func(t *testing.T) {
+		socketPath, _ := fakeQMP(t, map[string][]string{
+			"migrate": {`{"error": {"class": "GenericError", "desc": "migration in progress"}}`},
+		})
+
+		monitor, err := DialQMP(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer monitor.Close()
+
+		err = monitor.SaveState(path.Join(t.TempDir(), "state"))
+		if err == nil || err.Error() != "migrate failed: migration in progress" {
+			t.Errorf("got %v", err)
+		}
+	})
+}
+
+func TestQMPBlockStats(t *testing.T) {
+	socketPath, _ := fakeQMP(t, map[string][]string{
+		"query-blockstats": {`{"return": [
+			{"device": "hd0", "stats": {"rd_bytes": 1024, "wr_bytes": 512, "rd_operations": 2}},
+			{"device": "hd1", "stats": {"rd_bytes": 100, "wr_bytes": 0}}
+		]}`},
+	})
+
+	monitor, err := DialQMP(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitor.Close()
+
+	read, written, err := monitor.BlockStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if read != 1124 || written != 512 {
+		t.Errorf("got read %d written %d, want 1124 and 512", read, written)
+	}
+}
+
+func TestQMPVolumes(t *testing.T) {
+	t.Run("add", func(t *testing.T) {
+		socketPath, commands := fakeQMP(t, map[string][]string{})
+
+		monitor, err := DialQMP(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer monitor.Close()
+
+		err = monitor.AddVolume("vol-data", "/tmp/data.raw")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"qmp_capabilities", "blockdev-add", "device_add"}
+		for _, e := range expected {
+			if got := <-commands; got != e {
+				t.Errorf("got command %s, want %s", got, e)
+			}
+		}
+	})
+
+	t.Run("add failed", func(t *testing.T) {
+		socketPath, commands := fakeQMP(t, map[string][]string{
+			"device_add": {`{"error": {"class": "GenericError", "desc": "Bus 'scsi0.0' not found"}}`},
+		})
+
+		monitor, err := DialQMP(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer monitor.Close()
+
+		err = monitor.AddVolume("vol-data", "/tmp/data.raw")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		// the block device is removed when the disk can not be added
+		expected := []string{"qmp_capabilities", "blockdev-add", "device_add", "blockdev-del"}
+		for _, e := range expected {
+			if got := <-commands; got != e {
+				t.Errorf("got command %s, want %s", got, e)
+			}
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		socketPath, commands := fakeQMP(t, map[string][]string{
+			"blockdev-del": {`{"error": {"class": "GenericError", "desc": "Node vol-data is in use"}}`},
+		})
+
+		monitor, err := DialQMP(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer monitor.Close()
+
+		err = monitor.RemoveVolume("vol-data")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"qmp_capabilities", "device_del", "blockdev-del", "blockdev-del"}
+		for _, e := range expected {
+			if got := <-commands; got != e {
+				t.Errorf("got command %s, want %s", got, e)
+			}
+		}
+	})
+}
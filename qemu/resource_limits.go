@@ -0,0 +1,122 @@
+package qemu
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nanovms/ops/types"
+)
+
+// cpuPeriod is the cgroup period the cpu quota is applied over, in microseconds
+const cpuPeriod = 100000
+
+var memoryLimitRegexp = regexp.MustCompile(`^[0-9]+[kKmMgGtT]?$`)
+
+// HasResourceLimits returns true if the hypervisor must be placed in a cgroup of its own
+func HasResourceLimits(rconfig *types.RunConfig) bool {
+	return rconfig.CPUQuota > 0 || rconfig.CPUSet != "" || rconfig.MemoryLimit != "" || rconfig.IOWeight > 0
+}
+
+// StartCommand starts the hypervisor command and places it in a cgroup of its own
+// when the configuration has resource limits. The hypervisor starts in a cgroup
+// with the limits when the kernel supports it, otherwise it runs without limits
+// until it is moved to its cgroup right after it starts. The hypervisor is killed
+// if the limits can not be applied. The extra files of the command are closed once
+// the hypervisor has its own descriptors.
+func StartCommand(cmd *exec.Cmd, rconfig *types.RunConfig) error {
+	defer func() {
+		for _, f := range cmd.ExtraFiles {
+			f.Close()
+		}
+	}()
+
+	if !HasResourceLimits(rconfig) {
+		return cmd.Start()
+	}
+
+	release, err := startInCgroup(cmd, rconfig)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	err = ApplyResourceLimits(rconfig, cmd.Process.Pid)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return err
+	}
+
+	return nil
+}
+
+// ValidateResourceLimits returns an error if a resource limit of the configuration is invalid
+func ValidateResourceLimits(rconfig *types.RunConfig) error {
+	if rconfig.CPUQuota < 0 {
+		return errors.New("cpu quota must be positive")
+	}
+
+	if rconfig.CPUSet != "" {
+		if _, err := ParseCPUSet(rconfig.CPUSet); err != nil {
+			return err
+		}
+	}
+
+	if rconfig.MemoryLimit != "" && !memoryLimitRegexp.MatchString(rconfig.MemoryLimit) {
+		return fmt.Errorf("invalid memory limit \"%s\", use a number of bytes with an optional K, M, G or T suffix", rconfig.MemoryLimit)
+	}
+
+	if rconfig.IOWeight < 0 || rconfig.IOWeight > 10000 {
+		return fmt.Errorf("invalid io weight %d, use a value from 1 to 10000", rconfig.IOWeight)
+	}
+
+	return nil
+}
+
+// ParseCPUSet parses lists of host cpus with the format "2-3" or "0,4-5" and returns
+// the cpus in the list. The kernel checks the cpus are online and available to the
+// cgroup of the hypervisor when the cpuset is applied.
+func ParseCPUSet(spec string) ([]int, error) {
+	var cpus []int
+	seen := map[int]bool{}
+
+	for _, part := range strings.Split(spec, ",") {
+		first, last := part, part
+		if i := strings.Index(part, "-"); i != -1 {
+			first, last = part[:i], part[i+1:]
+		}
+
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid cpuset \"%s\"", spec)
+		}
+
+		to, err := strconv.Atoi(last)
+		if err != nil || to < from {
+			return nil, fmt.Errorf("invalid cpuset \"%s\"", spec)
+		}
+
+		for cpu := from; cpu <= to; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+
+	return cpus, nil
+}
+
+// cpuMax returns the cgroup cpu.max value limiting the cpu time to the number of cpus
+func cpuMax(quota float64) string {
+	return fmt.Sprintf("%d %d", int64(quota*cpuPeriod), cpuPeriod)
+}
@@ -0,0 +1,76 @@
+package qemu
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/nanovms/ops/types"
+)
+
+func TestParseCPUSet(t *testing.T) {
+	cpus, err := ParseCPUSet("0,4-5,4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []int{0, 4, 5}; !reflect.DeepEqual(cpus, expected) {
+		t.Errorf("got %v, want %v", cpus, expected)
+	}
+}
+
+func TestParseCPUSetInvalid(t *testing.T) {
+	for _, spec := range []string{"", "a", "3-2", "-1", "1-", "0,,1"} {
+		if _, err := ParseCPUSet(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestValidateResourceLimits(t *testing.T) {
+	valid := &types.RunConfig{CPUQuota: 0.5, CPUSet: "0", MemoryLimit: "512M", IOWeight: 100}
+	if err := ValidateResourceLimits(valid); err != nil {
+		t.Error(err)
+	}
+
+	invalid := map[string]*types.RunConfig{
+		"negative quota":    {CPUQuota: -1},
+		"memory limit unit": {MemoryLimit: "1GB"},
+		"io weight":         {IOWeight: 10001},
+	}
+	for name, rconfig := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if err := ValidateResourceLimits(rconfig); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestCPUMax(t *testing.T) {
+	if got := cpuMax(1.5); got != "150000 100000" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestStartCommandClosesExtraFiles(t *testing.T) {
+	f, err := ioutil.TempFile("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	cmd := exec.Command("true")
+	cmd.ExtraFiles = []*os.File{f}
+
+	if err := StartCommand(cmd, &types.RunConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+
+	if _, err := f.Stat(); err == nil {
+		t.Error("extra file left open")
+	}
+}
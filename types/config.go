@@ -37,6 +37,10 @@ type Config struct {
 	// Kernel
 	Kernel string
 
+	// Hosts are the entries of the /etc/hosts file of the image with the format
+	// "address name...", the file is not added when there are none
+	Hosts []string
+
 	// MapDirs specifies a map of local directories to add to into the image.
 	// These directory paths are then adjusted from local path specification
 	// to image path specification.
@@ -87,6 +91,16 @@ type ProviderConfig struct {
 	// DomainName
 	DomainName string
 
+	// Encrypt requires the volumes and the boot disks created on the cloud
+	// provider to be encrypted at rest, with the provider-managed key unless
+	// EncryptionKey is set.
+	Encrypt bool
+
+	// EncryptionKey is the customer key used to encrypt the volumes and the boot
+	// disks: the KMS key id on aws, the Cloud KMS key name on gcp and the disk
+	// encryption set id on azure. It implies Encrypt.
+	EncryptionKey string
+
 	// Flavor
 	Flavor string `cloud:"flavor"`
 
@@ -145,6 +159,13 @@ type RunConfig struct {
 	// CPUs specifies the number of CPU cores to use
 	CPUs int
 
+	// CPUQuota limits the cpu time of the hypervisor to the number of host cpus
+	// specified, 0 is unlimited
+	CPUQuota float64
+
+	// CPUSet is the list of host cpus the hypervisor runs on, e.g. "2-3" or "0,4"
+	CPUSet string
+
 	// Debug
 	Debug bool
 
@@ -160,6 +181,15 @@ type RunConfig struct {
 	// InstanceName
 	InstanceName string
 
+	// Incoming is the file with the machine state the instance is restored from
+	Incoming string
+
+	// IOThreads runs the disk controller emulation in a dedicated thread
+	IOThreads bool
+
+	// IOWeight is the relative weight of the hypervisor block I/O, from 1 to 10000
+	IOWeight int
+
 	// IPAddr
 	IPAddr string
 
@@ -171,6 +201,10 @@ type RunConfig struct {
 	// signify a value in megabytes or gigabytes respectively.
 	Memory string
 
+	// MemoryLimit is the maximum memory of the hypervisor process, including the
+	// guest memory and the hypervisor overhead
+	MemoryLimit string
+
 	// Mounts
 	Mounts []string
 
@@ -184,6 +218,13 @@ type RunConfig struct {
 	// Ports specifies a list of port to expose.
 	Ports []string
 
+	// Restart is the restart policy of onprem instances: no, on-failure[:max-retries]
+	// or always
+	Restart string
+
+	// Shares are host directories exposed to the guest
+	Shares []SharedDir
+
 	// ShowDebug
 	ShowDebug bool
 
@@ -205,10 +246,21 @@ type RunConfig struct {
 	// Verbose enables logging for the runtime environment.
 	Verbose bool
 
+	// VhostNet handles the tap device of bridged instances in the host kernel
+	VhostNet bool
+
 	// VolumeSizeInGb is an optional parameter only available for OpenStack.
 	VolumeSizeInGb int
 }
 
+// SharedDir is a host directory exposed to the guest with virtio-9p and mounted by the
+// kernel using its tag
+type SharedDir struct {
+	HostDir   string
+	GuestPath string
+	Tag       string
+}
+
 // RuntimeConfig constructs runtime config
 func RuntimeConfig(image string, ports []string, verbose bool) RunConfig {
 	return RunConfig{Imagename: image, Ports: ports, Verbose: verbose, Memory: "2G", Accel: true}
@@ -336,7 +336,7 @@ func (p *Provider) GetInstanceLogs(ctx *lepton.Context, instancename string) (st
 }
 
 // PrintInstanceLogs prints server log on console
-func (p *Provider) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
+func (p *Provider) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
 	return errors.New("Unsupported")
 }
 
@@ -3,7 +3,6 @@ package upcloud
 import (
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/UpCloudLtd/upcloud-go-api/upcloud"
@@ -58,7 +57,7 @@ func (p *Provider) GetAllVolumes(ctx *lepton.Context) (volumes *[]lepton.NanosVo
 				ID:         s.UUID,
 				Name:       s.Title,
 				Status:     s.State,
-				Size:       strconv.Itoa(s.Size),
+				Size:       lepton.VolumeSize(s.Size) * lepton.GiB,
 				AttachedTo: strings.Join(s.ServerUUIDs, ","),
 				CreatedAt:  lepton.Time2Human(s.Created),
 			})
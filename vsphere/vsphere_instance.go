@@ -544,13 +544,10 @@ func (v *Vsphere) StopInstance(ctx *lepton.Context, instancename string) error {
 }
 
 // PrintInstanceLogs writes instance logs to console
-func (v *Vsphere) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := v.GetInstanceLogs(ctx, instancename)
-	if err != nil {
-		return err
-	}
-	fmt.Printf(l)
-	return nil
+func (v *Vsphere) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	return lepton.PrintLogs(opts.Writer(), opts, func() (string, error) {
+		return v.GetInstanceLogs(ctx, instancename)
+	})
 }
 
 // GetInstanceLogs gets instance related logs.
@@ -1,29 +1,253 @@
 package vsphere
 
-import "github.com/nanovms/ops/lepton"
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
 
-// CreateVolume is a stub to satisfy VolumeService interface
+	"github.com/nanovms/ops/lepton"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/task"
+	"github.com/vmware/govmomi/vim25/soap"
+	vmwareTypes "github.com/vmware/govmomi/vim25/types"
+)
+
+// volumesFolder is the datastore folder with a folder per volume
+const volumesFolder = "volumes"
+
+// volumeDisk returns the datastore path of the disk of the volume
+func volumeDisk(name string) string {
+	return volumesFolder + "/" + name + "/disk.vmdk"
+}
+
+// CreateVolume creates a local volume, converts it to a monolithicFlat vmdk and
+// uploads it to the datastore. The uploaded disk is copied to let vSphere
+// translate it to the datastore format, as done for images.
 func (v *Vsphere) CreateVolume(ctx *lepton.Context, name, data, size, provider string) (lepton.NanosVolume, error) {
+	config := ctx.Config()
+
 	var vol lepton.NanosVolume
+
+	localVolume, err := lepton.CreateLocalVolume(config, name, data, size, provider)
+	if err != nil {
+		return vol, fmt.Errorf("create local volume: %v", err)
+	}
+
+	base := path.Join(os.TempDir(), name+".vmdk")
+	flat := path.Join(os.TempDir(), name+"-flat.vmdk")
+	defer os.Remove(base)
+	defer os.Remove(flat)
+
+	args := []string{
+		"convert", "-f", "raw",
+		"-O", "vmdk", "-o", "subformat=monolithicFlat",
+		localVolume.Path, base,
+	}
+
+	out, err := exec.Command("qemu-img", args...).CombinedOutput()
+	if err != nil {
+		return vol, fmt.Errorf("convert volume to vmdk: %v: %s", err, out)
+	}
+
+	ds, m, err := v.volumeFileManager()
+	if err != nil {
+		return vol, err
+	}
+
+	folder := volumesFolder + "/" + name
+	uploaded := folder + "/" + name + ".vmdk"
+
+	p := soap.DefaultUpload
+	err = ds.UploadFile(context.TODO(), flat, folder+"/"+name+"-flat.vmdk", &p)
+	if err != nil {
+		return vol, fmt.Errorf("upload volume: %v", err)
+	}
+	err = ds.UploadFile(context.TODO(), base, uploaded, &p)
+	if err != nil {
+		return vol, fmt.Errorf("upload volume: %v", err)
+	}
+
+	err = m.Copy(context.TODO(), uploaded, volumeDisk(name))
+	if err != nil {
+		return vol, fmt.Errorf("copy volume disk: %v", err)
+	}
+
+	err = m.Delete(context.TODO(), uploaded)
+	if err != nil {
+		return vol, err
+	}
+
+	vol = localVolume
+	vol.Path = ds.Path(volumeDisk(name))
+
 	return vol, nil
 }
 
-// GetAllVolumes is a stub to satisfy VolumeService interface
+// GetAllVolumes returns the volumes uploaded to the datastore
 func (v *Vsphere) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error) {
-	return nil, nil
+	vols := &[]lepton.NanosVolume{}
+
+	f := find.NewFinder(v.client, true)
+	ds, err := f.DatastoreOrDefault(context.TODO(), v.datastore)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ds.Browser(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	spec := vmwareTypes.HostDatastoreBrowserSearchSpec{
+		MatchPattern: []string{"*"},
+		Details:      &vmwareTypes.FileQueryFlags{Modification: true},
+	}
+
+	search, err := b.SearchDatastore(context.TODO(), ds.Path(volumesFolder), &spec)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := search.WaitForResult(context.TODO(), nil)
+	if err != nil {
+		// the folder is created with the first volume
+		if terr, ok := err.(task.Error); ok {
+			if _, ok := terr.Fault().(*vmwareTypes.FileNotFound); ok {
+				return vols, nil
+			}
+		}
+		return nil, err
+	}
+
+	r, ok := info.Result.(vmwareTypes.HostDatastoreBrowserSearchResults)
+	if !ok {
+		return vols, nil
+	}
+
+	for _, file := range r.File {
+		fi := file.GetFileInfo()
+		if fi.Path[0] == '.' {
+			continue
+		}
+
+		vol := lepton.NanosVolume{
+			Name: fi.Path,
+			Path: ds.Path(volumeDisk(fi.Path)),
+		}
+		if fi.Modification != nil {
+			vol.CreatedAt = fi.Modification.String()
+		}
+		*vols = append(*vols, vol)
+	}
+
+	return vols, nil
 }
 
-// DeleteVolume is a stub to satisfy VolumeService interface
+// DeleteVolume deletes the disk of the volume and its folder
 func (v *Vsphere) DeleteVolume(ctx *lepton.Context, name string) error {
-	return nil
+	_, m, err := v.volumeFileManager()
+	if err != nil {
+		return err
+	}
+
+	err = m.Delete(context.TODO(), volumeDisk(name))
+	if err != nil {
+		return err
+	}
+
+	return m.Delete(context.TODO(), volumesFolder+"/"+name)
 }
 
-// AttachVolume is a stub to satisfy VolumeService interface
+// AttachVolume adds the disk of the volume to the scsi controller of the vm
 func (v *Vsphere) AttachVolume(ctx *lepton.Context, image, name string) error {
-	return nil
+	f := find.NewFinder(v.client, true)
+	ds, err := f.DatastoreOrDefault(context.TODO(), v.datastore)
+	if err != nil {
+		return err
+	}
+
+	vm, err := v.findVM(f, image)
+	if err != nil {
+		return err
+	}
+
+	devices, err := vm.Device(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	controller, err := devices.FindSCSIController("")
+	if err != nil {
+		return err
+	}
+
+	disk := devices.CreateDisk(controller, ds.Reference(), ds.Path(volumeDisk(name)))
+
+	return vm.AddDevice(context.TODO(), disk)
 }
 
-// DetachVolume is a stub to satisfy VolumeService interface
+// DetachVolume removes the disk of the volume from the vm, keeping its files
 func (v *Vsphere) DetachVolume(ctx *lepton.Context, image, name string) error {
-	return nil
+	f := find.NewFinder(v.client, true)
+	ds, err := f.DatastoreOrDefault(context.TODO(), v.datastore)
+	if err != nil {
+		return err
+	}
+
+	vm, err := v.findVM(f, image)
+	if err != nil {
+		return err
+	}
+
+	devices, err := vm.Device(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	diskPath := ds.Path(volumeDisk(name))
+	for _, device := range devices.SelectByType((*vmwareTypes.VirtualDisk)(nil)) {
+		backing, ok := device.GetVirtualDevice().Backing.(*vmwareTypes.VirtualDiskFlatVer2BackingInfo)
+		if ok && backing.FileName == diskPath {
+			return vm.RemoveDevice(context.TODO(), true, device)
+		}
+	}
+
+	return fmt.Errorf("volume %s is not attached to instance %s", name, image)
+}
+
+func (v *Vsphere) findVM(f *find.Finder, name string) (*object.VirtualMachine, error) {
+	dc, err := f.DatacenterOrDefault(context.TODO(), v.datacenter)
+	if err != nil {
+		return nil, err
+	}
+
+	f.SetDatacenter(dc)
+
+	vms, err := f.VirtualMachineList(context.TODO(), name)
+	if err != nil {
+		if _, ok := err.(*find.NotFoundError); ok {
+			return nil, fmt.Errorf("can't find vm %s", name)
+		}
+		return nil, err
+	}
+
+	return vms[0], nil
+}
+
+func (v *Vsphere) volumeFileManager() (*object.Datastore, *object.DatastoreFileManager, error) {
+	f := find.NewFinder(v.client, true)
+	ds, err := f.DatastoreOrDefault(context.TODO(), v.datastore)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dc, err := f.DatacenterOrDefault(context.TODO(), v.datacenter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ds, ds.NewFileManager(dc, true), nil
 }
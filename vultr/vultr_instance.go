@@ -197,16 +197,11 @@ func (v *Vultr) StopInstance(ctx *lepton.Context, instanceID string) error {
 }
 
 // PrintInstanceLogs writes instance logs to console
-func (v *Vultr) PrintInstanceLogs(ctx *lepton.Context, instancename string, watch bool) error {
-	l, err := v.GetInstanceLogs(ctx, instancename)
-	if err != nil {
-		return err
-	}
-	fmt.Printf(l)
-	return nil
+func (v *Vultr) PrintInstanceLogs(ctx *lepton.Context, instancename string, opts lepton.LogOptions) error {
+	return errors.New("Unsupported")
 }
 
 // GetInstanceLogs gets instance related logs
 func (v *Vultr) GetInstanceLogs(ctx *lepton.Context, instancename string) (string, error) {
-	return "", nil
+	return "", errors.New("Unsupported")
 }
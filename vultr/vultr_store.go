@@ -2,6 +2,7 @@ package vultr
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"time"
@@ -46,6 +47,11 @@ func (s *Objects) getSignedURL(key string, bucket string, region string) string
 
 // CopyToBucket copies archive to bucket
 func (s *Objects) CopyToBucket(config *types.Config, archPath string) error {
+	return s.copyToBucket(config, archPath, config.CloudConfig.ImageName+".img")
+}
+
+// copyToBucket copies the file to the key of the bucket
+func (s *Objects) copyToBucket(config *types.Config, archPath string, key string) error {
 
 	bucket := config.CloudConfig.BucketName
 	zone := config.CloudConfig.Zone
@@ -75,7 +81,7 @@ func (s *Objects) CopyToBucket(config *types.Config, archPath string) error {
 		os.Exit(1)
 	}
 
-	n, err := client.PutObject(bucket, config.CloudConfig.ImageName+".img", file, stat.Size(), minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	n, err := client.PutObject(bucket, key, file, stat.Size(), minio.PutObjectOptions{ContentType: "application/octet-stream"})
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -83,12 +89,63 @@ func (s *Objects) CopyToBucket(config *types.Config, archPath string) error {
 
 	fmt.Println("Uploaded", "my-objectname", " of size: ", n, "Successfully.")
 
-	fmt.Printf("Successfully uploaded %q to %q\n", config.CloudConfig.ImageName, bucket)
+	fmt.Printf("Successfully uploaded %q to %q\n", key, bucket)
 
 	return nil
 }
 
 // DeleteFromBucket deletes key from config's bucket
 func (s *Objects) DeleteFromBucket(config *types.Config, key string) error {
-	return nil
+	accessKey := os.Getenv("VULTR_ACCESS")
+	secKey := os.Getenv("VULTR_SECRET")
+
+	endpoint := config.CloudConfig.Zone + ".vultrobjects.com"
+
+	client, err := minio.New(endpoint, accessKey, secKey, true)
+	if err != nil {
+		return err
+	}
+
+	return client.RemoveObject(config.CloudConfig.BucketName, key)
+}
+
+// getSignedPutURL returns a url the key of config's bucket can be uploaded to
+// until it expires
+func (s *Objects) getSignedPutURL(config *types.Config, key string, expires time.Duration) (string, error) {
+	client, err := s.getMinioClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	presignedURL, err := client.PresignedPutObject(config.CloudConfig.BucketName, key, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return presignedURL.String(), nil
+}
+
+// readFromBucket returns the content of the key of config's bucket
+func (s *Objects) readFromBucket(config *types.Config, key string) ([]byte, error) {
+	client, err := s.getMinioClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObject(config.CloudConfig.BucketName, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return ioutil.ReadAll(object)
+}
+
+func (s *Objects) getMinioClient(config *types.Config) (*minio.Client, error) {
+	accessKey := os.Getenv("VULTR_ACCESS")
+	secKey := os.Getenv("VULTR_SECRET")
+
+	endpoint := config.CloudConfig.Zone + ".vultrobjects.com"
+
+	return minio.New(endpoint, accessKey, secKey, true)
 }
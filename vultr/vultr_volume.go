@@ -1,29 +1,395 @@
 package vultr
 
-import "github.com/nanovms/ops/lepton"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
-// CreateVolume is a stub to satisfy VolumeService interface
-func (v *Vultr) CreateVolume(ctx *lepton.Context, name, data, size, provider string) (lepton.NanosVolume, error) {
-	var vol lepton.NanosVolume
-	return vol, nil
+	"github.com/nanovms/ops/lepton"
+	"github.com/nanovms/ops/types"
+)
+
+const vultrAPI = "https://api.vultr.com/v1"
+
+// volumeDCID is the New Jersey location, the location of the instances and of the
+// ewr1 object storage
+const volumeDCID = "1"
+
+// volumeWriterPlan and volumeWriterOS are the plan and Ubuntu 22.04 distribution of
+// the server that writes the volume built by ops to the block storage, block
+// storage can not be uploaded and is created empty
+const (
+	volumeWriterPlan = "201"
+	volumeWriterOS   = "1743"
+)
+
+// volumeWriterTimeout limits the time the writer server takes to boot, write the
+// volume and power off
+const volumeWriterTimeout = 15 * time.Minute
+
+// volumeWriterScript is the user data of the writer server, it downloads the volume
+// from object storage and writes it to the block storage attached as the second
+// disk. The server uploads the status of the write and powers off when the script
+// exits, on errors too.
+const volumeWriterScript = `#!/bin/sh
+status=failed
+trap "curl -sSf -X PUT --data \$status '%[2]s' || true; poweroff" EXIT
+set -e
+while [ ! -e /dev/vdb ]; do sleep 1; done
+curl -sSfL -o /tmp/volume.raw '%[1]s'
+dd if=/tmp/volume.raw of=/dev/vdb bs=1M conv=fsync
+status=written
+`
+
+// volumeWrittenStatus is the status the writer server uploads once the volume is written
+const volumeWrittenStatus = "written"
+
+type vultrBlock struct {
+	SUBID      json.Number `json:"SUBID"`
+	CreatedAt  string      `json:"date_created"`
+	Status     string      `json:"status"`
+	SizeGB     int64       `json:"size_gb"`
+	AttachedTo json.Number `json:"attached_to_SUBID"`
+	Label      string      `json:"label"`
+}
+
+// CreateVolume builds the volume locally, uploads it to object storage and writes
+// it to a new block storage from a temporary server the block storage is attached
+// to. The local volume and the block storage are deleted if the volume is not written.
+func (v *Vultr) CreateVolume(ctx *lepton.Context, name, data, size, provider string) (lv lepton.NanosVolume, err error) {
+	config := ctx.Config()
+
+	lv, err = lepton.CreateLocalVolume(config, name, data, size, provider)
+	if err != nil {
+		return lv, err
+	}
+	defer func() {
+		if err != nil {
+			lepton.DeleteLocalVolume(lv)
+		}
+	}()
+
+	key := name + ".raw"
+	err = v.Storage.copyToBucket(config, lv.Path, key)
+	if err != nil {
+		return lv, err
+	}
+	defer v.Storage.DeleteFromBucket(config, key)
+
+	urlData := url.Values{}
+	urlData.Set("DCID", volumeDCID)
+	urlData.Set("size_gb", strconv.FormatInt(lv.Size.GB(), 10))
+	urlData.Set("label", name)
+
+	blockID, err := vultrCreate("/block/create", urlData)
+	if err != nil {
+		return lv, err
+	}
+	defer func() {
+		if err != nil {
+			deleteUnwrittenBlock(name, blockID)
+		}
+	}()
+
+	signedURL := v.Storage.getSignedURL(key, config.CloudConfig.BucketName, config.CloudConfig.Zone)
+	if signedURL == "" {
+		return lv, fmt.Errorf("cannot sign url of volume %s", key)
+	}
+
+	err = v.writeVolume(config, name, blockID, signedURL)
+	if err != nil {
+		return lv, err
+	}
+
+	lv.ID = blockID
+	lv.Status = "active"
+	return lv, nil
+}
+
+// writeVolume writes the volume at the url to the block storage from a server
+// created for it, the server is destroyed once it powered off and the volume is
+// written if the server uploaded the written status
+func (v *Vultr) writeVolume(config *types.Config, name, blockID, volumeURL string) error {
+	statusKey := name + ".status"
+	statusURL, err := v.Storage.getSignedPutURL(config, statusKey, volumeWriterTimeout)
+	if err != nil {
+		return fmt.Errorf("cannot sign status url of volume %s: %v", name, err)
+	}
+	defer v.Storage.DeleteFromBucket(config, statusKey)
+
+	urlData := url.Values{}
+	urlData.Set("DCID", volumeDCID)
+	urlData.Set("VPSPLANID", volumeWriterPlan)
+	urlData.Set("OSID", volumeWriterOS)
+	urlData.Set("label", name+"-writer")
+	urlData.Set("userdata", base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(volumeWriterScript, volumeURL, statusURL))))
+
+	serverID, err := vultrCreate("/server/create", urlData)
+	if err != nil {
+		return fmt.Errorf("cannot create server writing volume %s: %v", name, err)
+	}
+	defer func() {
+		destroyData := url.Values{}
+		destroyData.Set("SUBID", serverID)
+		vultrPost("/server/destroy", destroyData)
+	}()
+
+	attached := false
+	deadline := time.Now().Add(volumeWriterTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(10 * time.Second)
+
+		var server vultrServerStatus
+		err = vultrGet("/server/list?SUBID="+serverID, &server)
+		if err != nil {
+			return err
+		}
+
+		// the block storage is attached once the server is installed
+		if !attached && server.Status == "active" {
+			attachData := url.Values{}
+			attachData.Set("SUBID", blockID)
+			attachData.Set("attach_to_SUBID", serverID)
+			attachData.Set("live", "yes")
+			err = vultrPost("/block/attach", attachData)
+			if err != nil {
+				return err
+			}
+			attached = true
+		} else if attached && server.PowerStatus == "stopped" {
+			status, err := v.Storage.readFromBucket(config, statusKey)
+			if err != nil {
+				return fmt.Errorf("cannot read status of server %s-writer writing volume %s: %v", name, name, err)
+			}
+			if strings.TrimSpace(string(status)) != volumeWrittenStatus {
+				return fmt.Errorf("server %s-writer failed writing volume %s", name, name)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("server %s-writer did not write volume %s after %v", name, name, volumeWriterTimeout)
 }
 
-// GetAllVolumes is a stub to satisfy VolumeService interface
+// deleteUnwrittenBlock deletes the block storage that was not written, the block
+// storage is detached from the destroyed writer server in the background so the
+// deletion is retried until the volume writer timeout
+func deleteUnwrittenBlock(name, blockID string) {
+	urlData := url.Values{}
+	urlData.Set("SUBID", blockID)
+
+	var err error
+	deadline := time.Now().Add(volumeWriterTimeout)
+	for time.Now().Before(deadline) {
+		err = vultrPost("/block/delete", urlData)
+		if err == nil {
+			return
+		}
+		time.Sleep(10 * time.Second)
+	}
+
+	fmt.Printf("cannot delete volume %s: %v\n", name, err)
+}
+
+// vultrServerStatus is the state of a server being installed
+type vultrServerStatus struct {
+	Status      string `json:"status"`
+	PowerStatus string `json:"power_status"`
+}
+
+// GetAllVolumes returns the block storage subscriptions
 func (v *Vultr) GetAllVolumes(ctx *lepton.Context) (*[]lepton.NanosVolume, error) {
-	return nil, nil
+	blocks, err := v.getBlocks()
+	if err != nil {
+		return nil, err
+	}
+
+	vols := &[]lepton.NanosVolume{}
+	for _, block := range blocks {
+		*vols = append(*vols, lepton.NanosVolume{
+			ID:         block.SUBID.String(),
+			Name:       block.Label,
+			Status:     block.Status,
+			Size:       lepton.VolumeSize(block.SizeGB) * lepton.GiB,
+			CreatedAt:  block.CreatedAt,
+			AttachedTo: block.AttachedTo.String(),
+		})
+	}
+
+	return vols, nil
 }
 
-// DeleteVolume is a stub to satisfy VolumeService interface
+// DeleteVolume deletes the block storage with the label or id
 func (v *Vultr) DeleteVolume(ctx *lepton.Context, name string) error {
-	return nil
+	block, err := v.getBlock(name)
+	if err != nil {
+		return err
+	}
+
+	urlData := url.Values{}
+	urlData.Set("SUBID", block.SUBID.String())
+
+	return vultrPost("/block/delete", urlData)
 }
 
-// AttachVolume is a stub to satisfy VolumeService interface
+// AttachVolume attaches the block storage to the instance with the label
 func (v *Vultr) AttachVolume(ctx *lepton.Context, image, name string) error {
-	return nil
+	block, err := v.getBlock(name)
+	if err != nil {
+		return err
+	}
+
+	server, err := v.getServer(image)
+	if err != nil {
+		return err
+	}
+
+	urlData := url.Values{}
+	urlData.Set("SUBID", block.SUBID.String())
+	urlData.Set("attach_to_SUBID", server.SUBID)
+
+	return vultrPost("/block/attach", urlData)
 }
 
-// DetachVolume is a stub to satisfy VolumeService interface
+// DetachVolume detaches the block storage from the instance with the label
 func (v *Vultr) DetachVolume(ctx *lepton.Context, image, name string) error {
-	return nil
+	block, err := v.getBlock(name)
+	if err != nil {
+		return err
+	}
+
+	server, err := v.getServer(image)
+	if err != nil {
+		return err
+	}
+
+	if block.AttachedTo.String() != server.SUBID {
+		return fmt.Errorf("volume %s is not attached to instance %s", name, image)
+	}
+
+	urlData := url.Values{}
+	urlData.Set("SUBID", block.SUBID.String())
+
+	return vultrPost("/block/detach", urlData)
+}
+
+func (v *Vultr) getBlocks() ([]vultrBlock, error) {
+	var blocks []vultrBlock
+	err := vultrGet("/block/list", &blocks)
+	return blocks, err
+}
+
+func (v *Vultr) getBlock(name string) (*vultrBlock, error) {
+	blocks, err := v.getBlocks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, block := range blocks {
+		if block.Label == name || block.SUBID.String() == name {
+			return &block, nil
+		}
+	}
+
+	return nil, fmt.Errorf(`volume "%s" not found`, name)
+}
+
+func (v *Vultr) getServer(name string) (*vultrServer, error) {
+	var list json.RawMessage
+	err := vultrGet("/server/list", &list)
+	if err != nil {
+		return nil, err
+	}
+
+	// the list is an empty array when there are no instances
+	var servers map[string]vultrServer
+	if string(list) != "[]" {
+		err = json.Unmarshal(list, &servers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, server := range servers {
+		if server.Name == name || server.SUBID == name {
+			return &server, nil
+		}
+	}
+
+	return nil, fmt.Errorf(`instance "%s" not found`, name)
+}
+
+func vultrGet(endpoint string, v interface{}) error {
+	req, err := http.NewRequest("GET", vultrAPI+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("API-Key", os.Getenv("TOKEN"))
+
+	body, err := vultrDo(req)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+func vultrPost(endpoint string, urlData url.Values) error {
+	req, err := http.NewRequest("POST", vultrAPI+endpoint, strings.NewReader(urlData.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("API-Key", os.Getenv("TOKEN"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	_, err = vultrDo(req)
+	return err
+}
+
+// vultrCreate posts to a create endpoint and returns the id of the subscription
+func vultrCreate(endpoint string, urlData url.Values) (string, error) {
+	req, err := http.NewRequest("POST", vultrAPI+endpoint, strings.NewReader(urlData.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("API-Key", os.Getenv("TOKEN"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := vultrDo(req)
+	if err != nil {
+		return "", err
+	}
+
+	var created struct {
+		SUBID json.Number `json:"SUBID"`
+	}
+	err = json.Unmarshal(body, &created)
+	return created.SUBID.String(), err
+}
+
+func vultrDo(req *http.Request) ([]byte, error) {
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vultr: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
 }